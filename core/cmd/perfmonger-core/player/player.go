@@ -21,83 +21,79 @@ type PlayerOption struct {
 	Pretty        bool
 	DiskOnly      string
 	DiskOnlyRegex *regexp.Regexp
+	IntrDetail    bool
+	CpuGroup      string
+
+	NetOnly         string
+	NetOnlyRegex    *regexp.Regexp
+	NetExclude      string
+	NetExcludeRegex *regexp.Regexp
 }
 
 var init_rec ss.StatRecord
+var irq_affinity map[int]string
+var cpu_topology []ss.LinuxCpuTopology
+var platform_header *ss.LinuxHeader
+var collectors []ss.Collector
 
-func showCpuStat(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord) error {
-	cusage, err := ss.GetCpuUsage(prev_rec.Cpu, cur_rec.Cpu)
-	if err != nil {
-		return err
-	}
-
-	printer.PutKey("cpu")
-	cusage.WriteJsonTo(printer)
-
-	return nil
-}
-
-func showInterruptStat(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord) error {
-	intr_usage, err := ss.GetInterruptUsage(
+func showIrqDetail(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord) error {
+	iusage, err := ss.GetIrqDetailUsage(
 		prev_rec.Time, prev_rec.Interrupt,
 		cur_rec.Time, cur_rec.Interrupt)
 	if err != nil {
 		return err
 	}
+	iusage.Affinity = irq_affinity
 
-	printer.PutKey("intr")
-	intr_usage.WriteJsonTo(printer)
+	printer.PutKey("intr_detail")
+	iusage.WriteJsonTo(printer)
 
 	return nil
 }
 
-func showDiskStat(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord, disk_only_regex *regexp.Regexp, option *PlayerOption) error {
-	dusage, err := ss.GetDiskUsage1(
-		prev_rec.Time, prev_rec.Disk,
-		cur_rec.Time, cur_rec.Disk,
-		option.DiskOnlyRegex)
+// showCollectorStat shows the usage of `collector` under its name.
+func showCollectorStat(printer *projson.JsonPrinter, collector ss.Collector, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord) error {
+	usage, err := collector.Usage(platform_header, prev_rec, cur_rec)
 	if err != nil {
 		return err
 	}
+	if usage == nil {
+		return nil
+	}
 
-	printer.PutKey("disk")
-
-	dusage.WriteJsonTo(printer)
+	printer.PutKey(collector.Name())
+	usage.WriteJsonTo(printer)
 
 	return nil
 }
 
-func showNetStat(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord) error {
-	dusage, err := ss.GetNetUsage(
-		prev_rec.Time, prev_rec.Net,
-		cur_rec.Time, cur_rec.Net,
-	)
+func showCpuGroupStat(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord, group string) error {
+	cusage, err := ss.GetCpuUsage(prev_rec.Cpu, cur_rec.Cpu)
 	if err != nil {
 		return err
 	}
-
-	printer.PutKey("net")
-
-	dusage.WriteJsonTo(printer)
-
-	return nil
-}
-
-func showMemStat(printer *projson.JsonPrinter, cur_rec *ss.StatRecord) error {
-	musage, err := ss.GetMemUsage(cur_rec.Mem)
+	gusages, err := ss.GetCpuGroupUsage(cusage, cpu_topology, group)
 	if err != nil {
 		return err
 	}
 
-	printer.PutKey("mem")
-
-	musage.WriteJsonTo(printer)
+	printer.PutKey("cpu_group")
+	printer.BeginObject()
+	printer.PutKey("group")
+	printer.PutString(group)
+	printer.PutKey("groups")
+	printer.BeginArray()
+	for _, gusage := range gusages {
+		gusage.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
 
 	return nil
 }
 
 func showStat(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss.StatRecord,
-	disk_only_regex *regexp.Regexp, option *PlayerOption) error {
+	option *PlayerOption) error {
 
 	printer.Reset()
 	if option.Pretty {
@@ -114,34 +110,27 @@ func showStat(printer *projson.JsonPrinter, prev_rec *ss.StatRecord, cur_rec *ss
 	printer.PutFloatFmt((float64(cur_rec.Time.UnixNano())-float64(init_rec.Time.UnixNano()))/1e9,
 		"%.3f")
 
-	if cur_rec.Cpu != nil {
-		err := showCpuStat(printer, prev_rec, cur_rec)
-		if err != nil {
-			return err
-		}
-	}
-	if cur_rec.Interrupt != nil {
-		err := showInterruptStat(printer, prev_rec, cur_rec)
-		if err != nil {
-			return err
-		}
-	}
-	if cur_rec.Disk != nil {
-		err := showDiskStat(printer, prev_rec, cur_rec, disk_only_regex, option)
-		if err != nil {
+	for _, collector := range collectors {
+		if err := showCollectorStat(printer, collector, prev_rec, cur_rec); err != nil {
 			return err
 		}
-	}
-	if cur_rec.Net != nil {
-		err := showNetStat(printer, prev_rec, cur_rec)
-		if err != nil {
-			return err
-		}
-	}
-	if cur_rec.Mem != nil {
-		err := showMemStat(printer, cur_rec)
-		if err != nil {
-			return err
+
+		switch collector.Name() {
+		case "cpu":
+			// logs recorded without topology have no groups to show
+			if option.CpuGroup != "" && cpu_topology != nil && cur_rec.Cpu != nil && prev_rec.Cpu != nil {
+				err := showCpuGroupStat(printer, prev_rec, cur_rec, option.CpuGroup)
+				if err != nil {
+					return err
+				}
+			}
+		case "intr":
+			if option.IntrDetail && cur_rec.Interrupt != nil && prev_rec.Interrupt != nil {
+				err := showIrqDetail(printer, prev_rec, cur_rec)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 
@@ -156,19 +145,16 @@ func parseArgs(args []string, option *PlayerOption) {
 	fs.BoolVar(&option.Color, "color", false, "Use colored JSON output")
 	fs.BoolVar(&option.Pretty, "pretty", false, "Use human readable JSON output")
 	fs.StringVar(&option.DiskOnly, "disk-only", "", "Select disk devices by regex")
+	fs.BoolVar(&option.IntrDetail, "intr-detail", false, "Show per-IRQ interrupt rates")
+	fs.StringVar(&option.CpuGroup, "cpu-group", "", "Show CPU usage per socket, node or core")
+	fs.StringVar(&option.NetOnly, "net-only", "", "Select network interfaces by regex")
+	fs.StringVar(&option.NetExclude, "net-exclude", "", "Exclude network interfaces by regex")
 
 	fs.Parse(args)
 
+	// compiled by RunDirect, which returns an invalid regex as an error
 	option.DiskOnlyRegex = nil
 
-	if option.DiskOnly != "" {
-		var err error
-		option.DiskOnlyRegex, err = regexp.Compile(option.DiskOnly)
-		if err != nil {
-			panic(err)
-		}
-	}
-
 	if len(fs.Args()) < 1 {
 		option.Logfile = "-"
 	} else {
@@ -184,6 +170,13 @@ func NewPlayerOption() *PlayerOption {
 		Pretty:        false,
 		DiskOnly:      "",
 		DiskOnlyRegex: nil,
+		IntrDetail:    false,
+		CpuGroup:      "",
+
+		NetOnly:         "",
+		NetOnlyRegex:    nil,
+		NetExclude:      "",
+		NetExcludeRegex: nil,
 	}
 }
 
@@ -191,7 +184,9 @@ func NewPlayerOption() *PlayerOption {
 // This is the preferred API that uses direct execution (no double argument parsing)
 func RunWithOption(option *PlayerOption) {
 	// Call the direct execution function (no args conversion needed)
-	RunDirect(option)
+	if err := RunDirect(option); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 }
 
 func Run(args []string) {
@@ -200,7 +195,10 @@ func Run(args []string) {
 	parseArgs(args, option)
 
 	// Call the direct execution function
-	RunDirect(option)
+	if err := RunDirect(option); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] %v\n", err)
+		os.Exit(1)
+	}
 }
 
 // writeRecord writes a single JSON record (with a trailing newline) to out and
@@ -216,10 +214,41 @@ func writeRecord(out *bufio.Writer, str string) error {
 
 // RunDirect executes the player with the provided PlayerOption directly
 // This avoids the double conversion: PlayerOption -> args -> parseArgs -> PlayerOption
-func RunDirect(option *PlayerOption) {
+func RunDirect(option *PlayerOption) error {
 	var in *os.File
 	var out *bufio.Writer
 
+	// Compile net regexes here for callers (e.g., cobra) that set them as
+	// strings only.
+	if option.NetOnlyRegex == nil && option.NetOnly != "" {
+		re, err := regexp.Compile(option.NetOnly)
+		if err != nil {
+			return fmt.Errorf("invalid net-only regex: %v", err)
+		}
+		option.NetOnlyRegex = re
+	}
+	if option.NetExcludeRegex == nil && option.NetExclude != "" {
+		re, err := regexp.Compile(option.NetExclude)
+		if err != nil {
+			return fmt.Errorf("invalid net-exclude regex: %v", err)
+		}
+		option.NetExcludeRegex = re
+	}
+	if option.DiskOnlyRegex == nil && option.DiskOnly != "" {
+		re, err := regexp.Compile(option.DiskOnly)
+		if err != nil {
+			return fmt.Errorf("invalid disk-only regex: %v", err)
+		}
+		option.DiskOnlyRegex = re
+	}
+
+	collector_option := &ss.CollectorOption{
+		DiskOnly:   option.DiskOnlyRegex,
+		NetOnly:    option.NetOnlyRegex,
+		NetExclude: option.NetExcludeRegex,
+	}
+	collectors = ss.NewCollectors(collector_option)
+
 	if option.Logfile == "-" {
 		in = os.Stdin
 	} else {
@@ -244,23 +273,26 @@ func RunDirect(option *PlayerOption) {
 
 	err = dec.Decode(&cheader)
 	if err == io.EOF {
-		return
+		return nil
 	}
 	if err != nil {
 		panic(err)
 	}
 	err = dec.Decode(&pheader)
 	if err == io.EOF {
-		return
+		return nil
 	}
 	if err != nil {
 		panic(err)
 	}
+	irq_affinity = pheader.IrqAffinity
+	cpu_topology = pheader.CpuTopology
+	platform_header = (*ss.LinuxHeader)(&pheader)
 
 	// read first record
 	err = dec.Decode(&records[curr])
 	if err == io.EOF {
-		return
+		return nil
 	} else if err != nil {
 		panic(err)
 	}
@@ -272,6 +304,10 @@ func RunDirect(option *PlayerOption) {
 		prev_rec := &records[curr^1]
 		cur_rec := &records[curr]
 
+		// gob does not encode zero values, so decoding into the record of
+		// two samples before would keep its values where they dropped to 0
+		*cur_rec = ss.StatRecord{}
+
 		err = dec.Decode(cur_rec)
 		if err == io.EOF {
 			break
@@ -279,7 +315,7 @@ func RunDirect(option *PlayerOption) {
 			panic(err)
 		}
 
-		err = showStat(printer, prev_rec, cur_rec, option.DiskOnlyRegex, option)
+		err = showStat(printer, prev_rec, cur_rec, option)
 		if err != nil {
 			printer.Reset()
 			fmt.Fprintln(os.Stderr, "skip by err")
@@ -302,5 +338,5 @@ func RunDirect(option *PlayerOption) {
 		curr ^= 1
 	}
 
-	return
+	return nil
 }
\ No newline at end of file
@@ -2,8 +2,17 @@ package player
 
 import (
 	"bufio"
+	"encoding/gob"
+	"encoding/json"
 	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	ss "github.com/hayamiz/perfmonger/core/internal/perfmonger"
 )
 
 // failingWriter is an io.Writer that always returns an error on Write.
@@ -28,3 +37,277 @@ func TestWriteRecordSurfacesWriteError(t *testing.T) {
 		t.Fatalf("expected a non-nil error when the underlying write fails, got nil")
 	}
 }
+
+// writeLog writes a log of the given records, one second apart.
+func writeLog(t *testing.T, header ss.LinuxHeader, records ...ss.StatRecord) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.pgr")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create log file: %v", err)
+	}
+	defer f.Close()
+
+	t0, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	enc := gob.NewEncoder(f)
+	if err := enc.Encode(&ss.CommonHeader{Platform: ss.Linux, Hostname: "testhost", StartTime: t0}); err != nil {
+		t.Fatalf("failed to encode common header: %v", err)
+	}
+	if err := enc.Encode(&header); err != nil {
+		t.Fatalf("failed to encode platform header: %v", err)
+	}
+	for idx := range records {
+		records[idx].Time = t0.Add(time.Duration(idx) * time.Second)
+		if err := enc.Encode(&records[idx]); err != nil {
+			t.Fatalf("failed to encode record: %v", err)
+		}
+	}
+
+	return path
+}
+
+// playLog runs the player on a log and returns its output lines.
+func playLog(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+
+	option := NewPlayerOption()
+	option.Logfile = path
+	RunDirect(option)
+	os.Stdout = stdout
+	w.Close()
+
+	lines := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(<-output), "\n") {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			t.Fatalf("invalid output line %q: %v", line, err)
+		}
+		lines = append(lines, obj)
+	}
+
+	return lines
+}
+
+// TestRunDirectZeroValues verifies that a value which drops to 0 is played as
+// 0, although gob does not encode zero values.
+func TestRunDirectZeroValues(t *testing.T) {
+	fs := func(avail int64) *ss.FsStat {
+		return &ss.FsStat{Entries: []*ss.FsStatEntry{{
+			MountPoint: "/", Device: "/dev/sda1", FsType: "ext4",
+			TotalBytes: 100 << 20, FreeBytes: avail << 20, AvailBytes: avail << 20,
+			TotalInodes: 100, FreeInodes: avail,
+		}}}
+	}
+	path := writeLog(t, ss.LinuxHeader{},
+		ss.StatRecord{Fs: fs(100)},
+		ss.StatRecord{Fs: fs(50)},
+		ss.StatRecord{Fs: fs(0)})
+
+	lines := playLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("lines = %v", lines)
+	}
+	mount := lines[1]["fs"].(map[string]interface{})["mounts"].([]interface{})[0].(map[string]interface{})
+	if mount["avail_mb"].(float64) != 0 || mount["inodes_used"].(float64) != 100 {
+		t.Errorf("mount = %v, want avail_mb 0 and inodes_used 100", mount)
+	}
+}
+
+// TestRunDirectZeroProcGauges verifies that run queue figures and load
+// average which drop to 0 are played as 0.
+func TestRunDirectZeroProcGauges(t *testing.T) {
+	proc := func(n int64, load float64) *ss.ProcStat {
+		return &ss.ProcStat{
+			ContextSwitch: 1000 * (n + 1), HasProcsRunning: true, ProcsRunning: n, ProcsBlocked: n,
+			LoadAvg: &ss.LoadAvgStat{Load1: load, Load5: load, Load15: load, NrRunning: n, NrThreads: 100},
+		}
+	}
+	path := writeLog(t, ss.LinuxHeader{},
+		ss.StatRecord{Proc: proc(4, 2.5)},
+		ss.StatRecord{Proc: proc(3, 1.5)},
+		ss.StatRecord{Proc: proc(0, 0)})
+
+	lines := playLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("lines = %v", lines)
+	}
+	proc_json := lines[1]["proc"].(map[string]interface{})
+	for _, key := range []string{"procs_running", "procs_blocked", "loadavg1", "loadavg15", "nr_running"} {
+		if proc_json[key].(float64) != 0 {
+			t.Errorf("%s = %v, want 0", key, proc_json[key])
+		}
+	}
+}
+
+// TestRunDirectZeroInFlight verifies that a device whose queue drains is
+// played with no I/O in flight.
+func TestRunDirectZeroInFlight(t *testing.T) {
+	disk := func(n int64) *ss.DiskStat {
+		return &ss.DiskStat{Entries: []*ss.DiskStatEntry{{
+			Name: "sda", RdIos: 100 * (n + 1), ReqTicks: 1000 * (n + 1), HasInFlight: true, IosPgr: n,
+		}}}
+	}
+	path := writeLog(t, ss.LinuxHeader{},
+		ss.StatRecord{Disk: disk(8)},
+		ss.StatRecord{Disk: disk(4)},
+		ss.StatRecord{Disk: disk(0)})
+
+	lines := playLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("lines = %v", lines)
+	}
+	inflight := func(line map[string]interface{}) interface{} {
+		return line["disk"].(map[string]interface{})["sda"].(map[string]interface{})["inflight"]
+	}
+	if inflight(lines[0]) != 4.0 || inflight(lines[1]) != 0.0 {
+		t.Errorf("inflight = %v, %v, want 4, 0", inflight(lines[0]), inflight(lines[1]))
+	}
+}
+
+// TestRunDirectZeroNetProtoGauges verifies that connection and socket counts
+// which drop to 0 are played as 0.
+func TestRunDirectZeroNetProtoGauges(t *testing.T) {
+	netproto := func(n int64) *ss.NetProtoStat {
+		return &ss.NetProtoStat{
+			TcpInSegs: 1000 * (n + 1), TcpCurrEstab: n,
+			SocketsUsed: n, TcpInUse: n, TcpOrphan: n, TcpTimeWait: n, TcpAlloc: n,
+			TcpMem: n, UdpInUse: n, UdpMem: n,
+		}
+	}
+	path := writeLog(t, ss.LinuxHeader{},
+		ss.StatRecord{NetProto: netproto(5)},
+		ss.StatRecord{NetProto: netproto(3)},
+		ss.StatRecord{NetProto: netproto(0)})
+
+	lines := playLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("lines = %v", lines)
+	}
+	netproto_json := lines[1]["netproto"].(map[string]interface{})
+	for _, key := range []string{"tcp_curr_estab", "sockets_used", "tcp_inuse", "tcp_orphan",
+		"tcp_tw", "tcp_alloc", "tcp_mem", "udp_inuse", "udp_mem"} {
+		if netproto_json[key].(float64) != 0 {
+			t.Errorf("%s = %v, want 0", key, netproto_json[key])
+		}
+	}
+}
+
+// TestRunDirectNfsNewOp verifies that an operation listed at the index of
+// another operation of the record two samples before, as after a remount,
+// does not take over its counters.
+func TestRunDirectNfsNewOp(t *testing.T) {
+	nfs := func(ops ...*ss.NfsOpStat) *ss.NfsStat {
+		return &ss.NfsStat{Entries: []*ss.NfsMountStatEntry{{
+			MountPoint: "/mnt", Device: "srv:/export", FsType: "nfs4", Ops: ops,
+		}}}
+	}
+	op := func(name string, n int64) *ss.NfsOpStat {
+		return &ss.NfsOpStat{Name: name, Ops: 10 * n, Trans: 10 * n, Timeouts: 2, Rtt: 100 * n, Execute: 100 * n}
+	}
+	path := writeLog(t, ss.LinuxHeader{},
+		ss.StatRecord{Nfs: nfs(op("GETATTR", 1), op("READ", 1))},
+		ss.StatRecord{Nfs: nfs(op("GETATTR", 2), op("READ", 2))},
+		// remounted
+		ss.StatRecord{Nfs: nfs(&ss.NfsOpStat{Name: "ACCESS", Ops: 5, Trans: 5}, op("READ", 3))})
+
+	lines := playLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("lines = %v", lines)
+	}
+	mount := lines[1]["nfs"].(map[string]interface{})["mounts"].([]interface{})[0].(map[string]interface{})
+	for _, op := range mount["ops"].([]interface{}) {
+		op := op.(map[string]interface{})
+		if op["name"] == "ACCESS" && (op["rtt"].(float64) != 0 || op["execute"].(float64) != 0) {
+			t.Errorf("ACCESS = %v, want rtt and execute 0", op)
+		}
+	}
+}
+
+// TestRunDirectSoftIrqFromSecondRecord verifies that softirqs missing from
+// the previous record are left out instead of failing the whole line.
+func TestRunDirectSoftIrqFromSecondRecord(t *testing.T) {
+	softirq := func(n int64) *ss.SoftIrqStat {
+		sirq := ss.NewSoftIrqStat(1)
+		sirq.All.Timer = n
+		sirq.CoreStats[0].Timer = n
+		return sirq
+	}
+	path := writeLog(t, ss.LinuxHeader{},
+		ss.StatRecord{},
+		ss.StatRecord{Softirq: softirq(100)},
+		ss.StatRecord{Softirq: softirq(200)})
+
+	lines := playLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("lines = %v", lines)
+	}
+	if _, ok := lines[0]["softirq"]; ok {
+		t.Errorf("lines[0] = %v, want no softirq", lines[0])
+	}
+	if _, ok := lines[1]["softirq"]; !ok {
+		t.Errorf("lines[1] = %v, want softirq", lines[1])
+	}
+}
+
+// TestRunDirectVmFromSecondRecord verifies that vmstat missing from the
+// previous record is left out instead of failing the whole line.
+func TestRunDirectVmFromSecondRecord(t *testing.T) {
+	path := writeLog(t, ss.LinuxHeader{},
+		ss.StatRecord{},
+		ss.StatRecord{Vm: &ss.VmStat{PgFault: 1000}},
+		ss.StatRecord{Vm: &ss.VmStat{PgFault: 2000}})
+
+	lines := playLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("lines = %v", lines)
+	}
+	if _, ok := lines[0]["vm"]; ok {
+		t.Errorf("lines[0] = %v, want no vm", lines[0])
+	}
+	if _, ok := lines[1]["vm"]; !ok {
+		t.Errorf("lines[1] = %v, want vm", lines[1])
+	}
+}
+
+// TestRunDirectInvalidRegex verifies that an invalid regex is returned as an
+// error instead of panicking.
+func TestRunDirectInvalidRegex(t *testing.T) {
+	for _, set := range []func(option *PlayerOption){
+		func(option *PlayerOption) { option.NetOnly = "(" },
+		func(option *PlayerOption) { option.NetExclude = "[" },
+		func(option *PlayerOption) { option.DiskOnly = "*" },
+	} {
+		option := NewPlayerOption()
+		option.Logfile = writeLog(t, ss.LinuxHeader{})
+		set(option)
+		if err := RunDirect(option); err == nil {
+			t.Errorf("RunDirect(%+v) should return an error", option)
+		}
+	}
+}
+
+// TestParseArgsLeavesRegexToRunDirect verifies that parseArgs does not
+// compile --disk-only, so that an invalid one is returned by RunDirect.
+func TestParseArgsLeavesRegexToRunDirect(t *testing.T) {
+	option := NewPlayerOption()
+	parseArgs([]string{"-disk-only", "(", writeLog(t, ss.LinuxHeader{})}, option)
+	if option.DiskOnlyRegex != nil || option.DiskOnly != "(" {
+		t.Fatalf("option = %+v", option)
+	}
+	if err := RunDirect(option); err == nil {
+		t.Error("RunDirect should return an error for an invalid --disk-only")
+	}
+}
@@ -8,30 +8,33 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	ss "github.com/hayamiz/perfmonger/core/internal/perfmonger"
 )
 
 type CmdOption struct {
-	DiskFile        string
-	CpuFile         string
-	MemFile         string
+	// data file of each collector with a plot section, keyed by the name
+	// of the collector; a section without a file is not written
+	DataFiles       map[string]string
 	PerfmongerFile  string
+	CpuGroup        string
 	disk_only       string
 	disk_only_regex *regexp.Regexp
 }
 
 // PlotFormatOption is a public option struct for direct invocation from Go code.
 type PlotFormatOption struct {
-	DiskFile       string
-	CpuFile        string
-	MemFile        string
+	DataFiles      map[string]string // see DataFiles
 	PerfmongerFile string
 	DiskOnly       string
+	CpuGroup       string // "socket", "node" or "core" to group per-core blocks of cpu.dat
 }
 
 type DiskMetaEntry struct {
@@ -40,18 +43,94 @@ type DiskMetaEntry struct {
 }
 
 type DiskMeta struct {
-	Devices []DiskMetaEntry `json:"devices"`
+	Devices    []DiskMetaEntry `json:"devices"`
+	HasDiscard bool            `json:"has_discard"`
+	HasFlush   bool            `json:"has_flush"`
 }
 
 type CpuMeta struct {
 	NumCore int `json:"num_core"`
+
+	// names of the per-core blocks of cpu.dat if they are grouped by
+	// CpuGroup, empty otherwise
+	Groups []string `json:"groups"`
+}
+
+type VmMeta struct {
+	Available bool `json:"available"`
+}
+
+type ProcMeta struct {
+	Available bool `json:"available"`
+}
+
+type CpuFreqMeta struct {
+	Available bool `json:"available"`
+	NumCore   int  `json:"num_core"`
+}
+
+type CpuIdleMeta struct {
+	Available    bool   `json:"available"`
+	NumCore      int    `json:"num_core"`
+	DeepestState string `json:"deepest_state"`
+}
+
+type NetMetaEntry struct {
+	Name  string `json:"name"`
+	Speed int64  `json:"speed"` // link speed in Mb/s, -1 if unknown
+}
+
+type NetMeta struct {
+	Available bool           `json:"available"`
+	Devices   []NetMetaEntry `json:"devices"`
+}
+
+type FsMetaEntry struct {
+	MountPoint string `json:"mount_point"`
+	FsType     string `json:"fstype"`
+}
+
+type FsMeta struct {
+	Available bool          `json:"available"`
+	Mounts    []FsMetaEntry `json:"mounts"`
+}
+
+type NfsMeta struct {
+	Available bool     `json:"available"`
+	Mounts    []string `json:"mounts"`
+}
+
+type ThermalMeta struct {
+	Available bool     `json:"available"`
+	Sensors   []string `json:"sensors"`
+}
+
+type CustomMetaEntry struct {
+	Metric  string `json:"metric"`
+	Name    string `json:"name"`
+	Counter bool   `json:"counter"`
+	Idx     int    `json:"idx"` // index of the block in custom.dat
+}
+
+type CustomMeta struct {
+	Available bool              `json:"available"`
+	Series    []CustomMetaEntry `json:"series"`
 }
 
 type PlotMeta struct {
-	Disk      DiskMeta `json:"disk"`
-	Cpu       CpuMeta  `json:"cpu"`
-	StartTime float64  `json:"start_time"`
-	EndTime   float64  `json:"end_time"`
+	Disk      DiskMeta    `json:"disk"`
+	Cpu       CpuMeta     `json:"cpu"`
+	Vm        VmMeta      `json:"vm"`
+	CpuFreq   CpuFreqMeta `json:"cpufreq"`
+	CpuIdle   CpuIdleMeta `json:"cpuidle"`
+	Net       NetMeta     `json:"net"`
+	Fs        FsMeta      `json:"fs"`
+	Nfs       NfsMeta     `json:"nfs"`
+	Thermal   ThermalMeta `json:"thermal"`
+	Custom    CustomMeta  `json:"custom"`
+	Proc      ProcMeta    `json:"proc"`
+	StartTime float64     `json:"start_time"`
+	EndTime   float64     `json:"end_time"`
 }
 
 type DiskDatTmpFile struct {
@@ -82,15 +161,22 @@ func parseArgs(args []string) *CmdOption {
 	opt := new(CmdOption)
 	fs := flag.NewFlagSet("plotformatter", flag.ExitOnError)
 
-	fs.StringVar(&opt.DiskFile, "diskfile", "./disk.dat", "Disk usage data file for gnuplot")
-	fs.StringVar(&opt.CpuFile, "cpufile", "./cpu.dat", "CPU usage data file for gnuplot")
-	fs.StringVar(&opt.MemFile, "memfile", "./mem.dat", "Memory usage data file for gnuplot")
+	files := map[string]*string{}
+	for name, section := range plot_sections {
+		files[name] = fs.String(section.flag, "./"+section.file, section.usage)
+	}
 	fs.StringVar(&opt.PerfmongerFile, "perfmonger", "", "Perfmonger log file")
+	fs.StringVar(&opt.CpuGroup, "cpu-group", "", "Group per-core CPU usage by socket, node or core")
 	fs.StringVar(&opt.disk_only, "disk-only",
 		"", "Select disk devices by regex")
 
 	fs.Parse(args)
 
+	opt.DataFiles = map[string]string{}
+	for name, file := range files {
+		opt.DataFiles[name] = *file
+	}
+
 	if opt.PerfmongerFile == "" {
 		os.Stderr.WriteString("[ERROR] perfmonger log file is required.\n")
 		os.Exit(1)
@@ -119,6 +205,24 @@ func printCoreUsage(writer *bufio.Writer, elapsed_time float64, coreusage *ss.Cp
 			coreusage.Idle))
 }
 
+// averageCpuGroupUsage scales usage of a CPU group down to one CPU, so that
+// a group block in cpu.dat has the same range as a per-core block.
+func averageCpuGroupUsage(gusage *ss.CpuGroupUsage) *ss.CpuCoreUsage {
+	n := float64(len(gusage.Cpus))
+	return &ss.CpuCoreUsage{
+		User:      gusage.Usage.User / n,
+		Nice:      gusage.Usage.Nice / n,
+		Sys:       gusage.Usage.Sys / n,
+		Idle:      gusage.Usage.Idle / n,
+		Iowait:    gusage.Usage.Iowait / n,
+		Hardirq:   gusage.Usage.Hardirq / n,
+		Softirq:   gusage.Usage.Softirq / n,
+		Steal:     gusage.Usage.Steal / n,
+		Guest:     gusage.Usage.Guest / n,
+		GuestNice: gusage.Usage.GuestNice / n,
+	}
+}
+
 func printMemUsage(writer *bufio.Writer, elapsed_time float64, mem *ss.MemStat) {
 	if mem == nil {
 		writer.WriteString("#")
@@ -158,10 +262,11 @@ func printMemUsage(writer *bufio.Writer, elapsed_time float64, mem *ss.MemStat)
 				"\t"))
 		writer.WriteString("\n")
 	} else {
+		musage, _ := ss.GetMemUsage(mem)
 		writer.WriteString(fmt.Sprintf("%f\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
 			elapsed_time,
 			mem.MemTotal,
-			mem.MemTotal-mem.MemFree-mem.Buffers-mem.Cached-mem.SReclaimable,
+			musage.Used,
 			mem.MemFree,
 			mem.Buffers,
 			mem.Cached,
@@ -193,6 +298,255 @@ func printMemUsage(writer *bufio.Writer, elapsed_time float64, mem *ss.MemStat)
 	}
 }
 
+func printVmUsage(writer *bufio.Writer, elapsed_time float64, vusage *ss.VmUsage) {
+	if vusage == nil {
+		writer.WriteString("#")
+		writer.WriteString(
+			strings.Join([]string{
+				"elapsed_time",              // 1
+				"pgfault",                   // 2
+				"pgmajfault",                // 3
+				"pswpin",                    // 4
+				"pswpout",                   // 5
+				"pgscan_kswapd",             // 6
+				"pgscan_direct",             // 7
+				"pgscan_khugepaged",         // 8
+				"pgsteal_kswapd",            // 9
+				"pgsteal_direct",            // 10
+				"pgsteal_khugepaged",        // 11
+				"allocstall",                // 12
+				"compact_stall",             // 13
+				"thp_fault_alloc",           // 14
+				"thp_fault_fallback",        // 15
+				"thp_collapse_alloc",        // 16
+				"thp_collapse_alloc_failed", // 17
+				"thp_split_page",            // 18
+				"oom_kill"},                 // 19
+				"\t"))
+		writer.WriteString("\n")
+	} else {
+		writer.WriteString(fmt.Sprintf("%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\n",
+			elapsed_time,
+			vusage.PgFault,
+			vusage.PgMajFault,
+			vusage.PswpIn,
+			vusage.PswpOut,
+			vusage.PgScanKswapd,
+			vusage.PgScanDirect,
+			vusage.PgScanKhugepaged,
+			vusage.PgStealKswapd,
+			vusage.PgStealDirect,
+			vusage.PgStealKhugepaged,
+			vusage.AllocStall,
+			vusage.CompactStall,
+			vusage.ThpFaultAlloc,
+			vusage.ThpFaultFallback,
+			vusage.ThpCollapseAlloc,
+			vusage.ThpCollapseAllocFailed,
+			vusage.ThpSplitPage,
+			vusage.OomKill))
+	}
+}
+
+func printProcUsage(writer *bufio.Writer, elapsed_time float64, pusage *ss.ProcUsage) {
+	if pusage == nil {
+		writer.WriteString("#")
+		writer.WriteString(
+			strings.Join([]string{
+				"elapsed_time",  // 1
+				"ctxtps",        // 2
+				"forkps",        // 3
+				"intrps",        // 4
+				"procs_running", // 5
+				"procs_blocked", // 6
+				"loadavg1",      // 7
+				"loadavg5",      // 8
+				"loadavg15"},    // 9
+				"\t"))
+		writer.WriteString("\n")
+	} else {
+		loadavg := &ss.LoadAvgStat{}
+		if pusage.LoadAvg != nil {
+			loadavg = pusage.LoadAvg
+		}
+		writer.WriteString(fmt.Sprintf("%f\t%f\t%f\t%f\t%d\t%d\t%f\t%f\t%f\n",
+			elapsed_time,
+			pusage.ContextSwitch,
+			pusage.Fork,
+			pusage.Interrupt,
+			pusage.ProcsRunning,
+			pusage.ProcsBlocked,
+			loadavg.Load1,
+			loadavg.Load5,
+			loadavg.Load15))
+	}
+}
+
+// printCpuIdleUsage prints a row per core so that a heatmap can be drawn
+// with boxxyerror; half_itv is the half width of a box.
+func printCpuIdleUsage(writer *bufio.Writer, elapsed_time float64, ciusage *ss.CpuIdleUsage) {
+	if ciusage == nil {
+		writer.WriteString("# elapsed_time\tcore\t%idle\t%deepest\thalf_itv\n")
+		return
+	}
+
+	half_itv := ciusage.Interval.Seconds() / 2.0
+	for _, e := range ciusage.CoreUsages {
+		writer.WriteString(
+			fmt.Sprintf("%f\t%d\t%f\t%f\t%f\n",
+				elapsed_time+half_itv,
+				e.CpuId,
+				e.Idle,
+				e.DeepestResidency(),
+				half_itv))
+	}
+}
+
+// printNetUsage prints rx/tx throughput in MB/s and link utilization in %
+// of each device in `devices`. Values of absent devices and utilization of
+// links with unknown speed are printed as NaN.
+func printNetUsage(writer *bufio.Writer, elapsed_time float64, nusage *ss.NetUsage, devices []string) {
+	if nusage == nil {
+		writer.WriteString("# elapsed_time")
+		for _, device := range devices {
+			writer.WriteString(fmt.Sprintf("\t%s:rx[MB/s] %s:tx[MB/s] %s:rx[%%] %s:tx[%%]",
+				device, device, device, device))
+		}
+		writer.WriteString("\n")
+		return
+	}
+
+	writer.WriteString(fmt.Sprintf("%f", elapsed_time))
+	for _, device := range devices {
+		entry, ok := (*nusage)[device]
+		if !ok {
+			writer.WriteString("\tNaN NaN NaN NaN")
+			continue
+		}
+		writer.WriteString(fmt.Sprintf("\t%f %f",
+			entry.RxBytesPerSec/1024.0/1024.0,
+			entry.TxBytesPerSec/1024.0/1024.0))
+		if entry.LinkSpeed > 0 {
+			writer.WriteString(fmt.Sprintf(" %f %f", entry.RxUtil, entry.TxUtil))
+		} else {
+			writer.WriteString(" NaN NaN")
+		}
+	}
+	writer.WriteString("\n")
+}
+
+func printFsUsage(writer *bufio.Writer, elapsed_time float64, fstat *ss.FsStat, mounts []string) {
+	if fstat == nil {
+		writer.WriteString("# elapsed_time")
+		for _, mount := range mounts {
+			writer.WriteString(fmt.Sprintf("\t%s:used[GB] %s:used[%%] %s:inodes[%%]",
+				mount, mount, mount))
+		}
+		writer.WriteString("\n")
+		return
+	}
+
+	writer.WriteString(fmt.Sprintf("%f", elapsed_time))
+	for _, mount := range mounts {
+		var entry *ss.FsStatEntry = nil
+		for _, e := range fstat.Entries {
+			if e.MountPoint == mount {
+				entry = e
+				break
+			}
+		}
+		if entry == nil {
+			writer.WriteString("\tNaN NaN NaN")
+			continue
+		}
+
+		used := entry.TotalBytes - entry.FreeBytes
+		used_pct := math.NaN()
+		if used+entry.AvailBytes > 0 {
+			used_pct = float64(used) / float64(used+entry.AvailBytes) * 100.0
+		}
+		inode_pct := math.NaN()
+		if entry.TotalInodes > 0 {
+			inode_pct = float64(entry.TotalInodes-entry.FreeInodes) / float64(entry.TotalInodes) * 100.0
+		}
+		writer.WriteString(fmt.Sprintf("\t%f %f %f",
+			float64(used)/1024.0/1024.0/1024.0, used_pct, inode_pct))
+	}
+	writer.WriteString("\n")
+}
+
+func printNfsUsage(writer *bufio.Writer, elapsed_time float64, nusage *ss.NfsUsage, mounts []string) {
+	if nusage == nil {
+		writer.WriteString("# elapsed_time")
+		for _, mount := range mounts {
+			writer.WriteString(fmt.Sprintf("\t%s:read[MB/s] %s:write[MB/s] %s:iops %s:rtt[ms]",
+				mount, mount, mount, mount))
+		}
+		writer.WriteString("\n")
+		return
+	}
+
+	writer.WriteString(fmt.Sprintf("%f", elapsed_time))
+	for _, mount := range mounts {
+		var entry *ss.NfsMountUsage = nil
+		for _, m := range nusage.Mounts {
+			if m.MountPoint == mount {
+				entry = m
+				break
+			}
+		}
+		if entry == nil {
+			writer.WriteString("\tNaN NaN NaN NaN")
+			continue
+		}
+		writer.WriteString(fmt.Sprintf("\t%f %f %f %f",
+			entry.RdBytesPerSec/1024.0/1024.0, entry.WrBytesPerSec/1024.0/1024.0,
+			entry.Iops, entry.Rtt))
+	}
+	writer.WriteString("\n")
+}
+
+func printThermal(writer *bufio.Writer, elapsed_time float64, thermal *ss.ThermalStat) {
+	writer.WriteString(fmt.Sprintf("%f", elapsed_time))
+	for _, millicelsius := range thermal.Temps {
+		if millicelsius == 0 {
+			// unavailable temperature is left out of the plot
+			writer.WriteString("\tNaN")
+			continue
+		}
+		writer.WriteString(fmt.Sprintf("\t%.1f", float64(millicelsius)/1000.0))
+	}
+	writer.WriteString("\n")
+}
+
+func printCpuFreq(writer *bufio.Writer, elapsed_time float64, freq *ss.CpuFreqStat) {
+	if freq == nil {
+		return
+	}
+
+	var sum float64
+	var count int
+	cols := make([]string, 0, freq.NumCore)
+	for _, khz := range freq.CoreFreqs {
+		if khz <= 0 {
+			// unknown frequency is left out of the plot
+			cols = append(cols, "NaN")
+			continue
+		}
+		mhz := float64(khz) / 1000.0
+		sum += mhz
+		count++
+		cols = append(cols, fmt.Sprintf("%f", mhz))
+	}
+	avg := 0.0
+	if count > 0 {
+		avg = sum / float64(count)
+	}
+
+	writer.WriteString(fmt.Sprintf("%f\t%f\t%s\n",
+		elapsed_time, avg, strings.Join(cols, "\t")))
+}
+
 // closeTmpFile closes a temp file handle. It is a package-level seam so tests
 // can observe how many times each temp file is closed (a double-close is an
 // FD-reuse hazard).
@@ -264,10 +618,9 @@ func RunDirect(option *PlotFormatOption) (*PlotMeta, error) {
 		}
 	}
 	opt := &CmdOption{
-		DiskFile:        option.DiskFile,
-		CpuFile:         option.CpuFile,
-		MemFile:         option.MemFile,
+		DataFiles:       option.DataFiles,
 		PerfmongerFile:  option.PerfmongerFile,
+		CpuGroup:        option.CpuGroup,
 		disk_only:       option.DiskOnly,
 		disk_only_regex: diskOnlyRegex,
 	}
@@ -285,6 +638,664 @@ func Run(args []string) {
 	json_enc.Encode(meta)
 }
 
+// DataFiles returns the data file in `dir` of each collector with a plot
+// section, keyed by the name of the collector.
+func DataFiles(dir string) map[string]string {
+	files := make(map[string]string, len(plot_sections))
+	for name, section := range plot_sections {
+		files[name] = filepath.Join(dir, section.file)
+	}
+	return files
+}
+
+// plotContext is shared by the sections of a run.
+type plotContext struct {
+	option *CmdOption
+	header *ss.LinuxHeader
+	meta   *PlotMeta
+	t0     time.Time
+
+	// temp files, which are closed once at the end of the run
+	tmp_files []*os.File
+}
+
+// plotSection writes the data file of a collector.
+type plotSection interface {
+	// begin writes the column labels, and the meta known from the first
+	// record.
+	begin(first *ss.StatRecord)
+
+	// add writes the row of `prev` at `elapsed_time`. `usage` is the usage
+	// of the collector between `prev` and `cur`, or nil without one.
+	add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter)
+
+	// finish writes what is kept until all records are read.
+	finish() error
+}
+
+type plotSectionDef struct {
+	file  string // default name of the data file
+	flag  string
+	usage string
+	new   func(ctx *plotContext, writer *bufio.Writer) plotSection
+}
+
+// plot_sections are the plot sections keyed by the name of their collector.
+var plot_sections = map[string]plotSectionDef{
+	"cpu":     {"cpu.dat", "cpufile", "CPU usage data file for gnuplot", newCpuSection},
+	"cpufreq": {"freq.dat", "freqfile", "CPU frequency data file for gnuplot", newCpuFreqSection},
+	"cpuidle": {"cpuidle.dat", "idlefile", "CPU idle state residency data file for gnuplot", newCpuIdleSection},
+	"thermal": {"thermal.dat", "thermalfile", "Temperature data file for gnuplot", newThermalSection},
+	"proc":    {"proc.dat", "procfile", "Scheduler activity data file for gnuplot", newProcSection},
+	"disk":    {"disk.dat", "diskfile", "Disk usage data file for gnuplot", newDiskSection},
+	"fs":      {"fs.dat", "fsfile", "Filesystem usage data file for gnuplot", newFsSection},
+	"nfs":     {"nfs.dat", "nfsfile", "NFS client activity data file for gnuplot", newNfsSection},
+	"net":     {"net.dat", "netfile", "Network throughput data file for gnuplot", newNetSection},
+	"mem":     {"mem.dat", "memfile", "Memory usage data file for gnuplot", newMemSection},
+	"vm":      {"vm.dat", "vmfile", "Paging activity data file for gnuplot", newVmSection},
+	"custom":  {"custom.dat", "customfile", "Custom metrics data file for gnuplot", newCustomSection},
+}
+
+type cpuSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+
+	cpu_dat_files []*CpuDatTmpFile
+	groups_set    bool
+}
+
+func newCpuSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &cpuSection{ctx: ctx, writer: writer}
+}
+
+func (section *cpuSection) begin(first *ss.StatRecord) {
+	section.ctx.meta.Cpu.NumCore = first.Cpu.NumCore
+
+	section.writer.WriteString("# All cpu usage\n")
+	section.writer.WriteString("# elapsed_time\t%usr\t%nice\t%sys\t%iowait\t%hardirq\t%softirq\t%steal\t%guest\t%idle\n")
+}
+
+func (section *cpuSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	cusage, _ := usage.(*ss.CpuUsage)
+	if cusage == nil {
+		return
+	}
+
+	block_usages := cusage.CoreUsages
+	block_names := []string{}
+	if group := section.ctx.option.CpuGroup; group != "" {
+		// logs recorded without topology fall back to per-core blocks
+		gusages, err := ss.GetCpuGroupUsage(cusage, section.ctx.header.CpuTopology, group)
+		if err == nil {
+			block_usages = make([]*ss.CpuCoreUsage, len(gusages))
+			for idx, gusage := range gusages {
+				block_usages[idx] = averageCpuGroupUsage(gusage)
+				block_names = append(block_names, gusage.Name)
+			}
+			if !section.groups_set {
+				section.ctx.meta.Cpu.Groups = block_names
+			}
+		}
+	}
+	section.groups_set = true
+
+	for coreid, coreusage := range block_usages {
+		for coreid >= len(section.cpu_dat_files) {
+			section.cpu_dat_files = append(section.cpu_dat_files, nil)
+		}
+		cpu_dat := section.cpu_dat_files[coreid]
+		if cpu_dat == nil {
+			cpu_dat = makeCpuDatTmpFile(coreid)
+			section.cpu_dat_files[coreid] = cpu_dat
+			section.ctx.tmp_files = append(section.ctx.tmp_files, cpu_dat.File)
+
+			if len(block_names) > 0 {
+				cpu_dat.Writer.WriteString(fmt.Sprintf("\n\n\n# group: %s\n", block_names[coreid]))
+			} else {
+				cpu_dat.Writer.WriteString(fmt.Sprintf("\n\n\n# core: %d\n", coreid))
+			}
+			cpu_dat.Writer.WriteString("# elapsed_time\t%usr\t%nice\t%sys\t%iowait\t%hardirq\t%softirq\t%steal\t%guest\t%idle\n")
+		}
+
+		printCoreUsage(cpu_dat.Writer, elapsed_time, coreusage)
+	}
+	printCoreUsage(section.writer, elapsed_time, cusage.All)
+}
+
+func (section *cpuSection) finish() error {
+	for _, cpu_dat := range section.cpu_dat_files {
+		// Flush buffered data; the handle is closed exactly once at the end
+		// of the run (avoids double-close).
+		if err := flushWriter(cpu_dat.Writer); err != nil {
+			return fmt.Errorf("failed to flush cpu data for core %d: %v", cpu_dat.CoreId, err)
+		}
+
+		content, err := ioutil.ReadFile(cpu_dat.Path)
+		if err != nil {
+			return err
+		}
+
+		section.writer.Write(content)
+		os.Remove(cpu_dat.Path)
+	}
+
+	return nil
+}
+
+// cpuFreqSection prints the frequencies sampled at `prev`, since they are
+// gauges, and so do the thermal and fs sections.
+type cpuFreqSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+}
+
+func newCpuFreqSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &cpuFreqSection{ctx, writer}
+}
+
+func (section *cpuFreqSection) begin(first *ss.StatRecord) {
+	section.writer.WriteString("# elapsed_time\tall\tcpu0 cpu1 ... [MHz]\n")
+}
+
+func (section *cpuFreqSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	if prev.CpuFreq == nil {
+		return
+	}
+
+	meta := &section.ctx.meta.CpuFreq
+	printCpuFreq(section.writer, elapsed_time, prev.CpuFreq)
+	meta.Available = true
+	if prev.CpuFreq.NumCore > meta.NumCore {
+		meta.NumCore = prev.CpuFreq.NumCore
+	}
+}
+
+func (section *cpuFreqSection) finish() error {
+	return nil
+}
+
+type cpuIdleSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+}
+
+func newCpuIdleSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &cpuIdleSection{ctx, writer}
+}
+
+func (section *cpuIdleSection) begin(first *ss.StatRecord) {
+	// print column labels
+	printCpuIdleUsage(section.writer, 0.0, nil)
+}
+
+func (section *cpuIdleSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	ciusage, _ := usage.(*ss.CpuIdleUsage)
+	if ciusage == nil {
+		return
+	}
+
+	meta := &section.ctx.meta.CpuIdle
+	printCpuIdleUsage(section.writer, elapsed_time, ciusage)
+	meta.Available = true
+	meta.NumCore = cur.CpuIdle.NumCore
+	meta.DeepestState = ciusage.StateNames[len(ciusage.StateNames)-1]
+}
+
+func (section *cpuIdleSection) finish() error {
+	return nil
+}
+
+// thermalSection has a column of each sensor in the header.
+type thermalSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+}
+
+func newThermalSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &thermalSection{ctx, writer}
+}
+
+func (section *thermalSection) begin(first *ss.StatRecord) {
+	meta := &section.ctx.meta.Thermal
+	section.writer.WriteString("# elapsed_time")
+	for _, sensor := range section.ctx.header.Sensors {
+		meta.Sensors = append(meta.Sensors, sensor.Name)
+		section.writer.WriteString("\t" + sensor.Name + "[C]")
+	}
+	section.writer.WriteString("\n")
+}
+
+func (section *thermalSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	meta := &section.ctx.meta.Thermal
+	if prev.Thermal == nil || len(prev.Thermal.Temps) != len(meta.Sensors) || len(meta.Sensors) == 0 {
+		return
+	}
+
+	printThermal(section.writer, elapsed_time, prev.Thermal)
+	meta.Available = true
+}
+
+func (section *thermalSection) finish() error {
+	return nil
+}
+
+type procSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+}
+
+func newProcSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &procSection{ctx, writer}
+}
+
+func (section *procSection) begin(first *ss.StatRecord) {
+	// print column labels
+	printProcUsage(section.writer, 0.0, nil)
+}
+
+func (section *procSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	pusage, _ := usage.(*ss.ProcUsage)
+	if pusage == nil {
+		return
+	}
+
+	printProcUsage(section.writer, elapsed_time, pusage)
+	section.ctx.meta.Proc.Available = true
+}
+
+func (section *procSection) finish() error {
+	return nil
+}
+
+// diskSection writes each device to a temp file, and merges them into a
+// block of each device at the end.
+type diskSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+
+	disk_dat_files map[string]*DiskDatTmpFile
+	devices_set    bool
+}
+
+func newDiskSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &diskSection{
+		ctx:            ctx,
+		writer:         writer,
+		disk_dat_files: map[string]*DiskDatTmpFile{},
+	}
+}
+
+func (section *diskSection) begin(first *ss.StatRecord) {
+}
+
+func (section *diskSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	dusage, _ := usage.(*ss.DiskUsage)
+	if dusage == nil {
+		return
+	}
+	meta := &section.ctx.meta.Disk
+
+	var dnames []string
+	for dname, _ := range *dusage {
+		if dname != "total" {
+			dnames = append(dnames, dname)
+		}
+	}
+	sort.Strings(dnames)
+	dnames = append(dnames, "total")
+
+	for didx, dname := range dnames {
+		dusage_entry, ok := (*dusage)[dname]
+		if !ok {
+			panic("device '" + dname + "' not found")
+		}
+
+		if !section.devices_set {
+			meta.Devices = append(meta.Devices, DiskMetaEntry{Name: dname, Idx: didx})
+		}
+
+		disk_dat, ok := section.disk_dat_files[dname]
+		if !ok {
+			disk_dat = makeDiskDatTmpFile(dname, didx)
+			section.disk_dat_files[dname] = disk_dat
+			section.ctx.tmp_files = append(section.ctx.tmp_files, disk_dat.File)
+
+			disk_dat.Writer.WriteString("\n\n\n")
+			disk_dat.Writer.WriteString("# device: " + disk_dat.Name + "\n")
+			disk_dat.Writer.WriteString(fmt.Sprintln(
+				"# elapsed_time\tr_iops\tw_iops\tr_MB/s\tw_MB/s\tr_latency\tw_latency\tr_avgsz\tw_avgsz\tqdepth\td_iops\td_MB/s\td_latency\tf_iops\tf_latency\tutil\tsvctm"))
+		}
+
+		disk_dat.Writer.WriteString(
+			fmt.Sprintf("%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\n",
+				elapsed_time,
+				dusage_entry.RdIops,
+				dusage_entry.WrIops,
+				dusage_entry.RdSecps*512.0/1024.0/1024.0,
+				dusage_entry.WrSecps*512.0/1024.0/1024.0,
+				dusage_entry.RdLatency,
+				dusage_entry.WrLatency,
+				dusage_entry.AvgRdSize,
+				dusage_entry.AvgWrSize,
+				dusage_entry.ReqQlen,
+				dusage_entry.DcIops,
+				dusage_entry.DcSecps*512.0/1024.0/1024.0,
+				dusage_entry.DcLatency,
+				dusage_entry.FlIops,
+				dusage_entry.FlLatency,
+				dusage_entry.Util,
+				dusage_entry.Svctm))
+		if dusage_entry.HasDiscard {
+			meta.HasDiscard = true
+		}
+		if dusage_entry.HasFlush {
+			meta.HasFlush = true
+		}
+	}
+	section.devices_set = true
+}
+
+func (section *diskSection) finish() error {
+	for _, disk_dat := range section.disk_dat_files {
+		// Flush buffered data to the temp file. The handle itself is closed
+		// exactly once at the end of the run, so it is intentionally not
+		// closed here (avoids an FD-reuse hazard).
+		if err := flushWriter(disk_dat.Writer); err != nil {
+			return fmt.Errorf("failed to flush disk data for device %q: %v", disk_dat.Name, err)
+		}
+	}
+
+	for _, dev := range section.ctx.meta.Disk.Devices {
+		disk_dat, ok := section.disk_dat_files[dev.Name]
+		if !ok {
+			panic(dev.Name)
+		}
+
+		content, err := ioutil.ReadFile(disk_dat.Path)
+		if err != nil {
+			return err
+		}
+
+		section.writer.Write(content)
+		os.Remove(disk_dat.Path)
+	}
+
+	return nil
+}
+
+// fsSection has columns of the mounts of the first record.
+type fsSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+
+	mounts []string
+}
+
+func newFsSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &fsSection{ctx: ctx, writer: writer}
+}
+
+func (section *fsSection) begin(first *ss.StatRecord) {
+	meta := &section.ctx.meta.Fs
+	if first.Fs != nil {
+		for _, entry := range first.Fs.Entries {
+			section.mounts = append(section.mounts, entry.MountPoint)
+			meta.Mounts = append(meta.Mounts, FsMetaEntry{entry.MountPoint, entry.FsType})
+		}
+	}
+
+	// print column labels
+	printFsUsage(section.writer, 0.0, nil, section.mounts)
+}
+
+func (section *fsSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	if len(section.mounts) == 0 || prev.Fs == nil {
+		return
+	}
+
+	printFsUsage(section.writer, elapsed_time, prev.Fs, section.mounts)
+	section.ctx.meta.Fs.Available = true
+}
+
+func (section *fsSection) finish() error {
+	return nil
+}
+
+// nfsSection has columns of the NFS mounts of the first record.
+type nfsSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+}
+
+func newNfsSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &nfsSection{ctx, writer}
+}
+
+func (section *nfsSection) begin(first *ss.StatRecord) {
+	meta := &section.ctx.meta.Nfs
+	if first.Nfs != nil {
+		for _, entry := range first.Nfs.Entries {
+			meta.Mounts = append(meta.Mounts, entry.MountPoint)
+		}
+		sort.Strings(meta.Mounts)
+	}
+
+	// print column labels
+	printNfsUsage(section.writer, 0.0, nil, meta.Mounts)
+}
+
+func (section *nfsSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	meta := &section.ctx.meta.Nfs
+	nusage, _ := usage.(*ss.NfsUsage)
+	if nusage == nil || len(meta.Mounts) == 0 {
+		return
+	}
+
+	printNfsUsage(section.writer, elapsed_time, nusage, meta.Mounts)
+	meta.Available = true
+}
+
+func (section *nfsSection) finish() error {
+	return nil
+}
+
+// netSection has columns of the devices of the first record except the
+// loopback.
+type netSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+
+	devices []string
+}
+
+func newNetSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &netSection{ctx: ctx, writer: writer}
+}
+
+func (section *netSection) begin(first *ss.StatRecord) {
+	meta := &section.ctx.meta.Net
+	if first.Net != nil {
+		for _, entry := range first.Net.Entries {
+			if entry.Name != "lo" {
+				section.devices = append(section.devices, entry.Name)
+			}
+		}
+		sort.Strings(section.devices)
+	}
+	for _, device := range section.devices {
+		speed := int64(-1)
+		if dev, ok := section.ctx.header.NetDevices[device]; ok {
+			speed = dev.Speed
+		}
+		meta.Devices = append(meta.Devices, NetMetaEntry{device, speed})
+	}
+
+	// print column labels
+	printNetUsage(section.writer, 0.0, nil, section.devices)
+}
+
+func (section *netSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	nusage, _ := usage.(*ss.NetUsage)
+	if nusage == nil || len(section.devices) == 0 {
+		return
+	}
+
+	printNetUsage(section.writer, elapsed_time, nusage, section.devices)
+	section.ctx.meta.Net.Available = true
+}
+
+func (section *netSection) finish() error {
+	return nil
+}
+
+// memSection prints the memory stats sampled at `cur`.
+type memSection struct {
+	writer *bufio.Writer
+}
+
+func newMemSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &memSection{writer}
+}
+
+func (section *memSection) begin(first *ss.StatRecord) {
+	// print column labels
+	printMemUsage(section.writer, 0.0, nil)
+}
+
+func (section *memSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	if usage == nil {
+		return
+	}
+
+	printMemUsage(section.writer, elapsed_time, cur.Mem)
+}
+
+func (section *memSection) finish() error {
+	return nil
+}
+
+type vmSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+}
+
+func newVmSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &vmSection{ctx, writer}
+}
+
+func (section *vmSection) begin(first *ss.StatRecord) {
+	// print column labels
+	printVmUsage(section.writer, 0.0, nil)
+}
+
+func (section *vmSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	vusage, _ := usage.(*ss.VmUsage)
+	if vusage == nil {
+		return
+	}
+
+	printVmUsage(section.writer, elapsed_time, vusage)
+	section.ctx.meta.Vm.Available = true
+}
+
+func (section *vmSection) finish() error {
+	return nil
+}
+
+// customSection writes a block of each custom series, whose points are at
+// the time the values were reported. The series are known only after all
+// records are read, so the points are kept until then.
+type customSection struct {
+	ctx    *plotContext
+	writer *bufio.Writer
+
+	points map[string]*strings.Builder
+	series map[string]*ss.CustomSeriesUsage
+}
+
+func newCustomSection(ctx *plotContext, writer *bufio.Writer) plotSection {
+	return &customSection{
+		ctx:    ctx,
+		writer: writer,
+		points: map[string]*strings.Builder{},
+		series: map[string]*ss.CustomSeriesUsage{},
+	}
+}
+
+func (section *customSection) begin(first *ss.StatRecord) {
+	if first.Custom == nil {
+		return
+	}
+	header := section.ctx.header
+	cusage, err := ss.GetCustomUsage(header.CustomMetrics, header.CustomRates, nil, first.Custom)
+	if err == nil {
+		section.addPoints(cusage)
+	}
+}
+
+func (section *customSection) add(elapsed_time float64, prev *ss.StatRecord, cur *ss.StatRecord, usage ss.UsageWriter) {
+	if cusage, _ := usage.(*ss.CustomUsage); cusage != nil {
+		section.addPoints(cusage)
+	}
+}
+
+func (section *customSection) addPoints(cusage *ss.CustomUsage) {
+	for _, series := range cusage.Series {
+		if series.NumSamples == 0 {
+			continue
+		}
+		points, ok := section.points[series.Name]
+		if !ok {
+			points = new(strings.Builder)
+			section.points[series.Name] = points
+			section.series[series.Name] = series
+		}
+		value := series.Value
+		if series.Counter {
+			value = series.Rate
+		}
+		points.WriteString(fmt.Sprintf("%f\t%f\n", series.Time.Sub(section.ctx.t0).Seconds(), value))
+	}
+}
+
+func (section *customSection) finish() error {
+	meta := &section.ctx.meta.Custom
+
+	metric_idxs := map[string]int{}
+	for idx, metric := range section.ctx.header.CustomMetrics {
+		metric_idxs[metric.Name] = idx
+	}
+	names := []string{}
+	for name := range section.series {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		mi := metric_idxs[section.series[names[i]].Metric]
+		mj := metric_idxs[section.series[names[j]].Metric]
+		if mi != mj {
+			return mi < mj
+		}
+		return names[i] < names[j]
+	})
+
+	for idx, name := range names {
+		series := section.series[name]
+		meta.Series = append(meta.Series,
+			CustomMetaEntry{series.Metric, name, series.Counter, idx})
+		unit := ""
+		if series.Counter {
+			unit = " [/sec]"
+		}
+		section.writer.WriteString("\n\n\n")
+		section.writer.WriteString("# series: " + name + unit + "\n")
+		section.writer.WriteString("# elapsed_time\tvalue\n")
+		section.writer.WriteString(section.points[name].String())
+	}
+	meta.Available = len(names) > 0
+
+	return nil
+}
+
 func runPlotFormat(opt *CmdOption) (*PlotMeta, error) {
 	f, err := os.Open(opt.PerfmongerFile)
 	if err != nil {
@@ -325,38 +1336,56 @@ func runPlotFormat(opt *CmdOption) (*PlotMeta, error) {
 	if records[curr].Cpu == nil {
 		return nil, fmt.Errorf("malformed log file: first record has no CPU data")
 	}
-	t0 := records[curr].Time
 	curr ^= 1
 
-	meta_set := false
 	meta := PlotMeta{}
 	meta.StartTime = float64(records[0].Time.UnixNano()) / 1.0e9
 
-	disk_dat_files := map[string]*DiskDatTmpFile{}
-	cpu_dat_files := make([]*CpuDatTmpFile, records[0].Cpu.NumCore)
-	meta.Cpu.NumCore = records[0].Cpu.NumCore
-
-	f, err = os.Create(opt.CpuFile)
-	if err != nil {
-		panic(err)
+	ctx := &plotContext{
+		option: opt,
+		header: (*ss.LinuxHeader)(&pheader),
+		meta:   &meta,
+		t0:     records[0].Time,
 	}
-	defer f.Close()
-	cpu_writer := bufio.NewWriter(f)
-
-	cpu_writer.WriteString("# All cpu usage\n")
-	cpu_writer.WriteString("# elapsed_time\t%usr\t%nice\t%sys\t%iowait\t%hardirq\t%softirq\t%steal\t%guest\t%idle\n")
+	defer func() {
+		for _, tmp_file := range ctx.tmp_files {
+			closeTmpFile(tmp_file)
+		}
+	}()
+
+	// the collectors with a data file, and their sections
+	var collectors []ss.Collector
+	var sections []plotSection
+	var writers []*bufio.Writer
+	collector_option := &ss.CollectorOption{DiskOnly: opt.disk_only_regex}
+	for _, collector := range ss.NewCollectors(collector_option) {
+		def, ok := plot_sections[collector.Name()]
+		if !ok || opt.DataFiles[collector.Name()] == "" {
+			continue
+		}
 
-	f, err = os.Create(opt.MemFile)
-	if err != nil {
-		panic(err)
+		f, err := os.Create(opt.DataFiles[collector.Name()])
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		writer := bufio.NewWriter(f)
+		section := def.new(ctx, writer)
+		section.begin(&records[0])
+
+		collectors = append(collectors, collector)
+		sections = append(sections, section)
+		writers = append(writers, writer)
 	}
-	defer f.Close()
-	mem_writer := bufio.NewWriter(f)
 
 	for {
 		prev_rec := &records[curr^1]
 		cur_rec := &records[curr]
 
+		// decode into a zero record, since gob skips zero values and
+		// fields absent from the stream
+		*cur_rec = ss.StatRecord{}
+
 		err := dec.Decode(cur_rec)
 		if err == io.EOF {
 			break
@@ -364,154 +1393,30 @@ func runPlotFormat(opt *CmdOption) (*PlotMeta, error) {
 			panic(err)
 		}
 
-		// Disk usage
-		dusage, err := ss.GetDiskUsage1(prev_rec.Time, prev_rec.Disk,
-			cur_rec.Time, cur_rec.Disk,
-			opt.disk_only_regex)
-		if err != nil {
-			panic(err)
-		}
-		didx := 0
-
-		var dnames []string
-		for dname, _ := range *dusage {
-			if dname != "total" {
-				dnames = append(dnames, dname)
+		elapsed_time := prev_rec.Time.Sub(ctx.t0).Seconds()
+		for idx, collector := range collectors {
+			// a usage which fails is left out of the plot
+			usage, err := collector.Usage(ctx.header, prev_rec, cur_rec)
+			if err != nil {
+				usage = nil
 			}
+			sections[idx].add(elapsed_time, prev_rec, cur_rec, usage)
 		}
-		sort.Strings(dnames)
-		dnames = append(dnames, "total")
-
-		// for dname, dusage_entry := range *dusage {
-		for _, dname := range dnames {
-			dusage_entry, ok := (*dusage)[dname]
-			if !ok {
-				panic("device '" + dname + "' not found")
-			}
-
-			if !meta_set {
-				meta.Disk.Devices =
-					append(meta.Disk.Devices,
-						DiskMetaEntry{Name: dname, Idx: didx})
-			}
-
-			disk_dat, ok := disk_dat_files[dname]
-			if !ok {
-				disk_dat = makeDiskDatTmpFile(dname, didx)
-				disk_dat_files[dname] = disk_dat
-				defer closeTmpFile(disk_dat.File)
-
-				disk_dat.Writer.WriteString("\n\n\n")
-				disk_dat.Writer.WriteString("# device: " + disk_dat.Name + "\n")
-				disk_dat.Writer.WriteString(fmt.Sprintln(
-					"# elapsed_time\tr_iops\tw_iops\tr_MB/s\tw_MB/s\tr_latency\tw_latency\tr_avgsz\tw_avgsz\tqdepth"))
-			}
-
-			elapsed_time := prev_rec.Time.Sub(t0).Seconds()
-			disk_dat.Writer.WriteString(
-				fmt.Sprintf("%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\n",
-					elapsed_time,
-					dusage_entry.RdIops,
-					dusage_entry.WrIops,
-					dusage_entry.RdSecps*512.0/1024.0/1024.0,
-					dusage_entry.WrSecps*512.0/1024.0/1024.0,
-					dusage_entry.RdLatency,
-					dusage_entry.WrLatency,
-					dusage_entry.AvgRdSize,
-					dusage_entry.AvgWrSize,
-					dusage_entry.ReqQlen))
-
-			didx += 1
-		}
-
-		// Cpu usage
-		cusage, err := ss.GetCpuUsage(prev_rec.Cpu, cur_rec.Cpu)
-		if err != nil {
-			panic(err)
-		}
-		for coreid, coreusage := range cusage.CoreUsages {
-			cpu_dat := cpu_dat_files[coreid]
-			if cpu_dat == nil {
-				cpu_dat = makeCpuDatTmpFile(coreid)
-				cpu_dat_files[coreid] = cpu_dat
-				defer closeTmpFile(cpu_dat.File)
-
-				cpu_dat.Writer.WriteString(fmt.Sprintf("\n\n\n# core: %d\n", coreid))
-				cpu_dat.Writer.WriteString("# elapsed_time\t%usr\t%nice\t%sys\t%iowait\t%hardirq\t%softirq\t%steal\t%guest\t%idle\n")
-			}
-
-			printCoreUsage(cpu_dat.Writer, prev_rec.Time.Sub(t0).Seconds(), coreusage)
-		}
-		printCoreUsage(cpu_writer, prev_rec.Time.Sub(t0).Seconds(), cusage.All)
-
-		if !meta_set {
-			// print column labels
-			printMemUsage(mem_writer, prev_rec.Time.Sub(t0).Seconds(), nil)
-		}
-		printMemUsage(mem_writer, prev_rec.Time.Sub(t0).Seconds(), cur_rec.Mem)
 
 		curr ^= 1
-		meta_set = true
 	}
 
 	meta.EndTime = float64(records[curr^1].Time.UnixNano()) / 1.0e9
 
-	for _, disk_dat := range disk_dat_files {
-		// Flush buffered data to the temp file. The handle itself is closed
-		// exactly once by the deferred close registered at creation time, so
-		// it is intentionally not closed here (avoids an FD-reuse hazard).
-		if err := flushWriter(disk_dat.Writer); err != nil {
-			return nil, fmt.Errorf("failed to flush disk data for device %q: %v", disk_dat.Name, err)
-		}
-	}
-
-	f, err = os.Create(opt.DiskFile)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-	df_writer := bufio.NewWriter(f)
-
-	for _, dev := range meta.Disk.Devices {
-		disk_dat, ok := disk_dat_files[dev.Name]
-		if !ok {
-			panic(dev.Name)
-		}
-
-		content, err := ioutil.ReadFile(disk_dat.Path)
-		if err != nil {
-			panic(err)
-		}
-
-		df_writer.Write(content)
-
-		os.Remove(disk_dat.Path)
-	}
-	if err := flushWriter(df_writer); err != nil {
-		return nil, fmt.Errorf("failed to flush disk data file %q: %v", opt.DiskFile, err)
-	}
-
-	for _, cpu_dat := range cpu_dat_files {
-		// Flush buffered data; the handle is closed exactly once by the
-		// deferred close registered at creation time (avoids double-close).
-		if err := flushWriter(cpu_dat.Writer); err != nil {
-			return nil, fmt.Errorf("failed to flush cpu data for core %d: %v", cpu_dat.CoreId, err)
+	for idx, collector := range collectors {
+		if err := sections[idx].finish(); err != nil {
+			return nil, err
 		}
-
-		content, err := ioutil.ReadFile(cpu_dat.Path)
-		if err != nil {
-			panic(err)
+		if err := flushWriter(writers[idx]); err != nil {
+			return nil, fmt.Errorf("failed to flush %s data file %q: %v",
+				collector.Name(), opt.DataFiles[collector.Name()], err)
 		}
-
-		cpu_writer.Write(content)
-		os.Remove(cpu_dat.Path)
-	}
-	if err := flushWriter(cpu_writer); err != nil {
-		return nil, fmt.Errorf("failed to flush cpu data file %q: %v", opt.CpuFile, err)
-	}
-	if err := flushWriter(mem_writer); err != nil {
-		return nil, fmt.Errorf("failed to flush mem data file %q: %v", opt.MemFile, err)
 	}
 
 	return &meta, nil
-}
\ No newline at end of file
+}
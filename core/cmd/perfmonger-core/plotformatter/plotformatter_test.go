@@ -52,9 +52,11 @@ func TestRunPlotFormatClosesTmpFilesOnce(t *testing.T) {
 
 	tmpDir := t.TempDir()
 	opt := &CmdOption{
-		DiskFile:       filepath.Join(tmpDir, "disk.dat"),
-		CpuFile:        filepath.Join(tmpDir, "cpu.dat"),
-		MemFile:        filepath.Join(tmpDir, "mem.dat"),
+		DataFiles: map[string]string{
+			"disk": filepath.Join(tmpDir, "disk.dat"),
+			"cpu":  filepath.Join(tmpDir, "cpu.dat"),
+			"mem":  filepath.Join(tmpDir, "mem.dat"),
+		},
 		PerfmongerFile: pgr,
 	}
 
@@ -103,9 +105,11 @@ func TestRunPlotFormatNilCpuReturnsError(t *testing.T) {
 	}
 
 	opt := &CmdOption{
-		DiskFile:       filepath.Join(tmpDir, "disk.dat"),
-		CpuFile:        filepath.Join(tmpDir, "cpu.dat"),
-		MemFile:        filepath.Join(tmpDir, "mem.dat"),
+		DataFiles: map[string]string{
+			"disk": filepath.Join(tmpDir, "disk.dat"),
+			"cpu":  filepath.Join(tmpDir, "cpu.dat"),
+			"mem":  filepath.Join(tmpDir, "mem.dat"),
+		},
 		PerfmongerFile: logPath,
 	}
 
@@ -131,9 +135,11 @@ func TestRunPlotFormatPropagatesFlushError(t *testing.T) {
 
 	tmpDir := t.TempDir()
 	opt := &CmdOption{
-		DiskFile:       filepath.Join(tmpDir, "disk.dat"),
-		CpuFile:        filepath.Join(tmpDir, "cpu.dat"),
-		MemFile:        filepath.Join(tmpDir, "mem.dat"),
+		DataFiles: map[string]string{
+			"disk": filepath.Join(tmpDir, "disk.dat"),
+			"cpu":  filepath.Join(tmpDir, "cpu.dat"),
+			"mem":  filepath.Join(tmpDir, "mem.dat"),
+		},
 		PerfmongerFile: pgr,
 	}
 
@@ -145,3 +151,112 @@ func TestRunPlotFormatPropagatesFlushError(t *testing.T) {
 		t.Errorf("error %q does not wrap the underlying flush error %q", err, wantErr)
 	}
 }
+
+// TestRunPlotFormatWithoutVmStat verifies that a log recorded without vmstat
+// yields a vm.dat with only column labels and the vm panel marked unavailable,
+// so that the plot command skips it instead of feeding gnuplot an empty file.
+func TestRunPlotFormatWithoutVmStat(t *testing.T) {
+	root := findRepoRoot(t)
+	pgr := filepath.Join(root, "spec", "data", "busy100.pgr")
+
+	tmpDir := t.TempDir()
+	opt := &CmdOption{
+		DataFiles: map[string]string{
+			"disk":    filepath.Join(tmpDir, "disk.dat"),
+			"cpu":     filepath.Join(tmpDir, "cpu.dat"),
+			"mem":     filepath.Join(tmpDir, "mem.dat"),
+			"vm":      filepath.Join(tmpDir, "vm.dat"),
+			"cpufreq": filepath.Join(tmpDir, "freq.dat"),
+			"cpuidle": filepath.Join(tmpDir, "cpuidle.dat"),
+			"net":     filepath.Join(tmpDir, "net.dat"),
+		},
+		PerfmongerFile: pgr,
+	}
+
+	meta, err := runPlotFormat(opt)
+	if err != nil {
+		t.Fatalf("runPlotFormat failed: %v", err)
+	}
+	if meta.Vm.Available {
+		t.Error("meta.Vm.Available = true, want false for a log without vmstat")
+	}
+	if meta.CpuFreq.Available {
+		t.Error("meta.CpuFreq.Available = true, want false for a log without cpufreq")
+	}
+	if meta.CpuIdle.Available {
+		t.Error("meta.CpuIdle.Available = true, want false for a log without cpuidle")
+	}
+	// busy100.pgr has net stats of eth0 and lo but no link metadata
+	if !meta.Net.Available || len(meta.Net.Devices) != 1 ||
+		meta.Net.Devices[0].Name != "eth0" || meta.Net.Devices[0].Speed != -1 {
+		t.Errorf("meta.Net = %+v, want eth0 without link speed", meta.Net)
+	}
+
+	content, err := os.ReadFile(opt.DataFiles["vm"])
+	if err != nil {
+		t.Fatalf("read vm.dat: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "#elapsed_time") {
+		t.Errorf("vm.dat = %q, want only the column label line", string(content))
+	}
+}
+
+// TestRunPlotFormatZeroProcGauges verifies that run queue figures and load
+// average which drop to 0 are written as 0 to proc.dat.
+func TestRunPlotFormatZeroProcGauges(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "proc.pgr")
+
+	f, err := os.Create(logPath)
+	if err != nil {
+		t.Fatalf("create log: %v", err)
+	}
+	enc := gob.NewEncoder(f)
+	t0 := time.Now()
+	if err := enc.Encode(&ss.CommonHeader{StartTime: t0}); err != nil {
+		t.Fatalf("encode common header: %v", err)
+	}
+	if err := enc.Encode(&ss.PlatformHeader{}); err != nil {
+		t.Fatalf("encode platform header: %v", err)
+	}
+	for idx, n := range []int64{4, 3, 0} {
+		rec := ss.StatRecord{
+			Time: t0.Add(time.Duration(idx) * time.Second),
+			Cpu:  ss.NewCpuStat(1),
+			Disk: &ss.DiskStat{Entries: []*ss.DiskStatEntry{{Name: "sda"}}},
+			Mem:  ss.NewMemStat(),
+			Proc: &ss.ProcStat{ProcsRunning: n, ProcsBlocked: n,
+				LoadAvg: &ss.LoadAvgStat{Load1: float64(n)}},
+		}
+		if err := enc.Encode(&rec); err != nil {
+			t.Fatalf("encode record: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close log: %v", err)
+	}
+
+	opt := &CmdOption{
+		DataFiles: map[string]string{
+			"disk": filepath.Join(tmpDir, "disk.dat"),
+			"cpu":  filepath.Join(tmpDir, "cpu.dat"),
+			"mem":  filepath.Join(tmpDir, "mem.dat"),
+			"proc": filepath.Join(tmpDir, "proc.dat"),
+		},
+		PerfmongerFile: logPath,
+	}
+	if _, err := runPlotFormat(opt); err != nil {
+		t.Fatalf("runPlotFormat failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opt.DataFiles["proc"])
+	if err != nil {
+		t.Fatalf("read proc.dat: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	fields := strings.Split(lines[len(lines)-1], "\t")
+	if len(lines) != 3 || fields[4] != "0" || fields[5] != "0" || fields[6] != "0.000000" {
+		t.Errorf("proc.dat = %q, want procs_running, procs_blocked and loadavg1 0 in the last row", string(content))
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"os/signal"
 	"os/user"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,22 +36,86 @@ type RecorderOption struct {
 	Output             string
 	NoCPU              bool
 	NoIntr             bool
+	NoSoftirq          bool
 	NoDisk             bool
 	NoNet              bool
 	NoMem              bool
+	NoVm               bool
+	NoNetProto         bool
+	NoPressure         bool
+	NoFs               bool
 	Debug              bool
 	ListDevices        bool
 	PlayerBin          string
 	PlayerArgs         []string
 	Disks              string
 	TargetDisks        *map[string]bool
+	NetOnly            string        // regex of network interfaces to be recorded
+	NetExclude         string        // regex of network interfaces not to be recorded
+	MountOnly          string        // regex of mount points to be recorded
+	MountExclude       string        // regex of mount points not to be recorded
+	Cgroups            []string      // cgroup v2 paths relative to /sys/fs/cgroup
+	ProcRoot           string        // where procfs is mounted, e.g. /host/proc
+	SysRoot            string        // where sysfs is mounted, e.g. /host/sys
+	ExecMetrics        []string      // "NAME=COMMAND" run every ExecMetricEvery records
+	ExecMetricStreams  []string      // "NAME=COMMAND" of long-lived commands
+	ExecMetricEvery    int
+	ExecMetricRates    []string      // patterns of custom series which are counters
 	Background         bool
 	Gzip               bool
 	Color              bool
 	Pretty             bool
 	StopCh             chan struct{} // External stop signal (closed to stop recording)
+	TargetPidCh        chan int      // PID of a process tree to be recorded (sent once)
+
+	// --no-<name> of collectors without a dedicated field above
+	NoCollectors map[string]*bool
+}
+
+// NoCollector returns the flag disabling the collector `name`, so that the
+// --no-<name> options can be generated from the collector registry. The
+// collectors which had a --no-<name> option before the registry keep their
+// field above.
+func (option *RecorderOption) NoCollector(name string) *bool {
+	switch name {
+	case "cpu":
+		return &option.NoCPU
+	case "intr":
+		return &option.NoIntr
+	case "softirq":
+		return &option.NoSoftirq
+	case "disk":
+		return &option.NoDisk
+	case "net":
+		return &option.NoNet
+	case "mem":
+		return &option.NoMem
+	case "vm":
+		return &option.NoVm
+	case "netproto":
+		return &option.NoNetProto
+	case "pressure":
+		return &option.NoPressure
+	case "fs":
+		return &option.NoFs
+	}
+
+	if option.NoCollectors == nil {
+		option.NoCollectors = make(map[string]*bool)
+	}
+	if _, ok := option.NoCollectors[name]; !ok {
+		option.NoCollectors[name] = new(bool)
+	}
+	return option.NoCollectors[name]
 }
 
+// Environment variables giving the default ProcRoot and SysRoot, so that a
+// containerized perfmonger can monitor its host without extra flags.
+const (
+	ProcRootEnvKey = "PERFMONGER_PROCFS"
+	SysRootEnvKey  = "PERFMONGER_SYSFS"
+)
+
 // signalNotify and signalStop wrap the os/signal package functions so that
 // signal registration/teardown can be observed in tests.
 var (
@@ -80,16 +145,10 @@ func parseArgs(args []string, option *RecorderOption) {
 		time.Second*0, "Wait time before measurement")
 	fs.StringVar(&option.Output, "output",
 		"-", "Output file name")
-	fs.BoolVar(&option.NoCPU, "no-cpu",
-		false, "Do not record CPU usage")
-	fs.BoolVar(&option.NoIntr, "no-intr",
-		false, "Do not record interrupts count")
-	fs.BoolVar(&option.NoDisk, "no-disk",
-		false, "Do not record disk usage")
-	fs.BoolVar(&option.NoNet, "no-net",
-		false, "Do not record net usage")
-	fs.BoolVar(&option.NoMem, "no-mem",
-		false, "Do not record memory usage")
+	for _, collector := range ss.NewCollectors(nil) {
+		fs.BoolVar(option.NoCollector(collector.Name()), "no-"+collector.Name(),
+			false, "Do not record "+collector.Description())
+	}
 	fs.BoolVar(&option.Debug, "debug",
 		false, "Enable debug mode")
 	fs.BoolVar(&option.ListDevices, "list-devices",
@@ -98,6 +157,18 @@ func parseArgs(args []string, option *RecorderOption) {
 		false, "Run in background mode")
 	fs.StringVar(&option.Disks, "disks",
 		"", "Disk devices to be monitored")
+	fs.StringVar(&option.NetOnly, "net-only",
+		"", "Select network interfaces by regex")
+	fs.StringVar(&option.NetExclude, "net-exclude",
+		"", "Exclude network interfaces by regex")
+	fs.StringVar(&option.MountOnly, "mount-only",
+		"", "Select mount points by regex")
+	fs.StringVar(&option.MountExclude, "mount-exclude",
+		"", "Exclude mount points by regex")
+	fs.StringVar(&option.ProcRoot, "procfs",
+		option.ProcRoot, "Root of procfs to be read")
+	fs.StringVar(&option.SysRoot, "sysfs",
+		option.SysRoot, "Root of sysfs to be read")
 	fs.StringVar(&option.PlayerBin, "player-bin",
 		"", "Run perfmonger-player to show JSON output")
 	fs.BoolVar(&option.Gzip, "gzip",
@@ -150,6 +221,125 @@ func BuildTargetDisks(disks string) *map[string]bool {
 	return targets
 }
 
+// BuildNetFilter compiles the --net-only and --net-exclude regexes. An empty
+// pattern yields a nil regexp, which ReadNetStat1 interprets as no filter.
+func BuildNetFilter(net_only string, net_exclude string) (*regexp.Regexp, *regexp.Regexp, error) {
+	var only, exclude *regexp.Regexp
+	var err error
+
+	if net_only != "" {
+		only, err = regexp.Compile(net_only)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid net-only regex: %v", err)
+		}
+	}
+	if net_exclude != "" {
+		exclude, err = regexp.Compile(net_exclude)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid net-exclude regex: %v", err)
+		}
+	}
+
+	return only, exclude, nil
+}
+
+// BuildMountFilter compiles the --mount-only and --mount-exclude regexes. An
+// empty pattern yields a nil regexp, which ReadMounts interprets as no filter.
+func BuildMountFilter(mount_only string, mount_exclude string) (*regexp.Regexp, *regexp.Regexp, error) {
+	var only, exclude *regexp.Regexp
+	var err error
+
+	if mount_only != "" {
+		only, err = regexp.Compile(mount_only)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid mount-only regex: %v", err)
+		}
+	}
+	if mount_exclude != "" {
+		exclude, err = regexp.Compile(mount_exclude)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid mount-exclude regex: %v", err)
+		}
+	}
+
+	return only, exclude, nil
+}
+
+// CheckRoots verifies that the procfs and sysfs roots are directories, since
+// NewPlatformHeader cannot do without them.
+func CheckRoots(proc_root string, sys_root string) error {
+	if fi, err := os.Stat(proc_root); err != nil || !fi.IsDir() {
+		return fmt.Errorf("procfs root is not a directory: %s", proc_root)
+	}
+	if fi, err := os.Stat(sys_root); err != nil || !fi.IsDir() {
+		return fmt.Errorf("sysfs root is not a directory: %s", sys_root)
+	}
+
+	return nil
+}
+
+var custom_metric_name_re = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// BuildCustomMetrics converts the NAME=COMMAND specs of --exec-metric and
+// --exec-metric-stream into the metrics of the exec collector, and checks
+// --exec-metric-every and the patterns of --exec-metric-rate.
+func BuildCustomMetrics(execs []string, streams []string, every int, rates []string) ([]ss.LinuxCustomMetric, error) {
+	if every <= 0 {
+		return nil, fmt.Errorf("exec-metric-every must be positive")
+	}
+	for _, pattern := range rates {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exec-metric-rate pattern: %s", pattern)
+		}
+	}
+
+	var metrics []ss.LinuxCustomMetric = nil
+	names := make(map[string]bool)
+	add := func(flag string, spec string, stream bool) error {
+		eq := strings.Index(spec, "=")
+		if eq < 0 || strings.TrimSpace(spec[eq+1:]) == "" {
+			return fmt.Errorf("%s must be NAME=COMMAND: %s", flag, spec)
+		}
+		name := spec[:eq]
+		if !custom_metric_name_re.MatchString(name) {
+			return fmt.Errorf("%s name must consist of letters, digits, '_' and '-': %s", flag, name)
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate exec-metric name: %s", name)
+		}
+		names[name] = true
+
+		metrics = append(metrics, ss.LinuxCustomMetric{
+			Name:    name,
+			Command: spec[eq+1:],
+			Stream:  stream,
+			Every:   every,
+		})
+		return nil
+	}
+	for _, spec := range execs {
+		if err := add("exec-metric", spec, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range streams {
+		if err := add("exec-metric-stream", spec, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// envOrDefault returns the value of environment variable `key`, or
+// `default_value` if it is unset or empty.
+func envOrDefault(key string, default_value string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return default_value
+}
+
 // NewRecorderOption creates a RecorderOption with default values
 func NewRecorderOption() *RecorderOption {
 	return &RecorderOption{
@@ -161,15 +351,31 @@ func NewRecorderOption() *RecorderOption {
 		Output:             "-",
 		NoCPU:              false,
 		NoIntr:             false,
+		NoSoftirq:          false,
 		NoDisk:             false,
 		NoNet:              false,
 		NoMem:              false,
+		NoVm:               false,
+		NoNetProto:         false,
+		NoPressure:         false,
+		NoFs:               false,
 		Debug:              false,
 		ListDevices:        false,
 		PlayerBin:          "",
 		PlayerArgs:         []string{},
 		Disks:              "",
 		TargetDisks:        nil,
+		NetOnly:            "",
+		NetExclude:         "",
+		MountOnly:          "",
+		MountExclude:       "",
+		Cgroups:            []string{},
+		ProcRoot:           envOrDefault(ProcRootEnvKey, "/proc"),
+		SysRoot:            envOrDefault(SysRootEnvKey, "/sys"),
+		ExecMetrics:        []string{},
+		ExecMetricStreams:  []string{},
+		ExecMetricEvery:    1,
+		ExecMetricRates:    []string{},
 		Background:         false,
 		Gzip:               false,
 		Color:              false,
@@ -188,9 +394,14 @@ func showRecorderOption(option *RecorderOption) {
 	fmt.Fprintf(os.Stderr, "Output: %s\n", option.Output)
 	fmt.Fprintf(os.Stderr, "NoCPU: %t\n", option.NoCPU)
 	fmt.Fprintf(os.Stderr, "NoIntr: %t\n", option.NoIntr)
+	fmt.Fprintf(os.Stderr, "NoSoftirq: %t\n", option.NoSoftirq)
 	fmt.Fprintf(os.Stderr, "NoDisk: %t\n", option.NoDisk)
 	fmt.Fprintf(os.Stderr, "NoNet: %t\n", option.NoNet)
 	fmt.Fprintf(os.Stderr, "NoMem: %t\n", option.NoMem)
+	fmt.Fprintf(os.Stderr, "NoVm: %t\n", option.NoVm)
+	fmt.Fprintf(os.Stderr, "NoNetProto: %t\n", option.NoNetProto)
+	fmt.Fprintf(os.Stderr, "NoPressure: %t\n", option.NoPressure)
+	fmt.Fprintf(os.Stderr, "NoFs: %t\n", option.NoFs)
 	fmt.Fprintf(os.Stderr, "Debug: %t\n", option.Debug)
 	fmt.Fprintf(os.Stderr, "ListDevices: %t\n", option.ListDevices)
 	fmt.Fprintf(os.Stderr, "PlayerBin: %s\n", option.PlayerBin)
@@ -200,6 +411,17 @@ func showRecorderOption(option *RecorderOption) {
 	} else {
 		fmt.Fprintf(os.Stderr, "TargetDisks: nil\n")
 	}
+	fmt.Fprintf(os.Stderr, "NetOnly: %s\n", option.NetOnly)
+	fmt.Fprintf(os.Stderr, "NetExclude: %s\n", option.NetExclude)
+	fmt.Fprintf(os.Stderr, "MountOnly: %s\n", option.MountOnly)
+	fmt.Fprintf(os.Stderr, "MountExclude: %s\n", option.MountExclude)
+	fmt.Fprintf(os.Stderr, "Cgroups: %v\n", option.Cgroups)
+	fmt.Fprintf(os.Stderr, "ProcRoot: %s\n", option.ProcRoot)
+	fmt.Fprintf(os.Stderr, "SysRoot: %s\n", option.SysRoot)
+	fmt.Fprintf(os.Stderr, "ExecMetrics: %v\n", option.ExecMetrics)
+	fmt.Fprintf(os.Stderr, "ExecMetricStreams: %v\n", option.ExecMetricStreams)
+	fmt.Fprintf(os.Stderr, "ExecMetricEvery: %d\n", option.ExecMetricEvery)
+	fmt.Fprintf(os.Stderr, "ExecMetricRates: %v\n", option.ExecMetricRates)
 	fmt.Fprintf(os.Stderr, "Background: %t\n", option.Background)
 	fmt.Fprintf(os.Stderr, "Gzip: %t\n", option.Gzip)
 	fmt.Fprintf(os.Stderr, "Color: %t\n", option.Color)
@@ -397,7 +619,34 @@ func RunDirect(option *RecorderOption) {
 	hostname, _ := os.Hostname()
 	cheader := &ss.CommonHeader{Platform: ss.Linux, Hostname: hostname, StartTime: time.Now()}
 
-	platform_header := ss.NewPlatformHeader()
+	net_only, net_exclude, err := BuildNetFilter(option.NetOnly, option.NetExclude)
+	if err != nil {
+		panic(err)
+	}
+	mount_only, mount_exclude, err := BuildMountFilter(option.MountOnly, option.MountExclude)
+	if err != nil {
+		panic(err)
+	}
+	custom_metrics, err := BuildCustomMetrics(option.ExecMetrics, option.ExecMetricStreams,
+		option.ExecMetricEvery, option.ExecMetricRates)
+	if err != nil {
+		panic(err)
+	}
+
+	roots := ss.NewRoots(option.ProcRoot, option.SysRoot)
+	all_collectors := ss.NewCollectors(&ss.CollectorOption{
+		Roots:         roots,
+		TargetDisks:   option.TargetDisks,
+		NetOnly:       net_only,
+		NetExclude:    net_exclude,
+		MountOnly:     mount_only,
+		MountExclude:  mount_exclude,
+		Cgroups:       option.Cgroups,
+		TargetPid:     option.TargetPidCh,
+		CustomMetrics: custom_metrics,
+		CustomRates:   option.ExecMetricRates,
+	})
+	platform_header := ss.NewPlatformHeaderOf(all_collectors)
 
 	if option.ListDevices {
 		for _, name := range platform_header.DevsParts {
@@ -406,6 +655,16 @@ func RunDirect(option *RecorderOption) {
 		return
 	}
 
+	collectors := []ss.Collector{}
+	for _, collector := range all_collectors {
+		if !*option.NoCollector(collector.Name()) {
+			collectors = append(collectors, collector)
+			if closer, ok := collector.(io.Closer); ok {
+				defer closer.Close()
+			}
+		}
+	}
+
 	var player_cmd *exec.Cmd = nil
 	var player_stdin io.WriteCloser = nil
 	var player_stdout io.ReadCloser = nil
@@ -510,6 +769,9 @@ func RunDirect(option *RecorderOption) {
 	next_time := time.Now()
 	record := ss.NewStatRecord()
 	backoff_counter := 0
+	// a collector which fails once likely fails at every sample, so only
+	// its first failure is reported
+	failed := make(map[string]bool)
 
 	// cause SIGINT or SIGTERM to break the loop. SIGTERM is the signal sent by
 	// systemd, container runtimes, and a plain `kill <pid>`, so it must be
@@ -524,20 +786,12 @@ func RunDirect(option *RecorderOption) {
 	for {
 		record.Time = time.Now()
 
-		if !option.NoCPU {
-			ss.ReadCpuStat(record)
-		}
-		if !option.NoIntr {
-			ss.ReadInterruptStat(record)
-		}
-		if !option.NoDisk {
-			ss.ReadDiskStats(record, option.TargetDisks)
-		}
-		if !option.NoNet {
-			ss.ReadNetStat(record)
-		}
-		if !option.NoMem {
-			ss.ReadMemStat(record)
+		for _, collector := range collectors {
+			serr := collector.Sample(platform_header, record)
+			if serr != nil && !failed[collector.Name()] {
+				fmt.Fprintf(os.Stderr, "Failed to record %s: %v\n", collector.Name(), serr)
+				failed[collector.Name()] = true
+			}
 		}
 
 		// Encode the record and flush it to durable storage. If either the
@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
 	"syscall"
 	"testing"
@@ -363,3 +364,81 @@ func TestBuildTargetDisks(t *testing.T) {
 		t.Fatalf("BuildTargetDisks(\"sda\") = %v, want {sda:true}", single)
 	}
 }
+
+func TestNewRecorderOptionRoots(t *testing.T) {
+	t.Setenv(ProcRootEnvKey, "")
+	t.Setenv(SysRootEnvKey, "")
+	option := NewRecorderOption()
+	if option.ProcRoot != "/proc" || option.SysRoot != "/sys" {
+		t.Errorf("roots = %q, %q, want /proc and /sys", option.ProcRoot, option.SysRoot)
+	}
+
+	t.Setenv(ProcRootEnvKey, "/host/proc")
+	t.Setenv(SysRootEnvKey, "/host/sys")
+	option = NewRecorderOption()
+	if option.ProcRoot != "/host/proc" || option.SysRoot != "/host/sys" {
+		t.Errorf("roots = %q, %q, want the environment variables", option.ProcRoot, option.SysRoot)
+	}
+
+	if err := CheckRoots(t.TempDir(), t.TempDir()); err != nil {
+		t.Errorf("CheckRoots returned an error: %v", err)
+	}
+	if err := CheckRoots("/host/proc", t.TempDir()); err == nil {
+		t.Error("CheckRoots should fail with a missing procfs root")
+	}
+}
+
+func TestBuildCustomMetrics(t *testing.T) {
+	metrics, err := BuildCustomMetrics(
+		[]string{"app=curl -s http://localhost/stats"},
+		[]string{"log=tail -F app.log | grep -c x"}, 5, []string{"app.*"})
+	if err != nil {
+		t.Fatalf("BuildCustomMetrics returned an error: %v", err)
+	}
+	want := []ss.LinuxCustomMetric{
+		{Name: "app", Command: "curl -s http://localhost/stats", Every: 5},
+		{Name: "log", Command: "tail -F app.log | grep -c x", Stream: true, Every: 5},
+	}
+	if !reflect.DeepEqual(metrics, want) {
+		t.Errorf("metrics = %+v, want %+v", metrics, want)
+	}
+
+	metrics, err = BuildCustomMetrics([]string{}, []string{}, 1, []string{})
+	if err != nil || metrics != nil {
+		t.Errorf("BuildCustomMetrics without specs = %v, %v", metrics, err)
+	}
+
+	errs := []struct {
+		execs   []string
+		streams []string
+		every   int
+		rates   []string
+	}{
+		{[]string{"app="}, nil, 1, nil},
+		{[]string{"app.x=true"}, nil, 1, nil},
+		{[]string{"app=true"}, []string{"app=true"}, 1, nil},
+		{[]string{"app=true"}, nil, 0, nil},
+		{[]string{"app=true"}, nil, 1, []string{"app.["}},
+	}
+	for _, e := range errs {
+		if _, err := BuildCustomMetrics(e.execs, e.streams, e.every, e.rates); err == nil {
+			t.Errorf("BuildCustomMetrics(%v, %v, %d, %v) should fail", e.execs, e.streams, e.every, e.rates)
+		}
+	}
+}
+
+func TestNoCollector(t *testing.T) {
+	option := NewRecorderOption()
+	if option.NoCollector("cpu") != &option.NoCPU || option.NoCollector("net") != &option.NoNet {
+		t.Error("NoCollector should return the dedicated fields")
+	}
+
+	no_fake := option.NoCollector("fake")
+	if no_fake == nil || *no_fake {
+		t.Fatalf("NoCollector(\"fake\") = %v, want a false flag", no_fake)
+	}
+	*no_fake = true
+	if !*option.NoCollector("fake") {
+		t.Error("NoCollector should return the same flag for a name")
+	}
+}
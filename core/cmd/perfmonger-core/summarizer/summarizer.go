@@ -8,6 +8,8 @@ import (
 	"os"
 	"regexp"
 	"sort"
+	"strings"
+	"time"
 
 	projson "github.com/hayamiz/go-projson"
 	ss "github.com/hayamiz/perfmonger/core/internal/perfmonger"
@@ -21,6 +23,15 @@ type SummaryOption struct {
 	JSON          bool
 	DiskOnly      string
 	DiskOnlyRegex *regexp.Regexp
+
+	NetOnly         string
+	NetOnlyRegex    *regexp.Regexp
+	NetExclude      string
+	NetExcludeRegex *regexp.Regexp
+
+	// Peak RSS of the command in KB reported by wait(2), which also covers
+	// a command that exited before the recorder could sample it.
+	MaxRss int64
 }
 
 func parseArgs(args []string, option *SummaryOption) {
@@ -34,6 +45,10 @@ func parseArgs(args []string, option *SummaryOption) {
 		"", "Title of summary")
 	fs.StringVar(&option.DiskOnly, "disk-only",
 		"", "Select disk devices by regex")
+	fs.StringVar(&option.NetOnly, "net-only",
+		"", "Select network interfaces by regex")
+	fs.StringVar(&option.NetExclude, "net-exclude",
+		"", "Exclude network interfaces by regex")
 
 	fs.Parse(args)
 
@@ -58,6 +73,13 @@ func NewSummaryOption() *SummaryOption {
 		JSON:          false,
 		DiskOnly:      "",
 		DiskOnlyRegex: nil,
+
+		NetOnly:         "",
+		NetOnlyRegex:    nil,
+		NetExclude:      "",
+		NetExcludeRegex: nil,
+
+		MaxRss: 0,
 	}
 }
 
@@ -94,6 +116,20 @@ func RunDirect(option *SummaryOption, out io.Writer) error {
 		}
 		option.DiskOnlyRegex = re
 	}
+	if option.NetOnlyRegex == nil && option.NetOnly != "" {
+		re, err := regexp.Compile(option.NetOnly)
+		if err != nil {
+			return err
+		}
+		option.NetOnlyRegex = re
+	}
+	if option.NetExcludeRegex == nil && option.NetExclude != "" {
+		re, err := regexp.Compile(option.NetExclude)
+		if err != nil {
+			return err
+		}
+		option.NetExcludeRegex = re
+	}
 
 	f, err := os.Open(option.Logfile)
 	if err != nil {
@@ -128,20 +164,35 @@ func RunDirect(option *SummaryOption, out io.Writer) error {
 		return err
 	}
 
+	collectors := ss.NewCollectors(&ss.CollectorOption{
+		DiskOnly:   option.DiskOnlyRegex,
+		NetOnly:    option.NetOnlyRegex,
+		NetExclude: option.NetExcludeRegex,
+	})
+	summaries := make([]ss.Summary, len(collectors))
+	for i, collector := range collectors {
+		summaries[i] = ss.NewSummary(collector, (*ss.LinuxHeader)(&pheader))
+		summaries[i].Add(nil, &fst_record)
+	}
+
 	// loop until last line.
 	//
 	// lst_records is a two-element ping-pong buffer; each successful decode
 	// lands in lst_records[idx] and then idx flips, so the slot opposite to
-	// idx holds the most recently decoded record. The buffer is left
-	// un-seeded: gob.Decode reuses (rather than fully overwrites) maps and
-	// slices in the destination, so pre-populating a slot would let stale
-	// fields from an earlier record leak into a later one. To still handle a
+	// idx holds the most recently decoded record. gob.Decode reuses (rather
+	// than fully overwrites) maps, slices and pointees in the destination and
+	// skips zero values, so a slot is zeroed before each decode lest stale
+	// fields from an earlier record leak into a later one. To handle a
 	// single-record log, track whether the loop decoded anything and fall
 	// back to fst_record when it did not.
 	var lst_records [2]ss.StatRecord
 	idx := 0
 	decoded := false
+	prev_rec := &fst_record
+
 	for {
+		lst_records[idx] = ss.StatRecord{}
+
 		err = dec.Decode(&lst_records[idx])
 		if err == io.EOF {
 			break
@@ -149,6 +200,11 @@ func RunDirect(option *SummaryOption, out io.Writer) error {
 			return err
 		}
 
+		for _, summary := range summaries {
+			summary.Add(prev_rec, &lst_records[idx])
+		}
+		prev_rec = &lst_records[idx]
+
 		decoded = true
 		idx ^= 1
 	}
@@ -161,35 +217,30 @@ func RunDirect(option *SummaryOption, out io.Writer) error {
 		lst_record = lst_records[idx^1]
 	}
 
-	var cpu_usage *ss.CpuUsage = nil
-	var intr_usage *ss.InterruptUsage = nil
-	var disk_usage *ss.DiskUsage = nil
-	var net_usage *ss.NetUsage = nil
-
-	if fst_record.Cpu != nil && lst_record.Cpu != nil {
-		cpu_usage, err = ss.GetCpuUsage(fst_record.Cpu, lst_record.Cpu)
+	// a collector whose usage fails is left out as if it had no samples
+	usages := make(map[string]ss.UsageWriter)
+	for i, collector := range collectors {
+		usage, err := summaries[i].Usage()
+		if err != nil || usage == nil {
+			continue
+		}
+		usages[collector.Name()] = usage
+	}
+	if proc_usage, ok := usages["process"].(*ss.ProcessUsage); ok && option.MaxRss > proc_usage.PeakRss {
+		proc_usage.PeakRss = option.MaxRss
 	}
 
+	// the interrupt sources are not a collector of their own, since they
+	// come from the same samples as the interrupt counts
+	var irq_usage *ss.IrqDetailUsage = nil
 	if fst_record.Interrupt != nil && lst_record.Interrupt != nil {
-		intr_usage, err = ss.GetInterruptUsage(
+		irq_usage, err = ss.GetIrqDetailUsage(
 			fst_record.Time, fst_record.Interrupt,
-			lst_record.Time, lst_record.Interrupt,
-		)
-	}
-
-	if fst_record.Disk != nil && lst_record.Disk != nil {
-		disk_usage, err = ss.GetDiskUsage1(
-			fst_record.Time, fst_record.Disk,
-			lst_record.Time, lst_record.Disk,
-			option.DiskOnlyRegex)
-	}
-
-	if fst_record.Net != nil && lst_record.Net != nil {
-		net_usage, err = ss.GetNetUsage(
-			fst_record.Time, fst_record.Net,
-			lst_record.Time, lst_record.Net)
+			lst_record.Time, lst_record.Interrupt)
+		if err == nil {
+			irq_usage.Affinity = pheader.IrqAffinity
+		}
 	}
-	_ = err // preserve existing behavior: accumulated errors above are ignored
 
 	interval := lst_record.Time.Sub(fst_record.Time)
 
@@ -199,24 +250,16 @@ func RunDirect(option *SummaryOption, out io.Writer) error {
 		printer.BeginObject()
 		printer.PutKey("exectime")
 		printer.PutFloatFmt(interval.Seconds(), "%.3f")
-		if cpu_usage != nil {
-			printer.PutKey("cpu")
-			cpu_usage.WriteJsonTo(printer)
-		}
-
-		if intr_usage != nil {
-			printer.PutKey("intr")
-			intr_usage.WriteJsonTo(printer)
-		}
-
-		if disk_usage != nil {
-			printer.PutKey("disk")
-			disk_usage.WriteJsonTo(printer)
-		}
-
-		if net_usage != nil {
-			printer.PutKey("net")
-			net_usage.WriteJsonTo(printer)
+		for _, collector := range collectors {
+			name := collector.Name()
+			if usage, ok := usages[name]; ok {
+				printer.PutKey(name)
+				usage.WriteJsonTo(printer)
+			}
+			if name == "intr" && irq_usage != nil {
+				printer.PutKey("intr_detail")
+				irq_usage.WriteJsonTo(printer)
+			}
 		}
 
 		printer.FinishObject()
@@ -235,6 +278,26 @@ Duration: %.3f sec
 
 `,
 			interval.Seconds())
+
+		cpu_usage, _ := usages["cpu"].(*ss.CpuUsage)
+		freq_usage, _ := usages["cpufreq"].(*ss.CpuFreqUsage)
+		idle_usage, _ := usages["cpuidle"].(*ss.CpuIdleUsage)
+		thermal_usage, _ := usages["thermal"].(*ss.ThermalUsage)
+		energy_usage, _ := usages["energy"].(*ss.EnergyUsage)
+		sched_usage, _ := usages["proc"].(*ss.ProcUsage)
+		softnet_usage, _ := usages["softnet"].(*ss.SoftnetUsage)
+		proc_usage, _ := usages["process"].(*ss.ProcessUsage)
+		mem_usage, _ := usages["mem"].(*ss.MemUsage)
+		vm_usage, _ := usages["vm"].(*ss.VmUsage)
+		numa_usage, _ := usages["numa"].(*ss.NumaUsage)
+		net_usage, _ := usages["net"].(*ss.NetUsage)
+		netproto_usage, _ := usages["netproto"].(*ss.NetProtoUsage)
+		pressure_usage, _ := usages["pressure"].(*ss.PressureUsage)
+		cgroup_usage, _ := usages["cgroup"].(*ss.CgroupUsage)
+		fs_usage, _ := usages["fs"].(*ss.FsUsage)
+		nfs_usage, _ := usages["nfs"].(*ss.NfsUsage)
+		disk_usage, _ := usages["disk"].(*ss.DiskUsage)
+		custom_usage, _ := usages["custom"].(*ss.CustomUsage)
 		if cpu_usage != nil {
 			fmt.Fprintf(out, `* Average CPU usage (MAX: %d %%)
   * Non-idle usage: %.2f %%
@@ -259,6 +322,410 @@ Duration: %.3f sec
 				cpu_usage.All.Iowait, cpu_usage.All.Idle)
 		}
 
+		// grouping with one group only repeats the CPU usage block
+		for _, group := range []string{"socket", "node"} {
+			if cpu_usage == nil {
+				break
+			}
+			gusages, err := ss.GetCpuGroupUsage(cpu_usage, pheader.CpuTopology, group)
+			if err != nil || len(gusages) < 2 {
+				continue
+			}
+			fmt.Fprintf(out, "* Average CPU usage per %s\n", group)
+			for _, gusage := range gusages {
+				u := gusage.Usage
+				fmt.Fprintf(out, "  %8s: non-idle %.2f %% (MAX: %d %%), %%usr %.2f %%, %%sys %.2f %%, %%iowait %.2f %%\n",
+					gusage.Name,
+					100.0*float64(len(gusage.Cpus))-u.Idle-u.Iowait,
+					100*len(gusage.Cpus),
+					u.User+u.Nice, u.Sys, u.Iowait)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if freq_usage != nil && freq_usage.All.NumSamples > 0 {
+			fmt.Fprintf(out, "* CPU frequency (avg / min / max)\n")
+			fmt.Fprintf(out, "       all: %.0f / %.0f / %.0f MHz\n",
+				freq_usage.All.Avg, freq_usage.All.Min, freq_usage.All.Max)
+			for coreid, e := range freq_usage.CoreFreqUsages {
+				if e.NumSamples == 0 {
+					continue
+				}
+				governor := ""
+				if coreid < len(freq_usage.Governors) && freq_usage.Governors[coreid] != "" {
+					governor = " (" + freq_usage.Governors[coreid] + ")"
+				}
+				fmt.Fprintf(out, "  %8s: %.0f / %.0f / %.0f MHz%s\n",
+					fmt.Sprintf("cpu%d", coreid), e.Avg, e.Min, e.Max, governor)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if thermal_usage != nil {
+			fmt.Fprintf(out, "* Temperature (avg / max)\n")
+			for _, e := range thermal_usage.Sensors {
+				if e.NumSamples == 0 {
+					continue
+				}
+				fmt.Fprintf(out, "  %s: %.1f / %.1f C\n", e.Name, e.Avg, e.Max)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if energy_usage != nil {
+			fmt.Fprintf(out, "* Energy consumption (total / avg power)\n")
+			for _, e := range energy_usage.Domains {
+				if e.NumIntervals == 0 {
+					continue
+				}
+				fmt.Fprintf(out, "  %s: %.1f J / %.2f W\n", e.Name, e.Joules, e.Watts)
+			}
+			if energy_usage.Total != nil && energy_usage.Total.NumIntervals > 0 {
+				fmt.Fprintf(out, "  total: %.1f J / %.2f W\n",
+					energy_usage.Total.Joules, energy_usage.Total.Watts)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if idle_usage != nil {
+			fmt.Fprintf(out, "* CPU idle state residency (%% of idle time)\n")
+			fmt.Fprintf(out, "  %8s", "")
+			for _, name := range idle_usage.StateNames {
+				fmt.Fprintf(out, " %8s", name)
+			}
+			fmt.Fprintf(out, " %8s\n", "%idle")
+			printIdleEntry := func(label string, e *ss.CpuIdleUsageEntry) {
+				fmt.Fprintf(out, "  %8s", label+":")
+				for _, residency := range e.Residency {
+					fmt.Fprintf(out, " %8.2f", residency)
+				}
+				fmt.Fprintf(out, " %8.2f\n", e.Idle)
+			}
+			printIdleEntry("all", idle_usage.All)
+			for _, e := range idle_usage.CoreUsages {
+				printIdleEntry(fmt.Sprintf("cpu%d", e.CpuId), e)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if sched_usage != nil {
+			fmt.Fprintf(out, `* Average scheduler activity
+  context switches: %.2f /sec
+             forks: %.2f /sec
+`,
+				sched_usage.ContextSwitch, sched_usage.Fork)
+			if sched_usage.HasProcsRunning {
+				fmt.Fprintf(out, "        interrupts: %.2f /sec\n", sched_usage.Interrupt)
+			}
+			if sched_usage.LoadAvg != nil {
+				fmt.Fprintf(out, "  load avg. at end: %.2f, %.2f, %.2f\n",
+					sched_usage.LoadAvg.Load1, sched_usage.LoadAvg.Load5,
+					sched_usage.LoadAvg.Load15)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if irq_usage != nil && len(irq_usage.Entries) > 0 && irq_usage.Entries[0].Total > 0.0 {
+			fmt.Fprintf(out, "* Top interrupt sources\n")
+			for idx, e := range irq_usage.Entries {
+				if idx >= 10 || e.Total <= 0.0 {
+					break
+				}
+				irq := e.Name
+				if e.IrqNo != -1 {
+					irq = fmt.Sprintf("%d (%s)", e.IrqNo, e.Name)
+				}
+				busiest, share := e.BusiestCore()
+				affinity := ""
+				if a, ok := irq_usage.Affinity[e.IrqNo]; ok && e.IrqNo != -1 {
+					affinity = ", affinity " + a
+				}
+				fmt.Fprintf(out, "  %24s: %.2f /sec, %.1f %% on cpu%d%s\n",
+					irq, e.Total, share, busiest, affinity)
+			}
+			num_devices := 0
+			for _, dev := range irq_usage.Devices {
+				if num_devices >= 10 || dev.Total <= 0.0 {
+					break
+				}
+				if dev.NumIrqs < 2 {
+					continue
+				}
+				num_devices += 1
+				busiest, share := dev.BusiestCore()
+				fmt.Fprintf(out, "  %24s: %.2f /sec over %d IRQs, %.1f %% on cpu%d\n",
+					dev.Device+" (all)", dev.Total, dev.NumIrqs, share, busiest)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if softnet_usage != nil {
+			fmt.Fprintf(out, `* Average softnet activity
+          processed: %.2f packets/sec
+            dropped: %.2f packets/sec
+       time squeeze: %.2f /sec
+`,
+				softnet_usage.All.Processed, softnet_usage.All.Dropped,
+				softnet_usage.All.TimeSqueeze)
+			for _, e := range softnet_usage.CoreUsages {
+				if e.Dropped > 0.0 {
+					fmt.Fprintf(out, "  WARNING: cpu%d dropped %.2f packets/sec (backlog full; see net.core.netdev_max_backlog)\n",
+						e.CpuId, e.Dropped)
+				}
+			}
+			for _, e := range softnet_usage.CoreUsages {
+				if e.TimeSqueeze > 0.0 {
+					fmt.Fprintf(out, "  WARNING: NET_RX softirq on cpu%d ran out of budget %.2f times/sec (see net.core.netdev_budget)\n",
+						e.CpuId, e.TimeSqueeze)
+				}
+			}
+			fmt.Fprintln(out)
+		}
+
+		if proc_usage != nil {
+			fmt.Fprintf(out, `* Command resource usage (up to %d processes)
+           user time: %.2f sec
+         system time: %.2f sec
+   major page faults: %d
+            peak RSS: %.2f MB
+          read bytes: %.2f MB
+         write bytes: %.2f MB
+   voluntary ctx sw.: %d
+ involuntary ctx sw.: %d
+
+`,
+				proc_usage.NumProcs,
+				proc_usage.Utime, proc_usage.Stime,
+				proc_usage.MajFlt,
+				float64(proc_usage.PeakRss)/1024.0,
+				float64(proc_usage.ReadBytes)/1024.0/1024.0,
+				float64(proc_usage.WriteBytes)/1024.0/1024.0,
+				proc_usage.VoluntaryCtxtSwitches,
+				proc_usage.NonvoluntaryCtxtSwitches)
+		}
+
+		if mem_usage != nil && lst_record.Mem != nil {
+			mem := lst_record.Mem
+			fmt.Fprintf(out, `* Memory usage at end
+           total: %.1f MB
+            used: %.1f MB (%.2f %%)
+       available: %.1f MB (%.2f %%, min. %.2f %%)
+     reclaimable: %.2f %%
+            anon: %.1f MB (%.2f %%)
+            file: %.1f MB (%.2f %%)
+       swap used: %.1f / %.1f MB (%.2f %%)
+
+`,
+				float64(mem.MemTotal)/1024.0,
+				float64(mem_usage.Used)/1024.0, 100.0-mem_usage.AvailablePct,
+				float64(mem_usage.Available)/1024.0, mem_usage.AvailablePct, mem_usage.MinAvailablePct,
+				mem_usage.ReclaimablePct,
+				float64(mem_usage.Anon)/1024.0, mem_usage.AnonPct,
+				float64(mem_usage.File)/1024.0, mem_usage.FilePct,
+				float64(mem_usage.SwapUsed)/1024.0, float64(mem.SwapTotal)/1024.0,
+				mem_usage.SwapUsedPct)
+		}
+
+		if vm_usage != nil {
+			fmt.Fprintf(out, `* Average paging activity
+        page faults: %.2f /sec
+  major page faults: %.2f /sec
+            swap in: %.2f pages/sec
+           swap out: %.2f pages/sec
+     kswapd scanned: %.2f pages/sec
+     direct scanned: %.2f pages/sec
+      kswapd stolen: %.2f pages/sec
+      direct stolen: %.2f pages/sec
+        alloc stall: %.2f /sec
+      compact stall: %.2f /sec
+           OOM kill: %.2f /sec
+
+`,
+				vm_usage.PgFault, vm_usage.PgMajFault,
+				vm_usage.PswpIn, vm_usage.PswpOut,
+				vm_usage.PgScanKswapd, vm_usage.PgScanDirect,
+				vm_usage.PgStealKswapd, vm_usage.PgStealDirect,
+				vm_usage.AllocStall, vm_usage.CompactStall,
+				vm_usage.OomKill)
+		}
+
+		if numa_usage != nil {
+			fmt.Fprintf(out, "* NUMA nodes (memory at end)\n")
+			for _, node := range numa_usage.Nodes {
+				used_pct := 0.0
+				if node.MemTotal > 0 {
+					used_pct = float64(node.MemUsed) / float64(node.MemTotal) * 100.0
+				}
+				fmt.Fprintf(out, "  %6s: used %.1f / %.1f MB (%.2f %%), anon %.1f MB, file %.1f MB\n",
+					fmt.Sprintf("node%d", node.NodeId),
+					float64(node.MemUsed)/1024.0, float64(node.MemTotal)/1024.0, used_pct,
+					float64(node.AnonPages)/1024.0, float64(node.FilePages)/1024.0)
+				fmt.Fprintf(out, "          hit %.2f /sec, miss %.2f /sec (%.2f %%), foreign %.2f /sec\n",
+					node.NumaHit, node.NumaMiss, node.MissRatio, node.NumaForeign)
+				if node.Cpu != nil {
+					fmt.Fprintf(out, "          CPU usage %.2f %% (idle %.2f %%)\n",
+						node.Cpu.User+node.Cpu.Nice+node.Cpu.Sys+node.Cpu.Hardirq+
+							node.Cpu.Softirq+node.Cpu.Steal,
+						node.Cpu.Idle+node.Cpu.Iowait)
+				}
+			}
+			fmt.Fprintln(out)
+		}
+
+		if net_usage != nil {
+			var devices []string
+			for device, entry := range *net_usage {
+				if device != "total" && entry.LinkSpeed > 0 {
+					devices = append(devices, device)
+				}
+			}
+			sort.Strings(devices)
+
+			if len(devices) > 0 {
+				fmt.Fprintf(out, "* Average network link utilization\n")
+				for _, device := range devices {
+					entry := (*net_usage)[device]
+					fmt.Fprintf(out, "  %s (%d Mb/s, %s duplex): rx %.2f MB/s (%.2f %%), tx %.2f MB/s (%.2f %%)\n",
+						device, entry.LinkSpeed, pheader.NetDevices[device].Duplex,
+						entry.RxBytesPerSec/1024.0/1024.0, entry.RxUtil,
+						entry.TxBytesPerSec/1024.0/1024.0, entry.TxUtil)
+				}
+				if total := (*net_usage)["total"]; total.LinkSpeed > 0 {
+					fmt.Fprintf(out, "  total of %s (%d Mb/s): rx %.2f MB/s (%.2f %%), tx %.2f MB/s (%.2f %%)\n",
+						strings.Join(total.Members, ", "), total.LinkSpeed,
+						total.RxBytesPerSec/1024.0/1024.0, total.RxUtil,
+						total.TxBytesPerSec/1024.0/1024.0, total.TxUtil)
+				}
+				fmt.Fprintln(out)
+			}
+		}
+
+		if netproto_usage != nil {
+			fmt.Fprintf(out, `* Average network protocol activity
+    TCP segments in: %.2f /sec
+   TCP segments out: %.2f /sec
+    TCP retransmits: %.2f /sec (%.2f %%)
+       TCP timeouts: %.2f /sec
+      TCP in errors: %.2f /sec
+   TCP active opens: %.2f /sec
+  TCP passive opens: %.2f /sec
+   listen overflows: %.2f /sec
+       listen drops: %.2f /sec
+   UDP datagrams in: %.2f /sec
+  UDP datagrams out: %.2f /sec
+  UDP rcvbuf errors: %.2f /sec
+  UDP sndbuf errors: %.2f /sec
+   sockets (at end): %d used, TCP %d in use / %d time-wait / %d orphan
+
+`,
+				netproto_usage.TcpInSegs, netproto_usage.TcpOutSegs,
+				netproto_usage.TcpRetransSegs, netproto_usage.TcpRetransRatio,
+				netproto_usage.TCPTimeouts, netproto_usage.TcpInErrs,
+				netproto_usage.TcpActiveOpens, netproto_usage.TcpPassiveOpens,
+				netproto_usage.ListenOverflows, netproto_usage.ListenDrops,
+				netproto_usage.UdpInDatagrams, netproto_usage.UdpOutDatagrams,
+				netproto_usage.UdpRcvbufErrors, netproto_usage.UdpSndbufErrors,
+				netproto_usage.SocketsUsed, netproto_usage.TcpInUse,
+				netproto_usage.TcpTimeWait, netproto_usage.TcpOrphan)
+		}
+
+		if pressure_usage != nil {
+			fmt.Fprintf(out, "* Average pressure stall\n")
+			for _, item := range []struct {
+				name  string
+				entry *ss.PressureUsageEntry
+			}{
+				{"cpu", pressure_usage.Cpu},
+				{"io", pressure_usage.Io},
+				{"memory", pressure_usage.Memory},
+			} {
+				if item.entry == nil {
+					continue
+				}
+				fmt.Fprintf(out, "  %6s: some %.2f %%, full %.2f %%\n",
+					item.name, item.entry.Some, item.entry.Full)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if cgroup_usage != nil {
+			paths := []string{}
+			for path, _ := range *cgroup_usage {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+
+			for _, path := range paths {
+				e := (*cgroup_usage)[path]
+				fmt.Fprintf(out, `* Average CGROUP usage: %s
+         CPU usage: %.2f %%
+              %%usr: %.2f %%
+              %%sys: %.2f %%
+         throttled: %.2f %% (%d times)
+   memory (at end): %.2f MB
+ major page faults: %.2f /sec
+   read throughput: %.2f MB/s
+  write throughput: %.2f MB/s
+         read IOPS: %.2f
+        write IOPS: %.2f
+
+`,
+					path,
+					e.Cpu, e.Usr, e.Sys,
+					e.Throttled, e.NrThrottled,
+					float64(e.MemCurrent)/1024.0,
+					e.PgMajFault,
+					e.RdBytesPerSec/1024.0/1024.0, e.WrBytesPerSec/1024.0/1024.0,
+					e.RdIops, e.WrIops)
+			}
+		}
+
+		if fs_usage != nil && len(fs_usage.Mounts) > 0 {
+			fmt.Fprintf(out, "* Filesystem usage at end\n")
+			for _, m := range fs_usage.Mounts {
+				fmt.Fprintf(out, "  %s (%s on %s): %.1f / %.1f GB used (%.2f %%), inodes %.2f %%, fill rate %.3f MB/s",
+					m.MountPoint, m.FsType, m.Device,
+					float64(m.UsedBytes)/1024.0/1024.0/1024.0,
+					float64(m.UsedBytes+m.AvailBytes)/1024.0/1024.0/1024.0,
+					m.UsedPct, m.UsedInodesPct, m.Growth/1024.0/1024.0)
+				if m.FullIn > 0.0 {
+					fmt.Fprintf(out, " (full in %s)",
+						time.Duration(m.FullIn*float64(time.Second)).Round(time.Minute))
+				}
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if nfs_usage != nil {
+			for _, m := range nfs_usage.Mounts {
+				fmt.Fprintf(out, `* Average NFS usage: %s (%s)
+        read IOPS: %.2f
+       write IOPS: %.2f
+        total ops: %.2f /sec
+  read throughput: %.2f MB/s
+ write throughput: %.2f MB/s
+         read RTT: %.3f msec (latency %.3f msec)
+        write RTT: %.3f msec (latency %.3f msec)
+      average RTT: %.3f msec
+      retransmits: %.2f /sec
+`,
+					m.MountPoint, m.Device,
+					m.RdIops, m.WrIops, m.Iops,
+					m.RdBytesPerSec/1024.0/1024.0, m.WrBytesPerSec/1024.0/1024.0,
+					m.RdRtt, m.RdLatency, m.WrRtt, m.WrLatency,
+					m.Rtt, m.Retrans)
+				for idx, op := range m.Ops {
+					if idx >= 5 {
+						break
+					}
+					fmt.Fprintf(out, "  %15s: %.2f /sec, RTT %.3f msec, latency %.3f msec\n",
+						op.Name, op.Iops, op.Rtt, op.Execute)
+				}
+				fmt.Fprintln(out)
+			}
+		}
+
 		if disk_usage != nil {
 			devices := []string{}
 
@@ -283,15 +750,53 @@ Duration: %.3f sec
     write latency: %.1f usec
       read amount: %.2f MB
      write amount: %.2f MB
-
+            %%util: %.2f %%
+           aqu-sz: %.2f
+            svctm: %.1f usec
+            %%rrqm: %.2f %% (%.2f /sec)
+            %%wrqm: %.2f %% (%.2f /sec)
 `,
 					device,
 					e.RdIops, e.WrIops,
 					e.RdSecps*512.0/1024.0/1024.0, e.WrSecps*512.0/1024.0/1024.0,
 					e.RdLatency*1000.0, e.WrLatency*1000.0,
 					float64(e.RdSectors*512)/1024.0/1024.0,
-					float64(e.WrSectors*512)/1024.0/1024.0)
+					float64(e.WrSectors*512)/1024.0/1024.0,
+					e.Util, e.ReqQlen, e.Svctm*1000.0,
+					e.RdMergePct, e.RdMergeps,
+					e.WrMergePct, e.WrMergeps)
+				if e.HasDiscard {
+					fmt.Fprintf(out, `     discard IOPS: %.2f
+  discard latency: %.1f usec
+   discard amount: %.2f MB
+`,
+						e.DcIops, e.DcLatency*1000.0,
+						float64(e.DcSectors*512)/1024.0/1024.0)
+				}
+				if e.HasFlush {
+					fmt.Fprintf(out, `       flush IOPS: %.2f
+    flush latency: %.1f usec
+`,
+						e.FlIops, e.FlLatency*1000.0)
+				}
+				fmt.Fprintln(out)
+			}
+		}
+
+		if custom_usage != nil {
+			fmt.Fprintf(out, "* Custom metrics (avg / min / max)\n")
+			for _, e := range custom_usage.Series {
+				if e.NumSamples == 0 {
+					continue
+				}
+				if e.Counter {
+					fmt.Fprintf(out, "  %s: %.3f / %.3f / %.3f /sec (total %g)\n",
+						e.Name, e.Avg, e.Min, e.Max, e.Total)
+				} else {
+					fmt.Fprintf(out, "  %s: %.3f / %.3f / %.3f\n", e.Name, e.Avg, e.Min, e.Max)
+				}
 			}
+			fmt.Fprintln(out)
 		}
 	}
 
@@ -82,6 +82,32 @@ func TestRunDirectOneRecordInterval(t *testing.T) {
 	}
 }
 
+// TestRunDirectMaxRss verifies that the peak RSS reported by wait(2) is
+// used when the recorder only saw the command as a zombie without VmRSS.
+func TestRunDirectMaxRss(t *testing.T) {
+	proc := ss.NewProcessStat(100)
+	proc.Entries = append(proc.Entries, &ss.ProcessStatEntry{Pid: 100, Utime: 10})
+	rec := ss.StatRecord{
+		Time:    time.Date(2026, 6, 27, 12, 0, 0, 0, time.UTC),
+		Process: proc,
+	}
+
+	path := writeOneRecordLog(t, rec)
+
+	option := NewSummaryOption()
+	option.Logfile = path
+	option.JSON = true
+	option.MaxRss = 2048
+
+	var buf bytes.Buffer
+	if err := RunDirect(option, &buf); err != nil {
+		t.Fatalf("RunDirect returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"peak_rss":2048`) {
+		t.Fatalf("expected peak_rss from MaxRss, got: %s", buf.String())
+	}
+}
+
 // TestWriteJSONPropagatesPrinterError verifies that when the JSON printer is in
 // an unfinished state (printer.String() fails), writeJSON returns the actual
 // error and does NOT write the debug literal "skip by err" to the output.
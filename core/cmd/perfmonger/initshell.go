@@ -95,10 +95,37 @@ _perfmonger() {
                     '--debug[Enable debug mode]' \
                     '-z[Gzip output]' \
                     '--gzip[Gzip output]' \
-                    '--no-cpu[Do not record CPU]' \
+                    '--no-cpu[Do not record CPU usage]' \
+                    '--no-cpufreq[Do not record CPU frequencies]' \
+                    '--no-cpuidle[Do not record CPU idle states]' \
+                    '--no-thermal[Do not record temperatures]' \
+                    '--no-energy[Do not record energy consumption]' \
+                    '--no-proc[Do not record process counts and load average]' \
                     '--no-disk[Do not record disk]' \
+                    '--no-nfs[Do not record NFS client statistics]' \
+                    '--no-softirq[Do not record softirqs]' \
+                    '--no-softnet[Do not record packet processing counters]' \
                     '--no-net[Do not record network]' \
-                    '--no-mem[Do not record memory]'
+                    '--net-only[Network interfaces to monitor]:regex:' \
+                    '--net-exclude[Network interfaces not to monitor]:regex:' \
+                    '--no-mem[Do not record memory]' \
+                    '--no-numa[Do not record NUMA node memory]' \
+                    '--no-vm[Do not record paging activity]' \
+                    '--no-netproto[Do not record protocol counters]' \
+                    '--no-pressure[Do not record pressure stall]' \
+                    '--no-cgroup[Do not record cgroups]' \
+                    '--no-process[Do not record the command]' \
+                    '--no-fs[Do not record filesystems]' \
+                    '--mount-only[Mount points to monitor]:regex:' \
+                    '--mount-exclude[Mount points not to monitor]:regex:' \
+                    '--procfs[Root of procfs]:directory:_files -/' \
+                    '--sysfs[Root of sysfs]:directory:_files -/' \
+                    '*--exec-metric[Command whose output to record]:name=command:' \
+                    '*--exec-metric-stream[Long-lived command whose output to record]:name=command:' \
+                    '--exec-metric-every[Samples between command runs]:count:' \
+                    '*--exec-metric-rate[Series to record as rates]:pattern:' \
+                    '--no-custom[Do not record command metrics]' \
+                    '*--cgroup[cgroup v2 path to monitor]:cgroup path:'
                 ;;
             *)
                 _files
@@ -57,6 +57,23 @@ func (cmd *liveCommand) validateOptions() error {
 	if cmd.RecorderOpt.Interval <= 0 {
 		return fmt.Errorf("interval must be positive")
 	}
+
+	if _, _, err := recorder.BuildNetFilter(cmd.RecorderOpt.NetOnly, cmd.RecorderOpt.NetExclude); err != nil {
+		return err
+	}
+
+	if _, _, err := recorder.BuildMountFilter(cmd.RecorderOpt.MountOnly, cmd.RecorderOpt.MountExclude); err != nil {
+		return err
+	}
+
+	if err := recorder.CheckRoots(cmd.RecorderOpt.ProcRoot, cmd.RecorderOpt.SysRoot); err != nil {
+		return err
+	}
+
+	if _, err := recorder.BuildCustomMetrics(cmd.RecorderOpt.ExecMetrics, cmd.RecorderOpt.ExecMetricStreams,
+		cmd.RecorderOpt.ExecMetricEvery, cmd.RecorderOpt.ExecMetricRates); err != nil {
+		return err
+	}
 	
 	return nil
 }
@@ -128,6 +145,8 @@ func newLiveCommand() *cobra.Command {
 	// Direct cobra flag setting to RecorderOption fields (no conversion needed) - same as record
 	cmd.Flags().StringSliceVarP(&liveCmd.RecorderOpt.DevsParts, "disk", "d", liveCmd.RecorderOpt.DevsParts, 
 		"Device name to be monitored (e.g. sda, sdb, md0, dm-1).")
+	cmd.Flags().StringArrayVar(&liveCmd.RecorderOpt.Cgroups, "cgroup", liveCmd.RecorderOpt.Cgroups, 
+		"cgroup v2 path to be monitored, relative to /sys/fs/cgroup (repeatable)")
 	
 	// Ruby-compatible duration setting (accepts both float64 seconds and duration format)
 	cmd.Flags().VarP(&secondsDurationValue{target: &liveCmd.RecorderOpt.Interval}, "interval", "i", 
@@ -140,12 +159,20 @@ func newLiveCommand() *cobra.Command {
 	// Feature flags (direct setting to RecorderOption) - same as record
 	cmd.Flags().BoolVar(&liveCmd.RecordIntr, "record-intr", liveCmd.RecordIntr, 
 		"Record per core interrupts count (experimental)")
-	cmd.Flags().BoolVar(&liveCmd.RecorderOpt.NoCPU, "no-cpu", liveCmd.RecorderOpt.NoCPU, 
-		"Suppress recording CPU usage.")
-	cmd.Flags().BoolVar(&liveCmd.RecorderOpt.NoNet, "no-net", liveCmd.RecorderOpt.NoNet, 
-		"Suppress recording network usage")
-	cmd.Flags().BoolVar(&liveCmd.RecorderOpt.NoMem, "no-mem", liveCmd.RecorderOpt.NoMem, 
-		"Suppress recording memory usage")
+	addCollectorFlags(cmd, liveCmd.RecorderOpt, "intr")
+	cmd.Flags().StringVar(&liveCmd.RecorderOpt.NetOnly, "net-only", liveCmd.RecorderOpt.NetOnly,
+		"Record network interfaces that match REGEX only (Ex. '^(eth|ens)')")
+	cmd.Flags().StringVar(&liveCmd.RecorderOpt.NetExclude, "net-exclude", liveCmd.RecorderOpt.NetExclude,
+		"Do not record network interfaces that match REGEX (Ex. '^(veth|docker)')")
+	cmd.Flags().StringVar(&liveCmd.RecorderOpt.MountOnly, "mount-only", liveCmd.RecorderOpt.MountOnly,
+		"Record filesystems whose mount point matches REGEX only (Ex. '^/(data|home)')")
+	cmd.Flags().StringVar(&liveCmd.RecorderOpt.MountExclude, "mount-exclude", liveCmd.RecorderOpt.MountExclude,
+		"Do not record filesystems whose mount point matches REGEX (Ex. '^/(boot|snap)')")
+	cmd.Flags().StringVar(&liveCmd.RecorderOpt.ProcRoot, "procfs", liveCmd.RecorderOpt.ProcRoot,
+		"Read procfs mounted at DIR (Ex. '/host/proc'; env: "+recorder.ProcRootEnvKey+")")
+	cmd.Flags().StringVar(&liveCmd.RecorderOpt.SysRoot, "sysfs", liveCmd.RecorderOpt.SysRoot,
+		"Read sysfs mounted at DIR (Ex. '/host/sys'; env: "+recorder.SysRootEnvKey+")")
+	addExecMetricFlags(cmd, liveCmd.RecorderOpt)
 	cmd.Flags().BoolVar(&liveCmd.NoGzip, "no-gzip", liveCmd.NoGzip, 
 		"Do not save a logfile in gzipped format")
 		
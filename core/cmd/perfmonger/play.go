@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"regexp"
 
 	"github.com/spf13/cobra"
 	"github.com/hayamiz/perfmonger/core/cmd/perfmonger-core/player"
@@ -41,6 +42,32 @@ func (cmd *playCommand) validateAndSetLogfile(args []string) error {
 	return nil
 }
 
+// validateOptions checks option values that the player itself does not
+func (cmd *playCommand) validateOptions() error {
+	switch cmd.PlayerOpt.CpuGroup {
+	case "", "socket", "node", "core":
+	default:
+		return fmt.Errorf("cpu-group must be 'socket', 'node' or 'core', got %q", cmd.PlayerOpt.CpuGroup)
+	}
+
+	if cmd.PlayerOpt.NetOnly != "" {
+		re, err := regexp.Compile(cmd.PlayerOpt.NetOnly)
+		if err != nil {
+			return fmt.Errorf("invalid net-only regex: %v", err)
+		}
+		cmd.PlayerOpt.NetOnlyRegex = re
+	}
+	if cmd.PlayerOpt.NetExclude != "" {
+		re, err := regexp.Compile(cmd.PlayerOpt.NetExclude)
+		if err != nil {
+			return fmt.Errorf("invalid net-exclude regex: %v", err)
+		}
+		cmd.PlayerOpt.NetExcludeRegex = re
+	}
+
+	return nil
+}
+
 // run executes the play command with direct API calls
 func (cmd *playCommand) run() error {
 	if os.Getenv("PERFMONGER_DEBUG") != "" {
@@ -48,8 +75,7 @@ func (cmd *playCommand) run() error {
 	}
 	
 	// Direct API call - no conversion needed
-	player.RunDirect(cmd.PlayerOpt)
-	return nil
+	return player.RunDirect(cmd.PlayerOpt)
 }
 
 
@@ -63,7 +89,10 @@ func newPlayCommand() *cobra.Command {
 		Long:  `Play a perfmonger log file in JSON`,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			// Validation moved to PreRunE for cobra integration
-			return playCmd.validateAndSetLogfile(args)
+			if err := playCmd.validateAndSetLogfile(args); err != nil {
+				return err
+			}
+			return playCmd.validateOptions()
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Direct execution - no additional validation needed
@@ -78,6 +107,14 @@ func newPlayCommand() *cobra.Command {
 		"Use human readable JSON output")
 	cmd.Flags().StringVar(&playCmd.PlayerOpt.DiskOnly, "disk-only", playCmd.PlayerOpt.DiskOnly,
 		"Select disk devices that matches REGEX (Ex. 'sd[b-d]')")
+	cmd.Flags().BoolVar(&playCmd.PlayerOpt.IntrDetail, "intr-detail", playCmd.PlayerOpt.IntrDetail,
+		"Show per-IRQ interrupt rates (requires a log recorded with --record-intr)")
+	cmd.Flags().StringVar(&playCmd.PlayerOpt.CpuGroup, "cpu-group", playCmd.PlayerOpt.CpuGroup,
+		"Show CPU usage aggregated per 'socket', 'node' or 'core' (physical core)")
+	cmd.Flags().StringVar(&playCmd.PlayerOpt.NetOnly, "net-only", playCmd.PlayerOpt.NetOnly,
+		"Select network interfaces that match REGEX (Ex. '^(eth|ens)')")
+	cmd.Flags().StringVar(&playCmd.PlayerOpt.NetExclude, "net-exclude", playCmd.PlayerOpt.NetExclude,
+		"Exclude network interfaces that match REGEX (Ex. '^(veth|docker)')")
 	
 	cmd.SetUsageTemplate(subCommandUsageTemplate)
 	return cmd
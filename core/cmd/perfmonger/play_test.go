@@ -80,6 +80,32 @@ func TestPlayCommand_ValidateAndSetLogfile(t *testing.T) {
 	}
 }
 
+func TestPlayCommand_ValidateOptions(t *testing.T) {
+	for _, group := range []string{"", "socket", "node", "core"} {
+		cmd := newPlayCommandStruct()
+		cmd.PlayerOpt.CpuGroup = group
+		if err := cmd.validateOptions(); err != nil {
+			t.Errorf("validateOptions() with cpu-group %q unexpected error: %v", group, err)
+		}
+	}
+
+	cmd := newPlayCommandStruct()
+	cmd.PlayerOpt.CpuGroup = "thread"
+	if err := cmd.validateOptions(); err == nil {
+		t.Error("validateOptions() expected error for cpu-group \"thread\", got nil")
+	}
+
+	cmd = newPlayCommandStruct()
+	cmd.PlayerOpt.NetExclude = "^(veth|docker)"
+	if err := cmd.validateOptions(); err != nil || cmd.PlayerOpt.NetExcludeRegex == nil {
+		t.Errorf("validateOptions() should compile net-exclude: %v", err)
+	}
+	cmd.PlayerOpt.NetOnly = "eth("
+	if err := cmd.validateOptions(); err == nil {
+		t.Error("validateOptions() expected error for net-only \"eth(\", got nil")
+	}
+}
+
 func TestNewPlayCommand(t *testing.T) {
 	cmd := newPlayCommand()
 
@@ -87,7 +113,7 @@ func TestNewPlayCommand(t *testing.T) {
 		t.Errorf("Use = %q, want %q", cmd.Use, "play [options] LOG_FILE")
 	}
 
-	expectedFlags := []string{"color", "pretty", "disk-only"}
+	expectedFlags := []string{"color", "pretty", "disk-only", "intr-detail", "cpu-group", "net-only", "net-exclude"}
 	for _, name := range expectedFlags {
 		if cmd.Flags().Lookup(name) == nil {
 			t.Errorf("expected flag %q to be defined", name)
@@ -28,6 +28,9 @@ type plotCommand struct {
 	DiskOnly      string
 	DiskOnlyRegex *regexp.Regexp
 
+	// CPU grouping of the per-core chart: "", "socket", "node" or "core"
+	CpuGroup string
+
 	// Plot mode options
 	PlotReadOnly   bool
 	PlotWriteOnly  bool
@@ -52,6 +55,7 @@ func newPlotCommandStruct() *plotCommand {
 		SaveGpfiles:         false,
 		DiskOnly:           "",
 		DiskOnlyRegex:      nil,
+		CpuGroup:           "",
 		PlotReadOnly:       false,
 		PlotWriteOnly:      false,
 		PlotReadWrite:      false,
@@ -96,6 +100,13 @@ func (cmd *plotCommand) validateOptions() error {
 		cmd.DiskOnlyRegex = regex
 	}
 
+	// Validate CPU grouping
+	switch cmd.CpuGroup {
+	case "", "socket", "node", "core":
+	default:
+		return fmt.Errorf("cpu-group must be 'socket', 'node' or 'core', got %q", cmd.CpuGroup)
+	}
+
 	// Handle plot mode flags
 	if cmd.PlotReadOnly {
 		cmd.DiskPlotRead = true
@@ -169,6 +180,8 @@ func newPlotCommand() *cobra.Command {
 		"Save GNUPLOT and data files")
 	cmd.Flags().StringVar(&plotCmd.DiskOnly, "disk-only", plotCmd.DiskOnly,
 		"Select disk devices that match REGEX")
+	cmd.Flags().StringVar(&plotCmd.CpuGroup, "cpu-group", plotCmd.CpuGroup,
+		"Plot per-core CPU usage aggregated per 'socket', 'node' or 'core' (physical core)")
 
 	// Plot mode flags
 	cmd.Flags().BoolVar(&plotCmd.PlotReadOnly, "plot-read-only", plotCmd.PlotReadOnly,
@@ -219,17 +232,14 @@ func runPlotCommand(cmd *plotCommand) error {
 	defer os.RemoveAll(tmpDir)
 
 	// Run plot-formatter to generate data files
-	diskDat := filepath.Join(tmpDir, "disk.dat")
-	cpuDat := filepath.Join(tmpDir, "cpu.dat") 
-	memDat := filepath.Join(tmpDir, "mem.dat")
-
-	meta, err := runPlotFormatter(cmd.DataFile, diskDat, cpuDat, memDat, cmd.DiskOnly)
+	dataFiles := plotformatter.DataFiles(tmpDir)
+	meta, err := runPlotFormatter(cmd, dataFiles)
 	if err != nil {
 		return err
 	}
 
 	// Generate plots
-	if err := generatePlots(cmd, tmpDir, meta); err != nil {
+	if err := generatePlots(cmd, tmpDir, dataFiles, meta); err != nil {
 		return err
 	}
 
@@ -272,21 +282,29 @@ func checkConvertAvailable() error {
 }
 
 // runPlotFormatter runs the plot-formatter component to generate data files
-func runPlotFormatter(dataFile, diskDat, cpuDat, memDat, diskOnly string) (*plotformatter.PlotMeta, error) {
+func runPlotFormatter(cmd *plotCommand, dataFiles map[string]string) (*plotformatter.PlotMeta, error) {
 	return plotformatter.RunDirect(&plotformatter.PlotFormatOption{
-		PerfmongerFile: dataFile,
-		DiskFile:       diskDat,
-		CpuFile:        cpuDat,
-		MemFile:        memDat,
-		DiskOnly:       diskOnly,
+		PerfmongerFile: cmd.DataFile,
+		DataFiles:      dataFiles,
+		DiskOnly:       cmd.DiskOnly,
+		CpuGroup:       cmd.CpuGroup,
 	})
 }
 
 // generatePlots generates the actual plot files using gnuplot
-func generatePlots(cmd *plotCommand, tmpDir string, meta *plotformatter.PlotMeta) error {
+func generatePlots(cmd *plotCommand, tmpDir string, dataFiles map[string]string, meta *plotformatter.PlotMeta) error {
 	duration := meta.EndTime - meta.StartTime
-	diskDat := filepath.Join(tmpDir, "disk.dat")
-	cpuDat := filepath.Join(tmpDir, "cpu.dat")
+	diskDat := dataFiles["disk"]
+	cpuDat := dataFiles["cpu"]
+	vmDat := dataFiles["vm"]
+	freqDat := dataFiles["cpufreq"]
+	procDat := dataFiles["proc"]
+	idleDat := dataFiles["cpuidle"]
+	netDat := dataFiles["net"]
+	fsDat := dataFiles["fs"]
+	nfsDat := dataFiles["nfs"]
+	thermalDat := dataFiles["thermal"]
+	customDat := dataFiles["custom"]
 
 	// Disk IOPS plot
 	if err := generateDiskIOPSPlot(cmd, tmpDir, diskDat, meta, duration); err != nil {
@@ -296,6 +314,14 @@ func generatePlots(cmd *plotCommand, tmpDir string, meta *plotformatter.PlotMeta
 	if err := generateDiskTransferPlot(cmd, tmpDir, diskDat, meta, duration); err != nil {
 		return err
 	}
+	// Disk utilization plot
+	if err := generateDiskUtilPlot(cmd, tmpDir, diskDat, meta, duration); err != nil {
+		return err
+	}
+	// Disk discard and flush plot
+	if err := generateDiskDiscardFlushPlot(cmd, tmpDir, diskDat, meta, duration); err != nil {
+		return err
+	}
 	// CPU plot
 	if err := generateCPUPlot(cmd, tmpDir, cpuDat, meta, duration); err != nil {
 		return err
@@ -305,9 +331,57 @@ func generatePlots(cmd *plotCommand, tmpDir string, meta *plotformatter.PlotMeta
 		return err
 	}
 
+	// Paging activity plot
+	if err := generateVmPlot(cmd, tmpDir, vmDat, meta, duration); err != nil {
+		return err
+	}
+
+	// CPU frequency plot
+	if err := generateCpuFreqPlot(cmd, tmpDir, freqDat, meta, duration); err != nil {
+		return err
+	}
+
+	// Temperature plot
+	if err := generateThermalPlot(cmd, tmpDir, thermalDat, freqDat, meta, duration); err != nil {
+		return err
+	}
+
+	// CPU idle state heatmap
+	if err := generateCpuIdlePlot(cmd, tmpDir, idleDat, meta, duration); err != nil {
+		return err
+	}
+
+	// Scheduler activity plot
+	if err := generateSchedPlot(cmd, tmpDir, procDat, meta, duration); err != nil {
+		return err
+	}
+
+	// Network throughput or link utilization plot
+	if err := generateNetPlot(cmd, tmpDir, netDat, meta, duration); err != nil {
+		return err
+	}
+
+	// Filesystem usage plot
+	if err := generateFsPlot(cmd, tmpDir, fsDat, meta, duration); err != nil {
+		return err
+	}
+
+	// NFS client activity plot
+	if err := generateNfsPlot(cmd, tmpDir, nfsDat, meta, duration); err != nil {
+		return err
+	}
+
+	// Custom metrics plots
+	if err := generateCustomPlots(cmd, tmpDir, customDat, meta, duration); err != nil {
+		return err
+	}
+
 	// Copy data/gp files if --save
 	if cmd.SaveGpfiles {
-		names := []string{"disk.dat", "cpu.dat", "mem.dat", "disk-iops.gp", "disk-transfer.gp", "cpu.gp", "allcpu.gp"}
+		names := []string{"disk.dat", "cpu.dat", "mem.dat", "vm.dat", "disk-iops.gp", "disk-transfer.gp", "disk-util.gp", "disk-discard-flush.gp", "cpu.gp", "allcpu.gp", "vm.gp", "freq.dat", "cpufreq.gp", "cpuidle.dat", "cpuidle.gp", "proc.dat", "sched.gp", "net.dat", "net.gp", "fs.dat", "fs.gp", "nfs.dat", "nfs.gp", "thermal.dat", "thermal.gp", "custom.dat"}
+		for _, metric := range customMetrics(meta) {
+			names = append(names, "custom-"+metric+".gp")
+		}
 		if err := saveGpfiles(tmpDir, cmd.OutputDir, names); err != nil {
 			return err
 		}
@@ -444,6 +518,92 @@ plot %s
 	return runGnuplot(cmd, gpFile)
 }
 
+func generateDiskUtilPlot(cmd *plotCommand, tmpDir, diskDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	gpFile := filepath.Join(tmpDir, "disk-util.gp")
+	outFile := filepath.Join(cmd.OutputDir, "disk-util."+cmd.OutputType)
+
+	var lines []string
+	for _, dev := range meta.Disk.Devices {
+		if cmd.DiskOnlyRegex != nil && !cmd.DiskOnlyRegex.MatchString(dev.Name) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf(
+			`"%s" ind %d usi 1:16 with lines lw 2 title "%s"`,
+			diskDat, dev.Idx, dev.Name))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "Device utilization"
+set output "%s"
+set xlabel "elapsed time [sec]"
+set ylabel "%%util"
+set grid
+set xrange [%g:%g]
+set yrange [0:100]
+%s
+
+plot %s
+`, escapeGnuplotString(outFile), cmd.OffsetTime, duration, setKeyStmt(meta, cmd.DiskNumkeyThreshold),
+		strings.Join(lines, ", \\\n     "))
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+func generateDiskDiscardFlushPlot(cmd *plotCommand, tmpDir, diskDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Disk.HasDiscard && !meta.Disk.HasFlush {
+		// kernel older than 4.18 reports neither
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "disk-discard-flush.gp")
+	outFile := filepath.Join(cmd.OutputDir, "disk-discard-flush."+cmd.OutputType)
+
+	var lines []string
+	for _, dev := range meta.Disk.Devices {
+		if cmd.DiskOnlyRegex != nil && !cmd.DiskOnlyRegex.MatchString(dev.Name) {
+			continue
+		}
+		if meta.Disk.HasDiscard {
+			lines = append(lines, fmt.Sprintf(
+				`"%s" ind %d usi 1:11 with lines lw 2 title "%s discard"`,
+				diskDat, dev.Idx, dev.Name))
+		}
+		if meta.Disk.HasFlush {
+			lines = append(lines, fmt.Sprintf(
+				`"%s" ind %d usi 1:14 with lines lw 2 title "%s flush"`,
+				diskDat, dev.Idx, dev.Name))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "Discard and flush"
+set output "%s"
+set xlabel "elapsed time [sec]"
+set ylabel "IOPS"
+set grid
+set xrange [%g:%g]
+set yrange [0:*]
+%s
+
+plot %s
+`, escapeGnuplotString(outFile), cmd.OffsetTime, duration, setKeyStmt(meta, cmd.DiskNumkeyThreshold),
+		strings.Join(lines, ", \\\n     "))
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
 func generateCPUPlot(cmd *plotCommand, tmpDir, cpuDat string, meta *plotformatter.PlotMeta, duration float64) error {
 	gpFile := filepath.Join(tmpDir, "cpu.gp")
 	outFile := filepath.Join(cmd.OutputDir, "cpu."+cmd.OutputType)
@@ -479,6 +639,10 @@ func generateAllCPUPlot(cmd *plotCommand, tmpDir, cpuDat string, meta *plotforma
 	gpFile := filepath.Join(tmpDir, "allcpu.gp")
 	outFile := filepath.Join(cmd.OutputDir, "allcpu."+cmd.OutputType)
 	nrCPU := meta.Cpu.NumCore
+	if len(meta.Cpu.Groups) > 0 {
+		// one chart per CPU group, averaged over its CPUs
+		nrCPU = len(meta.Cpu.Groups)
+	}
 
 	plotHeight := 8.0
 	if nrCPU > 8 {
@@ -495,7 +659,11 @@ func generateAllCPUPlot(cmd *plotCommand, tmpDir, cpuDat string, meta *plotforma
 
 	for i := 0; i < nrCPU; i++ {
 		ypos := legendHeight + float64(nrCPU-1-i)*cellHeight
-		fmt.Fprintf(&sb, "\nset title 'cpu %d' offset -61,-3 font 'Arial,16'\n", i)
+		title := fmt.Sprintf("cpu %d", i)
+		if len(meta.Cpu.Groups) > 0 {
+			title = meta.Cpu.Groups[i]
+		}
+		fmt.Fprintf(&sb, "\nset title '%s' offset -61,-3 font 'Arial,16'\n", title)
 		sb.WriteString("unset key\n")
 		fmt.Fprintf(&sb, "set origin 0.0, %f\nset size 1.0, %f\n", ypos, cellHeight)
 		sb.WriteString("set rmargin 2\nset lmargin 12\nset tmargin 0.5\nset bmargin 0.5\n")
@@ -536,4 +704,411 @@ func generateAllCPUPlot(cmd *plotCommand, tmpDir, cpuDat string, meta *plotforma
 		return err
 	}
 	return runGnuplot(cmd, gpFile)
-}
\ No newline at end of file
+}
+
+func generateVmPlot(cmd *plotCommand, tmpDir, vmDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Vm.Available {
+		// recorded without vmstat
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "vm.gp")
+	outFile := filepath.Join(cmd.OutputDir, "vm."+cmd.OutputType)
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "Paging activity"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "events/sec"
+set grid
+set xrange [%g:%g]
+set yrange [0:*]
+
+plot "%s" usi 1:3 with lines lw 2 title "major fault", \
+     "%s" usi 1:4 with lines lw 2 title "swap in", \
+     "%s" usi 1:5 with lines lw 2 title "swap out", \
+     "%s" usi 1:($6+$7+$8) with lines lw 2 title "scanned", \
+     "%s" usi 1:($9+$10+$11) with lines lw 2 title "stolen", \
+     "%s" usi 1:12 with lines lw 2 title "alloc stall"
+`, escapeGnuplotString(outFile), cmd.OffsetTime, duration,
+		vmDat, vmDat, vmDat, vmDat, vmDat, vmDat)
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+func generateCpuFreqPlot(cmd *plotCommand, tmpDir, freqDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.CpuFreq.Available {
+		// recorded without cpufreq
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "cpufreq.gp")
+	outFile := filepath.Join(cmd.OutputDir, "cpufreq."+cmd.OutputType)
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "CPU frequency"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "frequency [MHz]"
+set grid
+set xrange [%g:%g]
+set yrange [0:*]
+
+plot for [i=3:%d] "%s" usi 1:i with lines lw 1 lc rgb "#c0c0c0" notitle, \
+     "%s" usi 1:2 with lines lw 2 lc 1 title "average"
+`, escapeGnuplotString(outFile), cmd.OffsetTime, duration,
+		meta.CpuFreq.NumCore+2, freqDat, freqDat)
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+func generateThermalPlot(cmd *plotCommand, tmpDir, thermalDat, freqDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Thermal.Available {
+		// recorded without temperature sensors
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "thermal.gp")
+	outFile := filepath.Join(cmd.OutputDir, "thermal."+cmd.OutputType)
+
+	var lines []string
+	for idx, name := range meta.Thermal.Sensors {
+		lines = append(lines,
+			fmt.Sprintf(`"%s" usi 1:%d with lines lw 2 lc %d title "%s"`,
+				thermalDat, idx+2, idx+1, escapeGnuplotString(name)))
+	}
+	// The average CPU frequency on the right axis shares the timeline so
+	// that thermal throttling can be told from the chart.
+	y2 := ""
+	if meta.CpuFreq.Available {
+		y2 = `set y2label "frequency [MHz]"
+set y2tics
+set y2range [0:*]
+`
+		lines = append(lines,
+			fmt.Sprintf(`"%s" usi 1:2 axes x1y2 with lines lw 1 lc rgb "#808080" dt 2 title "CPU frequency (average)"`, freqDat))
+	}
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "Temperature"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "temperature [deg C]"
+%sset grid
+set xrange [%g:%g]
+set yrange [*:*]
+
+plot %s
+`, escapeGnuplotString(outFile), y2, cmd.OffsetTime, duration,
+		strings.Join(lines, ", \\\n     "))
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+// customMetrics returns the names of the custom metrics which have series
+// in custom.dat.
+func customMetrics(meta *plotformatter.PlotMeta) []string {
+	var metrics []string
+	for _, series := range meta.Custom.Series {
+		if !containsString(metrics, series.Metric) {
+			metrics = append(metrics, series.Metric)
+		}
+	}
+	return metrics
+}
+
+// generateCustomPlots plots the series of each custom metric in
+// custom-<metric>.<type>. Counters are plotted as rates, on the right axis
+// if the metric has gauges as well.
+func generateCustomPlots(cmd *plotCommand, tmpDir, customDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Custom.Available {
+		// recorded without --exec-metric
+		return nil
+	}
+
+	for _, metric := range customMetrics(meta) {
+		gpFile := filepath.Join(tmpDir, "custom-"+metric+".gp")
+		outFile := filepath.Join(cmd.OutputDir, "custom-"+metric+"."+cmd.OutputType)
+
+		has_gauge := false
+		for _, series := range meta.Custom.Series {
+			if series.Metric == metric && !series.Counter {
+				has_gauge = true
+			}
+		}
+
+		ylabel := "value"
+		y2 := ""
+		var lines []string
+		for _, series := range meta.Custom.Series {
+			if series.Metric != metric {
+				continue
+			}
+			axes := ""
+			title := series.Name
+			if series.Counter {
+				title += " [/sec]"
+				if has_gauge {
+					axes = " axes x1y2"
+					y2 = `set y2label "rate [/sec]"
+set y2tics
+set y2range [*:*]
+`
+				} else {
+					ylabel = "rate [/sec]"
+				}
+			}
+			lines = append(lines,
+				fmt.Sprintf(`"%s" ind %d usi 1:2%s with linespoints lw 2 pt 7 ps 0.3 title "%s"`,
+					customDat, series.Idx, axes, escapeGnuplotString(title)))
+		}
+
+		script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "%s"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "%s"
+%sset grid
+set xrange [%g:%g]
+set yrange [*:*]
+
+plot %s
+`, escapeGnuplotString(metric), escapeGnuplotString(outFile), ylabel, y2,
+			cmd.OffsetTime, duration, strings.Join(lines, ", \\\n     "))
+
+		if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+			return err
+		}
+		if err := runGnuplot(cmd, gpFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func generateCpuIdlePlot(cmd *plotCommand, tmpDir, idleDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.CpuIdle.Available {
+		// recorded without cpuidle
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "cpuidle.gp")
+	outFile := filepath.Join(cmd.OutputDir, "cpuidle."+cmd.OutputType)
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "Residency in deepest idle state (%s)"
+set output "%s"
+set xlabel "elapsed time [sec]"
+set ylabel "core"
+set cblabel "%% of idle time"
+set xrange [%g:%g]
+set yrange [-0.5:%g]
+set cbrange [0:100]
+set palette defined (0 "#ffffff", 100 "#0000c0")
+
+plot "%s" usi 1:2:($1-$5):($1+$5):($2-0.5):($2+0.5):4 with boxxyerror fs solid noborder lc palette notitle
+`, escapeGnuplotString(meta.CpuIdle.DeepestState), escapeGnuplotString(outFile),
+		cmd.OffsetTime, duration, float64(meta.CpuIdle.NumCore)-0.5, idleDat)
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+func generateSchedPlot(cmd *plotCommand, tmpDir, procDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Proc.Available {
+		// recorded without /proc/stat
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "sched.gp")
+	outFile := filepath.Join(cmd.OutputDir, "sched."+cmd.OutputType)
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "Scheduler activity"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "events/sec"
+set y2label "tasks"
+set ytics nomirror
+set y2tics
+set grid
+set xrange [%g:%g]
+set yrange [0:*]
+set y2range [0:*]
+
+plot "%s" usi 1:2 with lines lw 2 title "context switch", \
+     "%s" usi 1:3 with lines lw 2 title "fork", \
+     "%s" usi 1:5 axes x1y2 with lines lw 2 title "running", \
+     "%s" usi 1:6 axes x1y2 with lines lw 2 title "blocked", \
+     "%s" usi 1:7 axes x1y2 with lines lw 2 dt 2 title "load avg."
+`, escapeGnuplotString(outFile), cmd.OffsetTime, duration,
+		procDat, procDat, procDat, procDat, procDat)
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+func generateNetPlot(cmd *plotCommand, tmpDir, netDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Net.Available {
+		// recorded without network stats
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "net.gp")
+	outFile := filepath.Join(cmd.OutputDir, "net."+cmd.OutputType)
+
+	// Plot link utilization if any link speed is known, otherwise fall back
+	// to throughput. Each device takes 4 columns in net.dat: rx MB/s,
+	// tx MB/s, rx % and tx %.
+	hasUtil := false
+	for _, dev := range meta.Net.Devices {
+		if dev.Speed > 0 {
+			hasUtil = true
+		}
+	}
+
+	var lines []string
+	for idx, dev := range meta.Net.Devices {
+		col := 2 + idx*4
+		if hasUtil {
+			if dev.Speed <= 0 {
+				continue
+			}
+			col += 2
+		}
+		name := escapeGnuplotString(dev.Name)
+		lines = append(lines,
+			fmt.Sprintf(`"%s" usi 1:%d with lines lw 2 lc %d title "%s rx"`, netDat, col, idx+1, name),
+			fmt.Sprintf(`"%s" usi 1:%d with lines lw 2 lc %d dt 2 title "%s tx"`, netDat, col+1, idx+1, name))
+	}
+
+	title := "Network throughput"
+	ylabel := "throughput [MB/s]"
+	yrange := "[0:*]"
+	if hasUtil {
+		title = "Network link utilization"
+		ylabel = "link utilization [%]"
+		yrange = "[0:100]"
+	}
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "%s"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "%s"
+set grid
+set xrange [%g:%g]
+set yrange %s
+
+plot %s
+`, title, escapeGnuplotString(outFile), ylabel, cmd.OffsetTime, duration,
+		yrange, strings.Join(lines, ", \\\n     "))
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+func generateFsPlot(cmd *plotCommand, tmpDir, fsDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Fs.Available {
+		// recorded without filesystem stats
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "fs.gp")
+	outFile := filepath.Join(cmd.OutputDir, "fs."+cmd.OutputType)
+
+	// Each mount takes 3 columns in fs.dat: used GB, used % and inodes %.
+	var lines []string
+	for idx, mount := range meta.Fs.Mounts {
+		col := 2 + idx*3
+		name := escapeGnuplotString(mount.MountPoint)
+		lines = append(lines,
+			fmt.Sprintf(`"%s" usi 1:%d with lines lw 2 lc %d title "%s"`, fsDat, col+1, idx+1, name),
+			fmt.Sprintf(`"%s" usi 1:%d with lines lw 2 lc %d dt 2 title "%s inodes"`, fsDat, col+2, idx+1, name))
+	}
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "Filesystem usage"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "used [%%]"
+set grid
+set xrange [%g:%g]
+set yrange [0:100]
+
+plot %s
+`, escapeGnuplotString(outFile), cmd.OffsetTime, duration,
+		strings.Join(lines, ", \\\n     "))
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
+
+func generateNfsPlot(cmd *plotCommand, tmpDir, nfsDat string, meta *plotformatter.PlotMeta, duration float64) error {
+	if !meta.Nfs.Available {
+		// recorded without NFS mounts
+		return nil
+	}
+
+	gpFile := filepath.Join(tmpDir, "nfs.gp")
+	outFile := filepath.Join(cmd.OutputDir, "nfs."+cmd.OutputType)
+
+	// Each mount takes 4 columns in nfs.dat: read MB/s, write MB/s, ops/sec
+	// and average RTT. Throughput goes on the left axis, RTT on the right.
+	var lines []string
+	for idx, mount := range meta.Nfs.Mounts {
+		col := 2 + idx*4
+		name := escapeGnuplotString(mount)
+		lines = append(lines,
+			fmt.Sprintf(`"%s" usi 1:%d with lines lw 2 lc %d title "%s read"`, nfsDat, col, idx+1, name),
+			fmt.Sprintf(`"%s" usi 1:%d with lines lw 2 lc %d dt 2 title "%s write"`, nfsDat, col+1, idx+1, name),
+			fmt.Sprintf(`"%s" usi 1:%d axes x1y2 with points pt 7 ps 0.3 lc %d title "%s RTT"`, nfsDat, col+3, idx+1, name))
+	}
+
+	script := fmt.Sprintf(`set term pdfcairo enhanced color size 6in,2.5in
+set title "NFS client activity"
+set output "%s"
+set key below center
+set xlabel "elapsed time [sec]"
+set ylabel "throughput [MB/s]"
+set y2label "RTT [msec]"
+set y2tics
+set grid
+set xrange [%g:%g]
+set yrange [0:*]
+set y2range [0:*]
+
+plot %s
+`, escapeGnuplotString(outFile), cmd.OffsetTime, duration,
+		strings.Join(lines, ", \\\n     "))
+
+	if err := os.WriteFile(gpFile, []byte(script), 0644); err != nil {
+		return err
+	}
+	return runGnuplot(cmd, gpFile)
+}
@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/hayamiz/perfmonger/core/cmd/perfmonger-core/plotformatter"
 )
 
 // TestEscapeGnuplotString verifies that gnuplot C-style significant characters
@@ -114,3 +116,117 @@ func TestCheckPdfCairoSupported_NoShellInjection(t *testing.T) {
 			"GnuplotBin must not be passed through a shell", sentinel)
 	}
 }
+
+// TestGenerateNetPlot verifies that the network chart plots utilization of
+// links with known speed and falls back to throughput otherwise.
+func TestGenerateNetPlot(t *testing.T) {
+	tmpDir := t.TempDir()
+	cmd := newPlotCommandStruct()
+	cmd.GnuplotBin = "true"
+	cmd.OutputDir = tmpDir
+	cmd.OutputType = "pdf"
+
+	meta := &plotformatter.PlotMeta{}
+	meta.Net.Available = true
+	meta.Net.Devices = []plotformatter.NetMetaEntry{
+		{Name: "eth0", Speed: 10000}, {Name: "veth0", Speed: -1}}
+
+	gpFile := filepath.Join(tmpDir, "net.gp")
+	if err := generateNetPlot(cmd, tmpDir, "net.dat", meta, 10.0); err != nil {
+		t.Fatalf("generateNetPlot failed: %v", err)
+	}
+	script, err := os.ReadFile(gpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(script), "link utilization [%]") ||
+		!strings.Contains(string(script), `usi 1:4 with lines lw 2 lc 1 title "eth0 rx"`) ||
+		strings.Contains(string(script), "veth0") {
+		t.Errorf("unexpected utilization script:\n%s", script)
+	}
+
+	meta.Net.Devices[0].Speed = -1
+	if err := generateNetPlot(cmd, tmpDir, "net.dat", meta, 10.0); err != nil {
+		t.Fatalf("generateNetPlot failed: %v", err)
+	}
+	script, _ = os.ReadFile(gpFile)
+	if !strings.Contains(string(script), "throughput [MB/s]") ||
+		!strings.Contains(string(script), `usi 1:6 with lines lw 2 lc 2 title "veth0 rx"`) {
+		t.Errorf("unexpected throughput script:\n%s", script)
+	}
+}
+
+// TestGenerateThermalPlot verifies that the temperature chart overlays the
+// average CPU frequency when the log has it.
+func TestGenerateThermalPlot(t *testing.T) {
+	tmpDir := t.TempDir()
+	cmd := newPlotCommandStruct()
+	cmd.GnuplotBin = "true"
+	cmd.OutputDir = tmpDir
+	cmd.OutputType = "pdf"
+
+	meta := &plotformatter.PlotMeta{}
+	meta.Thermal.Available = true
+	meta.Thermal.Sensors = []string{"thermal_zone0:x86_pkg_temp", "nvme:Composite"}
+
+	gpFile := filepath.Join(tmpDir, "thermal.gp")
+	if err := generateThermalPlot(cmd, tmpDir, "thermal.dat", "freq.dat", meta, 10.0); err != nil {
+		t.Fatalf("generateThermalPlot failed: %v", err)
+	}
+	script, err := os.ReadFile(gpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(script), `usi 1:3 with lines lw 2 lc 2 title "nvme:Composite"`) ||
+		strings.Contains(string(script), "freq.dat") {
+		t.Errorf("unexpected script without cpufreq:\n%s", script)
+	}
+
+	meta.CpuFreq.Available = true
+	if err := generateThermalPlot(cmd, tmpDir, "thermal.dat", "freq.dat", meta, 10.0); err != nil {
+		t.Fatalf("generateThermalPlot failed: %v", err)
+	}
+	script, _ = os.ReadFile(gpFile)
+	if !strings.Contains(string(script), `"freq.dat" usi 1:2 axes x1y2`) {
+		t.Errorf("unexpected script with cpufreq:\n%s", script)
+	}
+}
+
+// TestGenerateCustomPlots verifies that each custom metric has a chart of
+// its own, with counters on the right axis next to gauges.
+func TestGenerateCustomPlots(t *testing.T) {
+	tmpDir := t.TempDir()
+	cmd := newPlotCommandStruct()
+	cmd.GnuplotBin = "true"
+	cmd.OutputDir = tmpDir
+	cmd.OutputType = "pdf"
+
+	meta := &plotformatter.PlotMeta{}
+	meta.Custom.Available = true
+	meta.Custom.Series = []plotformatter.CustomMetaEntry{
+		{Metric: "app", Name: "app.queue", Idx: 0},
+		{Metric: "app", Name: "app.requests", Counter: true, Idx: 1},
+		{Metric: "depth", Name: "depth", Idx: 2},
+	}
+
+	if err := generateCustomPlots(cmd, tmpDir, "custom.dat", meta, 10.0); err != nil {
+		t.Fatalf("generateCustomPlots failed: %v", err)
+	}
+	script, err := os.ReadFile(filepath.Join(tmpDir, "custom-app.gp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(script), `"custom.dat" ind 1 usi 1:2 axes x1y2`) ||
+		!strings.Contains(string(script), `title "app.requests [/sec]"`) ||
+		strings.Contains(string(script), `"depth"`) {
+		t.Errorf("unexpected script of app:\n%s", script)
+	}
+	script, err = os.ReadFile(filepath.Join(tmpDir, "custom-depth.gp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(script), `"custom.dat" ind 2 usi 1:2 with`) ||
+		strings.Contains(string(script), "y2") {
+		t.Errorf("unexpected script of depth:\n%s", script)
+	}
+}
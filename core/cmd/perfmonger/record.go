@@ -13,6 +13,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/hayamiz/perfmonger/core/cmd/perfmonger-core/recorder"
+	ss "github.com/hayamiz/perfmonger/core/internal/perfmonger"
 )
 
 // Environment variable used as a sentinel for the re-exec daemonization pattern.
@@ -107,6 +108,23 @@ func (cmd *recordCommand) validateOptions() error {
 	if cmd.RecorderOpt.Interval <= 0 {
 		return fmt.Errorf("interval must be positive")
 	}
+
+	if _, _, err := recorder.BuildNetFilter(cmd.RecorderOpt.NetOnly, cmd.RecorderOpt.NetExclude); err != nil {
+		return err
+	}
+
+	if _, _, err := recorder.BuildMountFilter(cmd.RecorderOpt.MountOnly, cmd.RecorderOpt.MountExclude); err != nil {
+		return err
+	}
+
+	if err := recorder.CheckRoots(cmd.RecorderOpt.ProcRoot, cmd.RecorderOpt.SysRoot); err != nil {
+		return err
+	}
+
+	if _, err := recorder.BuildCustomMetrics(cmd.RecorderOpt.ExecMetrics, cmd.RecorderOpt.ExecMetricStreams,
+		cmd.RecorderOpt.ExecMetricEvery, cmd.RecorderOpt.ExecMetricRates); err != nil {
+		return err
+	}
 	
 	return nil
 }
@@ -321,6 +339,41 @@ func (cmd *recordCommand) applyRubySpecificLogic() {
 	}
 }
 
+// addCollectorFlags defines --no-<name> for each registered collector except
+// `except`, which have options of their own.
+func addCollectorFlags(cmd *cobra.Command, opt *recorder.RecorderOption, except ...string) {
+	for _, collector := range ss.NewCollectors(nil) {
+		name := collector.Name()
+		if containsString(except, name) {
+			continue
+		}
+		disabled := opt.NoCollector(name)
+		cmd.Flags().BoolVar(disabled, "no-"+name, *disabled,
+			"Suppress recording "+collector.Description())
+	}
+}
+
+// addExecMetricFlags defines the options of the exec collector.
+func addExecMetricFlags(cmd *cobra.Command, opt *recorder.RecorderOption) {
+	cmd.Flags().StringArrayVar(&opt.ExecMetrics, "exec-metric", opt.ExecMetrics,
+		"Record the output of COMMAND as metric NAME; 'NAME=COMMAND' (repeatable)")
+	cmd.Flags().StringArrayVar(&opt.ExecMetricStreams, "exec-metric-stream", opt.ExecMetricStreams,
+		"Record each line of a long-lived COMMAND as metric NAME; 'NAME=COMMAND' (repeatable)")
+	cmd.Flags().IntVar(&opt.ExecMetricEvery, "exec-metric-every", opt.ExecMetricEvery,
+		"Run --exec-metric commands every N intervals")
+	cmd.Flags().StringArrayVar(&opt.ExecMetricRates, "exec-metric-rate", opt.ExecMetricRates,
+		"Show custom series matching PATTERN as per-second rates (Ex. 'app.requests', 'app.*'; repeatable)")
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
 // launchDaemonChild re-execs the current binary as a detached background process.
 // The parent returns nil after launching the child; the caller should then exit.
 func (cmd *recordCommand) launchDaemonChild() error {
@@ -333,14 +386,28 @@ func (cmd *recordCommand) launchDaemonChild() error {
 		args = append(args, "--start-delay", fmt.Sprintf("%g", cmd.RecorderOpt.StartDelay.Seconds()))
 	}
 	args = append(args, "-l", cmd.RecorderOpt.Output)
-	if cmd.RecorderOpt.NoCPU {
-		args = append(args, "--no-cpu")
+	for _, collector := range ss.NewCollectors(nil) {
+		if name := collector.Name(); name != "intr" {
+			args = append(args, fmt.Sprintf("--no-%s=%t", name, *cmd.RecorderOpt.NoCollector(name)))
+		}
+	}
+	if cmd.RecorderOpt.NetOnly != "" {
+		args = append(args, "--net-only", cmd.RecorderOpt.NetOnly)
+	}
+	if cmd.RecorderOpt.NetExclude != "" {
+		args = append(args, "--net-exclude", cmd.RecorderOpt.NetExclude)
 	}
-	if cmd.RecorderOpt.NoNet {
-		args = append(args, "--no-net")
+	if cmd.RecorderOpt.MountOnly != "" {
+		args = append(args, "--mount-only", cmd.RecorderOpt.MountOnly)
 	}
-	if cmd.RecorderOpt.NoMem {
-		args = append(args, "--no-mem")
+	if cmd.RecorderOpt.MountExclude != "" {
+		args = append(args, "--mount-exclude", cmd.RecorderOpt.MountExclude)
+	}
+	if cmd.RecorderOpt.ProcRoot != "/proc" {
+		args = append(args, "--procfs", cmd.RecorderOpt.ProcRoot)
+	}
+	if cmd.RecorderOpt.SysRoot != "/sys" {
+		args = append(args, "--sysfs", cmd.RecorderOpt.SysRoot)
 	}
 	if cmd.RecorderOpt.NoIntr || !cmd.RecordIntr {
 		args = append(args, "--record-intr=false")
@@ -354,6 +421,21 @@ func (cmd *recordCommand) launchDaemonChild() error {
 	for _, d := range cmd.RecorderOpt.DevsParts {
 		args = append(args, "-d", d)
 	}
+	for _, c := range cmd.RecorderOpt.Cgroups {
+		args = append(args, "--cgroup", c)
+	}
+	for _, spec := range cmd.RecorderOpt.ExecMetrics {
+		args = append(args, "--exec-metric", spec)
+	}
+	for _, spec := range cmd.RecorderOpt.ExecMetricStreams {
+		args = append(args, "--exec-metric-stream", spec)
+	}
+	if cmd.RecorderOpt.ExecMetricEvery != 1 {
+		args = append(args, "--exec-metric-every", strconv.Itoa(cmd.RecorderOpt.ExecMetricEvery))
+	}
+	for _, pattern := range cmd.RecorderOpt.ExecMetricRates {
+		args = append(args, "--exec-metric-rate", pattern)
+	}
 
 	selfBin, err := os.Executable()
 	if err != nil {
@@ -400,6 +482,8 @@ func newRecordCommand() *cobra.Command {
 	// Direct cobra flag setting to RecorderOption fields (no conversion needed)
 	cmd.Flags().StringSliceVarP(&recCmd.RecorderOpt.DevsParts, "disk", "d", recCmd.RecorderOpt.DevsParts, 
 		"Device name to be monitored (e.g. sda, sdb, md0, dm-1).")
+	cmd.Flags().StringArrayVar(&recCmd.RecorderOpt.Cgroups, "cgroup", recCmd.RecorderOpt.Cgroups, 
+		"cgroup v2 path to be monitored, relative to /sys/fs/cgroup (repeatable)")
 	cmd.Flags().StringVarP(&recCmd.RecorderOpt.Output, "logfile", "l", recCmd.RecorderOpt.Output, 
 		"Output file name")
 	
@@ -422,12 +506,20 @@ func newRecordCommand() *cobra.Command {
 	// Feature flags (direct setting to RecorderOption)
 	cmd.Flags().BoolVar(&recCmd.RecordIntr, "record-intr", recCmd.RecordIntr, 
 		"Record per core interrupts count (experimental)")
-	cmd.Flags().BoolVar(&recCmd.RecorderOpt.NoCPU, "no-cpu", recCmd.RecorderOpt.NoCPU, 
-		"Suppress recording CPU usage.")
-	cmd.Flags().BoolVar(&recCmd.RecorderOpt.NoNet, "no-net", recCmd.RecorderOpt.NoNet, 
-		"Suppress recording network usage")
-	cmd.Flags().BoolVar(&recCmd.RecorderOpt.NoMem, "no-mem", recCmd.RecorderOpt.NoMem, 
-		"Suppress recording memory usage")
+	addCollectorFlags(cmd, recCmd.RecorderOpt, "intr")
+	cmd.Flags().StringVar(&recCmd.RecorderOpt.NetOnly, "net-only", recCmd.RecorderOpt.NetOnly,
+		"Record network interfaces that match REGEX only (Ex. '^(eth|ens)')")
+	cmd.Flags().StringVar(&recCmd.RecorderOpt.NetExclude, "net-exclude", recCmd.RecorderOpt.NetExclude,
+		"Do not record network interfaces that match REGEX (Ex. '^(veth|docker)')")
+	cmd.Flags().StringVar(&recCmd.RecorderOpt.MountOnly, "mount-only", recCmd.RecorderOpt.MountOnly,
+		"Record filesystems whose mount point matches REGEX only (Ex. '^/(data|home)')")
+	cmd.Flags().StringVar(&recCmd.RecorderOpt.MountExclude, "mount-exclude", recCmd.RecorderOpt.MountExclude,
+		"Do not record filesystems whose mount point matches REGEX (Ex. '^/(boot|snap)')")
+	cmd.Flags().StringVar(&recCmd.RecorderOpt.ProcRoot, "procfs", recCmd.RecorderOpt.ProcRoot,
+		"Read procfs mounted at DIR (Ex. '/host/proc'; env: "+recorder.ProcRootEnvKey+")")
+	cmd.Flags().StringVar(&recCmd.RecorderOpt.SysRoot, "sysfs", recCmd.RecorderOpt.SysRoot,
+		"Read sysfs mounted at DIR (Ex. '/host/sys'; env: "+recorder.SysRootEnvKey+")")
+	addExecMetricFlags(cmd, recCmd.RecorderOpt)
 	cmd.Flags().BoolVar(&recCmd.NoGzip, "no-gzip", recCmd.NoGzip, 
 		"Do not save a logfile in gzipped format")
 	cmd.Flags().BoolVar(&recCmd.RecorderOpt.NoIntervalBackoff, "no-interval-backoff", recCmd.RecorderOpt.NoIntervalBackoff, 
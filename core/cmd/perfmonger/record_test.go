@@ -75,6 +75,62 @@ func TestRecordCommand_ValidateOptions(t *testing.T) {
 			},
 			wantErr: "start-delay cannot be negative",
 		},
+		{
+			name: "invalid net-only regex",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.NetOnly = "eth("
+			},
+			wantErr: "invalid net-only regex: error parsing regexp: missing closing ): `eth(`",
+		},
+		{
+			name: "invalid net-exclude regex",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.NetExclude = "[veth"
+			},
+			wantErr: "invalid net-exclude regex: error parsing regexp: missing closing ]: `[veth`",
+		},
+		{
+			name: "invalid mount-only regex",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.MountOnly = "^/(data"
+			},
+			wantErr: "invalid mount-only regex: error parsing regexp: missing closing ): `^/(data`",
+		},
+		{
+			name: "invalid mount-exclude regex",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.MountExclude = "*boot"
+			},
+			wantErr: "invalid mount-exclude regex: error parsing regexp: missing argument to repetition operator: `*`",
+		},
+		{
+			name: "missing procfs root",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.ProcRoot = "/nonexistent/proc"
+			},
+			wantErr: "procfs root is not a directory: /nonexistent/proc",
+		},
+		{
+			name: "sysfs root not a directory",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.SysRoot = "/proc/self/stat"
+			},
+			wantErr: "sysfs root is not a directory: /proc/self/stat",
+		},
+		{
+			name: "exec-metric without command",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.ExecMetrics = []string{"app"}
+			},
+			wantErr: "exec-metric must be NAME=COMMAND: app",
+		},
+		{
+			name: "zero exec-metric-every",
+			setup: func(cmd *recordCommand) {
+				cmd.RecorderOpt.ExecMetricEvery = 0
+			},
+			wantErr: "exec-metric-every must be positive",
+		},
 		{
 			name: "kill alone skips validation",
 			setup: func(cmd *recordCommand) {
@@ -120,9 +176,10 @@ func TestNewRecordCommand(t *testing.T) {
 
 	// Verify expected flags exist
 	expectedFlags := []string{
-		"disk", "logfile", "interval", "start-delay", "timeout",
+		"disk", "cgroup", "logfile", "interval", "start-delay", "timeout",
 		"kill", "status", "background", "record-intr",
-		"no-cpu", "no-net", "no-mem", "no-gzip", "no-interval-backoff",
+		"no-cpu", "no-cpufreq", "no-cpuidle", "no-thermal", "no-energy", "no-proc", "no-softirq", "no-softnet", "no-disk", "no-fs", "no-nfs", "no-net", "net-only", "net-exclude", "no-netproto", "no-mem", "no-numa", "no-vm", "no-pressure", "no-cgroup", "no-process", "mount-only", "mount-exclude", "procfs", "sysfs", "no-gzip", "no-interval-backoff",
+		"no-custom", "exec-metric", "exec-metric-stream", "exec-metric-every", "exec-metric-rate",
 		"verbose",
 	}
 	for _, name := range expectedFlags {
@@ -5,11 +5,13 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/hayamiz/perfmonger/core/cmd/perfmonger-core/recorder"
 	"github.com/hayamiz/perfmonger/core/cmd/perfmonger-core/summarizer"
+	"golang.org/x/sys/unix"
 )
 
 // statCommand represents the stat command with direct option setting
@@ -93,6 +95,15 @@ func (cmd *statCommand) validateOptions() error {
 	if cmd.RecorderOpt.Interval <= 0 {
 		return fmt.Errorf("interval must be positive")
 	}
+
+	if err := recorder.CheckRoots(cmd.RecorderOpt.ProcRoot, cmd.RecorderOpt.SysRoot); err != nil {
+		return err
+	}
+
+	if _, err := recorder.BuildCustomMetrics(cmd.RecorderOpt.ExecMetrics, cmd.RecorderOpt.ExecMetricStreams,
+		cmd.RecorderOpt.ExecMetricEvery, cmd.RecorderOpt.ExecMetricRates); err != nil {
+		return err
+	}
 	
 	return nil
 }
@@ -132,6 +143,11 @@ func (cmd *statCommand) run() error {
 	stopCh := make(chan struct{})
 	cmd.RecorderOpt.StopCh = stopCh
 
+	// The recorder samples the process tree of the user's command once its
+	// PID is sent
+	pidCh := make(chan int, 1)
+	cmd.RecorderOpt.TargetPidCh = pidCh
+
 	// Create a temporary goroutine to run the recorder in background
 	recorderDone := make(chan bool, 1)
 
@@ -150,7 +166,16 @@ func (cmd *statCommand) run() error {
 	userCmd.Stdout = os.Stdout
 	userCmd.Stderr = os.Stderr
 
-	cmdErr := userCmd.Run()
+	cmdErr := userCmd.Start()
+	if cmdErr == nil {
+		pidCh <- userCmd.Process.Pid
+
+		// Leave the exited command unreaped until the recorder takes the
+		// final sample, so that its /proc/<pid> entry remains readable.
+		if err := waitExited(userCmd.Process.Pid); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to wait for command: %v\n", err)
+		}
+	}
 
 	// Signal recorder to stop by closing the stop channel
 	close(stopCh)
@@ -163,6 +188,15 @@ func (cmd *statCommand) run() error {
 		fmt.Fprintf(os.Stderr, "Warning: recorder may still be running\n")
 	}
 
+	if cmdErr == nil {
+		cmdErr = userCmd.Wait()
+		if userCmd.ProcessState != nil {
+			if rusage, ok := userCmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+				cmd.SummaryOpt.MaxRss = rusage.Maxrss // KB on Linux
+			}
+		}
+	}
+
 	// Handle any error from the user command (but continue to show summary)
 	if cmdErr != nil {
 		fmt.Fprintf(os.Stderr, "Command failed: %v\n", cmdErr)
@@ -175,6 +209,17 @@ func (cmd *statCommand) run() error {
 	return nil
 }
 
+// waitExited blocks until the process exits without reaping it.
+func waitExited(pid int) error {
+	var info unix.Siginfo
+	for {
+		err := unix.Waitid(unix.P_PID, pid, &info, unix.WEXITED|unix.WNOWAIT, nil)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
+
 // newStatCommand creates the stat subcommand with direct cobra setting
 func newStatCommand() *cobra.Command {
 	statCmd := newStatCommandStruct()
@@ -199,6 +244,8 @@ func newStatCommand() *cobra.Command {
 	// Direct cobra flag setting to RecorderOption fields (no conversion needed) - same as record
 	cmd.Flags().StringSliceVarP(&statCmd.RecorderOpt.DevsParts, "disk", "d", statCmd.RecorderOpt.DevsParts, 
 		"Device name to be monitored (e.g. sda, sdb, md0, dm-1).")
+	cmd.Flags().StringArrayVar(&statCmd.RecorderOpt.Cgroups, "cgroup", statCmd.RecorderOpt.Cgroups, 
+		"cgroup v2 path to be monitored, relative to /sys/fs/cgroup (repeatable)")
 	cmd.Flags().StringVarP(&statCmd.RecorderOpt.Output, "logfile", "l", statCmd.RecorderOpt.Output, 
 		"Output file name")
 	
@@ -213,12 +260,12 @@ func newStatCommand() *cobra.Command {
 	// Feature flags (direct setting to RecorderOption) - same as record
 	cmd.Flags().BoolVar(&statCmd.RecordIntr, "record-intr", statCmd.RecordIntr, 
 		"Record per core interrupts count (experimental)")
-	cmd.Flags().BoolVar(&statCmd.RecorderOpt.NoCPU, "no-cpu", statCmd.RecorderOpt.NoCPU, 
-		"Suppress recording CPU usage.")
-	cmd.Flags().BoolVar(&statCmd.RecorderOpt.NoNet, "no-net", statCmd.RecorderOpt.NoNet, 
-		"Suppress recording network usage")
-	cmd.Flags().BoolVar(&statCmd.RecorderOpt.NoMem, "no-mem", statCmd.RecorderOpt.NoMem, 
-		"Suppress recording memory usage")
+	addCollectorFlags(cmd, statCmd.RecorderOpt, "intr")
+	cmd.Flags().StringVar(&statCmd.RecorderOpt.ProcRoot, "procfs", statCmd.RecorderOpt.ProcRoot,
+		"Read procfs mounted at DIR (Ex. '/host/proc'; env: "+recorder.ProcRootEnvKey+")")
+	cmd.Flags().StringVar(&statCmd.RecorderOpt.SysRoot, "sysfs", statCmd.RecorderOpt.SysRoot,
+		"Read sysfs mounted at DIR (Ex. '/host/sys'; env: "+recorder.SysRootEnvKey+")")
+	addExecMetricFlags(cmd, statCmd.RecorderOpt)
 	cmd.Flags().BoolVar(&statCmd.NoGzip, "no-gzip", statCmd.NoGzip, 
 		"Do not save a logfile in gzipped format")
 	cmd.Flags().BoolVar(&statCmd.RecorderOpt.NoIntervalBackoff, "no-interval-backoff", statCmd.RecorderOpt.NoIntervalBackoff, 
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
 	"testing"
 	"time"
 )
@@ -134,6 +137,13 @@ func TestStatCommand_ValidateOptions(t *testing.T) {
 			},
 			wantErr: "interval must be positive",
 		},
+		{
+			name: "missing procfs root",
+			setup: func(cmd *statCommand) {
+				cmd.RecorderOpt.ProcRoot = "/nonexistent/proc"
+			},
+			wantErr: "procfs root is not a directory: /nonexistent/proc",
+		},
 	}
 
 	for _, tt := range tests {
@@ -165,9 +175,10 @@ func TestNewStatCommand(t *testing.T) {
 
 	// Verify expected flags exist
 	expectedFlags := []string{
-		"disk", "logfile", "interval", "start-delay", "timeout",
-		"record-intr", "no-cpu", "no-net", "no-mem", "no-gzip",
-		"no-interval-backoff", "json", "verbose",
+		"disk", "cgroup", "logfile", "interval", "start-delay", "timeout",
+		"record-intr", "no-cpu", "no-disk", "no-nfs", "no-net", "no-mem", "no-gzip",
+		"no-interval-backoff", "procfs", "sysfs", "json", "verbose",
+		"no-custom", "exec-metric", "exec-metric-stream", "exec-metric-every", "exec-metric-rate",
 	}
 	for _, name := range expectedFlags {
 		if cmd.Flags().Lookup(name) == nil {
@@ -191,3 +202,24 @@ func TestNewStatCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestWaitExitedLeavesProcessUnreaped(t *testing.T) {
+	c := exec.Command("true")
+	if err := c.Start(); err != nil {
+		t.Skipf("cannot run true(1): %v", err)
+	}
+
+	if err := waitExited(c.Process.Pid); err != nil {
+		t.Fatalf("waitExited failed: %v", err)
+	}
+
+	// The exited process must remain as a zombie until Wait is called so
+	// that the recorder can take its final sample.
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d/stat", c.Process.Pid)); err != nil {
+		t.Errorf("/proc/<pid>/stat of the exited process is not readable: %v", err)
+	}
+
+	if err := c.Wait(); err != nil {
+		t.Errorf("Wait after waitExited failed: %v", err)
+	}
+}
@@ -190,6 +190,10 @@ func newSummaryCommand() *cobra.Command {
 		"Disable paging; write summary directly to stdout")
 	cmd.Flags().StringVar(&summaryCmd.SummaryOpt.DiskOnly, "disk-only", summaryCmd.SummaryOpt.DiskOnly,
 		"Select disk devices that matches REGEX (Ex. 'sd[b-d]')")
+	cmd.Flags().StringVar(&summaryCmd.SummaryOpt.NetOnly, "net-only", summaryCmd.SummaryOpt.NetOnly,
+		"Select network interfaces that match REGEX (Ex. '^(eth|ens)')")
+	cmd.Flags().StringVar(&summaryCmd.SummaryOpt.NetExclude, "net-exclude", summaryCmd.SummaryOpt.NetExclude,
+		"Exclude network interfaces that match REGEX (Ex. '^(veth|docker)')")
 
 	// Add aliases
 	cmd.Aliases = []string{"summarize"}
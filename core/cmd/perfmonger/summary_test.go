@@ -143,7 +143,7 @@ func TestNewSummaryCommand(t *testing.T) {
 		t.Errorf("Use = %q, want %q", cmd.Use, "summary [options] LOG_FILE")
 	}
 
-	expectedFlags := []string{"json", "pager", "no-pager", "disk-only"}
+	expectedFlags := []string{"json", "pager", "no-pager", "disk-only", "net-only", "net-exclude"}
 	for _, name := range expectedFlags {
 		if cmd.Flags().Lookup(name) == nil {
 			t.Errorf("expected flag %q to be defined", name)
@@ -0,0 +1,128 @@
+package perfmonger
+
+import (
+	"regexp"
+
+	projson "github.com/hayamiz/go-projson"
+)
+
+// UsageWriter is a usage computed from two records, e.g. *CpuUsage.
+type UsageWriter interface {
+	WriteJsonTo(printer *projson.JsonPrinter)
+}
+
+// Collector is a group of metrics which the recorder samples into
+// StatRecord and the player shows as a JSON key. The samples stay in
+// StatRecord fields so that logs recorded before a collector was introduced
+// can still be decoded. A collector which runs something in the background
+// also implements io.Closer, which the recorder calls after the last sample.
+type Collector interface {
+	// Name is the JSON key of the usage and the `<name>` of the recorder's
+	// --no-<name> flag.
+	Name() string
+
+	// Description completes the help of the --no-<name> flag, such as
+	// "Do not record " + Description().
+	Description() string
+
+	// CaptureHeader fills in the part of the platform header which the
+	// collector relies on. Called by NewPlatformHeaderOf.
+	CaptureHeader(header *LinuxHeader)
+
+	// Sample reads the current counters into `record`.
+	Sample(header *LinuxHeader, record *StatRecord) error
+
+	// Usage returns the usage between two records, or nil without error if
+	// `cur` has no samples of the collector.
+	Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error)
+}
+
+// CollectorOption selects the devices which collectors record or show, and
+// where they read procfs and sysfs.
+type CollectorOption struct {
+	Roots Roots // procfs and sysfs to be read; the zero value for /proc and /sys
+
+	TargetDisks *map[string]bool // disks to be recorded; nil for all
+	DiskOnly    *regexp.Regexp   // disks to be shown; nil for all
+	NetOnly     *regexp.Regexp   // network interfaces to be recorded and shown
+	NetExclude  *regexp.Regexp   // network interfaces not to be recorded nor shown
+
+	MountOnly    *regexp.Regexp // mount points to be recorded; nil for all
+	MountExclude *regexp.Regexp // mount points not to be recorded
+	Cgroups      []string       // cgroup v2 paths relative to /sys/fs/cgroup
+	TargetPid    chan int       // PID of a process tree to be recorded, sent once
+
+	CustomMetrics []LinuxCustomMetric // external commands to be recorded
+	CustomRates   []string            // see LinuxHeader.CustomRates
+}
+
+// Summarizer is implemented by a collector whose summary of a whole log is
+// not the usage between the first and the last record, e.g. that of gauges
+// or of counters which wrap around.
+type Summarizer interface {
+	NewSummary(header *LinuxHeader) Summary
+}
+
+// Summary accumulates the records of a log into the usage of a collector.
+type Summary interface {
+	// Add adds `cur`, which follows `prev`, or nil for the first record.
+	// The summary may keep both records, so the caller decodes each record
+	// into a zero StatRecord of its own.
+	Add(prev *StatRecord, cur *StatRecord)
+
+	// Usage returns the usage of the records added so far, or nil without
+	// error if they have no samples of the collector.
+	Usage() (UsageWriter, error)
+}
+
+// NewSummary returns the summary of `collector`, which is the usage between
+// the first and the last record unless the collector is a Summarizer.
+func NewSummary(collector Collector, header *LinuxHeader) Summary {
+	if summarizer, ok := collector.(Summarizer); ok {
+		return summarizer.NewSummary(header)
+	}
+	return &intervalSummary{collector: collector, header: header}
+}
+
+type intervalSummary struct {
+	collector Collector
+	header    *LinuxHeader
+	first     *StatRecord
+	last      *StatRecord
+}
+
+func (summary *intervalSummary) Add(prev *StatRecord, cur *StatRecord) {
+	if summary.first == nil {
+		summary.first = cur
+	}
+	summary.last = cur
+}
+
+func (summary *intervalSummary) Usage() (UsageWriter, error) {
+	if summary.first == nil {
+		return nil, nil
+	}
+	return summary.collector.Usage(summary.header, summary.first, summary.last)
+}
+
+var collector_factories []func(option *CollectorOption) Collector
+
+// RegisterCollector adds a kind of collector, usually from an init function.
+func RegisterCollector(factory func(option *CollectorOption) Collector) {
+	collector_factories = append(collector_factories, factory)
+}
+
+// NewCollectors returns a collector of each registered kind in the order of
+// registration. A nil `option` selects all devices.
+func NewCollectors(option *CollectorOption) []Collector {
+	if option == nil {
+		option = new(CollectorOption)
+	}
+
+	collectors := make([]Collector, 0, len(collector_factories))
+	for _, factory := range collector_factories {
+		collectors = append(collectors, factory(option))
+	}
+
+	return collectors
+}
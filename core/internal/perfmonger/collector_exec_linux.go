@@ -0,0 +1,304 @@
+// +build linux
+
+package perfmonger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// execCollector runs the external commands of CollectorOption.CustomMetrics
+// in the background, and samples the values which they reported last so
+// that a slow command does not delay the other collectors.
+type execCollector struct {
+	metrics []LinuxCustomMetric
+	rates   []string
+
+	mutex       sync.Mutex
+	samples     []CustomMetricSample
+	running     []bool
+	num_samples int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newExecCollector(option *CollectorOption) Collector {
+	return &execCollector{
+		metrics: option.CustomMetrics,
+		rates:   option.CustomRates,
+		samples: make([]CustomMetricSample, len(option.CustomMetrics)),
+		running: make([]bool, len(option.CustomMetrics)),
+	}
+}
+
+func (collector *execCollector) Name() string {
+	return "custom"
+}
+
+func (collector *execCollector) Description() string {
+	return "metrics of external commands"
+}
+
+func (collector *execCollector) CaptureHeader(header *LinuxHeader) {
+	header.CustomMetrics = collector.metrics
+	header.CustomRates = collector.rates
+}
+
+// Sample starts long-lived commands at the first call, and runs the other
+// commands every LinuxCustomMetric.Every calls unless the previous run is
+// still in progress.
+func (collector *execCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	if len(collector.metrics) == 0 {
+		return nil
+	}
+
+	var err error = nil
+	if collector.ctx == nil {
+		collector.ctx, collector.cancel = context.WithCancel(context.Background())
+		for idx, metric := range collector.metrics {
+			if metric.Stream {
+				if serr := collector.startStream(idx); serr != nil {
+					err = serr
+				}
+			}
+		}
+	}
+	for idx, metric := range collector.metrics {
+		if !metric.Stream && collector.num_samples%metric.Every == 0 {
+			collector.run(idx)
+		}
+	}
+	collector.num_samples++
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	if record.Custom == nil || len(record.Custom.Samples) != len(collector.metrics) {
+		record.Custom = NewCustomStat(len(collector.metrics))
+	}
+	// Values are replaced rather than updated, so they can be shared
+	copy(record.Custom.Samples, collector.samples)
+
+	return err
+}
+
+func (collector *execCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Custom == nil {
+		return nil, nil
+	}
+	usage, err := GetCustomUsage(header.CustomMetrics, header.CustomRates, prev.Custom, cur.Custom)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (collector *execCollector) NewSummary(header *LinuxHeader) Summary {
+	return &customSummary{header: header}
+}
+
+// customSummary counts values when they are reported, and accumulates
+// counters from report to report.
+type customSummary struct {
+	header *LinuxHeader
+	usage  *CustomUsage
+}
+
+func (summary *customSummary) Add(prev *StatRecord, cur *StatRecord) {
+	if cur.Custom == nil || len(summary.header.CustomMetrics) == 0 {
+		return
+	}
+	if summary.usage == nil {
+		summary.usage = NewCustomUsage(summary.header.CustomMetrics, summary.header.CustomRates)
+	}
+	var c1 *CustomStat = nil
+	if prev != nil {
+		c1 = prev.Custom
+	}
+	summary.usage.Add(c1, cur.Custom)
+}
+
+func (summary *customSummary) Usage() (UsageWriter, error) {
+	if summary.usage == nil {
+		return nil, nil
+	}
+	return summary.usage, nil
+}
+
+// Close kills the commands which are still running.
+func (collector *execCollector) Close() error {
+	if collector.cancel != nil {
+		collector.cancel()
+		collector.wg.Wait()
+	}
+
+	return nil
+}
+
+func (collector *execCollector) command(idx int) *exec.Cmd {
+	cmd := exec.CommandContext(collector.ctx, "/bin/sh", "-c", collector.metrics[idx].Command)
+	// run in a process group of its own so that the children of the shell
+	// are killed as well
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	return cmd
+}
+
+func (collector *execCollector) run(idx int) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	if collector.running[idx] {
+		return
+	}
+	collector.running[idx] = true
+
+	cmd := collector.command(idx)
+	collector.wg.Add(1)
+	go func() {
+		defer collector.wg.Done()
+		out, err := cmd.Output()
+
+		collector.mutex.Lock()
+		defer collector.mutex.Unlock()
+		collector.running[idx] = false
+		if err != nil {
+			return
+		}
+		values := ParseCustomMetricOutput(string(out))
+		if len(values) > 0 {
+			collector.samples[idx] = CustomMetricSample{time.Now(), values}
+		}
+	}()
+}
+
+func (collector *execCollector) startStream(idx int) error {
+	cmd := collector.command(idx)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	collector.wg.Add(1)
+	go func() {
+		defer collector.wg.Done()
+		scan := bufio.NewScanner(stdout)
+		for scan.Scan() {
+			values := ParseCustomMetricOutput(scan.Text())
+			if len(values) == 0 {
+				continue
+			}
+
+			collector.mutex.Lock()
+			// keys not in this line keep their last values
+			for key, value := range collector.samples[idx].Values {
+				if _, ok := values[key]; !ok {
+					values[key] = value
+				}
+			}
+			collector.samples[idx] = CustomMetricSample{time.Now(), values}
+			collector.mutex.Unlock()
+		}
+		cmd.Wait()
+	}()
+
+	return nil
+}
+
+// ParseCustomMetricOutput parses the output of an external command: a JSON
+// object, or lines each of which is a JSON object, `key value`, `key: value`,
+// `key=value` or a bare number. Members of nested objects and arrays have
+// dot-joined keys, such as "cache.hits" and "queues.0", and true and false
+// are taken as 1 and 0. A bare number has the key "". Lines starting with
+// '#' and values which are not numbers are ignored.
+func ParseCustomMetricOutput(output string) map[string]float64 {
+	values := make(map[string]float64)
+
+	output = strings.TrimSpace(output)
+	if strings.HasPrefix(output, "{") && parseCustomMetricJson(output, values) {
+		return values
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			parseCustomMetricJson(line, values)
+			continue
+		}
+
+		var key, value string
+		fields := strings.Fields(line)
+		if len(fields) == 1 {
+			if eq := strings.Index(line, "="); eq >= 0 {
+				key, value = line[:eq], line[eq+1:]
+			} else {
+				value = fields[0]
+			}
+		} else {
+			key, value = strings.TrimRight(fields[0], ":="), fields[1]
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		values[key] = v
+	}
+
+	return values
+}
+
+func parseCustomMetricJson(str string, values map[string]float64) bool {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(str), &obj); err != nil {
+		return false
+	}
+	flattenCustomMetricJson("", obj, values)
+
+	return true
+}
+
+func flattenCustomMetricJson(prefix string, v interface{}, values map[string]float64) {
+	switch v := v.(type) {
+	case float64:
+		values[prefix] = v
+	case bool:
+		if v {
+			values[prefix] = 1
+		} else {
+			values[prefix] = 0
+		}
+	case map[string]interface{}:
+		for key, child := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenCustomMetricJson(key, child, values)
+		}
+	case []interface{}:
+		for idx, child := range v {
+			key := strconv.Itoa(idx)
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenCustomMetricJson(key, child, values)
+		}
+	}
+}
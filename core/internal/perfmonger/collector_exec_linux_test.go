@@ -0,0 +1,84 @@
+package perfmonger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCustomMetricOutput(t *testing.T) {
+	cases := []struct {
+		output string
+		values map[string]float64
+	}{
+		{"42\n", map[string]float64{"": 42}},
+		{"# comment\nqueue 3\nhits: 10\nmisses=2\nstate ok\n\n", map[string]float64{"queue": 3, "hits": 10, "misses": 2}},
+		{`{"requests": 12, "cache": {"hit": 0.5, "enabled": true}, "queues": [1, 2], "version": "1.0"}`,
+			map[string]float64{"requests": 12, "cache.hit": 0.5, "cache.enabled": 1, "queues.0": 1, "queues.1": 2}},
+		{"{\n  \"a\": 1,\n  \"b\": 2\n}\n", map[string]float64{"a": 1, "b": 2}},
+		{"{\"a\": 1}\n{\"b\": 2}\nc 3\n", map[string]float64{"a": 1, "b": 2, "c": 3}},
+		{"x NaN\ny Inf\n", map[string]float64{}},
+	}
+
+	for _, c := range cases {
+		values := ParseCustomMetricOutput(c.output)
+		if !reflect.DeepEqual(values, c.values) {
+			t.Errorf("ParseCustomMetricOutput(%q) = %v, want %v", c.output, values, c.values)
+		}
+	}
+}
+
+func TestExecCollector(t *testing.T) {
+	collector := newExecCollector(&CollectorOption{
+		CustomMetrics: []LinuxCustomMetric{
+			{Name: "app", Command: "echo queue 3; echo hits 10", Every: 2},
+			{Name: "stream", Command: "echo 1; echo 'x 2'; sleep 60", Stream: true, Every: 2},
+		},
+		CustomRates: []string{"app.hits"},
+	})
+	defer collector.(*execCollector).Close()
+
+	header := new(LinuxHeader)
+	collector.CaptureHeader(header)
+	if len(header.CustomMetrics) != 2 || header.CustomRates[0] != "app.hits" {
+		t.Errorf("header = %+v", header)
+	}
+
+	// commands report in the background, so sample until both have
+	record := NewStatRecord()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err := collector.Sample(header, record); err != nil {
+			t.Fatalf("Sample returned an error: %v", err)
+		}
+		samples := record.Custom.Samples
+		if len(samples[0].Values) == 2 && len(samples[1].Values) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("commands did not report: %+v", samples)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	samples := record.Custom.Samples
+	if samples[0].Time.IsZero() || samples[0].Values["queue"] != 3 || samples[0].Values["hits"] != 10 {
+		t.Errorf("app = %+v", samples[0])
+	}
+	// keys not in the last line keep their values
+	if samples[1].Values[""] != 1 || samples[1].Values["x"] != 2 {
+		t.Errorf("stream = %+v", samples[1])
+	}
+
+	// Close kills the long-lived command
+	done := make(chan bool)
+	go func() {
+		collector.(*execCollector).Close()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Close did not kill the commands")
+	}
+}
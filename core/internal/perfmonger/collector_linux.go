@@ -0,0 +1,972 @@
+//go:build linux
+// +build linux
+
+package perfmonger
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+func init() {
+	RegisterCollector(newCpuCollector)
+	RegisterCollector(newCpuFreqCollector)
+	RegisterCollector(newCpuIdleCollector)
+	RegisterCollector(newThermalCollector)
+	RegisterCollector(newEnergyCollector)
+	RegisterCollector(newProcCollector)
+	RegisterCollector(newInterruptCollector)
+	RegisterCollector(newSoftIrqCollector)
+	RegisterCollector(newSoftnetCollector)
+	RegisterCollector(newDiskCollector)
+	RegisterCollector(newFsCollector)
+	RegisterCollector(newNfsCollector)
+	RegisterCollector(newNetCollector)
+	RegisterCollector(newNetProtoCollector)
+	RegisterCollector(newMemCollector)
+	RegisterCollector(newNumaCollector)
+	RegisterCollector(newVmCollector)
+	RegisterCollector(newPressureCollector)
+	RegisterCollector(newCgroupCollector)
+	RegisterCollector(newProcessCollector)
+	RegisterCollector(newExecCollector)
+}
+
+// cpuCollector samples CPU time of /proc/stat, and captures the NUMA nodes
+// and the topology of CPUs, by which CPU usage is grouped.
+type cpuCollector struct {
+	roots Roots
+}
+
+func newCpuCollector(option *CollectorOption) Collector {
+	return &cpuCollector{option.Roots}
+}
+
+func (collector *cpuCollector) Name() string {
+	return "cpu"
+}
+
+func (collector *cpuCollector) Description() string {
+	return "CPU usage"
+}
+
+func (collector *cpuCollector) CaptureHeader(header *LinuxHeader) {
+	header.NumaNodeCpus = readNumaNodeCpusFrom(collector.roots.sysPath("/devices/system/node"))
+	header.CpuTopology = readCpuTopologyFrom(collector.roots.sysPath("/devices/system/cpu"), header.NumaNodeCpus)
+}
+
+func (collector *cpuCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadCpuStat(record, collector.roots)
+}
+
+func (collector *cpuCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Cpu == nil {
+		return nil, nil
+	}
+	if prev.Cpu == nil {
+		return nil, errors.New("No CPU stat in the previous record")
+	}
+	usage, err := GetCpuUsage(prev.Cpu, cur.Cpu)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// cpuFreqCollector samples the current frequency of each CPU. The reader
+// leaves CpuFreq nil without cpufreq, so that Usage has no usage unless
+// both records have it, and so do the idle state, thermal and energy
+// collectors below.
+type cpuFreqCollector struct {
+	roots Roots
+}
+
+func newCpuFreqCollector(option *CollectorOption) Collector {
+	return &cpuFreqCollector{option.Roots}
+}
+
+func (collector *cpuFreqCollector) Name() string {
+	return "cpufreq"
+}
+
+func (collector *cpuFreqCollector) Description() string {
+	return "CPU frequencies"
+}
+
+func (collector *cpuFreqCollector) CaptureHeader(header *LinuxHeader) {
+	header.CpuGovernors = readCpuGovernorsFrom(collector.roots.sysPath("/devices/system/cpu"))
+}
+
+func (collector *cpuFreqCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadCpuFreqStat(record, collector.roots)
+}
+
+func (collector *cpuFreqCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.CpuFreq == nil || prev.CpuFreq == nil {
+		return nil, nil
+	}
+	usage, err := GetCpuFreqUsage(prev.CpuFreq, cur.CpuFreq)
+	if err != nil {
+		return nil, err
+	}
+	usage.Governors = header.CpuGovernors
+	return usage, nil
+}
+
+func (collector *cpuFreqCollector) NewSummary(header *LinuxHeader) Summary {
+	return &cpuFreqSummary{header: header}
+}
+
+// cpuFreqSummary accumulates the frequencies of all records, since they are
+// gauges, and so does thermalSummary.
+type cpuFreqSummary struct {
+	header *LinuxHeader
+	usage  *CpuFreqUsage
+}
+
+func (summary *cpuFreqSummary) Add(prev *StatRecord, cur *StatRecord) {
+	if cur.CpuFreq == nil {
+		return
+	}
+	if summary.usage == nil {
+		summary.usage = NewCpuFreqUsage(cur.CpuFreq.NumCore)
+		summary.usage.Governors = summary.header.CpuGovernors
+	}
+	summary.usage.Add(cur.CpuFreq)
+}
+
+func (summary *cpuFreqSummary) Usage() (UsageWriter, error) {
+	if summary.usage == nil {
+		return nil, nil
+	}
+	return summary.usage, nil
+}
+
+type cpuIdleCollector struct {
+	roots Roots
+}
+
+func newCpuIdleCollector(option *CollectorOption) Collector {
+	return &cpuIdleCollector{option.Roots}
+}
+
+func (collector *cpuIdleCollector) Name() string {
+	return "cpuidle"
+}
+
+func (collector *cpuIdleCollector) Description() string {
+	return "CPU idle states"
+}
+
+func (collector *cpuIdleCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *cpuIdleCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadCpuIdleStat(record, collector.roots)
+}
+
+func (collector *cpuIdleCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.CpuIdle == nil || prev.CpuIdle == nil {
+		return nil, nil
+	}
+	usage, err := GetCpuIdleUsage(prev.Time, prev.CpuIdle, cur.Time, cur.CpuIdle)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+type thermalCollector struct {
+	roots Roots
+}
+
+func newThermalCollector(option *CollectorOption) Collector {
+	return &thermalCollector{option.Roots}
+}
+
+func (collector *thermalCollector) Name() string {
+	return "thermal"
+}
+
+func (collector *thermalCollector) Description() string {
+	return "temperatures"
+}
+
+func (collector *thermalCollector) CaptureHeader(header *LinuxHeader) {
+	header.Sensors = readSensorsFrom(collector.roots.sysPath("/class/thermal"), collector.roots.sysPath("/class/hwmon"))
+}
+
+func (collector *thermalCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadThermalStat(record, header.Sensors)
+}
+
+func (collector *thermalCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Thermal == nil || prev.Thermal == nil {
+		return nil, nil
+	}
+	usage, err := GetThermalUsage(header.Sensors, prev.Thermal, cur.Thermal)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (collector *thermalCollector) NewSummary(header *LinuxHeader) Summary {
+	return &thermalSummary{header: header}
+}
+
+type thermalSummary struct {
+	header *LinuxHeader
+	usage  *ThermalUsage
+}
+
+func (summary *thermalSummary) Add(prev *StatRecord, cur *StatRecord) {
+	if cur.Thermal == nil || len(summary.header.Sensors) == 0 {
+		return
+	}
+	if summary.usage == nil {
+		summary.usage = NewThermalUsage(summary.header.Sensors)
+	}
+	summary.usage.Add(cur.Thermal)
+}
+
+func (summary *thermalSummary) Usage() (UsageWriter, error) {
+	if summary.usage == nil {
+		return nil, nil
+	}
+	return summary.usage, nil
+}
+
+type energyCollector struct {
+	roots Roots
+}
+
+func newEnergyCollector(option *CollectorOption) Collector {
+	return &energyCollector{option.Roots}
+}
+
+func (collector *energyCollector) Name() string {
+	return "energy"
+}
+
+func (collector *energyCollector) Description() string {
+	return "energy consumption"
+}
+
+func (collector *energyCollector) CaptureHeader(header *LinuxHeader) {
+	header.PowerDomains = readPowerDomainsFrom(collector.roots.sysPath("/class/powercap"))
+}
+
+func (collector *energyCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadEnergyStat(record, header.PowerDomains)
+}
+
+func (collector *energyCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Energy == nil || prev.Energy == nil {
+		return nil, nil
+	}
+	usage, err := GetEnergyUsage(header.PowerDomains, prev.Time, prev.Energy, cur.Time, cur.Energy)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (collector *energyCollector) NewSummary(header *LinuxHeader) Summary {
+	return &energySummary{header: header}
+}
+
+// energySummary accumulates energy interval by interval rather than taking
+// it from the first and the last record, since the counters wrap around.
+type energySummary struct {
+	header *LinuxHeader
+	usage  *EnergyUsage
+}
+
+func (summary *energySummary) Add(prev *StatRecord, cur *StatRecord) {
+	if prev == nil || prev.Energy == nil || cur.Energy == nil || len(summary.header.PowerDomains) == 0 {
+		return
+	}
+	if summary.usage == nil {
+		summary.usage = NewEnergyUsage(summary.header.PowerDomains)
+	}
+	summary.usage.Add(prev.Time, prev.Energy, cur.Time, cur.Energy)
+}
+
+func (summary *energySummary) Usage() (UsageWriter, error) {
+	if summary.usage == nil {
+		return nil, nil
+	}
+	return summary.usage, nil
+}
+
+// procCollector samples the process counters of /proc/stat and the load
+// average.
+type procCollector struct {
+	roots Roots
+}
+
+func newProcCollector(option *CollectorOption) Collector {
+	return &procCollector{option.Roots}
+}
+
+func (collector *procCollector) Name() string {
+	return "proc"
+}
+
+func (collector *procCollector) Description() string {
+	return "process counts and load average"
+}
+
+func (collector *procCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *procCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadProcStat(record, collector.roots)
+}
+
+func (collector *procCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Proc == nil || prev.Proc == nil {
+		return nil, nil
+	}
+	usage, err := GetProcUsage(prev.Time, prev.Proc, cur.Time, cur.Proc)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+type interruptCollector struct {
+	roots Roots
+}
+
+func newInterruptCollector(option *CollectorOption) Collector {
+	return &interruptCollector{option.Roots}
+}
+
+func (collector *interruptCollector) Name() string {
+	return "intr"
+}
+
+func (collector *interruptCollector) Description() string {
+	return "interrupts count"
+}
+
+func (collector *interruptCollector) CaptureHeader(header *LinuxHeader) {
+	header.IrqAffinity = readIrqAffinityFrom(collector.roots.procPath("/irq"))
+}
+
+func (collector *interruptCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadInterruptStat(record, collector.roots)
+}
+
+func (collector *interruptCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Interrupt == nil || prev.Interrupt == nil {
+		return nil, nil
+	}
+	usage, err := GetInterruptUsage(prev.Time, prev.Interrupt, cur.Time, cur.Interrupt)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+type softIrqCollector struct {
+	roots Roots
+}
+
+func newSoftIrqCollector(option *CollectorOption) Collector {
+	return &softIrqCollector{option.Roots}
+}
+
+func (collector *softIrqCollector) Name() string {
+	return "softirq"
+}
+
+func (collector *softIrqCollector) Description() string {
+	return "per core softirqs count"
+}
+
+func (collector *softIrqCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *softIrqCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadSoftIrqStat(record, collector.roots)
+}
+
+func (collector *softIrqCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Softirq == nil || prev.Softirq == nil {
+		return nil, nil
+	}
+	usage, err := GetSoftIrqUsage(prev.Time, prev.Softirq, cur.Time, cur.Softirq)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// softnetCollector samples the per-CPU packet processing counters of
+// /proc/net/softnet_stat.
+type softnetCollector struct {
+	roots Roots
+}
+
+func newSoftnetCollector(option *CollectorOption) Collector {
+	return &softnetCollector{option.Roots}
+}
+
+func (collector *softnetCollector) Name() string {
+	return "softnet"
+}
+
+func (collector *softnetCollector) Description() string {
+	return "per core packet processing counters"
+}
+
+func (collector *softnetCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *softnetCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadSoftnetStat(record, collector.roots)
+}
+
+func (collector *softnetCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Softnet == nil || prev.Softnet == nil {
+		return nil, nil
+	}
+	usage, err := GetSoftnetUsage(prev.Time, prev.Softnet, cur.Time, cur.Softnet)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (collector *softnetCollector) NewSummary(header *LinuxHeader) Summary {
+	return &softnetSummary{}
+}
+
+// softnetSummary accumulates the counters interval by interval, since they
+// are 32-bit and wrap around as well.
+type softnetSummary struct {
+	usage *SoftnetUsage
+}
+
+func (summary *softnetSummary) Add(prev *StatRecord, cur *StatRecord) {
+	if prev == nil || prev.Softnet == nil || cur.Softnet == nil {
+		return
+	}
+	if summary.usage == nil {
+		summary.usage = NewSoftnetUsage()
+	}
+	summary.usage.Add(prev.Time, prev.Softnet, cur.Time, cur.Softnet)
+}
+
+func (summary *softnetSummary) Usage() (UsageWriter, error) {
+	if summary.usage == nil {
+		return nil, nil
+	}
+	return summary.usage, nil
+}
+
+type diskCollector struct {
+	roots     Roots
+	targets   *map[string]bool
+	disk_only *regexp.Regexp
+}
+
+func newDiskCollector(option *CollectorOption) Collector {
+	return &diskCollector{option.Roots, option.TargetDisks, option.DiskOnly}
+}
+
+func (collector *diskCollector) Name() string {
+	return "disk"
+}
+
+func (collector *diskCollector) Description() string {
+	return "disk usage"
+}
+
+func (collector *diskCollector) CaptureHeader(header *LinuxHeader) {
+	header.getDevsParts(collector.roots)
+}
+
+func (collector *diskCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadDiskStats(record, collector.roots, collector.targets)
+}
+
+func (collector *diskCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Disk == nil || prev.Disk == nil {
+		return nil, nil
+	}
+	usage, err := GetDiskUsage2(prev.Time, prev.Disk, cur.Time, cur.Disk,
+		collector.disk_only, header.Devices)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// fsCollector samples the filesystems mounted at its first sample; a
+// filesystem mounted later is not recorded.
+type fsCollector struct {
+	roots   Roots
+	only    *regexp.Regexp
+	exclude *regexp.Regexp
+
+	mounted bool
+	mounts  []FsMount
+}
+
+func newFsCollector(option *CollectorOption) Collector {
+	return &fsCollector{roots: option.Roots, only: option.MountOnly, exclude: option.MountExclude}
+}
+
+func (collector *fsCollector) Name() string {
+	return "fs"
+}
+
+func (collector *fsCollector) Description() string {
+	return "filesystem usage"
+}
+
+func (collector *fsCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *fsCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	if !collector.mounted {
+		collector.mounted = true
+
+		mounts, err := ReadMounts(collector.roots, collector.only, collector.exclude)
+		if err != nil {
+			return fmt.Errorf("failed to read mounts: %v", err)
+		}
+		collector.mounts = mounts
+	}
+
+	return ReadFsStat(record, collector.roots, collector.mounts)
+}
+
+func (collector *fsCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Fs == nil || prev.Fs == nil {
+		return nil, nil
+	}
+	usage, err := GetFsUsage(prev.Time, prev.Fs, cur.Time, cur.Fs)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+type nfsCollector struct {
+	roots Roots
+}
+
+func newNfsCollector(option *CollectorOption) Collector {
+	return &nfsCollector{option.Roots}
+}
+
+func (collector *nfsCollector) Name() string {
+	return "nfs"
+}
+
+func (collector *nfsCollector) Description() string {
+	return "NFS client statistics"
+}
+
+func (collector *nfsCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *nfsCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadNfsStat(record, collector.roots)
+}
+
+// Usage has no usage without NFS mounts in both records, as the mounts may
+// be unmounted or mounted while recording.
+func (collector *nfsCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Nfs == nil || prev.Nfs == nil {
+		return nil, nil
+	}
+	usage, err := GetNfsUsage(prev.Time, prev.Nfs, cur.Time, cur.Nfs)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+type netCollector struct {
+	roots   Roots
+	only    *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newNetCollector(option *CollectorOption) Collector {
+	return &netCollector{option.Roots, option.NetOnly, option.NetExclude}
+}
+
+func (collector *netCollector) Name() string {
+	return "net"
+}
+
+func (collector *netCollector) Description() string {
+	return "network usage"
+}
+
+func (collector *netCollector) CaptureHeader(header *LinuxHeader) {
+	header.NetDevices = readNetDevicesFrom(collector.roots.sysPath("/class/net"))
+}
+
+func (collector *netCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadNetStat1(record, collector.roots, collector.only, collector.exclude)
+}
+
+func (collector *netCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Net == nil || prev.Net == nil {
+		return nil, nil
+	}
+	usage, err := GetNetUsage1(prev.Time, prev.Net, cur.Time, cur.Net,
+		header.NetDevices, collector.only, collector.exclude)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+type netProtoCollector struct {
+	roots Roots
+}
+
+func newNetProtoCollector(option *CollectorOption) Collector {
+	return &netProtoCollector{option.Roots}
+}
+
+func (collector *netProtoCollector) Name() string {
+	return "netproto"
+}
+
+func (collector *netProtoCollector) Description() string {
+	return "TCP/UDP/IP protocol counters"
+}
+
+func (collector *netProtoCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *netProtoCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadNetProtoStat(record, collector.roots)
+}
+
+func (collector *netProtoCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.NetProto == nil || prev.NetProto == nil {
+		return nil, nil
+	}
+	usage, err := GetNetProtoUsage(prev.Time, prev.NetProto, cur.Time, cur.NetProto)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// memCollector samples system-wide memory, and shows memory usage at the
+// time of `cur`.
+type memCollector struct {
+	roots Roots
+}
+
+func newMemCollector(option *CollectorOption) Collector {
+	return &memCollector{option.Roots}
+}
+
+func (collector *memCollector) Name() string {
+	return "mem"
+}
+
+func (collector *memCollector) Description() string {
+	return "memory usage"
+}
+
+func (collector *memCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *memCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadMemStat(record, collector.roots)
+}
+
+func (collector *memCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Mem == nil {
+		return nil, nil
+	}
+	usage, err := GetMemUsage(cur.Mem)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (collector *memCollector) NewSummary(header *LinuxHeader) Summary {
+	return &memSummary{}
+}
+
+// memSummary shows memory usage at the end, along with the lowest available
+// memory, which tells more about memory pressure than the value at the end.
+type memSummary struct {
+	last          *MemStat
+	min_avail_pct float64
+}
+
+func (summary *memSummary) Add(prev *StatRecord, cur *StatRecord) {
+	if cur.Mem == nil {
+		return
+	}
+	usage, err := GetMemUsage(cur.Mem)
+	if err != nil {
+		return
+	}
+	if summary.last == nil || usage.AvailablePct < summary.min_avail_pct {
+		summary.min_avail_pct = usage.AvailablePct
+	}
+	summary.last = cur.Mem
+}
+
+func (summary *memSummary) Usage() (UsageWriter, error) {
+	if summary.last == nil {
+		return nil, nil
+	}
+	usage, err := GetMemUsage(summary.last)
+	if err != nil {
+		return nil, err
+	}
+	usage.HasMinAvailable = true
+	usage.MinAvailablePct = summary.min_avail_pct
+	return usage, nil
+}
+
+// numaCollector samples memory of each NUMA node, and shows it together
+// with CPU usage of the node if CPU time is recorded as well.
+type numaCollector struct {
+	roots Roots
+}
+
+func newNumaCollector(option *CollectorOption) Collector {
+	return &numaCollector{option.Roots}
+}
+
+func (collector *numaCollector) Name() string {
+	return "numa"
+}
+
+func (collector *numaCollector) Description() string {
+	return "per NUMA node memory usage"
+}
+
+func (collector *numaCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *numaCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadNumaStat(record, collector.roots)
+}
+
+func (collector *numaCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Numa == nil || prev.Numa == nil {
+		return nil, nil
+	}
+	usage, err := GetNumaUsage(prev.Time, prev.Numa, cur.Time, cur.Numa)
+	if err != nil {
+		return nil, err
+	}
+	if prev.Cpu != nil && cur.Cpu != nil {
+		if cusage, err := GetCpuUsage(prev.Cpu, cur.Cpu); err == nil {
+			usage.SetCpuUsage(cusage, header.NumaNodeCpus)
+		}
+	}
+	return usage, nil
+}
+
+type vmCollector struct {
+	roots Roots
+}
+
+func newVmCollector(option *CollectorOption) Collector {
+	return &vmCollector{option.Roots}
+}
+
+func (collector *vmCollector) Name() string {
+	return "vm"
+}
+
+func (collector *vmCollector) Description() string {
+	return "paging and reclaim activity"
+}
+
+func (collector *vmCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *vmCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadVmStat(record, collector.roots)
+}
+
+func (collector *vmCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Vm == nil || prev.Vm == nil {
+		return nil, nil
+	}
+	usage, err := GetVmUsage(prev.Time, prev.Vm, cur.Time, cur.Vm)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+type pressureCollector struct {
+	roots Roots
+}
+
+func newPressureCollector(option *CollectorOption) Collector {
+	return &pressureCollector{option.Roots}
+}
+
+func (collector *pressureCollector) Name() string {
+	return "pressure"
+}
+
+func (collector *pressureCollector) Description() string {
+	return "pressure stall information"
+}
+
+func (collector *pressureCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *pressureCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return ReadPressureStat(record, collector.roots)
+}
+
+func (collector *pressureCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Pressure == nil || prev.Pressure == nil {
+		return nil, nil
+	}
+	usage, err := GetPressureUsage(prev.Time, prev.Pressure, cur.Time, cur.Pressure)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// cgroupCollector samples the cgroups in CollectorOption.Cgroups, and
+// samples nothing without them.
+type cgroupCollector struct {
+	roots Roots
+	paths []string
+}
+
+func newCgroupCollector(option *CollectorOption) Collector {
+	return &cgroupCollector{option.Roots, option.Cgroups}
+}
+
+func (collector *cgroupCollector) Name() string {
+	return "cgroup"
+}
+
+func (collector *cgroupCollector) Description() string {
+	return "usage of cgroups"
+}
+
+func (collector *cgroupCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *cgroupCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	if len(collector.paths) == 0 {
+		return nil
+	}
+	return ReadCgroupStat(record, collector.roots, collector.paths)
+}
+
+func (collector *cgroupCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Cgroup == nil || prev.Cgroup == nil || len(cur.Cgroup.Entries) == 0 {
+		return nil, nil
+	}
+	usage, err := GetCgroupUsage(prev.Time, prev.Cgroup, cur.Time, cur.Cgroup)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// processCollector samples the process tree of the PID sent to
+// CollectorOption.TargetPid, and samples nothing until the PID arrives.
+type processCollector struct {
+	roots  Roots
+	target chan int
+	pid    int
+}
+
+func newProcessCollector(option *CollectorOption) Collector {
+	return &processCollector{roots: option.Roots, target: option.TargetPid}
+}
+
+func (collector *processCollector) Name() string {
+	return "process"
+}
+
+func (collector *processCollector) Description() string {
+	return "resource usage of the command"
+}
+
+func (collector *processCollector) CaptureHeader(header *LinuxHeader) {
+}
+
+func (collector *processCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	if collector.pid == 0 && collector.target != nil {
+		select {
+		case collector.pid = <-collector.target:
+		default:
+		}
+	}
+	if collector.pid == 0 {
+		return nil
+	}
+	return ReadProcessStat(record, collector.roots, collector.pid)
+}
+
+// Usage shows the counters of the process tree at the time of `cur`, which
+// are cumulative from the start of each process.
+func (collector *processCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	if cur.Process == nil {
+		return nil, nil
+	}
+	usage, err := GetProcessUsage(cur.Process, header.ClockTicks)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (collector *processCollector) NewSummary(header *LinuxHeader) Summary {
+	return &processSummary{header: header}
+}
+
+// processSummary merges the counters of all records, since they are
+// cumulative but not monotonic (see ProcessUsage.Merge).
+type processSummary struct {
+	header *LinuxHeader
+	usage  *ProcessUsage
+}
+
+func (summary *processSummary) Add(prev *StatRecord, cur *StatRecord) {
+	if cur.Process == nil {
+		return
+	}
+	usage, err := GetProcessUsage(cur.Process, summary.header.ClockTicks)
+	if err != nil {
+		return
+	}
+	if summary.usage == nil {
+		summary.usage = usage
+	} else {
+		summary.usage.Merge(usage)
+	}
+}
+
+func (summary *processSummary) Usage() (UsageWriter, error) {
+	if summary.usage == nil {
+		return nil, nil
+	}
+	return summary.usage, nil
+}
@@ -0,0 +1,144 @@
+package perfmonger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeCollector struct{}
+
+func (collector *fakeCollector) Name() string                      { return "fake" }
+func (collector *fakeCollector) Description() string               { return "fake metrics" }
+func (collector *fakeCollector) CaptureHeader(header *LinuxHeader) {}
+func (collector *fakeCollector) Sample(header *LinuxHeader, record *StatRecord) error {
+	return nil
+}
+func (collector *fakeCollector) Usage(header *LinuxHeader, prev *StatRecord, cur *StatRecord) (UsageWriter, error) {
+	return nil, nil
+}
+
+func TestNewCollectors(t *testing.T) {
+	names := []string{}
+	for _, collector := range NewCollectors(nil) {
+		names = append(names, collector.Name())
+	}
+	if fmt.Sprint(names) != "[cpu cpufreq cpuidle thermal energy proc intr softirq softnet disk fs nfs net netproto mem numa vm pressure cgroup process custom]" {
+		t.Errorf("collectors = %v", names)
+	}
+
+	orig := collector_factories
+	defer func() { collector_factories = orig }()
+	RegisterCollector(func(option *CollectorOption) Collector { return &fakeCollector{} })
+	collectors := NewCollectors(nil)
+	if len(collectors) != len(names)+1 || collectors[len(names)].Name() != "fake" {
+		t.Errorf("fake collector is not registered: %v", collectors)
+	}
+}
+
+func TestCollectorSampleAndUsage(t *testing.T) {
+	proc_root := t.TempDir()
+	writeFile := func(path string, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(proc_root+"/meminfo", "MemTotal:        1024000 kB\nMemFree:          512000 kB")
+
+	collectors := make(map[string]Collector)
+	for _, collector := range NewCollectors(&CollectorOption{Roots: NewRoots(proc_root, "")}) {
+		collectors[collector.Name()] = collector
+	}
+	header := new(LinuxHeader)
+
+	t0, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	prev := NewStatRecord()
+	prev.Time = t0
+	cur := NewStatRecord()
+	cur.Time = t0.Add(time.Second)
+
+	if err := collectors["mem"].Sample(header, cur); err != nil {
+		t.Fatalf("Sample returned an error: %v", err)
+	}
+	usage, err := collectors["mem"].Usage(header, prev, cur)
+	if err != nil || usage == nil {
+		t.Fatalf("Usage = %v, %v", usage, err)
+	}
+	if _, ok := usage.(*MemUsage); !ok {
+		t.Errorf("usage = %+v", usage)
+	}
+
+	// a record without samples of the collector has no usage
+	usage, err = collectors["net"].Usage(header, prev, cur)
+	if err != nil || usage != nil {
+		t.Errorf("Usage without samples = %v, %v, want nil", usage, err)
+	}
+
+	cur.Cpu = NewCpuStat(1)
+	if _, err := collectors["cpu"].Usage(header, prev, cur); err == nil {
+		t.Error("Error should be returned without the previous sample")
+	}
+
+	// temperatures are shown without CPU samples
+	header.Sensors = []LinuxSensor{{"thermal_zone0:x86_pkg_temp", ""}}
+	prev.Thermal = &ThermalStat{[]int64{40000}}
+	cur.Thermal = &ThermalStat{[]int64{42000}}
+	usage, err = collectors["thermal"].Usage(header, prev, cur)
+	if err != nil || usage == nil {
+		t.Fatalf("Usage = %v, %v", usage, err)
+	}
+	if _, ok := usage.(*ThermalUsage); !ok {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestNewSummary(t *testing.T) {
+	collectors := make(map[string]Collector)
+	for _, collector := range NewCollectors(nil) {
+		collectors[collector.Name()] = collector
+	}
+	header := new(LinuxHeader)
+	proc_summary := NewSummary(collectors["proc"], header)
+	mem_summary := NewSummary(collectors["mem"], header)
+
+	if usage, err := proc_summary.Usage(); err != nil || usage != nil {
+		t.Errorf("Usage without records = %v, %v, want nil", usage, err)
+	}
+
+	t0, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	var prev *StatRecord = nil
+	for idx, avail := range []int64{500, 200, 800} {
+		cur := NewStatRecord()
+		cur.Time = t0.Add(time.Duration(idx) * time.Second)
+		cur.Proc = &ProcStat{ContextSwitch: int64(idx * idx * 10)}
+		cur.Mem = &MemStat{MemTotal: 1000, HasMemAvailable: true, MemAvailable: avail}
+
+		proc_summary.Add(prev, cur)
+		mem_summary.Add(prev, cur)
+		prev = cur
+	}
+
+	// counters are taken between the first and the last record
+	usage, err := proc_summary.Usage()
+	if err != nil {
+		t.Fatalf("Usage returned an error: %v", err)
+	}
+	if pusage := usage.(*ProcUsage); pusage.ContextSwitch != 20.0 {
+		t.Errorf("ContextSwitch = %v, want 20.0", pusage.ContextSwitch)
+	}
+
+	// memory is at the end, along with the lowest available memory
+	usage, err = mem_summary.Usage()
+	if err != nil {
+		t.Fatalf("Usage returned an error: %v", err)
+	}
+	if musage := usage.(*MemUsage); musage.AvailablePct != 80.0 ||
+		!musage.HasMinAvailable || musage.MinAvailablePct != 20.0 {
+		t.Errorf("usage = %+v, want 80 %% available and 20 %% at least", musage)
+	}
+}
@@ -1,6 +1,7 @@
 package perfmonger
 
 import (
+	"path/filepath"
 	"time"
 )
 
@@ -40,6 +41,32 @@ type CommonHeader struct {
 	StartTime time.Time
 }
 
+//
+// Roots of procfs and sysfs
+//
+
+// Roots are where the readers look for procfs and sysfs, e.g. /host/proc
+// and /host/sys to monitor the host from inside a container, or a captured
+// tree in tests. The zero value reads /proc and /sys.
+type Roots struct {
+	Proc string
+	Sys  string
+}
+
+// NewRoots returns the roots of procfs and sysfs; "" is taken as the
+// default.
+func NewRoots(proc_root string, sys_root string) Roots {
+	roots := Roots{"/proc", "/sys"}
+	if proc_root != "" {
+		roots.Proc = filepath.Clean(proc_root)
+	}
+	if sys_root != "" {
+		roots.Sys = filepath.Clean(sys_root)
+	}
+
+	return roots
+}
+
 //
 // Platform-dependent header
 //
@@ -49,8 +76,93 @@ type LinuxDevice struct {
 	Parts []string
 }
 
+// LinuxCpuTopology is the location of a logical CPU taken from
+// /sys/devices/system/cpu/cpuN/topology. Ids are -1 if unknown.
+type LinuxCpuTopology struct {
+	PackageId      int
+	CoreId         int
+	NodeId         int
+	ThreadSiblings []int
+}
+
+// LinuxNetDevice is the link metadata of a network interface taken from
+// /sys/class/net/<if>. Speed and Mtu are -1 if unknown.
+type LinuxNetDevice struct {
+	Speed     int64  // link speed in Mb/s
+	Duplex    string // "full", "half" or "unknown"
+	Mtu       int64
+	OperState string // "up", "down", "unknown", ...
+	Type      int64  // ARPHRD_* link type (1 for ethernet, 772 for loopback)
+
+	Physical bool // backed by a device (has /sys/class/net/<if>/device)
+
+	Kind   string   // "bond", "bridge", "veth", "vlan", ... or "" for others
+	Master string   // bond or bridge this interface is enslaved to
+	Lowers []string // bond slaves or bridge ports
+	Peer   string   // the other end of a veth pair if in the same namespace
+}
+
+// LinuxSensor is a temperature sensor in /sys/class/thermal or
+// /sys/class/hwmon.
+type LinuxSensor struct {
+	Name string // "<zone>:<type>" for thermal zones, "<chip>:<label>" for hwmon
+	Path string // file to read the temperature in millidegree Celsius
+}
+
+// LinuxPowerDomain is a powercap (RAPL) zone which has an energy counter,
+// e.g. /sys/class/powercap/intel-rapl:0 or its subzone intel-rapl:0:2.
+type LinuxPowerDomain struct {
+	Name           string // "package-0", or "package-0/dram" for a subzone
+	Zone           string // "package-0", "core", "uncore", "dram", "psys", ...
+	Parent         string // Name of the parent zone, "" if top-level
+	Path           string // zone directory
+	MaxEnergyRange int64  // energy_uj wraps around at this value
+}
+
+// LinuxCustomMetric is an external command given by `record --exec-metric`
+// or `--exec-metric-stream`, whose output is recorded in CustomStat.
+type LinuxCustomMetric struct {
+	Name    string
+	Command string // run by /bin/sh -c
+	Stream  bool   // long-lived command which reports a sample per line
+	Every   int    // run the command every Every records unless Stream
+}
+
 type LinuxHeader struct {
 	Devices   map[string]LinuxDevice
 	DevsParts []string
+
+	// cpufreq scaling governor of each core, "" if unavailable
+	CpuGovernors []string
+
+	// smp_affinity_list of each IRQ line (e.g. "0-3"), keyed by IRQ number
+	IrqAffinity map[int]string
+
+	// ids of CPUs in each NUMA node, keyed by node id; nil on non-NUMA
+	// kernels
+	NumaNodeCpus map[int][]int
+
+	// topology of each CPU, indexed by CPU id; nil if unavailable
+	CpuTopology []LinuxCpuTopology
+
+	// link metadata of each network interface, keyed by interface name
+	NetDevices map[string]LinuxNetDevice
+
+	// temperature sensors in the order of ThermalStat.Temps; nil if none
+	Sensors []LinuxSensor
+
+	// powercap domains in the order of EnergyStat.Energy; nil if none
+	PowerDomains []LinuxPowerDomain
+
+	// external commands in the order of CustomStat.Samples; nil if none
+	CustomMetrics []LinuxCustomMetric
+
+	// patterns (see path.Match) of the custom series which are counters
+	// and shown as per-second rates, e.g. "app.requests" or "app.*"
+	CustomRates []string
+
+	// USER_HZ, the unit of utime and stime of ProcessStatEntry; 0 in logs
+	// recorded before it was, which were recorded with 100
+	ClockTicks int64
 }
 
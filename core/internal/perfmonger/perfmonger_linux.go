@@ -4,29 +4,108 @@ package perfmonger
 
 import (
 	"bufio"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 type PlatformHeader LinuxHeader
 
+// procPath and sysPath return `path` under the roots.
+func (roots Roots) procPath(path string) string {
+	if roots.Proc == "" {
+		return "/proc" + path
+	}
+	return roots.Proc + path
+}
+
+func (roots Roots) sysPath(path string) string {
+	if roots.Sys == "" {
+		return "/sys" + path
+	}
+	return roots.Sys + path
+}
+
+// selfPath returns the file `name` of /proc/self, i.e. of the mount namespace
+// of perfmonger, or that of init in another procfs, whose self would still be
+// perfmonger.
+func (roots Roots) selfPath(name string) string {
+	if roots.Proc == "" || roots.Proc == "/proc" {
+		return "/proc/self/" + name
+	}
+	return roots.Proc + "/1/" + name
+}
+
+// mountPath returns where `mount_point` of the mount namespace of selfPath
+// is accessible.
+func (roots Roots) mountPath(mount_point string) string {
+	if roots.Proc == "" || roots.Proc == "/proc" {
+		return mount_point
+	}
+	return roots.Proc + "/1/root" + mount_point
+}
+
 func NewPlatformHeader() *LinuxHeader {
+	return NewPlatformHeaderOf(NewCollectors(nil))
+}
+
+// NewPlatformHeaderOf returns the header captured by `collectors`, whose
+// options may add to it, e.g. the commands of the exec collector.
+func NewPlatformHeaderOf(collectors []Collector) *LinuxHeader {
 	header := new(LinuxHeader)
 	header.Devices = make(map[string]LinuxDevice)
+	header.ClockTicks = readClockTicksFrom("/proc/self/auxv")
 
-	header.getDevsParts()
+	for _, collector := range collectors {
+		collector.CaptureHeader(header)
+	}
 
 	return header
 }
 
-func (header *LinuxHeader) getDevsParts() {
-	f, err := os.Open("/proc/diskstats")
+// AT_CLKTCK, the type of the auxiliary vector entry holding USER_HZ
+const atClkTck = 17
+
+// readClockTicksFrom returns USER_HZ from the auxiliary vector in `auxv`,
+// pairs of type and value in native words, or 100 if it is not found.
+// sysconf(_SC_CLK_TCK) reads the same entry.
+func readClockTicksFrom(auxv string) int64 {
+	buf, err := os.ReadFile(auxv)
+	if err != nil {
+		return 100
+	}
+
+	word := strconv.IntSize / 8
+	for off := 0; off+2*word <= len(buf); off += 2 * word {
+		var typ, val uint64
+		if word == 8 {
+			typ = binary.NativeEndian.Uint64(buf[off:])
+			val = binary.NativeEndian.Uint64(buf[off+word:])
+		} else {
+			typ = uint64(binary.NativeEndian.Uint32(buf[off:]))
+			val = uint64(binary.NativeEndian.Uint32(buf[off+word:]))
+		}
+		if typ == atClkTck && val > 0 {
+			return int64(val)
+		}
+	}
+
+	return 100
+}
+
+func (header *LinuxHeader) getDevsParts(roots Roots) {
+	f, err := os.Open(roots.procPath("/diskstats"))
 	if err != nil {
 		panic(err)
 	}
@@ -45,16 +124,484 @@ func (header *LinuxHeader) getDevsParts() {
 
 		header.DevsParts = append(header.DevsParts, name)
 
-		if isDevice(name) {
+		if isDevice(roots.sysPath("/block"), name) {
 			header.Devices[name] = LinuxDevice{
-				name, getPartitions(name),
+				name, getPartitionsFromDir(roots.sysPath("/block"), name),
+			}
+		}
+	}
+}
+
+// listCpuIds returns the ids of cpuN directories in `cpu_dir` (normally
+// /sys/devices/system/cpu) in ascending order.
+func listCpuIds(cpu_dir string) []int {
+	fis, err := ioutil.ReadDir(cpu_dir)
+	if err != nil {
+		return nil
+	}
+
+	cpu_ids := []int{}
+	for _, fi := range fis {
+		if !strings.HasPrefix(fi.Name(), "cpu") {
+			continue
+		}
+		cpu_id, err := strconv.Atoi(fi.Name()[3:])
+		if err != nil {
+			continue
+		}
+		cpu_ids = append(cpu_ids, cpu_id)
+	}
+	sort.Ints(cpu_ids)
+
+	return cpu_ids
+}
+
+// readCpuGovernorsFrom returns the cpufreq scaling governor of each core,
+// or nil if cpufreq is unavailable.
+func readCpuGovernorsFrom(cpu_dir string) []string {
+	cpu_ids := listCpuIds(cpu_dir)
+	if len(cpu_ids) == 0 {
+		return nil
+	}
+
+	governors := make([]string, cpu_ids[len(cpu_ids)-1]+1)
+	found := false
+	for _, cpu_id := range cpu_ids {
+		content, err := ioutil.ReadFile(
+			fmt.Sprintf("%s/cpu%d/cpufreq/scaling_governor", cpu_dir, cpu_id))
+		if err != nil {
+			continue
+		}
+		governors[cpu_id] = strings.TrimSpace(string(content))
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+
+	return governors
+}
+
+// readIrqAffinityFrom returns smp_affinity_list of each IRQ directory in
+// `irq_dir` (normally /proc/irq), or nil if none is readable.
+func readIrqAffinityFrom(irq_dir string) map[int]string {
+	fis, err := ioutil.ReadDir(irq_dir)
+	if err != nil {
+		return nil
+	}
+
+	var affinity map[int]string = nil
+	for _, fi := range fis {
+		irqno, err := strconv.Atoi(fi.Name())
+		if err != nil {
+			continue
+		}
+		content, err := ioutil.ReadFile(
+			fmt.Sprintf("%s/%d/smp_affinity_list", irq_dir, irqno))
+		if err != nil {
+			continue
+		}
+		if affinity == nil {
+			affinity = make(map[int]string)
+		}
+		affinity[irqno] = strings.TrimSpace(string(content))
+	}
+
+	return affinity
+}
+
+// listNodeIds returns the ids of nodeN directories in `node_dir` (normally
+// /sys/devices/system/node) in ascending order.
+func listNodeIds(node_dir string) []int {
+	fis, err := ioutil.ReadDir(node_dir)
+	if err != nil {
+		return nil
+	}
+
+	node_ids := []int{}
+	for _, fi := range fis {
+		if !strings.HasPrefix(fi.Name(), "node") {
+			continue
+		}
+		node_id, err := strconv.Atoi(fi.Name()[4:])
+		if err != nil {
+			continue
+		}
+		node_ids = append(node_ids, node_id)
+	}
+	sort.Ints(node_ids)
+
+	return node_ids
+}
+
+// parseCpuList parses a CPU list such as "0-3,8,10-11" into CPU ids.
+func parseCpuList(cpulist string) ([]int, error) {
+	cpu_ids := []int{}
+	cpulist = strings.TrimSpace(cpulist)
+	if cpulist == "" {
+		return cpu_ids, nil
+	}
+
+	for _, part := range strings.Split(cpulist, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for cpu_id := first; cpu_id <= last; cpu_id++ {
+			cpu_ids = append(cpu_ids, cpu_id)
+		}
+	}
+
+	return cpu_ids, nil
+}
+
+// readNumaNodeCpusFrom returns the cpulist of each nodeN directory in
+// `node_dir`, or nil if none is readable.
+func readNumaNodeCpusFrom(node_dir string) map[int][]int {
+	var node_cpus map[int][]int = nil
+	for _, node_id := range listNodeIds(node_dir) {
+		content, err := ioutil.ReadFile(
+			fmt.Sprintf("%s/node%d/cpulist", node_dir, node_id))
+		if err != nil {
+			continue
+		}
+		cpu_ids, err := parseCpuList(string(content))
+		if err != nil {
+			continue
+		}
+		if node_cpus == nil {
+			node_cpus = make(map[int][]int)
+		}
+		node_cpus[node_id] = cpu_ids
+	}
+
+	return node_cpus
+}
+
+// readCpuTopologyFrom returns the topology of each cpuN directory in
+// `cpu_dir`, or nil if no CPU has a topology directory. The NUMA node of a
+// CPU is looked up in `node_cpus`.
+func readCpuTopologyFrom(cpu_dir string, node_cpus map[int][]int) []LinuxCpuTopology {
+	cpu_ids := listCpuIds(cpu_dir)
+	if len(cpu_ids) == 0 {
+		return nil
+	}
+
+	readId := func(path string) int {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return -1
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			return -1
+		}
+		return id
+	}
+
+	topology := make([]LinuxCpuTopology, cpu_ids[len(cpu_ids)-1]+1)
+	for idx := range topology {
+		topology[idx] = LinuxCpuTopology{-1, -1, -1, nil}
+	}
+	found := false
+	for _, cpu_id := range cpu_ids {
+		topo_dir := fmt.Sprintf("%s/cpu%d/topology", cpu_dir, cpu_id)
+		if _, err := os.Stat(topo_dir); err != nil {
+			continue
+		}
+		found = true
+
+		cpu_topo := &topology[cpu_id]
+		cpu_topo.PackageId = readId(topo_dir + "/physical_package_id")
+		cpu_topo.CoreId = readId(topo_dir + "/core_id")
+		if content, err := ioutil.ReadFile(topo_dir + "/thread_siblings_list"); err == nil {
+			cpu_topo.ThreadSiblings, _ = parseCpuList(string(content))
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	for node_id, node_cpu_ids := range node_cpus {
+		for _, cpu_id := range node_cpu_ids {
+			if cpu_id >= 0 && cpu_id < len(topology) {
+				topology[cpu_id].NodeId = node_id
+			}
+		}
+	}
+
+	return topology
+}
+
+// readNetDevicesFrom returns link metadata of each interface in `net_dir`
+// (normally /sys/class/net), or nil if none is found. Attributes which the
+// kernel refuses to report (e.g. speed of a down or virtual link) are left
+// as -1 or "unknown".
+func readNetDevicesFrom(net_dir string) map[string]LinuxNetDevice {
+	fis, err := ioutil.ReadDir(net_dir)
+	if err != nil {
+		return nil
+	}
+
+	readStr := func(path string) string {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(content))
+	}
+	readInt := func(path string) int64 {
+		val, err := strconv.ParseInt(readStr(path), 10, 64)
+		if err != nil {
+			return -1
+		}
+		return val
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	var devices map[string]LinuxNetDevice = nil
+	ifnames := make(map[int64]string)
+	iflinks := make(map[string]int64)
+
+	for _, fi := range fis {
+		name := fi.Name()
+		dev_dir := net_dir + "/" + name
+		if !exists(dev_dir + "/type") {
+			continue
+		}
+
+		dev := LinuxNetDevice{
+			Speed:     readInt(dev_dir + "/speed"),
+			Duplex:    readStr(dev_dir + "/duplex"),
+			Mtu:       readInt(dev_dir + "/mtu"),
+			OperState: readStr(dev_dir + "/operstate"),
+			Type:      readInt(dev_dir + "/type"),
+		}
+		if dev.Speed <= 0 {
+			dev.Speed = -1
+		}
+		if dev.Duplex == "" {
+			dev.Duplex = "unknown"
+		}
+		if dev.OperState == "" {
+			dev.OperState = "unknown"
+		}
+
+		for _, line := range strings.Split(readStr(dev_dir+"/uevent"), "\n") {
+			if strings.HasPrefix(line, "DEVTYPE=") {
+				dev.Kind = line[len("DEVTYPE="):]
+			}
+		}
+
+		if exists(dev_dir + "/bonding") {
+			dev.Kind = "bond"
+			if slaves := readStr(dev_dir + "/bonding/slaves"); slaves != "" {
+				dev.Lowers = strings.Fields(slaves)
+			}
+		} else if exists(dev_dir + "/bridge") {
+			dev.Kind = "bridge"
+			if ports, err := ioutil.ReadDir(dev_dir + "/brif"); err == nil {
+				for _, port := range ports {
+					dev.Lowers = append(dev.Lowers, port.Name())
+				}
+			}
+		}
+
+		if link, err := os.Readlink(dev_dir + "/master"); err == nil {
+			dev.Master = filepath.Base(link)
+		}
+
+		dev.Physical = exists(dev_dir + "/device")
+
+		// A veth has no backing device and its iflink points to the
+		// ifindex of its peer.
+		ifindex := readInt(dev_dir + "/ifindex")
+		iflink := readInt(dev_dir + "/iflink")
+		if ifindex > 0 {
+			ifnames[ifindex] = name
+		}
+		if dev.Kind == "" && dev.Type == 1 && iflink > 0 && iflink != ifindex &&
+			!dev.Physical {
+			dev.Kind = "veth"
+			iflinks[name] = iflink
+		}
+
+		if devices == nil {
+			devices = make(map[string]LinuxNetDevice)
+		}
+		devices[name] = dev
+	}
+
+	for name, iflink := range iflinks {
+		dev := devices[name]
+		dev.Peer = ifnames[iflink]
+		devices[name] = dev
+	}
+
+	return devices
+}
+
+// listNumberedFiles returns the N of each `<prefix>N<suffix>` file in `dir`
+// in ascending order.
+func listNumberedFiles(dir string, prefix string, suffix string) []int {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	ids := []int{}
+	for _, fi := range fis {
+		name := fi.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		id, err := strconv.Atoi(name[len(prefix) : len(name)-len(suffix)])
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// readSensorsFrom returns the readable temperature sensors of the thermal
+// zones in `thermal_dir` and the hwmon chips in `hwmon_dir`, or nil if none.
+func readSensorsFrom(thermal_dir string, hwmon_dir string) []LinuxSensor {
+	var sensors []LinuxSensor = nil
+
+	readStr := func(path string) string {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(content))
+	}
+	readable := func(path string) bool {
+		_, err := strconv.ParseInt(readStr(path), 10, 64)
+		return err == nil
+	}
+
+	for _, zone_id := range listNumberedFiles(thermal_dir, "thermal_zone", "") {
+		zone := fmt.Sprintf("thermal_zone%d", zone_id)
+		path := thermal_dir + "/" + zone + "/temp"
+		if !readable(path) {
+			continue
+		}
+		sensors = append(sensors, LinuxSensor{
+			Name: zone + ":" + readStr(thermal_dir+"/"+zone+"/type"),
+			Path: path,
+		})
+	}
+
+	for _, hwmon_id := range listNumberedFiles(hwmon_dir, "hwmon", "") {
+		chip_dir := fmt.Sprintf("%s/hwmon%d", hwmon_dir, hwmon_id)
+		chip := readStr(chip_dir + "/name")
+		if chip == "" {
+			chip = fmt.Sprintf("hwmon%d", hwmon_id)
+		}
+		for _, temp_id := range listNumberedFiles(chip_dir, "temp", "_input") {
+			path := fmt.Sprintf("%s/temp%d_input", chip_dir, temp_id)
+			if !readable(path) {
+				continue
+			}
+			label := readStr(fmt.Sprintf("%s/temp%d_label", chip_dir, temp_id))
+			if label == "" {
+				label = fmt.Sprintf("temp%d", temp_id)
+			}
+			sensors = append(sensors, LinuxSensor{
+				Name: chip + ":" + label,
+				Path: path,
+			})
+		}
+	}
+
+	return sensors
+}
+
+// readPowerDomainsFrom returns the powercap zones in `powercap_dir` whose
+// energy_uj is readable (usually by root only), or nil if none. A subzone
+// is a directory named after its parent zone plus ":<N>".
+func readPowerDomainsFrom(powercap_dir string) []LinuxPowerDomain {
+	fis, err := ioutil.ReadDir(powercap_dir)
+	if err != nil {
+		return nil
+	}
+
+	readStr := func(path string) string {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(content))
+	}
+	readInt := func(path string) int64 {
+		val, err := strconv.ParseInt(readStr(path), 10, 64)
+		if err != nil {
+			return -1
+		}
+		return val
+	}
+
+	dirs := []string{}
+	for _, fi := range fis {
+		// intel-rapl-mmio exposes the package domains of intel-rapl again
+		if !strings.Contains(fi.Name(), ":") || strings.HasPrefix(fi.Name(), "intel-rapl-mmio") {
+			continue
+		}
+		dirs = append(dirs, fi.Name())
+	}
+	// parents come before their subzones
+	sort.Strings(dirs)
+
+	var domains []LinuxPowerDomain = nil
+	names := make(map[string]string)
+	for _, dir := range dirs {
+		zone_dir := powercap_dir + "/" + dir
+		if readInt(zone_dir+"/energy_uj") < 0 {
+			continue
+		}
+
+		domain := LinuxPowerDomain{
+			Zone:           readStr(zone_dir + "/name"),
+			Path:           zone_dir,
+			MaxEnergyRange: readInt(zone_dir + "/max_energy_range_uj"),
+		}
+		if domain.Zone == "" {
+			domain.Zone = dir
+		}
+		domain.Name = domain.Zone
+		if idx := strings.LastIndex(dir, ":"); idx >= 0 {
+			if parent, ok := names[dir[:idx]]; ok {
+				domain.Parent = parent
+				domain.Name = parent + "/" + domain.Zone
 			}
 		}
+		names[dir] = domain.Name
+		domains = append(domains, domain)
 	}
+
+	return domains
 }
 
-func isDevice(name string) bool {
-	stat, err := os.Stat(fmt.Sprintf("/sys/block/%s", name))
+// isDevice returns whether `name` is a whole block device, which has a
+// directory in `block_dir` (normally /sys/block) unlike partitions.
+func isDevice(block_dir string, name string) bool {
+	stat, err := os.Stat(block_dir + "/" + name)
 	if err == nil && stat.IsDir() {
 		return true
 	}
@@ -62,10 +609,6 @@ func isDevice(name string) bool {
 	return false
 }
 
-func getPartitions(name string) []string {
-	return getPartitionsFromDir("/sys/block", name)
-}
-
 // getPartitionsFromDir lists the partitions of block device `name` whose
 // per-device directory lives under `blockDir` (normally "/sys/block"). The
 // `blockDir` parameter is injectable so the function can be tested against a
@@ -96,8 +639,8 @@ func getPartitionsFromDir(blockDir string, name string) []string {
 	return parts
 }
 
-func ReadCpuStat(record *StatRecord) error {
-	f, ferr := os.Open("/proc/stat")
+func ReadCpuStat(record *StatRecord, roots Roots) error {
+	f, ferr := os.Open(roots.procPath("/stat"))
 	if ferr != nil {
 		return ferr
 	}
@@ -105,14 +648,21 @@ func ReadCpuStat(record *StatRecord) error {
 
 	if record.Cpu == nil {
 		num_core := 0
-		out, err := exec.Command("nproc", "--all").Output()
-		out_str := strings.TrimSpace(string(out))
+		if roots.Sys != "" && roots.Sys != "/sys" {
+			// nproc counts CPUs in the local sysfs
+			if cpu_ids := listCpuIds(roots.sysPath("/devices/system/cpu")); len(cpu_ids) > 0 {
+				num_core = cpu_ids[len(cpu_ids)-1] + 1
+			}
+		} else {
+			out, err := exec.Command("nproc", "--all").Output()
+			out_str := strings.TrimSpace(string(out))
 
-		if err == nil {
-			num_core, err = strconv.Atoi(out_str)
+			if err == nil {
+				num_core, err = strconv.Atoi(out_str)
 
-			if err != nil {
-				num_core = 0
+				if err != nil {
+					num_core = 0
+				}
 			}
 		}
 
@@ -125,12 +675,6 @@ func ReadCpuStat(record *StatRecord) error {
 		record.Cpu.Clear()
 	}
 
-	if record.Proc == nil {
-		record.Proc = NewProcStat()
-	} else {
-		record.Proc.Clear()
-	}
-
 	scan := bufio.NewScanner(f)
 	for scan.Scan() {
 		var err error
@@ -212,33 +756,115 @@ func ReadCpuStat(record *StatRecord) error {
 			if err != nil {
 				panic(err)
 			}
-		} else if line[0:5] == "ctxt " {
-			_, err = fmt.Sscanf(line[4:], "%d", &record.Proc.ContextSwitch)
-			if err != nil {
-				panic(err)
-			}
-		} else if line[0:10] == "processes " {
-			_, err = fmt.Sscanf(line[10:], "%d", &record.Proc.Fork)
-			if err != nil {
-				panic(err)
-			}
 		}
 	}
 
 	return nil
 }
 
-func parseInterruptStatEntry(line string, num_core int) (*InterruptStatEntry, error) {
-	entry := new(InterruptStatEntry)
-
-	entry.NumCore = num_core
-	entry.IntrCounts = make([]int, num_core)
-
-	tokens := strings.Fields(line)
+// ReadProcStat reads the process counters of /proc/stat into record.Proc,
+// followed by the load average.
+func ReadProcStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
 
-	idx := 0
+	f, err := os.Open(roots.procPath("/stat"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-	tok := tokens[0]
+	if record.Proc == nil {
+		record.Proc = NewProcStat()
+	} else {
+		record.Proc.Clear()
+	}
+	if err = parseProcStat(record.Proc, f); err != nil {
+		return err
+	}
+
+	return ReadLoadAvg(record, roots)
+}
+
+// parseProcStat parses the lines of /proc/stat other than those of CPUs.
+func parseProcStat(proc *ProcStat, r io.Reader) error {
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		var err error
+		line := scan.Text()
+		if strings.HasPrefix(line, "ctxt ") {
+			_, err = fmt.Sscanf(line[4:], "%d", &proc.ContextSwitch)
+		} else if strings.HasPrefix(line, "processes ") {
+			_, err = fmt.Sscanf(line[10:], "%d", &proc.Fork)
+		} else if strings.HasPrefix(line, "intr ") {
+			// only the total count, per-IRQ counts follow it
+			_, err = fmt.Sscanf(line[5:], "%d", &proc.Interrupt)
+		} else if strings.HasPrefix(line, "procs_running ") {
+			_, err = fmt.Sscanf(line[14:], "%d", &proc.ProcsRunning)
+			proc.HasProcsRunning = true
+		} else if strings.HasPrefix(line, "procs_blocked ") {
+			_, err = fmt.Sscanf(line[14:], "%d", &proc.ProcsBlocked)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return scan.Err()
+}
+
+// ReadLoadAvg reads /proc/loadavg into record.Proc. It should be called
+// after ReadProcStat, which clears record.Proc.
+func ReadLoadAvg(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	if record.Proc == nil {
+		record.Proc = NewProcStat()
+	}
+
+	f, err := os.Open(roots.procPath("/loadavg"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	record.Proc.LoadAvg, err = parseLoadAvg(f)
+
+	return err
+}
+
+// parseLoadAvg parses /proc/loadavg, which looks like:
+//   0.20 0.18 0.12 1/80 11206
+func parseLoadAvg(r io.Reader) (*LoadAvgStat, error) {
+	loadavg := new(LoadAvgStat)
+
+	n, err := fmt.Fscanf(r, "%f %f %f %d/%d",
+		&loadavg.Load1, &loadavg.Load5, &loadavg.Load15,
+		&loadavg.NrRunning, &loadavg.NrThreads)
+	if err != nil {
+		return nil, err
+	}
+	if n != 5 {
+		return nil, errors.New("Invalid /proc/loadavg format")
+	}
+
+	return loadavg, nil
+}
+
+func parseInterruptStatEntry(line string, num_core int) (*InterruptStatEntry, error) {
+	entry := new(InterruptStatEntry)
+
+	entry.NumCore = num_core
+	entry.IntrCounts = make([]int, num_core)
+
+	tokens := strings.Fields(line)
+
+	idx := 0
+
+	tok := tokens[0]
 	tok = strings.TrimRight(tok, ":")
 	if irqno, err := strconv.Atoi(tok); err == nil {
 		entry.IrqNo = irqno
@@ -274,14 +900,14 @@ func parseInterruptStatEntry(line string, num_core int) (*InterruptStatEntry, er
 	return entry, nil
 }
 
-func ReadInterruptStat(record *StatRecord) error {
+func ReadInterruptStat(record *StatRecord, roots Roots) error {
 	intr_stat := NewInterruptStat()
 
 	if record == nil {
 		return errors.New("Valid *StatRecord is required.")
 	}
 
-	f, err := os.Open("/proc/interrupts")
+	f, err := os.Open(roots.procPath("/interrupts"))
 	if err != nil {
 		panic(err)
 	}
@@ -289,7 +915,7 @@ func ReadInterruptStat(record *StatRecord) error {
 	scan := bufio.NewScanner(f)
 
 	if !scan.Scan() {
-		return errors.New("/proc/interrupts seems to be empty")
+		return errors.New(roots.procPath("/interrupts") + " seems to be empty")
 	}
 
 	cores := strings.Fields(scan.Text())
@@ -311,21 +937,111 @@ func ReadInterruptStat(record *StatRecord) error {
 	return nil
 }
 
-func ReadDiskStats(record *StatRecord, targets *map[string]bool) error {
+func ReadSoftIrqStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	f, err := os.Open(roots.procPath("/softirqs"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return parseSoftIrqStat(record, f)
+}
+
+// softIrqCounter returns the counter in core_stat that corresponds to the
+// softirq named `name` in /proc/softirqs, or nil for unknown names.
+func softIrqCounter(core_stat *SoftIrqCoreStat, name string) *int64 {
+	switch name {
+	case "HI":
+		return &core_stat.Hi
+	case "TIMER":
+		return &core_stat.Timer
+	case "NET_TX":
+		return &core_stat.NetTx
+	case "NET_RX":
+		return &core_stat.NetRx
+	case "BLOCK":
+		return &core_stat.Block
+	case "BLOCK_IOPOLL", "IRQ_POLL":
+		// renamed to IRQ_POLL in Linux 4.5
+		return &core_stat.BlockIopoll
+	case "TASKLET":
+		return &core_stat.Tasklet
+	case "SCHED":
+		return &core_stat.Sched
+	case "HRTIMER":
+		return &core_stat.Hrtimer
+	case "RCU":
+		return &core_stat.Rcu
+	}
+
+	return nil
+}
+
+func parseSoftIrqStat(record *StatRecord, r io.Reader) error {
+	scan := bufio.NewScanner(r)
+
+	if !scan.Scan() {
+		return errors.New("/proc/softirqs seems to be empty")
+	}
+
+	num_core := len(strings.Fields(scan.Text()))
+	sirq_stat := NewSoftIrqStat(num_core)
+	if sirq_stat == nil {
+		return errors.New("No CPU column found in /proc/softirqs")
+	}
+
+	for scan.Scan() {
+		tokens := strings.Fields(scan.Text())
+		if len(tokens) == 0 {
+			continue
+		}
+
+		name := strings.TrimRight(tokens[0], ":")
+		if softIrqCounter(&sirq_stat.All, name) == nil {
+			continue
+		}
+
+		for coreid := 0; coreid < num_core; coreid += 1 {
+			if coreid+1 >= len(tokens) {
+				break
+			}
+
+			count, err := strconv.ParseInt(tokens[coreid+1], 10, 64)
+			if err != nil {
+				return errors.New("Invalid string for softirq count: " + tokens[coreid+1])
+			}
+
+			*softIrqCounter(&sirq_stat.CoreStats[coreid], name) = count
+			*softIrqCounter(&sirq_stat.All, name) += count
+		}
+	}
+
+	record.Softirq = sirq_stat
+
+	return nil
+}
+
+func ReadDiskStats(record *StatRecord, roots Roots, targets *map[string]bool) error {
 	if record == nil {
 		return errors.New("Valid *StatRecord is required.")
 	}
 
-	f, ferr := os.Open("/proc/diskstats")
+	f, ferr := os.Open(roots.procPath("/diskstats"))
 	if ferr != nil {
 		panic(ferr)
 	}
 	defer f.Close()
 
-	return parseDiskStats(record, f, targets)
+	return parseDiskStats(record, f, targets, roots.sysPath("/block"))
 }
 
-func parseDiskStats(record *StatRecord, r io.Reader, targets *map[string]bool) error {
+// parseDiskStats parses /proc/diskstats. Without `targets`, the whole
+// devices in `block_dir` are recorded.
+func parseDiskStats(record *StatRecord, r io.Reader, targets *map[string]bool, block_dir string) error {
 	if record.Disk == nil {
 		record.Disk = NewDiskStat()
 	} else {
@@ -358,6 +1074,19 @@ func parseDiskStats(record *StatRecord, r io.Reader, targets *map[string]bool) e
 			entry.RdMerges = rdmerge_or_rdsec
 			entry.RdSectors = rdsec_or_wrios
 			entry.RdTicks = rdticks_or_wrsec
+			entry.HasInFlight = true
+
+			fields := strings.Fields(line)
+			if len(fields) >= 18 {
+				_, err = fmt.Sscanf(strings.Join(fields[14:18], " "), "%d %d %d %d",
+					&entry.DcIos, &entry.DcMerges, &entry.DcSectors, &entry.DcTicks)
+				entry.HasDiscard = (err == nil)
+			}
+			if len(fields) >= 20 {
+				_, err = fmt.Sscanf(strings.Join(fields[18:20], " "), "%d %d",
+					&entry.FlIos, &entry.FlTicks)
+				entry.HasFlush = (err == nil)
+			}
 		} else if num_items == 7 {
 			entry.RdSectors = rdmerge_or_rdsec
 			entry.WrIos = rdsec_or_wrios
@@ -376,7 +1105,7 @@ func parseDiskStats(record *StatRecord, r io.Reader, targets *map[string]bool) e
 				continue
 			}
 		} else {
-			if !isDevice(entry.Name) {
+			if !isDevice(block_dir, entry.Name) {
 				continue
 			}
 		}
@@ -387,18 +1116,218 @@ func parseDiskStats(record *StatRecord, r io.Reader, targets *map[string]bool) e
 	return nil
 }
 
+func ReadNumaStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	return readNumaStatFrom(record, roots.sysPath("/devices/system/node"))
+}
+
+// readNumaStatFrom is ReadNumaStat with an injectable `node_dir` so that it
+// can be tested against a fake directory. Numa is left nil if there is no
+// node directory, e.g. on kernels built without CONFIG_NUMA.
+func readNumaStatFrom(record *StatRecord, node_dir string) error {
+	record.Numa = nil
+
+	node_ids := listNodeIds(node_dir)
+	if len(node_ids) == 0 {
+		return nil
+	}
+
+	numa_stat := NewNumaStat()
+	for _, node_id := range node_ids {
+		entry := &NumaNodeStat{NodeId: node_id}
+
+		f, err := os.Open(fmt.Sprintf("%s/node%d/meminfo", node_dir, node_id))
+		if err != nil {
+			continue
+		}
+		err = parseNodeMeminfo(entry, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		f, err = os.Open(fmt.Sprintf("%s/node%d/numastat", node_dir, node_id))
+		if err == nil {
+			err = parseNumastat(entry, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		numa_stat.Entries = append(numa_stat.Entries, entry)
+	}
+
+	if len(numa_stat.Entries) > 0 {
+		record.Numa = numa_stat
+	}
+
+	return nil
+}
+
+// parseNodeMeminfo parses nodeN/meminfo, whose lines look like
+// "Node 0 MemTotal:       16314628 kB".
+func parseNodeMeminfo(entry *NumaNodeStat, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != "Node" {
+			continue
+		}
+		val, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		switch fields[2] {
+		case "MemTotal:":
+			entry.MemTotal = val
+		case "MemFree:":
+			entry.MemFree = val
+		case "MemUsed:":
+			entry.MemUsed = val
+		case "FilePages:":
+			entry.FilePages = val
+		case "AnonPages:":
+			entry.AnonPages = val
+		case "Slab:":
+			entry.Slab = val
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseNumastat parses nodeN/numastat, whose lines are "numa_hit 12345".
+func parseNumastat(entry *NumaNodeStat, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		val, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		switch fields[0] {
+		case "numa_hit":
+			entry.NumaHit = val
+		case "numa_miss":
+			entry.NumaMiss = val
+		case "numa_foreign":
+			entry.NumaForeign = val
+		case "interleave_hit":
+			entry.InterleaveHit = val
+		case "local_node":
+			entry.LocalNode = val
+		case "other_node":
+			entry.OtherNode = val
+		}
+	}
+
+	return scanner.Err()
+}
+
+func ReadSoftnetStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	f, err := os.Open(roots.procPath("/net/softnet_stat"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return parseSoftnetStat(record, f)
+}
+
+// parseSoftnetStat parses /proc/net/softnet_stat, whose lines have
+// hexadecimal counters of each online CPU. The 13th column is the CPU id
+// since Linux 5.10; older kernels are assumed to list CPUs without gaps.
+func parseSoftnetStat(record *StatRecord, r io.Reader) error {
+	softnet_stat := NewSoftnetStat()
+
+	scanner := bufio.NewScanner(r)
+
+	for idx := 0; scanner.Scan(); idx++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		values := make([]int64, len(fields))
+		for i, field := range fields {
+			val, err := strconv.ParseInt(field, 16, 64)
+			if err != nil {
+				return errors.New("Invalid value in /proc/net/softnet_stat: " + field)
+			}
+			values[i] = val
+		}
+
+		entry := new(SoftnetStatEntry)
+		entry.CpuId = idx
+		entry.Processed = values[0]
+		entry.Dropped = values[1]
+		entry.TimeSqueeze = values[2]
+		if len(values) > 10 {
+			entry.ReceivedRps = values[9]
+			entry.FlowLimitCount = values[10]
+		}
+		if len(values) > 12 {
+			entry.CpuId = int(values[12])
+		}
+
+		softnet_stat.Entries = append(softnet_stat.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	record.Softnet = softnet_stat
+
+	return nil
+}
+
 func ReadNetStat(record *StatRecord) error {
+	return ReadNetStat1(record, Roots{}, nil, nil)
+}
+
+// ReadNetStat1 is ReadNetStat recording only the interfaces which match
+// `only` and do not match `exclude` (see SelectNetDevice).
+func ReadNetStat1(record *StatRecord, roots Roots, only *regexp.Regexp, exclude *regexp.Regexp) error {
 	if record == nil {
 		return errors.New("Valid *StatRecord is required.")
 	}
 
-	f, err := os.Open("/proc/net/dev")
+	f, err := os.Open(roots.procPath("/net/dev"))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	return parseNetStat(record, f)
+	if err := parseNetStat(record, f); err != nil {
+		return err
+	}
+
+	if only != nil || exclude != nil {
+		entries := make([]*NetStatEntry, 0, len(record.Net.Entries))
+		for _, entry := range record.Net.Entries {
+			if SelectNetDevice(entry.Name, only, exclude) {
+				entries = append(entries, entry)
+			}
+		}
+		record.Net.Entries = entries
+	}
+
+	return nil
 }
 
 func parseNetStat(record *StatRecord, r io.Reader) error {
@@ -451,98 +1380,1290 @@ func parseNetStat(record *StatRecord, r io.Reader) error {
 	return nil
 }
 
-func ReadMemStat(record *StatRecord) error {
+func ReadVmStat(record *StatRecord, roots Roots) error {
 	if record == nil {
 		return errors.New("Valid *StatRecord is required.")
 	}
 
-	mem_stat := NewMemStat()
-
-	f, err := os.Open("/proc/meminfo")
+	f, err := os.Open(roots.procPath("/vmstat"))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	scanner := bufio.NewScanner(f)
+
+	return parseVmStat(record, f)
+}
+
+func parseVmStat(record *StatRecord, r io.Reader) error {
+	vm_stat := NewVmStat()
+
+	scanner := bufio.NewScanner(r)
 
 	for scanner.Scan() {
 		var key string
 		var val int64
-		line := scanner.Text()
 
-		n, err := fmt.Sscanf(line, "%s %d", &key, &val)
+		n, err := fmt.Sscanf(scanner.Text(), "%s %d", &key, &val)
+		if err != nil || n != 2 {
+			continue
+		}
 
-		if err == io.EOF {
-			break
-		} else if err != nil {
+		switch {
+		case key == "pgfault":
+			vm_stat.PgFault = val
+		case key == "pgmajfault":
+			vm_stat.PgMajFault = val
+		case key == "pswpin":
+			vm_stat.PswpIn = val
+		case key == "pswpout":
+			vm_stat.PswpOut = val
+		case key == "pgscan_direct_throttle":
+			// not a scan count
+		case strings.HasPrefix(key, "pgscan_kswapd"):
+			vm_stat.PgScanKswapd += val
+		case strings.HasPrefix(key, "pgscan_direct"):
+			vm_stat.PgScanDirect += val
+		case strings.HasPrefix(key, "pgscan_khugepaged"):
+			vm_stat.PgScanKhugepaged += val
+		case strings.HasPrefix(key, "pgsteal_kswapd"):
+			vm_stat.PgStealKswapd += val
+		case strings.HasPrefix(key, "pgsteal_direct"):
+			vm_stat.PgStealDirect += val
+		case strings.HasPrefix(key, "pgsteal_khugepaged"):
+			vm_stat.PgStealKhugepaged += val
+		case strings.HasPrefix(key, "allocstall"):
+			vm_stat.AllocStall += val
+		case key == "compact_stall":
+			vm_stat.CompactStall = val
+		case key == "thp_fault_alloc":
+			vm_stat.ThpFaultAlloc = val
+		case key == "thp_fault_fallback":
+			vm_stat.ThpFaultFallback = val
+		case key == "thp_collapse_alloc":
+			vm_stat.ThpCollapseAlloc = val
+		case key == "thp_collapse_alloc_failed":
+			vm_stat.ThpCollapseAllocFailed = val
+		case key == "thp_split_page":
+			vm_stat.ThpSplitPage = val
+		case key == "oom_kill":
+			vm_stat.OomKill = val
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	record.Vm = vm_stat
+
+	return nil
+}
+
+func ReadNetProtoStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	return readNetProtoStatFrom(record, roots.procPath("/net"))
+}
+
+// readNetProtoStatFrom is ReadNetProtoStat with an injectable directory
+// `net_dir` so that it can be tested against a fake directory. snmp is
+// required; netstat and sockstat are read if present.
+func readNetProtoStatFrom(record *StatRecord, net_dir string) error {
+	net_proto := NewNetProtoStat()
+
+	f, err := os.Open(net_dir + "/snmp")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	counters, err := parseSnmpTable(f)
+	if err != nil {
+		return err
+	}
+
+	if f, err := os.Open(net_dir + "/netstat"); err == nil {
+		defer f.Close()
+		ext_counters, err := parseSnmpTable(f)
+		if err != nil {
 			return err
 		}
-		if n != 2 {
-			continue
+		for key, val := range ext_counters {
+			counters[key] = val
 		}
+	}
 
-		switch key {
-		case "HugePages_Surp:":
-			mem_stat.HugePages_Surp = val
-		case "HugePages_Rsvd:":
-			mem_stat.HugePages_Rsvd = val
-		case "HugePages_Free:":
-			mem_stat.HugePages_Free = val
-		case "HugePages_Total:":
-			mem_stat.HugePages_Total = val
-		case "Hugepagesize:":
-			mem_stat.Hugepagesize = val
-		case "AnonHugePages:":
-			mem_stat.AnonHugePages = val
-		case "Committed_AS:":
-			mem_stat.Committed_AS = val
-		case "CommitLimit:":
-			mem_stat.CommitLimit = val
-		case "Bounce:":
-			mem_stat.Bounce = val
-		case "NFS_Unstable:":
-			mem_stat.NFS_Unstable = val
-		case "Shmem:":
-			mem_stat.Shmem = val
-		case "Slab:":
-			mem_stat.Slab = val
-		case "SReclaimable:":
-			mem_stat.SReclaimable = val
-		case "SUnreclaim:":
-			mem_stat.SUnreclaim = val
-		case "KernelStack:":
-			mem_stat.KernelStack = val
-		case "PageTables:":
-			mem_stat.PageTables = val
-		case "Mapped:":
-			mem_stat.Mapped = val
-		case "AnonPages:":
-			mem_stat.AnonPages = val
-		case "Writeback:":
-			mem_stat.Writeback = val
-		case "Dirty:":
-			mem_stat.Dirty = val
-		case "SwapFree:":
-			mem_stat.SwapFree = val
-		case "SwapTotal:":
-			mem_stat.SwapTotal = val
-		case "Inactive:":
-			mem_stat.Inactive = val
-		case "Active:":
-			mem_stat.Active = val
-		case "SwapCached:":
-			mem_stat.SwapCached = val
-		case "Cached:":
-			mem_stat.Cached = val
-		case "Buffers:":
-			mem_stat.Buffers = val
-		case "MemFree:":
-			mem_stat.MemFree = val
-		case "MemTotal:":
-			mem_stat.MemTotal = val
+	net_proto.IpInReceives = counters["Ip.InReceives"]
+	net_proto.IpInDiscards = counters["Ip.InDiscards"]
+	net_proto.IpOutRequests = counters["Ip.OutRequests"]
+	net_proto.IpOutDiscards = counters["Ip.OutDiscards"]
+	net_proto.TcpActiveOpens = counters["Tcp.ActiveOpens"]
+	net_proto.TcpPassiveOpens = counters["Tcp.PassiveOpens"]
+	net_proto.TcpAttemptFails = counters["Tcp.AttemptFails"]
+	net_proto.TcpEstabResets = counters["Tcp.EstabResets"]
+	net_proto.TcpCurrEstab = counters["Tcp.CurrEstab"]
+	net_proto.TcpInSegs = counters["Tcp.InSegs"]
+	net_proto.TcpOutSegs = counters["Tcp.OutSegs"]
+	net_proto.TcpRetransSegs = counters["Tcp.RetransSegs"]
+	net_proto.TcpInErrs = counters["Tcp.InErrs"]
+	net_proto.TcpOutRsts = counters["Tcp.OutRsts"]
+	net_proto.UdpInDatagrams = counters["Udp.InDatagrams"]
+	net_proto.UdpNoPorts = counters["Udp.NoPorts"]
+	net_proto.UdpInErrors = counters["Udp.InErrors"]
+	net_proto.UdpOutDatagrams = counters["Udp.OutDatagrams"]
+	net_proto.UdpRcvbufErrors = counters["Udp.RcvbufErrors"]
+	net_proto.UdpSndbufErrors = counters["Udp.SndbufErrors"]
+	net_proto.ListenOverflows = counters["TcpExt.ListenOverflows"]
+	net_proto.ListenDrops = counters["TcpExt.ListenDrops"]
+	net_proto.TCPTimeouts = counters["TcpExt.TCPTimeouts"]
+	net_proto.TCPSynRetrans = counters["TcpExt.TCPSynRetrans"]
+	net_proto.TCPFastRetrans = counters["TcpExt.TCPFastRetrans"]
+	net_proto.TCPAbortOnMemory = counters["TcpExt.TCPAbortOnMemory"]
+	net_proto.TCPBacklogDrop = counters["TcpExt.TCPBacklogDrop"]
+
+	if f, err := os.Open(net_dir + "/sockstat"); err == nil {
+		defer f.Close()
+		err = parseSockStat(net_proto, f)
+		if err != nil {
+			return err
 		}
 	}
 
+	record.NetProto = net_proto
+
+	return nil
+}
+
+// parseSnmpTable parses the header/value line pairs of /proc/net/snmp and
+// /proc/net/netstat, e.g.
+//
+//	Tcp: RtoAlgorithm RtoMin ... RetransSegs ...
+//	Tcp: 1 200 ... 42 ...
+//
+// into a map keyed by "<Proto>.<Name>".
+func parseSnmpTable(r io.Reader) (map[string]int64, error) {
+	counters := make(map[string]int64)
+
+	scanner := bufio.NewScanner(r)
+	var header []string = nil
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+
+		if header == nil || header[0] != fields[0] {
+			header = fields
+			continue
+		}
+
+		proto := strings.TrimSuffix(fields[0], ":")
+		for i := 1; i < len(fields) && i < len(header); i++ {
+			val, err := strconv.ParseInt(fields[i], 10, 64)
+			if err != nil {
+				continue
+			}
+			counters[proto+"."+header[i]] = val
+		}
+		header = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+func parseSockStat(net_proto *NetProtoStat, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		proto := strings.TrimSuffix(fields[0], ":")
+		for i := 1; i+1 < len(fields); i += 2 {
+			val, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				continue
+			}
+
+			switch proto + "." + fields[i] {
+			case "sockets.used":
+				net_proto.SocketsUsed = val
+			case "TCP.inuse":
+				net_proto.TcpInUse = val
+			case "TCP.orphan":
+				net_proto.TcpOrphan = val
+			case "TCP.tw":
+				net_proto.TcpTimeWait = val
+			case "TCP.alloc":
+				net_proto.TcpAlloc = val
+			case "TCP.mem":
+				net_proto.TcpMem = val
+			case "UDP.inuse":
+				net_proto.UdpInUse = val
+			case "UDP.mem":
+				net_proto.UdpMem = val
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ReadProcessStat reads counters of the process `root_pid` and all of its
+// descendants. If the process no longer exists, record.Process is left nil.
+func ReadProcessStat(record *StatRecord, roots Roots, root_pid int) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	return readProcessStatFrom(record, roots.procPath(""), root_pid)
+}
+
+// readProcessStatFrom is ReadProcessStat with an injectable `proc_dir` so
+// that it can be tested against a fake directory.
+func readProcessStatFrom(record *StatRecord, proc_dir string, root_pid int) error {
+	dir, err := os.Open(proc_dir)
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+
+	// read stat of all processes to find descendants by ppid
+	entries := make(map[int]*ProcessStatEntry)
+	children := make(map[int][]int)
+	for _, name := range names {
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		f, err := os.Open(fmt.Sprintf("%s/%d/stat", proc_dir, pid))
+		if err != nil {
+			// the process has gone
+			continue
+		}
+		entry := NewProcessStatEntry()
+		err = parseProcPidStat(entry, f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+
+		entries[pid] = entry
+		children[entry.Ppid] = append(children[entry.Ppid], pid)
+	}
+
+	if _, ok := entries[root_pid]; !ok {
+		record.Process = nil
+		return nil
+	}
+
+	proc_stat := NewProcessStat(root_pid)
+	queue := []int{root_pid}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		queue = append(queue, children[pid]...)
+
+		entry := entries[pid]
+
+		// io and status are optional: /proc/<pid>/io may not be readable
+		// by unprivileged users
+		if f, err := os.Open(fmt.Sprintf("%s/%d/io", proc_dir, pid)); err == nil {
+			parseProcPidIo(entry, f)
+			f.Close()
+		}
+		if f, err := os.Open(fmt.Sprintf("%s/%d/status", proc_dir, pid)); err == nil {
+			parseProcPidStatus(entry, f)
+			f.Close()
+		}
+
+		proc_stat.Entries = append(proc_stat.Entries, entry)
+	}
+
+	record.Process = proc_stat
+
+	return nil
+}
+
+// parseProcPidStat parses /proc/<pid>/stat. Since comm may contain spaces and
+// parentheses, fields are split after the last ')'.
+func parseProcPidStat(entry *ProcessStatEntry, r io.Reader) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	line := string(content)
+
+	lparen := strings.IndexByte(line, '(')
+	rparen := strings.LastIndexByte(line, ')')
+	if lparen < 0 || rparen < lparen {
+		return errors.New("Invalid format of /proc/<pid>/stat")
+	}
+
+	entry.Pid, err = strconv.Atoi(strings.TrimSpace(line[:lparen]))
+	if err != nil {
+		return err
+	}
+	entry.Comm = line[lparen+1 : rparen]
+
+	// fields[0] is state (the 3rd field in proc(5))
+	fields := strings.Fields(line[rparen+1:])
+	if len(fields) < 15 {
+		return errors.New("Too few fields in /proc/<pid>/stat")
+	}
+
+	entry.Ppid, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return err
+	}
+
+	for _, item := range []struct {
+		idx int
+		dst *int64
+	}{
+		{9, &entry.MajFlt},
+		{10, &entry.CMajFlt},
+		{11, &entry.Utime},
+		{12, &entry.Stime},
+		{13, &entry.Cutime},
+		{14, &entry.Cstime},
+	} {
+		*item.dst, err = strconv.ParseInt(fields[item.idx], 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseProcPidIo(entry *ProcessStatEntry, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		var key string
+		var val int64
+
+		n, err := fmt.Sscanf(scanner.Text(), "%s %d", &key, &val)
+		if err != nil || n != 2 {
+			continue
+		}
+
+		switch key {
+		case "read_bytes:":
+			entry.ReadBytes = val
+		case "write_bytes:":
+			entry.WriteBytes = val
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseProcPidStatus(entry *ProcessStatEntry, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		var key string
+		var val int64
+
+		n, err := fmt.Sscanf(scanner.Text(), "%s %d", &key, &val)
+		if err != nil || n != 2 {
+			continue
+		}
+
+		switch key {
+		case "VmRSS:":
+			entry.VmRSS = val
+		case "VmHWM:":
+			entry.VmHWM = val
+		case "voluntary_ctxt_switches:":
+			entry.VoluntaryCtxtSwitches = val
+		case "nonvoluntary_ctxt_switches:":
+			entry.NonvoluntaryCtxtSwitches = val
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ReadCpuFreqStat reads the current frequency of each core from cpufreq in
+// sysfs, falling back to "cpu MHz" in /proc/cpuinfo where cpufreq is not
+// available (e.g. on many virtual machines). Leaves CpuFreq nil if neither
+// is available.
+func ReadCpuFreqStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	return readCpuFreqStatFrom(record, roots.sysPath("/devices/system/cpu"), roots.procPath("/cpuinfo"))
+}
+
+// readCpuFreqStatFrom is ReadCpuFreqStat with an injectable `cpu_dir` and
+// `cpuinfo_path` so that it can be tested against fake files.
+func readCpuFreqStatFrom(record *StatRecord, cpu_dir string, cpuinfo_path string) error {
+	record.CpuFreq = nil
+
+	cpu_ids := listCpuIds(cpu_dir)
+	if len(cpu_ids) > 0 {
+		freq_stat := NewCpuFreqStat(cpu_ids[len(cpu_ids)-1] + 1)
+		found := false
+		for _, cpu_id := range cpu_ids {
+			content, err := ioutil.ReadFile(
+				fmt.Sprintf("%s/cpu%d/cpufreq/scaling_cur_freq", cpu_dir, cpu_id))
+			if err != nil {
+				continue
+			}
+			freq, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+			if err != nil {
+				continue
+			}
+			freq_stat.CoreFreqs[cpu_id] = freq
+			found = true
+		}
+
+		if found {
+			record.CpuFreq = freq_stat
+			return nil
+		}
+	}
+
+	f, err := os.Open(cpuinfo_path)
+	if err != nil {
+		// neither cpufreq nor cpuinfo is available
+		return nil
+	}
+	defer f.Close()
+
+	return parseCpuInfoFreq(record, f)
+}
+
+func ReadCpuIdleStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	return readCpuIdleStatFrom(record, roots.sysPath("/devices/system/cpu"))
+}
+
+// readCpuIdleStatFrom is ReadCpuIdleStat with an injectable `cpu_dir` so
+// that it can be tested against a fake directory. CpuIdle is left nil if no
+// core has cpuidle states.
+func readCpuIdleStatFrom(record *StatRecord, cpu_dir string) error {
+	record.CpuIdle = nil
+
+	cpu_ids := listCpuIds(cpu_dir)
+	if len(cpu_ids) == 0 {
+		return nil
+	}
+
+	idle_stat := NewCpuIdleStat(cpu_ids[len(cpu_ids)-1] + 1)
+	found := false
+	for _, cpu_id := range cpu_ids {
+		core_stat := &idle_stat.CoreStats[cpu_id]
+		for state := 0; ; state++ {
+			state_dir := fmt.Sprintf("%s/cpu%d/cpuidle/state%d", cpu_dir, cpu_id, state)
+			time_content, err := ioutil.ReadFile(state_dir + "/time")
+			if err != nil {
+				break
+			}
+			usage_content, err := ioutil.ReadFile(state_dir + "/usage")
+			if err != nil {
+				break
+			}
+			time_usec, err := strconv.ParseInt(strings.TrimSpace(string(time_content)), 10, 64)
+			if err != nil {
+				break
+			}
+			usage, err := strconv.ParseInt(strings.TrimSpace(string(usage_content)), 10, 64)
+			if err != nil {
+				break
+			}
+			core_stat.Times = append(core_stat.Times, time_usec)
+			core_stat.Usages = append(core_stat.Usages, usage)
+
+			if !found {
+				name, err := ioutil.ReadFile(state_dir + "/name")
+				if err != nil {
+					name = []byte(fmt.Sprintf("state%d", state))
+				}
+				idle_stat.StateNames = append(idle_stat.StateNames, strings.TrimSpace(string(name)))
+			}
+		}
+		if len(core_stat.Times) > 0 {
+			found = true
+		}
+	}
+
+	if found {
+		record.CpuIdle = idle_stat
+	}
+
+	return nil
+}
+
+// parseCpuInfoFreq fills CpuFreq with "cpu MHz" of each "processor" in
+// /proc/cpuinfo.
+func parseCpuInfoFreq(record *StatRecord, r io.Reader) error {
+	freqs := map[int]int64{}
+	max_cpu_id := -1
+	cpu_id := -1
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		val := strings.TrimSpace(kv[1])
+
+		switch key {
+		case "processor":
+			id, err := strconv.Atoi(val)
+			if err != nil {
+				cpu_id = -1
+				continue
+			}
+			cpu_id = id
+			if cpu_id > max_cpu_id {
+				max_cpu_id = cpu_id
+			}
+		case "cpu MHz":
+			mhz, err := strconv.ParseFloat(val, 64)
+			if err != nil || cpu_id < 0 {
+				continue
+			}
+			freqs[cpu_id] = int64(mhz * 1000.0)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(freqs) == 0 {
+		return nil
+	}
+
+	freq_stat := NewCpuFreqStat(max_cpu_id + 1)
+	for cpu_id, freq := range freqs {
+		freq_stat.CoreFreqs[cpu_id] = freq
+	}
+	record.CpuFreq = freq_stat
+
+	return nil
+}
+
+// ReadCgroupStat reads counters of the cgroup v2 directories `paths`, which
+// are relative to /sys/fs/cgroup. Nonexistent cgroups are skipped.
+func ReadCgroupStat(record *StatRecord, roots Roots, paths []string) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	return readCgroupStatFrom(record, roots.sysPath("/fs/cgroup"), paths)
+}
+
+// readCgroupStatFrom is ReadCgroupStat with an injectable cgroup2 mount point
+// `cgroup_root` so that it can be tested against a fake directory tree.
+func readCgroupStatFrom(record *StatRecord, cgroup_root string, paths []string) error {
+	cgroup_stat := NewCgroupStat()
+
+	for _, path := range paths {
+		path = strings.Trim(path, "/")
+		dir := cgroup_root
+		if path != "" {
+			dir = cgroup_root + "/" + path
+		}
+
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+
+		entry := NewCgroupStatEntry("/" + path)
+
+		// Each file is optional: controllers may not be enabled for the
+		// cgroup, and the root cgroup lacks some files.
+		readCgroupFile := func(name string, parse func(io.Reader) error) {
+			f, err := os.Open(dir + "/" + name)
+			if err != nil {
+				return
+			}
+			defer f.Close()
+			parse(f)
+		}
+		readCgroupFile("cpu.stat", func(r io.Reader) error {
+			return parseCgroupCpuStat(entry, r)
+		})
+		readCgroupFile("memory.current", func(r io.Reader) error {
+			_, err := fmt.Fscanf(r, "%d", &entry.MemoryCurrent)
+			return err
+		})
+		readCgroupFile("memory.stat", func(r io.Reader) error {
+			return parseCgroupMemoryStat(entry, r)
+		})
+		readCgroupFile("io.stat", func(r io.Reader) error {
+			return parseCgroupIoStat(entry, r)
+		})
+		readCgroupFile("cpu.pressure", func(r io.Reader) (err error) {
+			entry.CpuPressure, err = parsePressureStatEntry(r)
+			return err
+		})
+		readCgroupFile("io.pressure", func(r io.Reader) (err error) {
+			entry.IoPressure, err = parsePressureStatEntry(r)
+			return err
+		})
+
+		cgroup_stat.Entries = append(cgroup_stat.Entries, entry)
+	}
+
+	record.Cgroup = cgroup_stat
+
+	return nil
+}
+
+func parseCgroupCpuStat(entry *CgroupStatEntry, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		var key string
+		var val int64
+
+		n, err := fmt.Sscanf(scanner.Text(), "%s %d", &key, &val)
+		if err != nil || n != 2 {
+			continue
+		}
+
+		switch key {
+		case "usage_usec":
+			entry.UsageUsec = val
+		case "user_usec":
+			entry.UserUsec = val
+		case "system_usec":
+			entry.SystemUsec = val
+		case "nr_periods":
+			entry.NrPeriods = val
+		case "nr_throttled":
+			entry.NrThrottled = val
+		case "throttled_usec":
+			entry.ThrottledUsec = val
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseCgroupMemoryStat(entry *CgroupStatEntry, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		var key string
+		var val int64
+
+		n, err := fmt.Sscanf(scanner.Text(), "%s %d", &key, &val)
+		if err != nil || n != 2 {
+			continue
+		}
+
+		switch key {
+		case "anon":
+			entry.MemAnon = val
+		case "file":
+			entry.MemFile = val
+		case "pgmajfault":
+			entry.MemPgMajFault = val
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseCgroupIoStat parses io.stat, which has lines like:
+//   8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func parseCgroupIoStat(entry *CgroupStatEntry, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		tokens := strings.Fields(scanner.Text())
+		if len(tokens) < 2 {
+			continue
+		}
+
+		for _, token := range tokens[1:] {
+			kv := strings.SplitN(token, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			val, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				continue
+			}
+
+			switch kv[0] {
+			case "rbytes":
+				entry.IoRbytes += val
+			case "wbytes":
+				entry.IoWbytes += val
+			case "rios":
+				entry.IoRios += val
+			case "wios":
+				entry.IoWios += val
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// FsMount is a filesystem to be sampled by ReadFsStat.
+type FsMount struct {
+	MountPoint string
+	Device     string
+	FsType     string
+}
+
+// pseudoFsTypes are filesystem types which do not hold user data and are
+// skipped by ReadMounts unless a mount point is selected explicitly.
+var pseudoFsTypes = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true,
+	"cgroup2": true, "configfs": true, "debugfs": true, "devpts": true,
+	"devtmpfs": true, "efivarfs": true, "fusectl": true, "hugetlbfs": true,
+	"mqueue": true, "nsfs": true, "proc": true, "pstore": true,
+	"ramfs": true, "rpc_pipefs": true, "securityfs": true, "selinuxfs": true,
+	"squashfs": true, "sysfs": true, "tmpfs": true, "tracefs": true,
+}
+
+// networkFsTypes are filesystem types whose statfs(2) may block for a long
+// time on an unresponsive server. Like pseudoFsTypes, they are skipped by
+// ReadMounts unless a mount point is selected explicitly. FUSE filesystems
+// ("fuse.<name>") are treated the same, since their daemon may hang too.
+var networkFsTypes = map[string]bool{
+	"9p": true, "afs": true, "ceph": true, "cifs": true, "glusterfs": true,
+	"lustre": true, "ncpfs": true, "nfs": true, "nfs4": true, "smb3": true,
+	"smbfs": true,
+}
+
+func isNetworkFs(fstype string) bool {
+	return networkFsTypes[fstype] || strings.HasPrefix(fstype, "fuse.")
+}
+
+// ReadMounts returns the filesystems listed in /proc/self/mountinfo whose
+// mount point matches `only` and does not match `exclude`. Without `only`,
+// pseudo and network filesystems (see pseudoFsTypes and networkFsTypes) are
+// skipped as well.
+func ReadMounts(roots Roots, only *regexp.Regexp, exclude *regexp.Regexp) ([]FsMount, error) {
+	f, err := os.Open(roots.selfPath("mountinfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseMountinfo(f, only, exclude)
+}
+
+// unescapeMountPath decodes the octal escapes (e.g. "\040" for a space) of
+// a path in /proc/self/mountinfo.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(path[i])
+	}
+
+	return sb.String()
+}
+
+// parseMountinfo selects mounts in /proc/self/mountinfo format. A mount point
+// mounted over is represented by its topmost mount, and a filesystem mounted
+// at several places (bind mounts, btrfs subvolumes) by the first one.
+func parseMountinfo(r io.Reader, only *regexp.Regexp, exclude *regexp.Regexp) ([]FsMount, error) {
+	var mounts []FsMount
+	var devids []string
+	mount_idx := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for idx := 6; idx < len(fields); idx++ {
+			if fields[idx] == "-" {
+				sep = idx
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+
+		mount := FsMount{
+			MountPoint: unescapeMountPath(fields[4]),
+			Device:     unescapeMountPath(fields[sep+2]),
+			FsType:     fields[sep+1],
+		}
+		if only == nil && (pseudoFsTypes[mount.FsType] || isNetworkFs(mount.FsType)) {
+			continue
+		}
+		if only != nil && !only.MatchString(mount.MountPoint) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(mount.MountPoint) {
+			continue
+		}
+
+		if idx, ok := mount_idx[mount.MountPoint]; ok {
+			mounts[idx] = mount
+			devids[idx] = fields[2]
+		} else {
+			mount_idx[mount.MountPoint] = len(mounts)
+			mounts = append(mounts, mount)
+			devids = append(devids, fields[2])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ret := make([]FsMount, 0, len(mounts))
+	seen := make(map[string]bool)
+	for idx, mount := range mounts {
+		if seen[devids[idx]] {
+			continue
+		}
+		seen[devids[idx]] = true
+		ret = append(ret, mount)
+	}
+
+	return ret, nil
+}
+
+// ReadFsStat samples capacity and inode counts of `mounts` by statfs(2).
+// Mounts which cannot be statfs'ed (e.g. unmounted since ReadMounts) are
+// skipped, and record.Fs is left nil if none can.
+func ReadFsStat(record *StatRecord, roots Roots, mounts []FsMount) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	fs_stat := NewFsStat()
+	for _, mount := range mounts {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(roots.mountPath(mount.MountPoint), &st); err != nil {
+			continue
+		}
+		if st.Blocks == 0 {
+			continue
+		}
+
+		frsize := int64(st.Frsize)
+		if frsize <= 0 {
+			frsize = int64(st.Bsize)
+		}
+		fs_stat.Entries = append(fs_stat.Entries, &FsStatEntry{
+			MountPoint:  mount.MountPoint,
+			Device:      mount.Device,
+			FsType:      mount.FsType,
+			TotalBytes:  int64(st.Blocks) * frsize,
+			FreeBytes:   int64(st.Bfree) * frsize,
+			AvailBytes:  int64(st.Bavail) * frsize,
+			TotalInodes: int64(st.Files),
+			FreeInodes:  int64(st.Ffree),
+		})
+	}
+
+	if len(fs_stat.Entries) > 0 {
+		record.Fs = fs_stat
+	}
+
+	return nil
+}
+
+// ReadNfsStat reads per-mount NFS client counters from
+// /proc/self/mountstats. Without NFS mounts, record.Nfs is left nil.
+func ReadNfsStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	f, err := os.Open(roots.selfPath("mountstats"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return parseMountstats(record, f)
+}
+
+// parseMountstats parses the NFS mounts in /proc/self/mountstats format:
+//
+//	device srv:/export mounted on /mnt with fstype nfs4 statvers=1.1
+//		bytes:	<normal rd> <normal wr> <direct rd> <direct wr> <server rd> <server wr> ...
+//		per-op statistics
+//		        READ: <ops> <trans> <timeouts> <sent> <recv> <queue> <rtt> <execute> ...
+//
+// A mount point listed twice keeps the last entry. Other filesystems, which
+// have no statistics, are skipped.
+func parseMountstats(record *StatRecord, r io.Reader) error {
+	nfs_stat := NewNfsStat()
+	var entry *NfsMountStatEntry = nil
+	per_op := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "device" {
+			entry = nil
+			per_op = false
+			if len(fields) < 8 || fields[2] != "mounted" || fields[5] != "with" ||
+				!strings.HasPrefix(fields[7], "nfs") {
+				continue
+			}
+			entry = &NfsMountStatEntry{
+				MountPoint: unescapeMountPath(fields[4]),
+				Device:     unescapeMountPath(fields[1]),
+				FsType:     fields[7],
+				Ops:        make([]*NfsOpStat, 0),
+			}
+			for idx, e := range nfs_stat.Entries {
+				if e.MountPoint == entry.MountPoint {
+					nfs_stat.Entries = append(nfs_stat.Entries[:idx], nfs_stat.Entries[idx+1:]...)
+					break
+				}
+			}
+			nfs_stat.Entries = append(nfs_stat.Entries, entry)
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+
+		if fields[0] == "bytes:" {
+			values := make([]int64, 6)
+			for idx := 0; idx < 6 && idx+1 < len(fields); idx++ {
+				val, err := strconv.ParseInt(fields[idx+1], 10, 64)
+				if err != nil {
+					return errors.New("Invalid value in /proc/self/mountstats: " + fields[idx+1])
+				}
+				values[idx] = val
+			}
+			entry.ReadBytes = values[0] + values[2]
+			entry.WriteBytes = values[1] + values[3]
+			entry.ServerReadBytes = values[4]
+			entry.ServerWriteBytes = values[5]
+		} else if strings.TrimSpace(line) == "per-op statistics" {
+			per_op = true
+		} else if per_op && strings.HasSuffix(fields[0], ":") && len(fields) >= 9 {
+			values := make([]int64, 8)
+			for idx := range values {
+				val, err := strconv.ParseInt(fields[idx+1], 10, 64)
+				if err != nil {
+					return errors.New("Invalid value in /proc/self/mountstats: " + fields[idx+1])
+				}
+				values[idx] = val
+			}
+			if values[0] == 0 {
+				continue
+			}
+			entry.Ops = append(entry.Ops, &NfsOpStat{
+				Name:      strings.TrimSuffix(fields[0], ":"),
+				Ops:       values[0],
+				Trans:     values[1],
+				Timeouts:  values[2],
+				BytesSent: values[3],
+				BytesRecv: values[4],
+				QueueTime: values[5],
+				Rtt:       values[6],
+				Execute:   values[7],
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(nfs_stat.Entries) > 0 {
+		record.Nfs = nfs_stat
+	}
+
+	return nil
+}
+
+// ReadThermalStat reads the temperature of each of `sensors`, normally
+// LinuxHeader.Sensors. Without sensors, record.Thermal is left nil.
+func ReadThermalStat(record *StatRecord, sensors []LinuxSensor) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+	if len(sensors) == 0 {
+		return nil
+	}
+
+	thermal_stat := NewThermalStat(len(sensors))
+	for idx, sensor := range sensors {
+		content, err := ioutil.ReadFile(sensor.Path)
+		if err != nil {
+			continue
+		}
+		val, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil {
+			continue
+		}
+		thermal_stat.Temps[idx] = val
+	}
+
+	record.Thermal = thermal_stat
+
+	return nil
+}
+
+// ReadEnergyStat reads the energy counter of each of `domains`, normally
+// LinuxHeader.PowerDomains. Without domains, record.Energy is left nil.
+func ReadEnergyStat(record *StatRecord, domains []LinuxPowerDomain) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+
+	energy_stat := NewEnergyStat(len(domains))
+	for idx, domain := range domains {
+		energy_stat.Energy[idx] = -1
+		content, err := ioutil.ReadFile(domain.Path + "/energy_uj")
+		if err != nil {
+			continue
+		}
+		val, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil {
+			continue
+		}
+		energy_stat.Energy[idx] = val
+	}
+
+	record.Energy = energy_stat
+
+	return nil
+}
+
+// ReadPressureStat reads PSI counters from /proc/pressure. On kernels
+// without PSI support, record.Pressure is left nil and no error is returned.
+func ReadPressureStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	return readPressureStatFrom(record, roots.procPath("/pressure"))
+}
+
+// readPressureStatFrom is ReadPressureStat with an injectable `pressure_dir`
+// so that it can be tested against a fake directory.
+func readPressureStatFrom(record *StatRecord, pressure_dir string) error {
+	pressure_stat := NewPressureStat()
+	found := false
+
+	for _, resource := range []string{"cpu", "io", "memory"} {
+		f, err := os.Open(fmt.Sprintf("%s/%s", pressure_dir, resource))
+		if err != nil {
+			continue
+		}
+		entry, err := parsePressureStatEntry(f)
+		f.Close()
+		if err != nil {
+			// e.g. EOPNOTSUPP when PSI is disabled by psi=0
+			continue
+		}
+
+		switch resource {
+		case "cpu":
+			pressure_stat.Cpu = entry
+		case "io":
+			pressure_stat.Io = entry
+		case "memory":
+			pressure_stat.Memory = entry
+		}
+		found = true
+	}
+
+	if found {
+		record.Pressure = pressure_stat
+	} else {
+		record.Pressure = nil
+	}
+
+	return nil
+}
+
+// parsePressureStatEntry parses lines like:
+//   some avg10=0.00 avg60=0.00 avg300=0.00 total=12345
+//   full avg10=0.00 avg60=0.00 avg300=0.00 total=6789
+func parsePressureStatEntry(r io.Reader) (*PressureStatEntry, error) {
+	entry := new(PressureStatEntry)
+	found := false
+
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		tokens := strings.Fields(scan.Text())
+		if len(tokens) == 0 {
+			continue
+		}
+
+		var total int64 = -1
+		for _, token := range tokens[1:] {
+			if !strings.HasPrefix(token, "total=") {
+				continue
+			}
+			val, err := strconv.ParseInt(token[len("total="):], 10, 64)
+			if err != nil {
+				return nil, errors.New("Invalid string for PSI total: " + token)
+			}
+			total = val
+		}
+		if total < 0 {
+			continue
+		}
+
+		switch tokens[0] {
+		case "some":
+			entry.SomeTotal = total
+			found = true
+		case "full":
+			entry.FullTotal = total
+			found = true
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, errors.New("No PSI entry found")
+	}
+
+	return entry, nil
+}
+
+func ReadMemStat(record *StatRecord, roots Roots) error {
+	if record == nil {
+		return errors.New("Valid *StatRecord is required.")
+	}
+
+	f, err := os.Open(roots.procPath("/meminfo"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return parseMemStat(record, f)
+}
+
+// parseMemStat parses /proc/meminfo. Lines which are not "Key: value [kB]"
+// are skipped, and keys without a MemStat field are kept in Others so
+// that fields added by newer kernels are not lost.
+func parseMemStat(record *StatRecord, r io.Reader) error {
+	mem_stat := NewMemStat()
+
+	fields := map[string]*int64{
+		"MemTotal":        &mem_stat.MemTotal,
+		"MemFree":         &mem_stat.MemFree,
+		"MemAvailable":    &mem_stat.MemAvailable,
+		"Buffers":         &mem_stat.Buffers,
+		"Cached":          &mem_stat.Cached,
+		"SwapCached":      &mem_stat.SwapCached,
+		"Active":          &mem_stat.Active,
+		"Inactive":        &mem_stat.Inactive,
+		"Active(anon)":    &mem_stat.ActiveAnon,
+		"Inactive(anon)":  &mem_stat.InactiveAnon,
+		"Active(file)":    &mem_stat.ActiveFile,
+		"Inactive(file)":  &mem_stat.InactiveFile,
+		"SwapTotal":       &mem_stat.SwapTotal,
+		"SwapFree":        &mem_stat.SwapFree,
+		"Zswap":           &mem_stat.Zswap,
+		"Zswapped":        &mem_stat.Zswapped,
+		"Dirty":           &mem_stat.Dirty,
+		"Writeback":       &mem_stat.Writeback,
+		"AnonPages":       &mem_stat.AnonPages,
+		"Mapped":          &mem_stat.Mapped,
+		"Shmem":           &mem_stat.Shmem,
+		"KReclaimable":    &mem_stat.KReclaimable,
+		"Slab":            &mem_stat.Slab,
+		"SReclaimable":    &mem_stat.SReclaimable,
+		"SUnreclaim":      &mem_stat.SUnreclaim,
+		"KernelStack":     &mem_stat.KernelStack,
+		"PageTables":      &mem_stat.PageTables,
+		"NFS_Unstable":    &mem_stat.NFS_Unstable,
+		"Bounce":          &mem_stat.Bounce,
+		"CommitLimit":     &mem_stat.CommitLimit,
+		"Committed_AS":    &mem_stat.Committed_AS,
+		"Percpu":          &mem_stat.Percpu,
+		"AnonHugePages":   &mem_stat.AnonHugePages,
+		"ShmemHugePages":  &mem_stat.ShmemHugePages,
+		"FileHugePages":   &mem_stat.FileHugePages,
+		"Unaccepted":      &mem_stat.Unaccepted,
+		"CmaTotal":        &mem_stat.CmaTotal,
+		"CmaFree":         &mem_stat.CmaFree,
+		"HugePages_Total": &mem_stat.HugePages_Total,
+		"HugePages_Free":  &mem_stat.HugePages_Free,
+		"HugePages_Rsvd":  &mem_stat.HugePages_Rsvd,
+		"HugePages_Surp":  &mem_stat.HugePages_Surp,
+		"Hugepagesize":    &mem_stat.Hugepagesize,
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		cols := strings.Fields(scanner.Text())
+		if len(cols) < 2 || !strings.HasSuffix(cols[0], ":") {
+			continue
+		}
+		key := strings.TrimSuffix(cols[0], ":")
+		val, err := strconv.ParseInt(cols[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if field, ok := fields[key]; ok {
+			*field = val
+		} else {
+			if mem_stat.Others == nil {
+				mem_stat.Others = make(map[string]int64)
+			}
+			mem_stat.Others[key] = val
+		}
+		if key == "MemAvailable" {
+			mem_stat.HasMemAvailable = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
 	record.Mem = mem_stat
 
 	return nil
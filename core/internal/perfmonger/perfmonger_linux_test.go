@@ -1,8 +1,13 @@
 package perfmonger
 
 import (
+	"encoding/binary"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -46,7 +51,7 @@ func TestParseDiskStatsShortFormat(t *testing.T) {
 
 	record := NewStatRecord()
 	targets := map[string]bool{"ram0": true}
-	err := parseDiskStats(record, strings.NewReader(input), &targets)
+	err := parseDiskStats(record, strings.NewReader(input), &targets, "/sys/block")
 	if err != nil {
 		t.Fatalf("parseDiskStats should not return an error on short-format lines: %v", err)
 	}
@@ -66,11 +71,54 @@ func TestParseDiskStatsShortFormat(t *testing.T) {
 	}
 }
 
+func TestParseDiskStatsDiscardFlush(t *testing.T) {
+	// 14 classic fields, 4 discard fields (Linux 4.18+) and 2 flush
+	// fields (Linux 5.5+).
+	input := " 259 0 nvme0n1 10 1 80 5 20 2 160 15 3 30 40 7 1 64 9 4 6\n" +
+		"   8 0 sda 10 1 80 5 20 2 160 15 0 30 40 7 1 64 9\n" +
+		"   8 16 sdb 10 1 80 5 20 2 160 15 0 30 40\n"
+
+	record := NewStatRecord()
+	targets := map[string]bool{"nvme0n1": true, "sda": true, "sdb": true}
+	err := parseDiskStats(record, strings.NewReader(input), &targets, "/sys/block")
+	if err != nil {
+		t.Fatalf("parseDiskStats should not return an error: %v", err)
+	}
+	if len(record.Disk.Entries) != 3 {
+		t.Fatalf("3 entries expected, got %d", len(record.Disk.Entries))
+	}
+
+	nvme := record.Disk.Entries[0]
+	if nvme.IosPgr != 3 {
+		t.Errorf("nvme0n1 IosPgr = %d, want 3", nvme.IosPgr)
+	}
+	if !nvme.HasDiscard || nvme.DcIos != 7 || nvme.DcMerges != 1 ||
+		nvme.DcSectors != 64 || nvme.DcTicks != 9 {
+		t.Errorf("nvme0n1 discard fields are not parsed: %+v", nvme)
+	}
+	if !nvme.HasFlush || nvme.FlIos != 4 || nvme.FlTicks != 6 {
+		t.Errorf("nvme0n1 flush fields are not parsed: %+v", nvme)
+	}
+
+	sda := record.Disk.Entries[1]
+	if !sda.HasDiscard || sda.DcIos != 7 {
+		t.Errorf("sda discard fields are not parsed: %+v", sda)
+	}
+	if sda.HasFlush {
+		t.Error("sda should not have flush fields")
+	}
+
+	sdb := record.Disk.Entries[2]
+	if sdb.HasDiscard || sdb.HasFlush {
+		t.Error("sdb should have neither discard nor flush fields")
+	}
+}
+
 func TestReadDiskStat(t *testing.T) {
 	var err error
 	var stat_record *StatRecord = nil
 
-	err = ReadDiskStats(stat_record, nil)
+	err = ReadDiskStats(stat_record, Roots{}, nil)
 	if err == nil {
 		t.Errorf("Error should be returned with nil *StatRecord.")
 	}
@@ -81,7 +129,7 @@ func TestReadDiskStat(t *testing.T) {
 	}
 
 	stat_record = NewStatRecord()
-	err = ReadDiskStats(stat_record, nil)
+	err = ReadDiskStats(stat_record, Roots{}, nil)
 	if err != nil {
 		t.Error("Error should not be returned with valid *StatRecord")
 	}
@@ -131,13 +179,24 @@ func TestReadNetStat(t *testing.T) {
 	if !lo_found {
 		t.Error("Device 'lo' not found.")
 	}
+
+	stat_record = NewStatRecord()
+	err = ReadNetStat1(stat_record, Roots{}, nil, regexp.MustCompile("^lo$"))
+	if err != nil {
+		t.Errorf("Error should not be returned with valid *StatRecord: %v", err)
+	}
+	for _, entry := range stat_record.Net.Entries {
+		if entry.Name == "lo" {
+			t.Error("Device 'lo' should be excluded.")
+		}
+	}
 }
 
 func TestReadMemStat(t *testing.T) {
 	var err error
 	var stat_record *StatRecord = nil
 
-	err = ReadMemStat(stat_record)
+	err = ReadMemStat(stat_record, Roots{})
 	if err == nil {
 		t.Errorf("Error should not be returned with non-nil *StatRecord.")
 	}
@@ -148,7 +207,7 @@ func TestReadMemStat(t *testing.T) {
 	}
 
 	stat_record = NewStatRecord()
-	err = ReadMemStat(stat_record)
+	err = ReadMemStat(stat_record, Roots{})
 	if err != nil {
 		log.Print(err)
 		t.Error("Error should not be returned with valid *StatRecord.")
@@ -171,3 +230,1308 @@ func TestReadMemStat(t *testing.T) {
 		return
 	}
 }
+
+func TestParseSoftIrqStat(t *testing.T) {
+	input := "                    CPU0       CPU1\n" +
+		"          HI:          1          2\n" +
+		"       TIMER:        100        200\n" +
+		"      NET_TX:          3          4\n" +
+		"      NET_RX:       1000         10\n" +
+		"       BLOCK:         50       5000\n" +
+		"    IRQ_POLL:          0          0\n" +
+		"     TASKLET:          7          8\n" +
+		"       SCHED:         30         40\n" +
+		"     HRTIMER:          0          1\n" +
+		"         RCU:         60         70\n"
+
+	record := NewStatRecord()
+	err := parseSoftIrqStat(record, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseSoftIrqStat returned an error: %v", err)
+	}
+	if record.Softirq == nil {
+		t.Fatal("record.Softirq should not be nil")
+	}
+
+	sirq_stat := record.Softirq
+	if sirq_stat.NumCore != 2 {
+		t.Errorf("NumCore = %v, want %v", sirq_stat.NumCore, 2)
+	}
+	if sirq_stat.CoreStats[0].NetRx != 1000 || sirq_stat.CoreStats[1].NetRx != 10 {
+		t.Errorf("NET_RX = %v/%v, want 1000/10",
+			sirq_stat.CoreStats[0].NetRx, sirq_stat.CoreStats[1].NetRx)
+	}
+	if sirq_stat.CoreStats[1].Block != 5000 {
+		t.Errorf("CoreStats[1].Block = %v, want %v", sirq_stat.CoreStats[1].Block, 5000)
+	}
+	if sirq_stat.All.Timer != 300 {
+		t.Errorf("All.Timer = %v, want %v", sirq_stat.All.Timer, 300)
+	}
+	if sirq_stat.All.Rcu != 130 {
+		t.Errorf("All.Rcu = %v, want %v", sirq_stat.All.Rcu, 130)
+	}
+
+	err = parseSoftIrqStat(NewStatRecord(), strings.NewReader(""))
+	if err == nil {
+		t.Error("Error should be returned for empty input")
+	}
+}
+
+func TestParsePressureStatEntry(t *testing.T) {
+	input := "some avg10=1.50 avg60=0.80 avg300=0.20 total=123456\n" +
+		"full avg10=0.50 avg60=0.10 avg300=0.00 total=7890\n"
+
+	entry, err := parsePressureStatEntry(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parsePressureStatEntry returned an error: %v", err)
+	}
+	if entry.SomeTotal != 123456 {
+		t.Errorf("SomeTotal = %v, want %v", entry.SomeTotal, 123456)
+	}
+	if entry.FullTotal != 7890 {
+		t.Errorf("FullTotal = %v, want %v", entry.FullTotal, 7890)
+	}
+
+	// Kernels before 5.13 report only a "some" line for cpu
+	entry, err = parsePressureStatEntry(strings.NewReader(
+		"some avg10=0.00 avg60=0.00 avg300=0.00 total=42\n"))
+	if err != nil {
+		t.Fatalf("parsePressureStatEntry returned an error: %v", err)
+	}
+	if entry.SomeTotal != 42 || entry.FullTotal != 0 {
+		t.Errorf("entry = %v, want {42 0}", entry)
+	}
+
+	_, err = parsePressureStatEntry(strings.NewReader(""))
+	if err == nil {
+		t.Error("Error should be returned for empty input")
+	}
+}
+
+func TestReadPressureStatMissing(t *testing.T) {
+	dir := t.TempDir()
+
+	record := NewStatRecord()
+	err := readPressureStatFrom(record, dir+"/nonexistent")
+	if err != nil {
+		t.Errorf("readPressureStatFrom should not fail without PSI: %v", err)
+	}
+	if record.Pressure != nil {
+		t.Errorf("record.Pressure = %v, want nil", record.Pressure)
+	}
+
+	content := "some avg10=0.00 avg60=0.00 avg300=0.00 total=100\n" +
+		"full avg10=0.00 avg60=0.00 avg300=0.00 total=50\n"
+	if err := os.WriteFile(dir+"/io", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = readPressureStatFrom(record, dir)
+	if err != nil {
+		t.Fatalf("readPressureStatFrom returned an error: %v", err)
+	}
+	if record.Pressure == nil {
+		t.Fatal("record.Pressure should not be nil")
+	}
+	if record.Pressure.Cpu != nil || record.Pressure.Memory != nil {
+		t.Error("Missing resources should be left nil")
+	}
+	if record.Pressure.Io == nil || record.Pressure.Io.FullTotal != 50 {
+		t.Errorf("record.Pressure.Io = %v, want {100 50}", record.Pressure.Io)
+	}
+}
+
+func TestParseVmStat(t *testing.T) {
+	input := "nr_free_pages 812866\n" +
+		"pgfault 1000\n" +
+		"pgmajfault 20\n" +
+		"pswpin 3\n" +
+		"pswpout 4\n" +
+		"allocstall_dma32 1\n" +
+		"allocstall_normal 5\n" +
+		"pgsteal_kswapd 70\n" +
+		"pgsteal_direct 8\n" +
+		"pgscan_kswapd_dma 10\n" +
+		"pgscan_kswapd_normal 90\n" +
+		"pgscan_direct 9\n" +
+		"pgscan_direct_throttle 12345\n" +
+		"oom_kill 2\n" +
+		"compact_stall 6\n" +
+		"thp_fault_alloc 11\n" +
+		"thp_fault_fallback_charge 999\n" +
+		"thp_split_page 13\n"
+
+	record := NewStatRecord()
+	err := parseVmStat(record, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseVmStat returned an error: %v", err)
+	}
+	if record.Vm == nil {
+		t.Fatal("record.Vm should not be nil")
+	}
+
+	vm_stat := record.Vm
+	checks := []struct {
+		name   string
+		val    int64
+		wanted int64
+	}{
+		{"PgFault", vm_stat.PgFault, 1000},
+		{"PgMajFault", vm_stat.PgMajFault, 20},
+		{"PswpIn", vm_stat.PswpIn, 3},
+		{"PswpOut", vm_stat.PswpOut, 4},
+		{"AllocStall", vm_stat.AllocStall, 6},
+		{"PgStealKswapd", vm_stat.PgStealKswapd, 70},
+		{"PgStealDirect", vm_stat.PgStealDirect, 8},
+		{"PgScanKswapd", vm_stat.PgScanKswapd, 100},
+		{"PgScanDirect", vm_stat.PgScanDirect, 9},
+		{"OomKill", vm_stat.OomKill, 2},
+		{"CompactStall", vm_stat.CompactStall, 6},
+		{"ThpFaultAlloc", vm_stat.ThpFaultAlloc, 11},
+		{"ThpFaultFallback", vm_stat.ThpFaultFallback, 0},
+		{"ThpSplitPage", vm_stat.ThpSplitPage, 13},
+	}
+	for _, c := range checks {
+		if c.val != c.wanted {
+			t.Errorf("%s = %v, want %v", c.name, c.val, c.wanted)
+		}
+	}
+}
+
+func TestParseProcPidStat(t *testing.T) {
+	// comm may contain spaces and parentheses
+	input := "1234 (my (odd) cmd) S 1000 1234 1000 34816 1234 4194304 " +
+		"500 600 7 8 150 40 30 20 20 0 1 0 12345 1000000 200\n"
+
+	entry := NewProcessStatEntry()
+	err := parseProcPidStat(entry, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseProcPidStat returned an error: %v", err)
+	}
+
+	if entry.Pid != 1234 || entry.Ppid != 1000 {
+		t.Errorf("Pid, Ppid = %v, %v, want 1234, 1000", entry.Pid, entry.Ppid)
+	}
+	if entry.Comm != "my (odd) cmd" {
+		t.Errorf("Comm = %q, want %q", entry.Comm, "my (odd) cmd")
+	}
+	if entry.MajFlt != 7 || entry.CMajFlt != 8 {
+		t.Errorf("MajFlt, CMajFlt = %v, %v, want 7, 8", entry.MajFlt, entry.CMajFlt)
+	}
+	if entry.Utime != 150 || entry.Stime != 40 || entry.Cutime != 30 || entry.Cstime != 20 {
+		t.Errorf("entry = %+v, want utime/stime/cutime/cstime = 150/40/30/20", entry)
+	}
+
+	err = parseProcPidStat(NewProcessStatEntry(), strings.NewReader("1234 (cmd) S 1"))
+	if err == nil {
+		t.Error("Error should be returned for a truncated line")
+	}
+}
+
+func TestReadProcessStatTree(t *testing.T) {
+	dir := t.TempDir()
+
+	writeProc := func(pid int, ppid int, utime int, status string, io string) {
+		pid_dir := fmt.Sprintf("%s/%d", dir, pid)
+		if err := os.Mkdir(pid_dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		stat := fmt.Sprintf("%d (proc%d) S %d 0 0 0 0 0 0 0 1 0 %d 0 0 0 20 0 1 0 0 0 0\n",
+			pid, pid, ppid, utime)
+		if err := os.WriteFile(pid_dir+"/stat", []byte(stat), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if status != "" {
+			if err := os.WriteFile(pid_dir+"/status", []byte(status), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if io != "" {
+			if err := os.WriteFile(pid_dir+"/io", []byte(io), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	writeProc(1, 0, 1000, "", "")
+	writeProc(100, 1, 10, "Name:\tsh\nVmHWM:\t   2048 kB\nVmRSS:\t   1024 kB\n"+
+		"voluntary_ctxt_switches:\t5\nnonvoluntary_ctxt_switches:\t1\n",
+		"rchar: 10\nread_bytes: 4096\nwrite_bytes: 8192\n")
+	writeProc(101, 100, 20, "VmRSS:\t   512 kB\n", "")
+	writeProc(102, 101, 30, "", "")
+	writeProc(200, 1, 40, "", "")
+	if err := os.Mkdir(dir+"/self", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	record := NewStatRecord()
+	err := readProcessStatFrom(record, dir, 100)
+	if err != nil {
+		t.Fatalf("readProcessStatFrom returned an error: %v", err)
+	}
+	if record.Process == nil {
+		t.Fatal("record.Process should not be nil")
+	}
+	if record.Process.RootPid != 100 {
+		t.Errorf("RootPid = %v, want %v", record.Process.RootPid, 100)
+	}
+
+	pids := map[int]*ProcessStatEntry{}
+	for _, entry := range record.Process.Entries {
+		pids[entry.Pid] = entry
+	}
+	if len(pids) != 3 || pids[100] == nil || pids[101] == nil || pids[102] == nil {
+		t.Errorf("Entries = %v, want pid 100, 101 and 102", record.Process.Entries)
+	}
+	if e := pids[100]; e != nil {
+		if e.VmRSS != 1024 || e.VmHWM != 2048 || e.ReadBytes != 4096 || e.WriteBytes != 8192 ||
+			e.VoluntaryCtxtSwitches != 5 || e.NonvoluntaryCtxtSwitches != 1 {
+			t.Errorf("entry of pid 100 = %+v", e)
+		}
+	}
+
+	err = readProcessStatFrom(record, dir, 999)
+	if err != nil {
+		t.Errorf("readProcessStatFrom returned an error for a missing process: %v", err)
+	}
+	if record.Process != nil {
+		t.Errorf("record.Process = %v, want nil for a missing process", record.Process)
+	}
+}
+
+func TestReadCgroupStat(t *testing.T) {
+	dir := t.TempDir()
+
+	cg_dir := dir + "/system.slice/foo.service"
+	if err := os.MkdirAll(cg_dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"cpu.stat": "usage_usec 3000\nuser_usec 2000\nsystem_usec 1000\n" +
+			"nr_periods 10\nnr_throttled 2\nthrottled_usec 500\n",
+		"memory.current": "1048576\n",
+		"memory.stat":    "anon 524288\nfile 262144\nkernel 4096\npgfault 100\npgmajfault 7\n",
+		"io.stat": "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n" +
+			"8:16 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n",
+		"io.pressure": "some avg10=0.00 avg60=0.00 avg300=0.00 total=300\n" +
+			"full avg10=0.00 avg60=0.00 avg300=0.00 total=100\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(cg_dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record := NewStatRecord()
+	err := readCgroupStatFrom(record, dir, []string{"/system.slice/foo.service", "nonexistent"})
+	if err != nil {
+		t.Fatalf("readCgroupStatFrom returned an error: %v", err)
+	}
+	if record.Cgroup == nil {
+		t.Fatal("record.Cgroup should not be nil")
+	}
+	if len(record.Cgroup.Entries) != 1 {
+		t.Fatalf("len(Entries) = %v, want 1 (nonexistent cgroups are skipped)", len(record.Cgroup.Entries))
+	}
+
+	e := record.Cgroup.Entries[0]
+	if e.Path != "/system.slice/foo.service" {
+		t.Errorf("Path = %v, want %v", e.Path, "/system.slice/foo.service")
+	}
+	if e.UsageUsec != 3000 || e.UserUsec != 2000 || e.SystemUsec != 1000 ||
+		e.NrPeriods != 10 || e.NrThrottled != 2 || e.ThrottledUsec != 500 {
+		t.Errorf("cpu.stat counters = %+v", e)
+	}
+	if e.MemoryCurrent != 1048576 || e.MemAnon != 524288 || e.MemFile != 262144 || e.MemPgMajFault != 7 {
+		t.Errorf("memory counters = %+v", e)
+	}
+	if e.IoRbytes != 8192 || e.IoWbytes != 8192 || e.IoRios != 2 || e.IoWios != 2 {
+		t.Errorf("io.stat counters = %+v", e)
+	}
+	if e.CpuPressure != nil {
+		t.Errorf("CpuPressure = %v, want nil", e.CpuPressure)
+	}
+	if e.IoPressure == nil || e.IoPressure.SomeTotal != 300 || e.IoPressure.FullTotal != 100 {
+		t.Errorf("IoPressure = %v", e.IoPressure)
+	}
+}
+
+func TestReadCpuFreqStat(t *testing.T) {
+	dir := t.TempDir()
+
+	for cpu_id, freq := range map[int]string{0: "800000\n", 2: "3500000\n"} {
+		freq_dir := fmt.Sprintf("%s/cpu%d/cpufreq", dir, cpu_id)
+		if err := os.MkdirAll(freq_dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(freq_dir+"/scaling_cur_freq", []byte(freq), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(freq_dir+"/scaling_governor", []byte("powersave\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// cpu1 without cpufreq, and directories which are not cores
+	for _, name := range []string{"cpu1", "cpufreq", "cpuidle"} {
+		if err := os.Mkdir(dir+"/"+name, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record := NewStatRecord()
+	err := readCpuFreqStatFrom(record, dir, dir+"/nonexistent")
+	if err != nil {
+		t.Fatalf("readCpuFreqStatFrom returned an error: %v", err)
+	}
+	if record.CpuFreq == nil {
+		t.Fatal("record.CpuFreq should not be nil")
+	}
+	if record.CpuFreq.NumCore != 3 {
+		t.Errorf("NumCore = %v, want 3", record.CpuFreq.NumCore)
+	}
+	expected := []int64{800000, 0, 3500000}
+	for idx, freq := range expected {
+		if record.CpuFreq.CoreFreqs[idx] != freq {
+			t.Errorf("CoreFreqs[%d] = %v, want %v", idx, record.CpuFreq.CoreFreqs[idx], freq)
+		}
+	}
+
+	governors := readCpuGovernorsFrom(dir)
+	if len(governors) != 3 || governors[0] != "powersave" || governors[1] != "" || governors[2] != "powersave" {
+		t.Errorf("governors = %q", governors)
+	}
+
+	// fall back to /proc/cpuinfo
+	cpuinfo := "processor\t: 0\nmodel name\t: Fake CPU\ncpu MHz\t\t: 2100.500\n\n" +
+		"processor\t: 1\nmodel name\t: Fake CPU\ncpu MHz\t\t: 1200.000\n\n"
+	if err := os.WriteFile(dir+"/cpuinfo", []byte(cpuinfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty_dir := t.TempDir()
+	err = readCpuFreqStatFrom(record, empty_dir, dir+"/cpuinfo")
+	if err != nil {
+		t.Fatalf("readCpuFreqStatFrom returned an error: %v", err)
+	}
+	if record.CpuFreq == nil || record.CpuFreq.NumCore != 2 ||
+		record.CpuFreq.CoreFreqs[0] != 2100500 || record.CpuFreq.CoreFreqs[1] != 1200000 {
+		t.Errorf("CpuFreq from cpuinfo = %+v", record.CpuFreq)
+	}
+	if readCpuGovernorsFrom(empty_dir) != nil {
+		t.Error("governors should be nil without cpufreq")
+	}
+
+	err = readCpuFreqStatFrom(record, empty_dir, dir+"/nonexistent")
+	if err != nil {
+		t.Errorf("readCpuFreqStatFrom returned an error: %v", err)
+	}
+	if record.CpuFreq != nil {
+		t.Errorf("CpuFreq = %+v, want nil", record.CpuFreq)
+	}
+}
+
+func TestReadCpuIdleStat(t *testing.T) {
+	dir := t.TempDir()
+
+	writeState := func(cpu_id int, state int, name string, time_usec string, usage string) {
+		state_dir := fmt.Sprintf("%s/cpu%d/cpuidle/state%d", dir, cpu_id, state)
+		if err := os.MkdirAll(state_dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for file, content := range map[string]string{"name": name, "time": time_usec, "usage": usage} {
+			if err := os.WriteFile(state_dir+"/"+file, []byte(content+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeState(0, 0, "POLL", "100", "10")
+	writeState(0, 1, "C1", "2000", "20")
+	writeState(0, 2, "C6", "300000", "30")
+	writeState(2, 0, "POLL", "400", "40")
+	writeState(2, 1, "C1", "5000", "50")
+	writeState(2, 2, "C6", "600000", "60")
+	// cpu1 without cpuidle
+	if err := os.Mkdir(dir+"/cpu1", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	record := NewStatRecord()
+	err := readCpuIdleStatFrom(record, dir)
+	if err != nil {
+		t.Fatalf("readCpuIdleStatFrom returned an error: %v", err)
+	}
+	if record.CpuIdle == nil {
+		t.Fatal("record.CpuIdle should not be nil")
+	}
+	if record.CpuIdle.NumCore != 3 {
+		t.Errorf("NumCore = %v, want 3", record.CpuIdle.NumCore)
+	}
+	if len(record.CpuIdle.StateNames) != 3 || record.CpuIdle.StateNames[0] != "POLL" ||
+		record.CpuIdle.StateNames[2] != "C6" {
+		t.Errorf("StateNames = %q", record.CpuIdle.StateNames)
+	}
+	if len(record.CpuIdle.CoreStats[1].Times) != 0 {
+		t.Errorf("cpu1 = %+v, want no states", record.CpuIdle.CoreStats[1])
+	}
+	core_stat := record.CpuIdle.CoreStats[2]
+	if len(core_stat.Times) != 3 || core_stat.Times[2] != 600000 || core_stat.Usages[0] != 40 {
+		t.Errorf("cpu2 = %+v", core_stat)
+	}
+
+	err = readCpuIdleStatFrom(record, t.TempDir())
+	if err != nil {
+		t.Errorf("readCpuIdleStatFrom returned an error: %v", err)
+	}
+	if record.CpuIdle != nil {
+		t.Errorf("CpuIdle = %+v, want nil", record.CpuIdle)
+	}
+}
+
+func TestParseLoadAvg(t *testing.T) {
+	loadavg, err := parseLoadAvg(strings.NewReader("0.20 1.18 2.50 3/80 11206\n"))
+	if err != nil {
+		t.Fatalf("parseLoadAvg returned an error: %v", err)
+	}
+	if loadavg.Load1 != 0.20 || loadavg.Load5 != 1.18 || loadavg.Load15 != 2.50 {
+		t.Errorf("load averages = %v, %v, %v", loadavg.Load1, loadavg.Load5, loadavg.Load15)
+	}
+	if loadavg.NrRunning != 3 || loadavg.NrThreads != 80 {
+		t.Errorf("NrRunning = %v, NrThreads = %v, want 3, 80", loadavg.NrRunning, loadavg.NrThreads)
+	}
+
+	_, err = parseLoadAvg(strings.NewReader("garbage\n"))
+	if err == nil {
+		t.Error("Error should be returned for a malformed line")
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	if _, err := os.Stat("/proc/stat"); err != nil {
+		t.Skip("/proc/stat is not present.")
+	}
+
+	record := NewStatRecord()
+	if err := ReadProcStat(record, Roots{}); err != nil {
+		t.Fatalf("ReadProcStat returned an error: %v", err)
+	}
+
+	proc := record.Proc
+	if proc == nil {
+		t.Fatal("record.Proc should not be nil")
+	}
+	if proc.ContextSwitch == 0 || proc.Fork == 0 || proc.Interrupt == 0 {
+		t.Errorf("counters should be non-zero: %+v", proc)
+	}
+	// this process itself is running
+	if proc.ProcsRunning < 1 {
+		t.Errorf("ProcsRunning = %v, want >= 1", proc.ProcsRunning)
+	}
+	if proc.LoadAvg == nil || proc.LoadAvg.NrThreads < 1 {
+		t.Errorf("LoadAvg = %+v", proc.LoadAvg)
+	}
+}
+
+func TestReadNetProtoStat(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"snmp": "Ip: Forwarding DefaultTTL InReceives InHdrErrors InAddrErrors ForwDatagrams InUnknownProtos InDiscards InDelivers OutRequests OutDiscards\n" +
+			"Ip: 1 64 1000 0 0 0 0 3 990 800 2\n" +
+			"Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors\n" +
+			"Tcp: 1 200 120000 -1 10 20 1 2 5 700 600 12 4 3 0\n" +
+			"Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti MemErrors\n" +
+			"Udp: 100 1 2 90 7 8 0 0 0\n",
+		"netstat": "TcpExt: SyncookiesSent ListenOverflows ListenDrops TCPTimeouts TCPSynRetrans\n" +
+			"TcpExt: 0 6 9 11 13\n" +
+			"IpExt: InNoRoutes InTruncatedPkts\n" +
+			"IpExt: 0 0\n",
+		"sockstat": "sockets: used 123\n" +
+			"TCP: inuse 5 orphan 1 tw 2 alloc 7 mem 3\n" +
+			"UDP: inuse 4 mem 6\n" +
+			"FRAG: inuse 0 memory 0\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record := NewStatRecord()
+	err := readNetProtoStatFrom(record, dir)
+	if err != nil {
+		t.Fatalf("readNetProtoStatFrom returned an error: %v", err)
+	}
+	n := record.NetProto
+	if n == nil {
+		t.Fatal("record.NetProto should not be nil")
+	}
+	if n.IpInReceives != 1000 || n.IpInDiscards != 3 || n.IpOutRequests != 800 || n.IpOutDiscards != 2 {
+		t.Errorf("Ip counters are not parsed: %+v", n)
+	}
+	if n.TcpActiveOpens != 10 || n.TcpPassiveOpens != 20 || n.TcpCurrEstab != 5 ||
+		n.TcpInSegs != 700 || n.TcpOutSegs != 600 || n.TcpRetransSegs != 12 ||
+		n.TcpInErrs != 4 || n.TcpOutRsts != 3 {
+		t.Errorf("Tcp counters are not parsed: %+v", n)
+	}
+	if n.UdpInDatagrams != 100 || n.UdpRcvbufErrors != 7 || n.UdpSndbufErrors != 8 {
+		t.Errorf("Udp counters are not parsed: %+v", n)
+	}
+	if n.ListenOverflows != 6 || n.ListenDrops != 9 || n.TCPTimeouts != 11 || n.TCPSynRetrans != 13 {
+		t.Errorf("TcpExt counters are not parsed: %+v", n)
+	}
+	if n.SocketsUsed != 123 || n.TcpInUse != 5 || n.TcpOrphan != 1 || n.TcpTimeWait != 2 ||
+		n.TcpAlloc != 7 || n.TcpMem != 3 || n.UdpInUse != 4 || n.UdpMem != 6 {
+		t.Errorf("sockstat values are not parsed: %+v", n)
+	}
+
+	// netstat and sockstat are optional
+	os.Remove(dir + "/netstat")
+	os.Remove(dir + "/sockstat")
+	record = NewStatRecord()
+	if err := readNetProtoStatFrom(record, dir); err != nil {
+		t.Fatalf("readNetProtoStatFrom returned an error without netstat: %v", err)
+	}
+	if record.NetProto.TcpRetransSegs != 12 || record.NetProto.ListenOverflows != 0 {
+		t.Errorf("unexpected NetProto: %+v", record.NetProto)
+	}
+
+	os.Remove(dir + "/snmp")
+	if err := readNetProtoStatFrom(NewStatRecord(), dir); err == nil {
+		t.Error("Error should be returned without snmp")
+	}
+
+	if err := ReadNetProtoStat(nil, Roots{}); err == nil {
+		t.Error("Error should be returned with nil *StatRecord.")
+	}
+}
+
+func TestReadIrqAffinity(t *testing.T) {
+	dir := t.TempDir()
+
+	for irqno, content := range map[string]string{"24": "0-3\n", "25": "2\n"} {
+		if err := os.MkdirAll(dir+"/"+irqno, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dir+"/"+irqno+"/smp_affinity_list", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not an IRQ directory
+	if err := os.WriteFile(dir+"/default_smp_affinity", []byte("f\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	affinity := readIrqAffinityFrom(dir)
+	if len(affinity) != 2 || affinity[24] != "0-3" || affinity[25] != "2" {
+		t.Errorf("affinity = %v, want map[24:0-3 25:2]", affinity)
+	}
+
+	if affinity := readIrqAffinityFrom(dir + "/nonexistent"); affinity != nil {
+		t.Errorf("affinity = %v, want nil", affinity)
+	}
+}
+
+func TestParseMemStat(t *testing.T) {
+	input := "MemTotal:       16000000 kB\n" +
+		"MemFree:         2000000 kB\n" +
+		"MemAvailable:    9000000 kB\n" +
+		"Active(anon):    3000000 kB\n" +
+		"Inactive(file):  4000000 kB\n" +
+		"Zswap:             10000 kB\n" +
+		"Unaccepted:            0 kB\n" +
+		"HugePages_Total:       4\n" +
+		"\n" +
+		"malformed line\n" +
+		"Broken:              abc kB\n" +
+		"DirectMap2M:     8000000 kB\n"
+
+	record := NewStatRecord()
+	err := parseMemStat(record, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseMemStat returned an error: %v", err)
+	}
+	mem := record.Mem
+	if mem == nil {
+		t.Fatal("record.Mem should not be nil")
+	}
+	if mem.MemTotal != 16000000 || mem.MemFree != 2000000 || mem.HugePages_Total != 4 {
+		t.Errorf("classic fields = %+v", mem)
+	}
+	if !mem.HasMemAvailable || mem.MemAvailable != 9000000 || mem.ActiveAnon != 3000000 ||
+		mem.InactiveFile != 4000000 || mem.Zswap != 10000 {
+		t.Errorf("modern fields = %+v", mem)
+	}
+	if len(mem.Others) != 1 || mem.Others["DirectMap2M"] != 8000000 {
+		t.Errorf("Others = %v, want map[DirectMap2M:8000000]", mem.Others)
+	}
+
+	// kernels older than 3.14
+	err = parseMemStat(record, strings.NewReader("MemTotal: 1000 kB\nMemFree: 500 kB\n"))
+	if err != nil {
+		t.Fatalf("parseMemStat returned an error: %v", err)
+	}
+	if record.Mem.HasMemAvailable || record.Mem.Others != nil {
+		t.Errorf("Mem = %+v, want no MemAvailable and no other keys", record.Mem)
+	}
+}
+
+func TestReadNumaStat(t *testing.T) {
+	dir := t.TempDir()
+
+	meminfo := "Node %d MemTotal:       16314628 kB\n" +
+		"Node %d MemFree:         8000000 kB\n" +
+		"Node %d MemUsed:         8314628 kB\n" +
+		"Node %d FilePages:       2000000 kB\n" +
+		"Node %d AnonPages:       3000000 kB\n" +
+		"Node %d Slab:             400000 kB\n"
+	numastat := "numa_hit 1000\nnuma_miss 20\nnuma_foreign 30\n" +
+		"interleave_hit 4\nlocal_node 990\nother_node 30\n"
+	for node_id, cpulist := range map[int]string{0: "0-1,4\n", 1: "2-3\n"} {
+		node_dir := fmt.Sprintf("%s/node%d", dir, node_id)
+		if err := os.MkdirAll(node_dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := strings.ReplaceAll(meminfo, "%d", fmt.Sprint(node_id))
+		if err := os.WriteFile(node_dir+"/meminfo", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(node_dir+"/numastat", []byte(numastat), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(node_dir+"/cpulist", []byte(cpulist), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not a node directory
+	if err := os.Mkdir(dir+"/power", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	record := NewStatRecord()
+	err := readNumaStatFrom(record, dir)
+	if err != nil {
+		t.Fatalf("readNumaStatFrom returned an error: %v", err)
+	}
+	if record.Numa == nil || len(record.Numa.Entries) != 2 {
+		t.Fatalf("record.Numa = %+v, want 2 nodes", record.Numa)
+	}
+	entry := record.Numa.Entries[1]
+	if entry.NodeId != 1 || entry.MemTotal != 16314628 || entry.MemUsed != 8314628 ||
+		entry.AnonPages != 3000000 || entry.Slab != 400000 {
+		t.Errorf("node1 memory = %+v", entry)
+	}
+	if entry.NumaHit != 1000 || entry.NumaMiss != 20 || entry.NumaForeign != 30 ||
+		entry.InterleaveHit != 4 || entry.LocalNode != 990 || entry.OtherNode != 30 {
+		t.Errorf("node1 numastat = %+v", entry)
+	}
+
+	node_cpus := readNumaNodeCpusFrom(dir)
+	if len(node_cpus) != 2 || fmt.Sprint(node_cpus[0]) != "[0 1 4]" ||
+		fmt.Sprint(node_cpus[1]) != "[2 3]" {
+		t.Errorf("node_cpus = %v", node_cpus)
+	}
+
+	err = readNumaStatFrom(record, dir+"/nonexistent")
+	if err != nil {
+		t.Errorf("readNumaStatFrom returned an error: %v", err)
+	}
+	if record.Numa != nil {
+		t.Errorf("Numa = %+v, want nil", record.Numa)
+	}
+	if node_cpus := readNumaNodeCpusFrom(dir + "/nonexistent"); node_cpus != nil {
+		t.Errorf("node_cpus = %v, want nil", node_cpus)
+	}
+}
+
+func TestReadCpuTopology(t *testing.T) {
+	dir := t.TempDir()
+
+	// 2 sockets x 1 core x 2 threads, cpu4 without topology
+	for cpu_id, topo := range map[int][3]string{
+		0: {"0", "0", "0,2"},
+		1: {"1", "0", "1,3"},
+		2: {"0", "0", "0,2"},
+		3: {"1", "0", "1,3"},
+	} {
+		topo_dir := fmt.Sprintf("%s/cpu%d/topology", dir, cpu_id)
+		if err := os.MkdirAll(topo_dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for idx, file := range []string{"physical_package_id", "core_id", "thread_siblings_list"} {
+			if err := os.WriteFile(topo_dir+"/"+file, []byte(topo[idx]+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.Mkdir(dir+"/cpu4", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	topology := readCpuTopologyFrom(dir, map[int][]int{0: {0, 2}, 1: {1, 3}})
+	if len(topology) != 5 {
+		t.Fatalf("len(topology) = %d, want 5", len(topology))
+	}
+	if topology[3].PackageId != 1 || topology[3].CoreId != 0 || topology[3].NodeId != 1 ||
+		fmt.Sprint(topology[3].ThreadSiblings) != "[1 3]" {
+		t.Errorf("cpu3 = %+v", topology[3])
+	}
+	if topology[4].PackageId != -1 || topology[4].CoreId != -1 || topology[4].NodeId != -1 {
+		t.Errorf("cpu4 = %+v, want unknown ids", topology[4])
+	}
+
+	if topology := readCpuTopologyFrom(t.TempDir(), nil); topology != nil {
+		t.Errorf("topology = %+v, want nil", topology)
+	}
+}
+
+func TestReadNetDevices(t *testing.T) {
+	dir := t.TempDir()
+
+	writeAttrs := func(name string, attrs map[string]string) {
+		for file, content := range attrs {
+			path := dir + "/" + name + "/" + file
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// eth0 and eth1 are bonded into bond0, which is a bridge port of br0;
+	// veth0 and veth1 are a veth pair; eth2 reports no speed since it is down.
+	writeAttrs("eth0", map[string]string{"speed": "10000", "duplex": "full",
+		"mtu": "9000", "operstate": "up", "type": "1", "ifindex": "2",
+		"iflink": "2", "device/vendor": "0x8086"})
+	writeAttrs("eth1", map[string]string{"speed": "10000", "duplex": "full",
+		"mtu": "9000", "operstate": "up", "type": "1", "ifindex": "3",
+		"iflink": "3", "device/vendor": "0x8086"})
+	writeAttrs("bond0", map[string]string{"speed": "20000", "duplex": "full",
+		"mtu": "9000", "operstate": "up", "type": "1", "ifindex": "4",
+		"iflink": "4", "bonding/slaves": "eth0 eth1"})
+	writeAttrs("br0", map[string]string{"mtu": "9000", "operstate": "up",
+		"type": "1", "ifindex": "5", "iflink": "5", "uevent": "DEVTYPE=bridge",
+		"bridge/stp_state": "0", "brif/bond0/port_no": "0x1"})
+	writeAttrs("veth0", map[string]string{"speed": "10000", "duplex": "full",
+		"type": "1", "ifindex": "6", "iflink": "7"})
+	writeAttrs("veth1", map[string]string{"speed": "10000", "duplex": "full",
+		"type": "1", "ifindex": "7", "iflink": "6"})
+	writeAttrs("eth2", map[string]string{"speed": "-1", "duplex": "unknown",
+		"operstate": "down", "type": "1", "device/vendor": "0x8086"})
+	for _, name := range []string{"eth0", "eth1"} {
+		if err := os.Symlink("../bond0", dir+"/"+name+"/master"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../br0", dir+"/bond0/master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dir+"/bonding_masters", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	devices := readNetDevicesFrom(dir)
+	if len(devices) != 7 {
+		t.Fatalf("len(devices) = %d, want 7: %+v", len(devices), devices)
+	}
+	if dev := devices["eth0"]; dev.Speed != 10000 || dev.Duplex != "full" ||
+		dev.Mtu != 9000 || dev.OperState != "up" || dev.Type != 1 ||
+		dev.Kind != "" || dev.Master != "bond0" || !dev.Physical {
+		t.Errorf("eth0 = %+v", dev)
+	}
+	if dev := devices["bond0"]; dev.Kind != "bond" || dev.Master != "br0" ||
+		fmt.Sprint(dev.Lowers) != "[eth0 eth1]" {
+		t.Errorf("bond0 = %+v", dev)
+	}
+	if dev := devices["br0"]; dev.Kind != "bridge" || dev.Speed != -1 ||
+		fmt.Sprint(dev.Lowers) != "[bond0]" {
+		t.Errorf("br0 = %+v", dev)
+	}
+	if dev := devices["veth0"]; dev.Kind != "veth" || dev.Peer != "veth1" || dev.Mtu != -1 ||
+		dev.Physical {
+		t.Errorf("veth0 = %+v", dev)
+	}
+	if dev := devices["eth2"]; dev.Speed != -1 || dev.OperState != "down" || dev.Kind != "" {
+		t.Errorf("eth2 = %+v", dev)
+	}
+
+	if devices := readNetDevicesFrom(t.TempDir()); devices != nil {
+		t.Errorf("devices = %+v, want nil", devices)
+	}
+}
+
+func TestParseCpuList(t *testing.T) {
+	cpu_ids, err := parseCpuList("0-2,8,10-11\n")
+	if err != nil {
+		t.Fatalf("parseCpuList returned an error: %v", err)
+	}
+	if fmt.Sprint(cpu_ids) != "[0 1 2 8 10 11]" {
+		t.Errorf("cpu_ids = %v", cpu_ids)
+	}
+	if cpu_ids, err := parseCpuList(""); err != nil || len(cpu_ids) != 0 {
+		t.Errorf("cpu_ids = %v, err = %v, want empty", cpu_ids, err)
+	}
+	if _, err := parseCpuList("0-x"); err == nil {
+		t.Error("Error should be returned for a malformed list")
+	}
+}
+
+func TestParseSoftnetStat(t *testing.T) {
+	// Linux 5.10+ lists the CPU id in the 13th column, and skips offline
+	// CPUs (cpu1 here).
+	input := "00001000 00000002 0000000a 00000000 00000000 00000000 00000000 00000000 00000000 00000005 00000001 00000000 00000000 00000000 00000000\n" +
+		"000000ff 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000002 00000000 00000000\n"
+
+	record := NewStatRecord()
+	err := parseSoftnetStat(record, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseSoftnetStat returned an error: %v", err)
+	}
+	if record.Softnet == nil || len(record.Softnet.Entries) != 2 {
+		t.Fatalf("2 entries expected, got %+v", record.Softnet)
+	}
+	e := record.Softnet.Entries[0]
+	if e.CpuId != 0 || e.Processed != 0x1000 || e.Dropped != 2 || e.TimeSqueeze != 10 ||
+		e.ReceivedRps != 5 || e.FlowLimitCount != 1 {
+		t.Errorf("Entries[0] = %+v", e)
+	}
+	if record.Softnet.Entries[1].CpuId != 2 || record.Softnet.Entries[1].Processed != 0xff {
+		t.Errorf("Entries[1] = %+v", record.Softnet.Entries[1])
+	}
+
+	// old kernels have neither the RPS columns nor the CPU id
+	record = NewStatRecord()
+	err = parseSoftnetStat(record, strings.NewReader(
+		"00000010 00000000 00000001\n00000020 00000000 00000000\n"))
+	if err != nil {
+		t.Fatalf("parseSoftnetStat returned an error: %v", err)
+	}
+	if record.Softnet.Entries[1].CpuId != 1 || record.Softnet.Entries[1].Processed != 0x20 {
+		t.Errorf("Entries[1] = %+v", record.Softnet.Entries[1])
+	}
+
+	err = parseSoftnetStat(NewStatRecord(), strings.NewReader("0000zz 0 0\n"))
+	if err == nil {
+		t.Error("Error should be returned for a non-hexadecimal value")
+	}
+
+	if err := ReadSoftnetStat(nil, Roots{}); err == nil {
+		t.Error("Error should be returned with nil *StatRecord.")
+	}
+}
+
+func TestParseMountinfo(t *testing.T) {
+	input := "22 1 253:1 / / rw,relatime shared:1 - ext4 /dev/vda1 rw\n" +
+		"23 22 0:21 / /proc rw,nosuid - proc proc rw\n" +
+		"24 22 0:22 / /run rw,nosuid shared:5 - tmpfs tmpfs rw,size=100k\n" +
+		"25 22 253:16 / /mnt/my\\040data rw master:2 - xfs /dev/vdb rw\n" +
+		"26 22 253:16 /sub /srv rw - xfs /dev/vdb rw\n" +
+		"27 22 253:32 / /data rw - ext4 /dev/vdc rw\n" +
+		"28 27 253:48 / /data rw - btrfs /dev/vdd rw\n" +
+		"29 22 0:50 / /nfs rw - nfs4 server:/export rw\n" +
+		"30 22 0:51 / /smb rw - cifs //server/share rw\n" +
+		"31 22 0:52 / /sshfs rw - fuse.sshfs user@server: rw\n" +
+		"broken line\n"
+
+	mounts, err := parseMountinfo(strings.NewReader(input), nil, nil)
+	if err != nil {
+		t.Fatalf("parseMountinfo returned an error: %v", err)
+	}
+	want := []FsMount{
+		{"/", "/dev/vda1", "ext4"},
+		{"/mnt/my data", "/dev/vdb", "xfs"},
+		{"/data", "/dev/vdd", "btrfs"},
+	}
+	if len(mounts) != len(want) {
+		t.Fatalf("mounts = %+v, want %+v", mounts, want)
+	}
+	for idx := range want {
+		if mounts[idx] != want[idx] {
+			t.Errorf("mounts[%d] = %+v, want %+v", idx, mounts[idx], want[idx])
+		}
+	}
+
+	// pseudo and network filesystems can be selected explicitly
+	mounts, err = parseMountinfo(strings.NewReader(input), regexp.MustCompile("^/(run|data|nfs)$"), nil)
+	if err != nil {
+		t.Fatalf("parseMountinfo returned an error: %v", err)
+	}
+	if len(mounts) != 3 || mounts[0].MountPoint != "/run" || mounts[1].MountPoint != "/data" ||
+		mounts[2].MountPoint != "/nfs" {
+		t.Errorf("mounts = %+v, want /run, /data and /nfs", mounts)
+	}
+
+	mounts, err = parseMountinfo(strings.NewReader(input), nil, regexp.MustCompile("^/mnt"))
+	if err != nil {
+		t.Fatalf("parseMountinfo returned an error: %v", err)
+	}
+	if len(mounts) != 3 || mounts[1].MountPoint != "/srv" {
+		t.Errorf("mounts = %+v, want /srv in place of excluded /mnt/my data", mounts)
+	}
+}
+
+func TestReadFsStat(t *testing.T) {
+	dir := t.TempDir()
+
+	record := NewStatRecord()
+	err := ReadFsStat(record, Roots{}, []FsMount{
+		{dir, "tmp", "unknown"},
+		{dir + "/not-exist", "none", "unknown"},
+	})
+	if err != nil {
+		t.Fatalf("ReadFsStat returned an error: %v", err)
+	}
+	if record.Fs == nil || len(record.Fs.Entries) != 1 {
+		t.Fatalf("record.Fs = %+v, want 1 entry", record.Fs)
+	}
+	e := record.Fs.Entries[0]
+	if e.MountPoint != dir || e.Device != "tmp" || e.TotalBytes <= 0 ||
+		e.FreeBytes > e.TotalBytes || e.AvailBytes > e.FreeBytes {
+		t.Errorf("Entries[0] = %+v", e)
+	}
+
+	record = NewStatRecord()
+	if err := ReadFsStat(record, Roots{}, []FsMount{{dir + "/not-exist", "none", "unknown"}}); err != nil {
+		t.Fatalf("ReadFsStat returned an error: %v", err)
+	}
+	if record.Fs != nil {
+		t.Errorf("record.Fs = %+v, want nil without statfs-able mounts", record.Fs)
+	}
+
+	if err := ReadFsStat(nil, Roots{}, nil); err == nil {
+		t.Error("Error should be returned with nil *StatRecord.")
+	}
+}
+
+func TestParseMountstats(t *testing.T) {
+	f, err := os.Open("testdata/mountstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	record := NewStatRecord()
+	if err := parseMountstats(record, f); err != nil {
+		t.Fatalf("parseMountstats returned an error: %v", err)
+	}
+	if record.Nfs == nil || len(record.Nfs.Entries) != 2 {
+		t.Fatalf("record.Nfs = %+v, want 2 NFS mounts", record.Nfs)
+	}
+
+	e := record.Nfs.Entries[0]
+	if e.MountPoint != "/mnt/data" || e.Device != "10.0.0.1:/export/data" || e.FsType != "nfs4" {
+		t.Errorf("Entries[0] = %+v", e)
+	}
+	if e.ReadBytes != 1073741824+4096 || e.WriteBytes != 536870912 ||
+		e.ServerReadBytes != 1073745920 || e.ServerWriteBytes != 536870912 {
+		t.Errorf("Entries[0] bytes = %+v", e)
+	}
+	// COMMIT has never been issued
+	if len(e.Ops) != 4 {
+		t.Fatalf("Entries[0].Ops = %d ops, want 4", len(e.Ops))
+	}
+	write := e.Ops[2]
+	if write.Name != "WRITE" || write.Ops != 512 || write.Trans != 514 || write.Timeouts != 1 ||
+		write.BytesSent != 537010176 || write.QueueTime != 300 || write.Rtt != 40960 ||
+		write.Execute != 41984 {
+		t.Errorf("WRITE = %+v", write)
+	}
+
+	e = record.Nfs.Entries[1]
+	if e.MountPoint != "/home/my home" || e.FsType != "nfs" || len(e.Ops) != 1 ||
+		e.Ops[0].Name != "LOOKUP" || e.Ops[0].Execute != 25 {
+		t.Errorf("Entries[1] = %+v", e)
+	}
+
+	record = NewStatRecord()
+	err = parseMountstats(record, strings.NewReader(
+		"device proc mounted on /proc with fstype proc\n"))
+	if err != nil {
+		t.Fatalf("parseMountstats returned an error: %v", err)
+	}
+	if record.Nfs != nil {
+		t.Errorf("record.Nfs = %+v, want nil without NFS mounts", record.Nfs)
+	}
+
+	err = parseMountstats(NewStatRecord(), strings.NewReader(
+		"device s:/ mounted on /mnt with fstype nfs\n\tbytes:\t1 x 0 0 0 0 0 0\n"))
+	if err == nil {
+		t.Error("Error should be returned for a non-numeric value")
+	}
+
+	if err := ReadNfsStat(nil, Roots{}); err == nil {
+		t.Error("Error should be returned with nil *StatRecord.")
+	}
+}
+
+func TestReadSensors(t *testing.T) {
+	thermal_dir := t.TempDir()
+	hwmon_dir := t.TempDir()
+
+	writeFile := func(path string, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(thermal_dir+"/thermal_zone10/temp", "30000")
+	writeFile(thermal_dir+"/thermal_zone10/type", "acpitz")
+	writeFile(thermal_dir+"/thermal_zone2/temp", "45000")
+	writeFile(thermal_dir+"/thermal_zone2/type", "x86_pkg_temp")
+	// a zone whose sensor fails to read is left out
+	writeFile(thermal_dir+"/thermal_zone3/temp", "")
+	writeFile(thermal_dir+"/cooling_device0/type", "Processor")
+	writeFile(hwmon_dir+"/hwmon1/name", "coretemp")
+	writeFile(hwmon_dir+"/hwmon1/temp1_input", "47000")
+	writeFile(hwmon_dir+"/hwmon1/temp1_label", "Package id 0")
+	writeFile(hwmon_dir+"/hwmon1/temp2_input", "44000")
+	writeFile(hwmon_dir+"/hwmon1/temp2_crit", "100000")
+	writeFile(hwmon_dir+"/hwmon0/temp1_input", "38850")
+
+	sensors := readSensorsFrom(thermal_dir, hwmon_dir)
+	want := []string{
+		"thermal_zone2:x86_pkg_temp", "thermal_zone10:acpitz",
+		"hwmon0:temp1", "coretemp:Package id 0", "coretemp:temp2",
+	}
+	if len(sensors) != len(want) {
+		t.Fatalf("sensors = %+v, want %v", sensors, want)
+	}
+	for idx, name := range want {
+		if sensors[idx].Name != name {
+			t.Errorf("sensors[%d].Name = %q, want %q", idx, sensors[idx].Name, name)
+		}
+	}
+	if sensors[3].Path != hwmon_dir+"/hwmon1/temp1_input" {
+		t.Errorf("sensors[3].Path = %q", sensors[3].Path)
+	}
+
+	writeFile(hwmon_dir+"/hwmon1/temp1_input", "52000")
+	os.Remove(hwmon_dir + "/hwmon0/temp1_input")
+	record := NewStatRecord()
+	if err := ReadThermalStat(record, sensors); err != nil {
+		t.Fatalf("ReadThermalStat returned an error: %v", err)
+	}
+	if record.Thermal == nil || len(record.Thermal.Temps) != 5 ||
+		record.Thermal.Temps[0] != 45000 || record.Thermal.Temps[2] != 0 ||
+		record.Thermal.Temps[3] != 52000 {
+		t.Errorf("record.Thermal = %+v", record.Thermal)
+	}
+
+	if readSensorsFrom(t.TempDir(), hwmon_dir+"/not-exist") != nil {
+		t.Error("readSensorsFrom should return nil without sensors")
+	}
+	record = NewStatRecord()
+	if err := ReadThermalStat(record, nil); err != nil || record.Thermal != nil {
+		t.Errorf("ReadThermalStat without sensors: Thermal = %+v, err = %v", record.Thermal, err)
+	}
+	if err := ReadThermalStat(nil, sensors); err == nil {
+		t.Error("Error should be returned with nil *StatRecord.")
+	}
+}
+
+func TestReadPowerDomains(t *testing.T) {
+	powercap_dir := t.TempDir()
+
+	writeFile := func(path string, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeZone := func(dir string, name string, energy string) {
+		writeFile(powercap_dir+"/"+dir+"/name", name)
+		writeFile(powercap_dir+"/"+dir+"/energy_uj", energy)
+		writeFile(powercap_dir+"/"+dir+"/max_energy_range_uj", "262143328850")
+	}
+	writeFile(powercap_dir+"/intel-rapl/enabled", "1")
+	writeZone("intel-rapl:0", "package-0", "1000000")
+	writeZone("intel-rapl:0:0", "core", "400000")
+	writeZone("intel-rapl:0:1", "dram", "200000")
+	writeZone("intel-rapl:1", "package-1", "3000000")
+	writeZone("intel-rapl-mmio:0", "package-0", "1000000")
+	// energy_uj readable by root only
+	writeZone("intel-rapl:1:0", "core", "")
+
+	domains := readPowerDomainsFrom(powercap_dir)
+	want := []string{"package-0", "package-0/core", "package-0/dram", "package-1"}
+	if len(domains) != len(want) {
+		t.Fatalf("domains = %+v, want %v", domains, want)
+	}
+	for idx, name := range want {
+		if domains[idx].Name != name {
+			t.Errorf("domains[%d].Name = %q, want %q", idx, domains[idx].Name, name)
+		}
+	}
+	if d := domains[2]; d.Zone != "dram" || d.Parent != "package-0" ||
+		d.Path != powercap_dir+"/intel-rapl:0:1" || d.MaxEnergyRange != 262143328850 {
+		t.Errorf("domains[2] = %+v", d)
+	}
+
+	writeFile(powercap_dir+"/intel-rapl:0/energy_uj", "1500000")
+	os.Remove(powercap_dir + "/intel-rapl:1/energy_uj")
+	record := NewStatRecord()
+	if err := ReadEnergyStat(record, domains); err != nil {
+		t.Fatalf("ReadEnergyStat returned an error: %v", err)
+	}
+	if record.Energy == nil || len(record.Energy.Energy) != 4 ||
+		record.Energy.Energy[0] != 1500000 || record.Energy.Energy[1] != 400000 ||
+		record.Energy.Energy[3] != -1 {
+		t.Errorf("record.Energy = %+v", record.Energy)
+	}
+
+	if readPowerDomainsFrom(powercap_dir+"/not-exist") != nil {
+		t.Error("readPowerDomainsFrom should return nil without powercap")
+	}
+	record = NewStatRecord()
+	if err := ReadEnergyStat(record, nil); err != nil || record.Energy != nil {
+		t.Errorf("ReadEnergyStat without domains: Energy = %+v, err = %v", record.Energy, err)
+	}
+	if err := ReadEnergyStat(nil, domains); err == nil {
+		t.Error("Error should be returned with nil *StatRecord.")
+	}
+}
+
+func TestReadClockTicks(t *testing.T) {
+	word := strconv.IntSize / 8
+	auxv := func(pairs ...uint64) string {
+		buf := []byte{}
+		for _, v := range pairs {
+			if word == 8 {
+				buf = binary.NativeEndian.AppendUint64(buf, v)
+			} else {
+				buf = binary.NativeEndian.AppendUint32(buf, uint32(v))
+			}
+		}
+		path := filepath.Join(t.TempDir(), "auxv")
+		if err := os.WriteFile(path, buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// AT_PAGESZ, AT_CLKTCK and AT_NULL
+	if hz := readClockTicksFrom(auxv(6, 4096, 17, 250, 0, 0)); hz != 250 {
+		t.Errorf("readClockTicksFrom = %v, want 250", hz)
+	}
+	if hz := readClockTicksFrom(auxv(6, 4096, 0, 0)); hz != 100 {
+		t.Errorf("readClockTicksFrom without AT_CLKTCK = %v, want 100", hz)
+	}
+	if hz := readClockTicksFrom("/nonexistent"); hz != 100 {
+		t.Errorf("readClockTicksFrom of a missing file = %v, want 100", hz)
+	}
+	if hz := readClockTicksFrom("/proc/self/auxv"); hz <= 0 {
+		t.Errorf("readClockTicksFrom(/proc/self/auxv) = %v", hz)
+	}
+}
+
+func TestProcSysRoot(t *testing.T) {
+	proc_root := t.TempDir()
+	sys_root := t.TempDir()
+
+	writeFile := func(path string, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(proc_root+"/diskstats",
+		"   8       0 sda 10 0 80 5 20 0 160 10 0 15 15\n"+
+			"   8       1 sda1 10 0 80 5 20 0 160 10 0 15 15")
+	writeFile(proc_root+"/loadavg", "0.20 0.18 0.12 1/80 11206")
+	writeFile(proc_root+"/meminfo", "MemTotal:        1024000 kB\nMemFree:          512000 kB")
+	writeFile(proc_root+"/stat",
+		"cpu  10 0 20 70 0 0 0 0 0 0\n"+
+			"cpu0 4 0 10 36 0 0 0 0 0 0\n"+
+			"cpu1 6 0 10 34 0 0 0 0 0 0\n"+
+			"ctxt 100\nprocesses 10\nprocs_running 1\nprocs_blocked 0")
+	writeFile(sys_root+"/devices/system/cpu/cpu0/online", "1")
+	writeFile(sys_root+"/devices/system/cpu/cpu1/online", "1")
+	writeFile(sys_root+"/block/sda/sda1/stat", "10 0 80 5 20 0 160 10 0 15 15")
+	writeFile(sys_root+"/class/net/eth0/type", "1")
+	writeFile(sys_root+"/class/powercap/intel-rapl:0/name", "package-0")
+	writeFile(sys_root+"/class/powercap/intel-rapl:0/energy_uj", "1000")
+
+	writeFile(proc_root+"/1/mountinfo",
+		"22 1 253:1 / / rw - ext4 /dev/vda1 rw\n"+
+			"23 22 253:16 / /data rw - xfs /dev/vdb rw")
+	if err := os.MkdirAll(proc_root+"/1/root/data", 0755); err != nil {
+		t.Fatal(err)
+	}
+	mountstats, err := os.ReadFile("testdata/mountstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(proc_root+"/1/mountstats", string(mountstats))
+
+	roots := NewRoots(proc_root+"/", sys_root)
+	if roots.Proc != proc_root || roots.Sys != sys_root {
+		t.Errorf("roots = %+v, want %q, %q", roots, proc_root, sys_root)
+	}
+	if roots := NewRoots("", ""); roots.Proc != "/proc" || roots.Sys != "/sys" {
+		t.Errorf("roots = %+v, want the defaults", roots)
+	}
+
+	header := NewPlatformHeaderOf(NewCollectors(&CollectorOption{Roots: roots}))
+	if fmt.Sprint(header.DevsParts) != "[sda sda1]" {
+		t.Errorf("DevsParts = %v", header.DevsParts)
+	}
+	if dev, ok := header.Devices["sda"]; !ok || fmt.Sprint(dev.Parts) != "[sda1]" {
+		t.Errorf("Devices = %v", header.Devices)
+	}
+	if _, ok := header.NetDevices["eth0"]; !ok || len(header.NetDevices) != 1 {
+		t.Errorf("NetDevices = %v", header.NetDevices)
+	}
+	if len(header.PowerDomains) != 1 || header.PowerDomains[0].Name != "package-0" {
+		t.Errorf("PowerDomains = %+v", header.PowerDomains)
+	}
+
+	record := NewStatRecord()
+	if err := ReadLoadAvg(record, roots); err != nil {
+		t.Fatalf("ReadLoadAvg returned an error: %v", err)
+	}
+	if record.Proc.LoadAvg.NrThreads != 80 {
+		t.Errorf("LoadAvg = %+v", record.Proc.LoadAvg)
+	}
+	if err := ReadCpuStat(record, roots); err != nil {
+		t.Fatalf("ReadCpuStat returned an error: %v", err)
+	}
+	if record.Cpu.NumCore != 2 || record.Cpu.CoreStats[1].User != 6 || record.Cpu.All.Idle != 70 {
+		t.Errorf("Cpu = %+v", record.Cpu)
+	}
+	if err := ReadMemStat(record, roots); err != nil {
+		t.Fatalf("ReadMemStat returned an error: %v", err)
+	}
+	if record.Mem.MemTotal != 1024000 || record.Mem.MemFree != 512000 {
+		t.Errorf("Mem = %+v", record.Mem)
+	}
+	if err := ReadPressureStat(record, roots); err == nil && record.Pressure != nil {
+		t.Errorf("Pressure = %+v, want nil without /proc/pressure", record.Pressure)
+	}
+
+	// mounts are those of init, which are statfs-ed under its root
+	mounts, err := ReadMounts(roots, nil, nil)
+	if err != nil {
+		t.Fatalf("ReadMounts returned an error: %v", err)
+	}
+	if fmt.Sprint(mounts) != "[{/ /dev/vda1 ext4} {/data /dev/vdb xfs}]" {
+		t.Errorf("mounts = %v", mounts)
+	}
+	if err := ReadFsStat(record, roots, mounts[1:]); err != nil {
+		t.Fatalf("ReadFsStat returned an error: %v", err)
+	}
+	if record.Fs == nil || len(record.Fs.Entries) != 1 || record.Fs.Entries[0].MountPoint != "/data" {
+		t.Errorf("Fs = %+v", record.Fs)
+	}
+	if err := ReadNfsStat(record, roots); err != nil {
+		t.Fatalf("ReadNfsStat returned an error: %v", err)
+	}
+	if record.Nfs == nil || len(record.Nfs.Entries) != 2 {
+		t.Errorf("Nfs = %+v", record.Nfs)
+	}
+}
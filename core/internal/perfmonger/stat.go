@@ -25,12 +25,28 @@ type CpuStat struct {
 	CoreStats []CpuCoreStat
 }
 
+// LoadAvgStat holds the content of /proc/loadavg.
+type LoadAvgStat struct {
+	Load1     float64
+	Load5     float64
+	Load15    float64
+	NrRunning int64 // runnable scheduling entities
+	NrThreads int64 // all scheduling entities
+}
+
 type ProcStat struct {
 	ContextSwitch int64
 	Fork          int64
+	LoadAvg       *LoadAvgStat
+
+	// logs recorded by older versions lack these
+	HasProcsRunning bool
+	Interrupt       int64 // total of all interrupts
+	ProcsRunning    int64
+	ProcsBlocked    int64
 }
 
-type SoftIrqStat struct {
+type SoftIrqCoreStat struct {
 	Hi          int64
 	Timer       int64
 	NetTx       int64
@@ -43,6 +59,27 @@ type SoftIrqStat struct {
 	Rcu         int64
 }
 
+type SoftIrqStat struct {
+	All       SoftIrqCoreStat
+	NumCore   int
+	CoreStats []SoftIrqCoreStat
+}
+
+// SoftnetStatEntry holds per-CPU counters of a line in
+// /proc/net/softnet_stat.
+type SoftnetStatEntry struct {
+	CpuId          int
+	Processed      int64 // packets processed by NET_RX softirq
+	Dropped        int64 // packets dropped because the backlog queue was full
+	TimeSqueeze    int64 // times NET_RX softirq ran out of budget or time
+	ReceivedRps    int64 // RPS IPIs received
+	FlowLimitCount int64
+}
+
+type SoftnetStat struct {
+	Entries []*SoftnetStatEntry
+}
+
 type InterruptStatEntry struct {
 	IrqNo   int    // >0 if associated with devices, -1 if not
 	IrqType string // set intr name if IrqNo == -1
@@ -72,6 +109,21 @@ type DiskStatEntry struct {
 	IosPgr     int64
 	TotalTicks int64
 	ReqTicks   int64
+
+	// logs recorded by older versions lack this
+	HasInFlight bool
+
+	// Linux 4.18 or later
+	HasDiscard bool
+	DcIos      int64
+	DcMerges   int64
+	DcSectors  int64
+	DcTicks    int64
+
+	// Linux 5.5 or later
+	HasFlush bool
+	FlIos    int64
+	FlTicks  int64
 }
 
 type DiskStat struct {
@@ -133,6 +185,303 @@ type MemStat struct {
 	HugePages_Rsvd  int64
 	HugePages_Surp  int64
 	Hugepagesize    int64
+
+	// fields of newer kernels; HasMemAvailable is false for logs recorded
+	// before they were collected, or on kernels older than 3.14
+	HasMemAvailable bool
+	MemAvailable    int64
+	ActiveAnon      int64
+	InactiveAnon    int64
+	ActiveFile      int64
+	InactiveFile    int64
+	KReclaimable    int64
+	Percpu          int64
+	Zswap           int64
+	Zswapped        int64
+	ShmemHugePages  int64
+	FileHugePages   int64
+	Unaccepted      int64
+	CmaTotal        int64
+	CmaFree         int64
+
+	// other keys in /proc/meminfo (e.g. "DirectMap2M"), nil if none
+	Others map[string]int64
+}
+
+// NumaNodeStat holds memory usage of a NUMA node in KB, taken from
+// /sys/devices/system/node/nodeN/meminfo, and cumulative page allocation
+// counters in nodeN/numastat.
+type NumaNodeStat struct {
+	NodeId    int
+	MemTotal  int64
+	MemFree   int64
+	MemUsed   int64
+	FilePages int64
+	AnonPages int64
+	Slab      int64
+
+	NumaHit       int64
+	NumaMiss      int64
+	NumaForeign   int64
+	InterleaveHit int64
+	LocalNode     int64
+	OtherNode     int64
+}
+
+type NumaStat struct {
+	Entries []*NumaNodeStat
+}
+
+// FsStatEntry holds capacity and inode counts of a mounted filesystem taken
+// by statfs(2). Sizes are in bytes.
+type FsStatEntry struct {
+	MountPoint string
+	Device     string
+	FsType     string
+
+	TotalBytes int64
+	FreeBytes  int64 // free for root
+	AvailBytes int64 // free for unprivileged users
+
+	TotalInodes int64
+	FreeInodes  int64
+}
+
+type FsStat struct {
+	Entries []*FsStatEntry
+}
+
+// NfsOpStat holds cumulative counters of an NFS operation (e.g. READ) in
+// the per-op statistics of /proc/self/mountstats. Times are in msec.
+type NfsOpStat struct {
+	Name      string
+	Ops       int64 // requests completed
+	Trans     int64 // transmissions, including retransmissions
+	Timeouts  int64
+	BytesSent int64
+	BytesRecv int64
+	QueueTime int64
+	Rtt       int64 // round trip time waiting for the server
+	Execute   int64 // total time from the request to its completion
+}
+
+// NfsMountStatEntry holds cumulative counters of an NFS mount in
+// /proc/self/mountstats. Only operations issued at least once are listed in
+// Ops.
+type NfsMountStatEntry struct {
+	MountPoint string
+	Device     string // server:/export
+	FsType     string
+
+	ReadBytes        int64 // read by applications, incl. O_DIRECT
+	WriteBytes       int64 // written by applications, incl. O_DIRECT
+	ServerReadBytes  int64 // read from the server by READ
+	ServerWriteBytes int64 // written to the server by WRITE
+
+	Ops []*NfsOpStat
+}
+
+type NfsStat struct {
+	Entries []*NfsMountStatEntry
+}
+
+// VmStat holds selected cumulative event counters in /proc/vmstat. Counters
+// that the kernel splits per zone (e.g. allocstall_normal) or that older
+// kernels split per zone (e.g. pgscan_kswapd_normal) are summed up.
+type VmStat struct {
+	PgFault                int64
+	PgMajFault             int64
+	PswpIn                 int64
+	PswpOut                int64
+	PgScanKswapd           int64
+	PgScanDirect           int64
+	PgScanKhugepaged       int64
+	PgStealKswapd          int64
+	PgStealDirect          int64
+	PgStealKhugepaged      int64
+	AllocStall             int64
+	CompactStall           int64
+	ThpFaultAlloc          int64
+	ThpFaultFallback       int64
+	ThpCollapseAlloc       int64
+	ThpCollapseAllocFailed int64
+	ThpSplitPage           int64
+	OomKill                int64
+}
+
+// NetProtoStat holds selected protocol counters in /proc/net/snmp and
+// /proc/net/netstat, and socket counts in /proc/net/sockstat. TcpCurrEstab
+// and the sockstat fields are instantaneous values; the rest are cumulative.
+type NetProtoStat struct {
+	// /proc/net/snmp
+	IpInReceives    int64
+	IpInDiscards    int64
+	IpOutRequests   int64
+	IpOutDiscards   int64
+	TcpActiveOpens  int64
+	TcpPassiveOpens int64
+	TcpAttemptFails int64
+	TcpEstabResets  int64
+	TcpCurrEstab    int64
+	TcpInSegs       int64
+	TcpOutSegs      int64
+	TcpRetransSegs  int64
+	TcpInErrs       int64
+	TcpOutRsts      int64
+	UdpInDatagrams  int64
+	UdpNoPorts      int64
+	UdpInErrors     int64
+	UdpOutDatagrams int64
+	UdpRcvbufErrors int64
+	UdpSndbufErrors int64
+
+	// TcpExt in /proc/net/netstat
+	ListenOverflows  int64
+	ListenDrops      int64
+	TCPTimeouts      int64
+	TCPSynRetrans    int64
+	TCPFastRetrans   int64
+	TCPAbortOnMemory int64
+	TCPBacklogDrop   int64
+
+	// /proc/net/sockstat
+	SocketsUsed int64
+	TcpInUse    int64
+	TcpOrphan   int64
+	TcpTimeWait int64
+	TcpAlloc    int64
+	TcpMem      int64 // pages
+	UdpInUse    int64
+	UdpMem      int64 // pages
+}
+
+// ProcessStatEntry holds counters of a process read from
+// /proc/<pid>/{stat,io,status}.
+type ProcessStatEntry struct {
+	Pid                      int
+	Ppid                     int
+	Comm                     string
+	Utime                    int64 // clock ticks
+	Stime                    int64 // clock ticks
+	Cutime                   int64 // clock ticks of waited-for children
+	Cstime                   int64 // clock ticks of waited-for children
+	MajFlt                   int64
+	CMajFlt                  int64
+	VmRSS                    int64 // KB
+	VmHWM                    int64 // KB, peak RSS
+	ReadBytes                int64
+	WriteBytes               int64
+	VoluntaryCtxtSwitches    int64
+	NonvoluntaryCtxtSwitches int64
+}
+
+// ProcessStat holds entries of a process specified by RootPid and all of
+// its descendants.
+type ProcessStat struct {
+	RootPid int
+	Entries []*ProcessStatEntry
+}
+
+// CpuFreqStat holds the current frequency of each core in kHz. A core whose
+// frequency is unavailable has 0.
+type CpuFreqStat struct {
+	NumCore   int
+	CoreFreqs []int64
+}
+
+// ThermalStat holds the temperature of each sensor in LinuxHeader.Sensors in
+// millidegree Celsius. A sensor whose temperature is unavailable has 0.
+type ThermalStat struct {
+	Temps []int64
+}
+
+// EnergyStat holds the cumulative energy counter (energy_uj) of each domain
+// in LinuxHeader.PowerDomains in microjoules. A domain whose counter is
+// unavailable has -1.
+type EnergyStat struct {
+	Energy []int64
+}
+
+// CustomMetricSample holds the values which an external command reported
+// last, keyed by the key of each `key value` line or the dot-joined path of
+// each JSON member; a bare number has the key "". Time is when they were
+// reported, which stays the same over records until the command reports
+// again, and is zero until the first report.
+type CustomMetricSample struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// CustomStat holds the latest sample of each command in
+// LinuxHeader.CustomMetrics.
+type CustomStat struct {
+	Samples []CustomMetricSample
+}
+
+// CpuIdleCoreStat holds cumulative counters of each idle state of a core in
+// /sys/devices/system/cpu/cpuN/cpuidle/stateM. Both are empty if the core
+// has no cpuidle directory.
+type CpuIdleCoreStat struct {
+	Times  []int64 // usec spent in each state
+	Usages []int64 // times each state was entered
+}
+
+// CpuIdleStat holds idle state counters of each core. StateNames are the
+// names of the states of the first core with cpuidle (e.g. "POLL", "C1",
+// "C6"), in the order of stateM.
+type CpuIdleStat struct {
+	NumCore    int
+	StateNames []string
+	CoreStats  []CpuIdleCoreStat
+}
+
+// CgroupStatEntry holds counters of a cgroup v2 directory. Path is relative
+// to the cgroup2 mount point. Counters in io.stat are summed over devices.
+type CgroupStatEntry struct {
+	Path string
+
+	// cpu.stat
+	UsageUsec     int64
+	UserUsec      int64
+	SystemUsec    int64
+	NrPeriods     int64
+	NrThrottled   int64
+	ThrottledUsec int64
+
+	// memory.current and memory.stat
+	MemoryCurrent int64 // bytes
+	MemAnon       int64 // bytes
+	MemFile       int64 // bytes
+	MemPgMajFault int64
+
+	// io.stat
+	IoRbytes int64
+	IoWbytes int64
+	IoRios   int64
+	IoWios   int64
+
+	// cpu.pressure and io.pressure, nil if unavailable
+	CpuPressure *PressureStatEntry
+	IoPressure  *PressureStatEntry
+}
+
+type CgroupStat struct {
+	Entries []*CgroupStatEntry
+}
+
+// PressureStatEntry holds cumulative stall time of a resource reported in
+// /proc/pressure/{cpu,io,memory}, in microseconds.
+type PressureStatEntry struct {
+	SomeTotal int64
+	FullTotal int64
+}
+
+// PressureStat holds PSI counters. An entry is nil if the resource is not
+// available on the running kernel.
+type PressureStat struct {
+	Cpu    *PressureStatEntry
+	Io     *PressureStatEntry
+	Memory *PressureStatEntry
 }
 
 type StatRecord struct {
@@ -144,6 +493,20 @@ type StatRecord struct {
 	Softirq   *SoftIrqStat
 	Net       *NetStat
 	Mem       *MemStat
+	Pressure  *PressureStat
+	Vm        *VmStat
+	Process   *ProcessStat
+	Cgroup    *CgroupStat
+	CpuFreq   *CpuFreqStat
+	NetProto  *NetProtoStat
+	Softnet   *SoftnetStat
+	CpuIdle   *CpuIdleStat
+	Numa      *NumaStat
+	Fs        *FsStat
+	Nfs       *NfsStat
+	Thermal   *ThermalStat
+	Energy    *EnergyStat
+	Custom    *CustomStat
 }
 
 func (core_stat *CpuCoreStat) Clear() {
@@ -200,12 +563,17 @@ func NewInterruptStat() *InterruptStat {
 }
 
 func NewProcStat() *ProcStat {
-	return &ProcStat{0, 0}
+	return &ProcStat{0, 0, nil, false, 0, 0, 0}
 }
 
 func (proc_stat *ProcStat) Clear() {
 	proc_stat.ContextSwitch = 0
 	proc_stat.Fork = 0
+	proc_stat.LoadAvg = nil
+	proc_stat.HasProcsRunning = false
+	proc_stat.Interrupt = 0
+	proc_stat.ProcsRunning = 0
+	proc_stat.ProcsBlocked = 0
 }
 
 func NewDiskStatEntry() *DiskStatEntry {
@@ -220,7 +588,7 @@ func (disk_stat *DiskStat) Clear() {
 	disk_stat.Entries = []*DiskStatEntry{}
 }
 
-func (sirq_stat *SoftIrqStat) Clear() {
+func (sirq_stat *SoftIrqCoreStat) Clear() {
 	sirq_stat.Hi = 0
 	sirq_stat.Timer = 0
 	sirq_stat.NetTx = 0
@@ -233,6 +601,30 @@ func (sirq_stat *SoftIrqStat) Clear() {
 	sirq_stat.Rcu = 0
 }
 
+func NewSoftIrqStat(num_core int) *SoftIrqStat {
+	if num_core < 1 {
+		return nil
+	}
+
+	sirq_stat := new(SoftIrqStat)
+
+	sirq_stat.NumCore = num_core
+	sirq_stat.CoreStats = make([]SoftIrqCoreStat, num_core)
+
+	return sirq_stat
+}
+
+func (sirq_stat *SoftIrqStat) Clear() {
+	sirq_stat.All.Clear()
+	for idx, _ := range sirq_stat.CoreStats {
+		sirq_stat.CoreStats[idx].Clear()
+	}
+}
+
+func NewSoftnetStat() *SoftnetStat {
+	return &SoftnetStat{make([]*SoftnetStatEntry, 0)}
+}
+
 func NewNetStatEntry() *NetStatEntry {
 	return new(NetStatEntry)
 }
@@ -253,6 +645,30 @@ func NewNetStat() *NetStat {
 	return new(NetStat)
 }
 
+func NewNumaStat() *NumaStat {
+	return &NumaStat{make([]*NumaNodeStat, 0)}
+}
+
+func NewFsStat() *FsStat {
+	return &FsStat{make([]*FsStatEntry, 0)}
+}
+
+func NewNfsStat() *NfsStat {
+	return &NfsStat{make([]*NfsMountStatEntry, 0)}
+}
+
+func NewThermalStat(num_sensors int) *ThermalStat {
+	return &ThermalStat{make([]int64, num_sensors)}
+}
+
+func NewEnergyStat(num_domains int) *EnergyStat {
+	return &EnergyStat{make([]int64, num_domains)}
+}
+
+func NewCustomStat(num_metrics int) *CustomStat {
+	return &CustomStat{make([]CustomMetricSample, num_metrics)}
+}
+
 func NewMemStat() *MemStat {
 	return new(MemStat)
 }
@@ -288,6 +704,80 @@ func (entry *MemStat) Clear() {
 	entry.HugePages_Rsvd = 0
 	entry.HugePages_Surp = 0
 	entry.Hugepagesize = 0
+	entry.HasMemAvailable = false
+	entry.MemAvailable = 0
+	entry.ActiveAnon = 0
+	entry.InactiveAnon = 0
+	entry.ActiveFile = 0
+	entry.InactiveFile = 0
+	entry.KReclaimable = 0
+	entry.Percpu = 0
+	entry.Zswap = 0
+	entry.Zswapped = 0
+	entry.ShmemHugePages = 0
+	entry.FileHugePages = 0
+	entry.Unaccepted = 0
+	entry.CmaTotal = 0
+	entry.CmaFree = 0
+	entry.Others = nil
+}
+
+func NewVmStat() *VmStat {
+	return new(VmStat)
+}
+
+func NewNetProtoStat() *NetProtoStat {
+	return new(NetProtoStat)
+}
+
+func NewProcessStatEntry() *ProcessStatEntry {
+	return new(ProcessStatEntry)
+}
+
+func NewProcessStat(root_pid int) *ProcessStat {
+	return &ProcessStat{root_pid, []*ProcessStatEntry{}}
+}
+
+func NewCpuIdleStat(num_core int) *CpuIdleStat {
+	if num_core < 1 {
+		return nil
+	}
+
+	idle_stat := new(CpuIdleStat)
+
+	idle_stat.NumCore = num_core
+	idle_stat.StateNames = make([]string, 0)
+	idle_stat.CoreStats = make([]CpuIdleCoreStat, num_core)
+
+	return idle_stat
+}
+
+func NewCpuFreqStat(num_core int) *CpuFreqStat {
+	if num_core < 1 {
+		return nil
+	}
+
+	freq_stat := new(CpuFreqStat)
+
+	freq_stat.NumCore = num_core
+	freq_stat.CoreFreqs = make([]int64, num_core)
+
+	return freq_stat
+}
+
+func NewCgroupStatEntry(path string) *CgroupStatEntry {
+	entry := new(CgroupStatEntry)
+	entry.Path = path
+
+	return entry
+}
+
+func NewCgroupStat() *CgroupStat {
+	return &CgroupStat{[]*CgroupStatEntry{}}
+}
+
+func NewPressureStat() *PressureStat {
+	return new(PressureStat)
 }
 
 func NewStatRecord() *StatRecord {
@@ -300,6 +790,20 @@ func NewStatRecord() *StatRecord {
 		nil,
 		nil,
 		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
 	}
 }
 
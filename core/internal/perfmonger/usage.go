@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"path"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	projson "github.com/hayamiz/go-projson"
@@ -24,6 +27,14 @@ type CpuCoreUsage struct {
 	GuestNice float64
 }
 
+// CpuGroupUsage holds CPU usage summed over a group of CPUs sharing a
+// socket, a NUMA node or a physical core (MAX: 100% * len(Cpus)).
+type CpuGroupUsage struct {
+	Name  string // e.g. "socket0", "node1" or "socket0/core3"
+	Cpus  []int
+	Usage *CpuCoreUsage
+}
+
 type CpuUsage struct {
 	All        *CpuCoreUsage
 	NumCore    int
@@ -44,6 +55,92 @@ type InterruptUsage struct {
 	CoreIntrUsages []*CpuCoreIntrUsage
 }
 
+// IrqUsageEntry holds per-core rates of a line in /proc/interrupts.
+type IrqUsageEntry struct {
+	IrqNo     int    // -1 for system interrupts
+	Name      string // action name (e.g. "nvme0q3"), or the type of system interrupts (e.g. "LOC")
+	Device    string // Name without the queue suffix (e.g. "nvme0"), "" for system interrupts
+	Descr     string
+	Total     float64   // intr/sec
+	CoreRates []float64 // intr/sec
+}
+
+// IrqDeviceUsage is the sum of the IrqUsageEntry of the same Device.
+type IrqDeviceUsage struct {
+	Device    string
+	NumIrqs   int
+	Total     float64   // intr/sec
+	CoreRates []float64 // intr/sec
+}
+
+// IrqDetailUsage breaks interrupts down to each IRQ line. Entries and
+// Devices are sorted by Total in descending order.
+type IrqDetailUsage struct {
+	Interval time.Duration
+
+	NumCore int
+	Entries []*IrqUsageEntry
+	Devices []*IrqDeviceUsage
+
+	Affinity map[int]string // smp_affinity_list of each IRQ, nil if unknown
+}
+
+type CpuCoreSoftIrqUsage struct {
+	Hi          float64 // softirq/sec for each softirq type
+	Timer       float64
+	NetTx       float64
+	NetRx       float64
+	Block       float64
+	BlockIopoll float64
+	Tasklet     float64
+	Sched       float64
+	Hrtimer     float64
+	Rcu         float64
+}
+
+type SoftIrqUsage struct {
+	Interval time.Duration
+
+	NumCore int
+
+	All               *CpuCoreSoftIrqUsage
+	CoreSoftIrqUsages []*CpuCoreSoftIrqUsage
+}
+
+type SoftnetUsageEntry struct {
+	CpuId          int     // -1 for the sum of all CPUs
+	Processed      float64 // packets/sec
+	Dropped        float64 // packets/sec
+	TimeSqueeze    float64 // /sec
+	ReceivedRps    float64 // /sec
+	FlowLimitCount float64 // /sec
+}
+
+type SoftnetUsage struct {
+	Interval time.Duration
+
+	All        *SoftnetUsageEntry
+	CoreUsages []*SoftnetUsageEntry
+}
+
+// CpuIdleUsageEntry holds idle state statistics of a core. Residency is the
+// share of idle time spent in each state and sums up to 100 if the core was
+// idle at all.
+type CpuIdleUsageEntry struct {
+	CpuId     int       // -1 for the average of all CPUs
+	Idle      float64   // % of the interval spent in any idle state
+	Residency []float64 // % of idle time
+	Usage     []float64 // entries/sec
+}
+
+type CpuIdleUsage struct {
+	Interval   time.Duration
+	StateNames []string
+
+	All        *CpuIdleUsageEntry
+	CoreUsages []*CpuIdleUsageEntry
+}
+
 type DiskUsageEntry struct {
 	Interval time.Duration
 
@@ -58,6 +155,31 @@ type DiskUsageEntry struct {
 	AvgRdSize float64 // sectors
 	AvgWrSize float64 // sectors
 	ReqQlen   float64
+
+	// valid only if HasInFlight
+	HasInFlight bool
+	InFlight    int64 // I/Os in progress at the end of the interval
+
+	// iostat -x equivalents. RdLatency/WrLatency are r_await/w_await and
+	// ReqQlen is aqu-sz.
+	RdMergeps  float64 // rrqm/s
+	WrMergeps  float64 // wrqm/s
+	RdMergePct float64 // %rrqm
+	WrMergePct float64 // %wrqm
+	Svctm      float64 // msec
+	Util       float64 // %util
+
+	// valid only if HasDiscard
+	HasDiscard bool
+	DcIops     float64
+	DcSectors  int64
+	DcSecps    float64 // sectors per second
+	DcLatency  float64 // msec
+
+	// valid only if HasFlush
+	HasFlush  bool
+	FlIops    float64
+	FlLatency float64 // msec
 }
 
 type DiskUsage map[string]*DiskUsageEntry
@@ -81,12 +203,369 @@ type NetUsageEntry struct {
 	TxFramePerSec      float64
 	TxCompressedPerSec float64
 	TxMulticastPerSec  float64
+
+	// Link speed in Mb/s, 0 if unknown. RxUtil and TxUtil are the
+	// throughput in % of the link speed; on half-duplex links rx and tx
+	// share the capacity, so both are computed from rx + tx.
+	LinkSpeed int64
+	RxUtil    float64
+	TxUtil    float64
+
+	// interfaces summed into the "total" entry if it was computed from link
+	// metadata (see GetNetUsage1), nil otherwise
+	Members []string
 }
 
 type NetUsage map[string]*NetUsageEntry
 
+// MemUsage wraps a MemStat with derived metrics in KB or in % of MemTotal.
+// For logs without MemAvailable (see MemStat.HasMemAvailable), available
+// memory is estimated as MemFree + Buffers + Cached + SReclaimable, and the
+// anon and file sizes are taken from AnonPages and Buffers + Cached.
 type MemUsage struct {
 	mem *MemStat
+
+	Used           int64 // MemTotal - available
+	Available      int64
+	AvailablePct   float64
+	ReclaimablePct float64 // file LRU + reclaimable kernel memory
+	Anon           int64   // anonymous LRU pages
+	AnonPct        float64
+	File           int64 // file LRU pages
+	FilePct        float64
+	SwapUsed       int64
+	SwapUsedPct    float64 // % of SwapTotal
+
+	// the lowest AvailablePct of a log; valid only if HasMinAvailable
+	HasMinAvailable bool
+	MinAvailablePct float64
+}
+
+// NumaNodeUsage holds memory usage of a NUMA node at the end of the
+// interval and rates of its page allocation events.
+type NumaNodeUsage struct {
+	NodeId    int
+	MemTotal  int64 // KB
+	MemUsed   int64 // KB
+	MemFree   int64 // KB
+	FilePages int64 // KB
+	AnonPages int64 // KB
+	Slab      int64 // KB
+
+	NumaHit       float64 // pages/sec
+	NumaMiss      float64 // pages/sec
+	NumaForeign   float64 // pages/sec
+	InterleaveHit float64 // pages/sec
+	LocalNode     float64 // pages/sec
+	OtherNode     float64 // pages/sec
+	MissRatio     float64 // % of numa_miss in numa_hit + numa_miss
+
+	// CPU usage of the cores in the node (MAX: 100% * num of cores);
+	// nil unless set by the caller with NumaUsage.SetCpuUsage
+	Cpu *CpuCoreUsage
+}
+
+type NumaUsage struct {
+	Interval time.Duration
+	Nodes    []*NumaNodeUsage
+}
+
+// FsUsageEntry holds capacity and inode usage of a mounted filesystem at the
+// end of the interval and its fill rate during the interval.
+type FsUsageEntry struct {
+	MountPoint string
+	Device     string
+	FsType     string
+
+	TotalBytes int64
+	UsedBytes  int64
+	AvailBytes int64   // available for unprivileged users
+	UsedPct    float64 // % of used + avail, as df(1) reports
+
+	TotalInodes   int64
+	UsedInodes    int64
+	UsedInodesPct float64
+
+	Growth float64 // bytes/sec of used space, negative if shrinking
+	FullIn float64 // sec until avail runs out at Growth; 0 if not growing
+}
+
+type FsUsage struct {
+	Interval time.Duration
+	Mounts   []*FsUsageEntry
+}
+
+// NfsOpUsage holds the rate and average latencies of an NFS operation.
+type NfsOpUsage struct {
+	Name    string
+	Iops    float64
+	Rtt     float64 // msec
+	Execute float64 // msec
+}
+
+// NfsMountUsage holds per-second rates and average latencies of an NFS
+// mount during the interval.
+type NfsMountUsage struct {
+	MountPoint string
+	Device     string
+	FsType     string
+
+	RdBytesPerSec float64 // read by applications
+	WrBytesPerSec float64 // written by applications
+	Iops          float64 // all operations
+	RdIops        float64 // READ operations
+	WrIops        float64 // WRITE operations
+	Rtt           float64 // msec, average over all operations
+	RdRtt         float64 // msec
+	WrRtt         float64 // msec
+	RdLatency     float64 // msec, execute time of READ
+	WrLatency     float64 // msec, execute time of WRITE
+	Retrans       float64 // retransmissions/sec
+	Timeouts      float64 // timeouts/sec
+
+	// operations issued in the interval, sorted by rate, descending
+	Ops []*NfsOpUsage
+}
+
+type NfsUsage struct {
+	Interval time.Duration
+	Mounts   []*NfsMountUsage
+}
+
+// VmUsage holds rates of /proc/vmstat events per second.
+type VmUsage struct {
+	Interval time.Duration
+
+	PgFault                float64
+	PgMajFault             float64
+	PswpIn                 float64
+	PswpOut                float64
+	PgScanKswapd           float64
+	PgScanDirect           float64
+	PgScanKhugepaged       float64
+	PgStealKswapd          float64
+	PgStealDirect          float64
+	PgStealKhugepaged      float64
+	AllocStall             float64
+	CompactStall           float64
+	ThpFaultAlloc          float64
+	ThpFaultFallback       float64
+	ThpCollapseAlloc       float64
+	ThpCollapseAllocFailed float64
+	ThpSplitPage           float64
+	OomKill                float64
+}
+
+// NetProtoUsage holds per-second protocol counters. TcpCurrEstab and the
+// socket counts are the values at the end of the interval.
+type NetProtoUsage struct {
+	Interval time.Duration
+
+	IpInReceives    float64
+	IpInDiscards    float64
+	IpOutRequests   float64
+	IpOutDiscards   float64
+	TcpActiveOpens  float64
+	TcpPassiveOpens float64
+	TcpAttemptFails float64
+	TcpEstabResets  float64
+	TcpInSegs       float64
+	TcpOutSegs      float64
+	TcpRetransSegs  float64
+	TcpRetransRatio float64 // % of sent segments
+	TcpInErrs       float64
+	TcpOutRsts      float64
+	UdpInDatagrams  float64
+	UdpNoPorts      float64
+	UdpInErrors     float64
+	UdpOutDatagrams float64
+	UdpRcvbufErrors float64
+	UdpSndbufErrors float64
+
+	ListenOverflows  float64
+	ListenDrops      float64
+	TCPTimeouts      float64
+	TCPSynRetrans    float64
+	TCPFastRetrans   float64
+	TCPAbortOnMemory float64
+	TCPBacklogDrop   float64
+
+	TcpCurrEstab int64
+	SocketsUsed  int64
+	TcpInUse     int64
+	TcpOrphan    int64
+	TcpTimeWait  int64
+	TcpAlloc     int64
+	TcpMem       int64 // pages
+	UdpInUse     int64
+	UdpMem       int64 // pages
+}
+
+// ProcessUsage holds cumulative resource usage of a process tree. Counters
+// of exited children are included once they are waited for by a parent in
+// the tree.
+type ProcessUsage struct {
+	NumProcs                 int
+	Utime                    float64 // sec
+	Stime                    float64 // sec
+	MajFlt                   int64
+	Rss                      int64 // KB, sum of RSS of the processes
+	PeakRss                  int64 // KB, larger of the largest Rss and VmHWM seen
+	ReadBytes                int64
+	WriteBytes               int64
+	VoluntaryCtxtSwitches    int64
+	NonvoluntaryCtxtSwitches int64
+}
+
+type PressureUsageEntry struct {
+	Some float64 // % of wall time some tasks were stalled
+	Full float64 // % of wall time all non-idle tasks were stalled
+}
+
+type PressureUsage struct {
+	Interval time.Duration
+
+	Cpu    *PressureUsageEntry
+	Io     *PressureUsageEntry
+	Memory *PressureUsageEntry
+}
+
+// CgroupUsageEntry holds resource usage of a cgroup v2 directory. CPU
+// figures are in % of a single core, so a cgroup saturating two cores shows
+// 200.0.
+type CgroupUsageEntry struct {
+	Interval time.Duration
+
+	Cpu           float64
+	Usr           float64
+	Sys           float64
+	Throttled     float64 // % of wall time throttled by cpu.max
+	NrThrottled   int64
+	MemCurrent    int64 // KB
+	MemAnon       int64 // KB
+	MemFile       int64 // KB
+	PgMajFault    float64
+	RdBytesPerSec float64
+	WrBytesPerSec float64
+	RdIops        float64
+	WrIops        float64
+
+	CpuPressure *PressureUsageEntry
+	IoPressure  *PressureUsageEntry
+}
+
+type CgroupUsage map[string]*CgroupUsageEntry
+
+// ProcUsage holds scheduler activity. Rates are per second, while the run
+// queue figures and the load average are taken at the end of the interval.
+type ProcUsage struct {
+	Interval time.Duration
+
+	ContextSwitch float64
+	Fork          float64
+	LoadAvg       *LoadAvgStat // nil if not recorded
+
+	// valid only if HasProcsRunning
+	HasProcsRunning bool
+	Interrupt       float64
+	ProcsRunning    int64
+	ProcsBlocked    int64
+}
+
+// CpuCoreFreqUsage holds the average, minimum and maximum frequency of a
+// core over samples in MHz. Samples with unknown frequency are ignored.
+type CpuCoreFreqUsage struct {
+	Avg        float64
+	Min        float64
+	Max        float64
+	NumSamples int
+
+	sum float64
+}
+
+type CpuFreqUsage struct {
+	NumCore int
+
+	All            *CpuCoreFreqUsage
+	CoreFreqUsages []*CpuCoreFreqUsage
+
+	// cpufreq governor of each core taken from the platform header; may
+	// be nil
+	Governors []string
+}
+
+// ThermalSensorUsage holds temperature statistics of a sensor over samples
+// in degree Celsius. Unavailable samples are not counted.
+type ThermalSensorUsage struct {
+	Name       string
+	Temp       float64 // the last sample
+	Avg        float64
+	Min        float64
+	Max        float64
+	NumSamples int
+
+	sum float64
+}
+
+type ThermalUsage struct {
+	Sensors []*ThermalSensorUsage
+}
+
+// EnergyDomainUsage holds energy consumed by a powercap domain and its
+// average power. Intervals in which the counter is unavailable are not
+// counted.
+type EnergyDomainUsage struct {
+	Name         string
+	Joules       float64
+	Watts        float64
+	NumIntervals int
+
+	elapsed float64
+}
+
+type EnergyUsage struct {
+	Interval time.Duration
+	Domains  []*EnergyDomainUsage
+
+	// sum of the domains which do not overlap each other: top-level zones
+	// other than psys plus dram subzones, or psys alone if it is the only
+	// one; nil if none
+	Total *EnergyDomainUsage
+
+	total_idxs []int
+	max_ranges []int64
+}
+
+// CustomSeriesUsage holds statistics of a series of values reported by an
+// external command. A series whose name matches LinuxHeader.CustomRates is a
+// counter, whose statistics are of the per-second rate between reports; the
+// others are gauges. Only new reports are counted.
+type CustomSeriesUsage struct {
+	Name       string // "<metric>.<key>", or "<metric>" for the key ""
+	Metric     string // name of the LinuxCustomMetric
+	Counter    bool
+	Value      float64   // the last value
+	Rate       float64   // the last rate of a counter
+	Time       time.Time // when the last counted value was reported
+	Avg        float64   // mean value of a gauge, or mean rate of a counter
+	Min        float64
+	Max        float64
+	Total      float64 // increase of a counter
+	NumSamples int     // values of a gauge, or rates of a counter
+
+	metric  int
+	key     string
+	sum     float64
+	elapsed float64
+}
+
+type CustomUsage struct {
+	// in the order of LinuxHeader.CustomMetrics, then of keys
+	Series []*CustomSeriesUsage
+
+	metrics []LinuxCustomMetric
+	rates   []string
+	index   map[string]*CustomSeriesUsage
 }
 
 var UseColor = false
@@ -287,157 +766,810 @@ func (intr_usage *InterruptUsage) WriteJsonTo(printer *projson.JsonPrinter) {
 	printer.FinishObject()
 }
 
-func (duentry *DiskUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
-	printer.BeginObject()
-	printer.PutKey("riops")
-	printer.PutFloatFmt(duentry.RdIops, "%.2f")
-	printer.PutKey("wiops")
-	printer.PutFloatFmt(duentry.WrIops, "%.2f")
-	printer.PutKey("rkbyteps")
-	printer.PutFloatFmt(duentry.RdSecps/2.0, "%.2f")
-	printer.PutKey("wkbyteps")
-	printer.PutFloatFmt(duentry.WrSecps/2.0, "%.2f")
-	printer.PutKey("rlatency")
-	printer.PutFloatFmt(duentry.RdLatency, "%.3f")
-	printer.PutKey("wlatency")
-	printer.PutFloatFmt(duentry.WrLatency, "%.3f")
-	printer.PutKey("rsize")
-	printer.PutFloatFmt(duentry.AvgRdSize, "%.2f")
-	printer.PutKey("wsize")
-	printer.PutFloatFmt(duentry.AvgWrSize, "%.2f")
-	printer.PutKey("qlen")
-	printer.PutFloatFmt(duentry.ReqQlen, "%.2f")
-	printer.FinishObject()
+var irqQueueRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`^(.*[0-9])q[0-9]+$`),  // nvme0q3
+	regexp.MustCompile(`^(.*_[a-z]+)[0-9]+$`), // mlx5_comp7
+	regexp.MustCompile(`^([^-]+)-.*$`),        // eth0-TxRx-3, virtio0-input.0
 }
 
-func strarrayToString(arr []string) string {
-	buf := bytes.NewBuffer([]byte{})
+// irqName returns the action name of an interrupt line, which is the last
+// word of its description (e.g. "nvme0q3" of "PCI-MSI 524291-edge nvme0q3").
+func irqName(entry *InterruptStatEntry) string {
+	if entry.IrqNo == -1 {
+		return entry.IrqType
+	}
 
-	fmt.Fprintf(buf, "[")
-	for i, elem := range arr {
-		if i > 0 {
-			fmt.Fprintf(buf, ",")
-		}
+	tokens := strings.Fields(entry.Descr)
+	if len(tokens) == 0 {
+		return strconv.Itoa(entry.IrqNo)
+	}
 
-		if UseColor {
-			fmt.Fprintf(buf, "\033[35m\"%s\"\033[0m", elem)
-		} else {
-			fmt.Fprintf(buf, "\"%s\"", elem)
+	return tokens[len(tokens)-1]
+}
+
+// irqDeviceName strips the queue suffix of an interrupt action name so
+// that the queue interrupts of a device are grouped together. The bus
+// address after "@" is kept, since it tells apart the devices which share
+// a driver, such as the queues of two mlx5 NICs.
+func irqDeviceName(name string) string {
+	addr := ""
+	if idx := strings.Index(name, "@"); idx > 0 {
+		// mlx5_comp7@pci:0000:3b:00.0
+		name, addr = name[:idx], name[idx:]
+	}
+
+	for _, re := range irqQueueRegexps {
+		if m := re.FindStringSubmatch(name); m != nil {
+			return m[1] + addr
 		}
 	}
-	fmt.Fprintf(buf, "]")
 
-	return buf.String()
+	return name + addr
 }
 
-func (dusage *DiskUsage) WriteJsonTo(printer *projson.JsonPrinter) {
-	var devices []string
+func GetIrqDetailUsage(t1 time.Time, i1 *InterruptStat, t2 time.Time, i2 *InterruptStat) (*IrqDetailUsage, error) {
+	if i1 == nil || i2 == nil || len(i1.Entries) == 0 || len(i2.Entries) == 0 {
+		return nil, errors.New("No interrupt stat entries")
+	}
 
-	for device, _ := range *dusage {
-		if device != "total" {
-			devices = append(devices, device)
-		}
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
 	}
-	sort.Strings(devices)
+	itv := interval.Seconds()
 
-	printer.BeginObject()
-	printer.PutKey("devices")
-	printer.BeginArray()
-	for _, device := range devices {
-		printer.PutString(device)
+	usage := new(IrqDetailUsage)
+	usage.Interval = interval
+	usage.NumCore = i2.Entries[0].NumCore
+	usage.Entries = make([]*IrqUsageEntry, 0, len(i2.Entries))
+	usage.Devices = make([]*IrqDeviceUsage, 0)
+
+	// match lines by IRQ number or type, since lines may come and go
+	// between samples
+	entries1 := make(map[string]*InterruptStatEntry)
+	for _, e := range i1.Entries {
+		entries1[fmt.Sprintf("%d:%s", e.IrqNo, e.IrqType)] = e
 	}
-	printer.FinishArray()
+	devices := make(map[string]*IrqDeviceUsage)
 
-	devices = append(devices, "total")
+	for _, e2 := range i2.Entries {
+		e1, ok := entries1[fmt.Sprintf("%d:%s", e2.IrqNo, e2.IrqType)]
+		if !ok {
+			continue
+		}
 
-	for _, device := range devices {
-		usage := (*dusage)[device]
+		entry := new(IrqUsageEntry)
+		entry.IrqNo = e2.IrqNo
+		entry.Name = irqName(e2)
+		entry.Descr = e2.Descr
+		entry.CoreRates = make([]float64, usage.NumCore)
+		for coreid := 0; coreid < usage.NumCore; coreid++ {
+			if coreid >= len(e1.IntrCounts) || coreid >= len(e2.IntrCounts) {
+				break
+			}
+			rate := float64(e2.IntrCounts[coreid]-e1.IntrCounts[coreid]) / itv
+			entry.CoreRates[coreid] = rate
+			entry.Total += rate
+		}
+		usage.Entries = append(usage.Entries, entry)
 
-		printer.PutKey(device)
-		usage.WriteJsonTo(printer)
+		if entry.IrqNo == -1 {
+			continue
+		}
+		entry.Device = irqDeviceName(entry.Name)
+
+		dev, ok := devices[entry.Device]
+		if !ok {
+			dev = &IrqDeviceUsage{entry.Device, 0, 0.0, make([]float64, usage.NumCore)}
+			devices[entry.Device] = dev
+			usage.Devices = append(usage.Devices, dev)
+		}
+		dev.NumIrqs += 1
+		dev.Total += entry.Total
+		for coreid, rate := range entry.CoreRates {
+			dev.CoreRates[coreid] += rate
+		}
 	}
 
-	printer.FinishObject()
-}
+	sort.SliceStable(usage.Entries, func(i, j int) bool {
+		return usage.Entries[i].Total > usage.Entries[j].Total
+	})
+	sort.SliceStable(usage.Devices, func(i, j int) bool {
+		return usage.Devices[i].Total > usage.Devices[j].Total
+	})
 
-func avgDelta(v int64, w int64, interval float64) float64 {
-	ret := float64(w-v) / interval
-	return ret
+	return usage, nil
 }
 
-func GetDiskUsage(t1 time.Time, d1 *DiskStat, t2 time.Time, d2 *DiskStat) (*DiskUsage, error) {
-	return GetDiskUsage1(t1, d1, t2, d2, nil)
+// BusiestCore returns the core which handled the most interrupts of the
+// line, and its share of them in percent.
+func (entry *IrqUsageEntry) BusiestCore() (int, float64) {
+	return busiestCore(entry.CoreRates, entry.Total)
 }
 
-func GetDiskUsage1(t1 time.Time, d1 *DiskStat, t2 time.Time, d2 *DiskStat,
-	filter *regexp.Regexp) (*DiskUsage, error) {
-	interval := t2.Sub(t1)
-	itv := interval.Seconds()
+// BusiestCore returns the core which handled the most interrupts of the
+// device, and its share of them in percent.
+func (dev *IrqDeviceUsage) BusiestCore() (int, float64) {
+	return busiestCore(dev.CoreRates, dev.Total)
+}
 
-	if itv <= 0.0 {
-		return nil, errors.New("negative interval")
+func busiestCore(core_rates []float64, total float64) (int, float64) {
+	busiest := 0
+	for coreid, rate := range core_rates {
+		if rate > core_rates[busiest] {
+			busiest = coreid
+		}
 	}
-
-	if len(d1.Entries) == 0 || len(d2.Entries) == 0 {
-		return nil, errors.New("no DiskEntry")
+	if total <= 0.0 || len(core_rates) == 0 {
+		return busiest, 0.0
 	}
 
-	usage := new(DiskUsage)
-	(*usage) = make(DiskUsage)
-	total := new(DiskUsageEntry)
-
-	var total_rd_ios int64 = 0
-	var total_wr_ios int64 = 0
+	return busiest, 100.0 * core_rates[busiest] / total
+}
 
-	for _, entry1 := range d1.Entries {
-		name := entry1.Name
-		if filter != nil {
-			if !filter.MatchString(name) {
-				continue
-			}
+func (usage *IrqDetailUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("irqs")
+	printer.BeginArray()
+	for _, entry := range usage.Entries {
+		printer.BeginObject()
+		if entry.IrqNo != -1 {
+			printer.PutKey("irq")
+			printer.PutInt(entry.IrqNo)
 		}
-		var entry2 *DiskStatEntry = nil
-		for _, e := range d2.Entries {
-			if e.Name == entry1.Name {
-				entry2 = e
-				break
+		printer.PutKey("name")
+		printer.PutString(entry.Name)
+		if entry.IrqNo != -1 {
+			printer.PutKey("device")
+			printer.PutString(entry.Device)
+			if affinity, ok := usage.Affinity[entry.IrqNo]; ok {
+				printer.PutKey("affinity")
+				printer.PutString(affinity)
 			}
 		}
-		if entry2 == nil {
-			continue
+		printer.PutKey("total")
+		printer.PutFloatFmt(entry.Total, "%.2f")
+		printer.PutKey("cores")
+		printer.BeginArray()
+		for _, rate := range entry.CoreRates {
+			printer.PutFloatFmt(rate, "%.2f")
 		}
+		printer.FinishArray()
+		printer.FinishObject()
+	}
+	printer.FinishArray()
 
-		rd_latency := 0.0
-		wr_latency := 0.0
-		avg_rd_sz := 0.0
-		avg_wr_sz := 0.0
-		if entry2.RdIos != entry1.RdIos {
-			rd_latency = float64(entry2.RdTicks-entry1.RdTicks) / float64(entry2.RdIos-entry1.RdIos)
-			avg_rd_sz = float64(entry2.RdSectors-entry1.RdSectors) / float64(entry2.RdIos-entry1.RdIos)
-		}
-		if entry2.WrIos != entry1.WrIos {
-			wr_latency = float64(entry2.WrTicks-entry1.WrTicks) / float64(entry2.WrIos-entry1.WrIos)
-			avg_wr_sz = float64(entry2.WrSectors-entry1.WrSectors) / float64(entry2.WrIos-entry1.WrIos)
+	printer.PutKey("devices")
+	printer.BeginArray()
+	for _, dev := range usage.Devices {
+		printer.BeginObject()
+		printer.PutKey("device")
+		printer.PutString(dev.Device)
+		printer.PutKey("nirqs")
+		printer.PutInt(dev.NumIrqs)
+		printer.PutKey("total")
+		printer.PutFloatFmt(dev.Total, "%.2f")
+		printer.PutKey("cores")
+		printer.BeginArray()
+		for _, rate := range dev.CoreRates {
+			printer.PutFloatFmt(rate, "%.2f")
 		}
+		printer.FinishArray()
+		printer.FinishObject()
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
 
-		entry := &DiskUsageEntry{
-			interval,
-			avgDelta(entry1.RdIos, entry2.RdIos, itv),
-			avgDelta(entry1.WrIos, entry2.WrIos, itv),
-			entry2.RdSectors - entry1.RdSectors,
-			entry2.WrSectors - entry1.WrSectors,
-			avgDelta(entry1.RdSectors, entry2.RdSectors, itv),
-			avgDelta(entry1.WrSectors, entry2.WrSectors, itv),
-			rd_latency,
-			wr_latency,
-			avg_rd_sz,
-			avg_wr_sz,
-			float64(entry2.ReqTicks-entry1.ReqTicks) / itv / 1.0e3,
-		}
+func getCpuCoreSoftIrqUsage(c1 *SoftIrqCoreStat, c2 *SoftIrqCoreStat, interval float64) *CpuCoreSoftIrqUsage {
+	usage := new(CpuCoreSoftIrqUsage)
+
+	usage.Hi = float64(c2.Hi-c1.Hi) / interval
+	usage.Timer = float64(c2.Timer-c1.Timer) / interval
+	usage.NetTx = float64(c2.NetTx-c1.NetTx) / interval
+	usage.NetRx = float64(c2.NetRx-c1.NetRx) / interval
+	usage.Block = float64(c2.Block-c1.Block) / interval
+	usage.BlockIopoll = float64(c2.BlockIopoll-c1.BlockIopoll) / interval
+	usage.Tasklet = float64(c2.Tasklet-c1.Tasklet) / interval
+	usage.Sched = float64(c2.Sched-c1.Sched) / interval
+	usage.Hrtimer = float64(c2.Hrtimer-c1.Hrtimer) / interval
+	usage.Rcu = float64(c2.Rcu-c1.Rcu) / interval
+
+	return usage
+}
 
-		(*usage)[name] = entry
+func GetSoftIrqUsage(t1 time.Time, s1 *SoftIrqStat, t2 time.Time, s2 *SoftIrqStat) (*SoftIrqUsage, error) {
+	if s1 == nil || s2 == nil {
+		return nil, errors.New("No softirq stat")
+	}
 
-		total.RdIops += entry.RdIops
+	if s1.NumCore != s2.NumCore {
+		return nil, errors.New("Softirq stat format changed")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+
+	usage := new(SoftIrqUsage)
+	usage.Interval = interval
+	usage.NumCore = s1.NumCore
+	usage.All = getCpuCoreSoftIrqUsage(&s1.All, &s2.All, interval.Seconds())
+	usage.CoreSoftIrqUsages = make([]*CpuCoreSoftIrqUsage, s1.NumCore)
+
+	for coreid := 0; coreid < usage.NumCore; coreid += 1 {
+		usage.CoreSoftIrqUsages[coreid] =
+			getCpuCoreSoftIrqUsage(&s1.CoreStats[coreid], &s2.CoreStats[coreid], interval.Seconds())
+	}
+
+	return usage, nil
+}
+
+func (csusage *CpuCoreSoftIrqUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("hi")
+	printer.PutFloatFmt(csusage.Hi, "%.2f")
+	printer.PutKey("timer")
+	printer.PutFloatFmt(csusage.Timer, "%.2f")
+	printer.PutKey("net_tx")
+	printer.PutFloatFmt(csusage.NetTx, "%.2f")
+	printer.PutKey("net_rx")
+	printer.PutFloatFmt(csusage.NetRx, "%.2f")
+	printer.PutKey("block")
+	printer.PutFloatFmt(csusage.Block, "%.2f")
+	printer.PutKey("irq_poll")
+	printer.PutFloatFmt(csusage.BlockIopoll, "%.2f")
+	printer.PutKey("tasklet")
+	printer.PutFloatFmt(csusage.Tasklet, "%.2f")
+	printer.PutKey("sched")
+	printer.PutFloatFmt(csusage.Sched, "%.2f")
+	printer.PutKey("hrtimer")
+	printer.PutFloatFmt(csusage.Hrtimer, "%.2f")
+	printer.PutKey("rcu")
+	printer.PutFloatFmt(csusage.Rcu, "%.2f")
+	printer.FinishObject()
+}
+
+func (susage *SoftIrqUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("num_core")
+	printer.PutInt(susage.NumCore)
+	printer.PutKey("all")
+	susage.All.WriteJsonTo(printer)
+	printer.PutKey("cores")
+	printer.BeginArray()
+	for _, core_usage := range susage.CoreSoftIrqUsages {
+		core_usage.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+// GetSoftnetUsage returns per-second softnet counters between the two
+// samples. Only a single wraparound of each counter can be detected in
+// between, so a long period should be accumulated interval by interval with
+// SoftnetUsage.Add.
+func GetSoftnetUsage(t1 time.Time, s1 *SoftnetStat, t2 time.Time, s2 *SoftnetStat) (*SoftnetUsage, error) {
+	usage := NewSoftnetUsage()
+	if err := usage.Add(t1, s1, t2, s2); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// NewSoftnetUsage returns empty statistics to which intervals are added
+// with SoftnetUsage.Add.
+func NewSoftnetUsage() *SoftnetUsage {
+	return &SoftnetUsage{0, &SoftnetUsageEntry{CpuId: -1}, []*SoftnetUsageEntry{}}
+}
+
+// Add accumulates softnet counters of another interval, so that the rates
+// are averages over all the intervals added. The counters are 32-bit, so a
+// counter smaller than the previous one is taken as wrapped around once.
+func (usage *SoftnetUsage) Add(t1 time.Time, s1 *SoftnetStat, t2 time.Time, s2 *SoftnetStat) error {
+	if s1 == nil || s2 == nil || len(s1.Entries) == 0 || len(s2.Entries) == 0 {
+		return errors.New("No softnet stat entries")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return errors.New("negative interval")
+	}
+	prev_itv := usage.Interval.Seconds()
+	usage.Interval += interval
+	itv := usage.Interval.Seconds()
+
+	// rates so far are averaged over the whole period
+	for _, core_usage := range usage.CoreUsages {
+		core_usage.Processed *= prev_itv / itv
+		core_usage.Dropped *= prev_itv / itv
+		core_usage.TimeSqueeze *= prev_itv / itv
+		core_usage.ReceivedRps *= prev_itv / itv
+		core_usage.FlowLimitCount *= prev_itv / itv
+	}
+	addDelta := func(rate *float64, v int64, w int64) {
+		delta := w - v
+		if delta < 0 {
+			delta += 1 << 32
+		}
+		*rate += float64(delta) / itv
+	}
+
+	for _, e2 := range s2.Entries {
+		var e1 *SoftnetStatEntry = nil
+		for _, e := range s1.Entries {
+			if e.CpuId == e2.CpuId {
+				e1 = e
+				break
+			}
+		}
+		if e1 == nil {
+			// CPU onlined during the interval
+			continue
+		}
+
+		var core_usage *SoftnetUsageEntry = nil
+		for _, u := range usage.CoreUsages {
+			if u.CpuId == e2.CpuId {
+				core_usage = u
+				break
+			}
+		}
+		if core_usage == nil {
+			core_usage = &SoftnetUsageEntry{CpuId: e2.CpuId}
+			usage.CoreUsages = append(usage.CoreUsages, core_usage)
+		}
+
+		addDelta(&core_usage.Processed, e1.Processed, e2.Processed)
+		addDelta(&core_usage.Dropped, e1.Dropped, e2.Dropped)
+		addDelta(&core_usage.TimeSqueeze, e1.TimeSqueeze, e2.TimeSqueeze)
+		addDelta(&core_usage.ReceivedRps, e1.ReceivedRps, e2.ReceivedRps)
+		addDelta(&core_usage.FlowLimitCount, e1.FlowLimitCount, e2.FlowLimitCount)
+	}
+
+	usage.All = &SoftnetUsageEntry{CpuId: -1}
+	for _, core_usage := range usage.CoreUsages {
+		usage.All.Processed += core_usage.Processed
+		usage.All.Dropped += core_usage.Dropped
+		usage.All.TimeSqueeze += core_usage.TimeSqueeze
+		usage.All.ReceivedRps += core_usage.ReceivedRps
+		usage.All.FlowLimitCount += core_usage.FlowLimitCount
+	}
+
+	return nil
+}
+
+// newCpuIdleUsageEntry computes statistics of a core (or all cores) from
+// per-state deltas of residency time in usec and of entry count.
+func newCpuIdleUsageEntry(cpu_id int, time_deltas []int64, usage_deltas []int64, num_core int, itv float64) *CpuIdleUsageEntry {
+	entry := &CpuIdleUsageEntry{
+		cpu_id,
+		0.0,
+		make([]float64, len(time_deltas)),
+		make([]float64, len(usage_deltas)),
+	}
+
+	var total int64 = 0
+	for _, delta := range time_deltas {
+		total += delta
+	}
+
+	entry.Idle = float64(total) / (itv * 1.0e6 * float64(num_core)) * 100.0
+	if entry.Idle > 100.0 {
+		entry.Idle = 100.0
+	}
+	for idx, delta := range time_deltas {
+		if total > 0 {
+			entry.Residency[idx] = float64(delta) / float64(total) * 100.0
+		}
+	}
+	for idx, delta := range usage_deltas {
+		entry.Usage[idx] = float64(delta) / itv
+	}
+
+	return entry
+}
+
+// GetCpuIdleUsage returns idle state residency of each core over the
+// interval. Cores without cpuidle states, or whose set of states changed,
+// are skipped.
+func GetCpuIdleUsage(t1 time.Time, c1 *CpuIdleStat, t2 time.Time, c2 *CpuIdleStat) (*CpuIdleUsage, error) {
+	if c1 == nil || c2 == nil {
+		return nil, errors.New("No cpuidle stat")
+	}
+	if c1.NumCore == 0 || c1.NumCore != c2.NumCore || len(c2.StateNames) == 0 {
+		return nil, errors.New("Invalid cpuidle stat")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+	itv := interval.Seconds()
+
+	num_state := len(c2.StateNames)
+	usage := new(CpuIdleUsage)
+	usage.Interval = interval
+	usage.StateNames = c2.StateNames
+	usage.CoreUsages = make([]*CpuIdleUsageEntry, 0, c2.NumCore)
+
+	all_time_deltas := make([]int64, num_state)
+	all_usage_deltas := make([]int64, num_state)
+	num_core := 0
+	for cpu_id := 0; cpu_id < c2.NumCore; cpu_id++ {
+		s1 := c1.CoreStats[cpu_id]
+		s2 := c2.CoreStats[cpu_id]
+		if len(s2.Times) != num_state || len(s1.Times) != num_state {
+			continue
+		}
+
+		time_deltas := make([]int64, num_state)
+		usage_deltas := make([]int64, num_state)
+		for idx := 0; idx < num_state; idx++ {
+			time_deltas[idx] = s2.Times[idx] - s1.Times[idx]
+			usage_deltas[idx] = s2.Usages[idx] - s1.Usages[idx]
+			all_time_deltas[idx] += time_deltas[idx]
+			all_usage_deltas[idx] += usage_deltas[idx]
+		}
+		usage.CoreUsages = append(usage.CoreUsages,
+			newCpuIdleUsageEntry(cpu_id, time_deltas, usage_deltas, 1, itv))
+		num_core++
+	}
+
+	if num_core == 0 {
+		return nil, errors.New("No cpuidle stat")
+	}
+	usage.All = newCpuIdleUsageEntry(-1, all_time_deltas, all_usage_deltas, num_core, itv)
+
+	return usage, nil
+}
+
+// DeepestResidency returns the share of idle time spent in the deepest
+// idle state, i.e. the last one.
+func (entry *CpuIdleUsageEntry) DeepestResidency() float64 {
+	if len(entry.Residency) == 0 {
+		return 0.0
+	}
+	return entry.Residency[len(entry.Residency)-1]
+}
+
+func (entry *CpuIdleUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	if entry.CpuId >= 0 {
+		printer.PutKey("cpu")
+		printer.PutInt(entry.CpuId)
+	}
+	printer.PutKey("idle")
+	printer.PutFloatFmt(entry.Idle, "%.2f")
+	printer.PutKey("residency")
+	printer.BeginArray()
+	for _, residency := range entry.Residency {
+		printer.PutFloatFmt(residency, "%.2f")
+	}
+	printer.FinishArray()
+	printer.PutKey("usage")
+	printer.BeginArray()
+	for _, usage := range entry.Usage {
+		printer.PutFloatFmt(usage, "%.2f")
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+func (usage *CpuIdleUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("states")
+	printer.BeginArray()
+	for _, name := range usage.StateNames {
+		printer.PutString(name)
+	}
+	printer.FinishArray()
+	printer.PutKey("all")
+	usage.All.WriteJsonTo(printer)
+	printer.PutKey("cores")
+	printer.BeginArray()
+	for _, core_usage := range usage.CoreUsages {
+		core_usage.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+func (entry *SoftnetUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	if entry.CpuId >= 0 {
+		printer.PutKey("cpu")
+		printer.PutInt(entry.CpuId)
+	}
+	printer.PutKey("processed")
+	printer.PutFloatFmt(entry.Processed, "%.2f")
+	printer.PutKey("dropped")
+	printer.PutFloatFmt(entry.Dropped, "%.2f")
+	printer.PutKey("time_squeeze")
+	printer.PutFloatFmt(entry.TimeSqueeze, "%.2f")
+	printer.PutKey("received_rps")
+	printer.PutFloatFmt(entry.ReceivedRps, "%.2f")
+	printer.PutKey("flow_limit")
+	printer.PutFloatFmt(entry.FlowLimitCount, "%.2f")
+	printer.FinishObject()
+}
+
+func (susage *SoftnetUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("all")
+	susage.All.WriteJsonTo(printer)
+	printer.PutKey("cores")
+	printer.BeginArray()
+	for _, core_usage := range susage.CoreUsages {
+		core_usage.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+func (duentry *DiskUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("riops")
+	printer.PutFloatFmt(duentry.RdIops, "%.2f")
+	printer.PutKey("wiops")
+	printer.PutFloatFmt(duentry.WrIops, "%.2f")
+	printer.PutKey("rkbyteps")
+	printer.PutFloatFmt(duentry.RdSecps/2.0, "%.2f")
+	printer.PutKey("wkbyteps")
+	printer.PutFloatFmt(duentry.WrSecps/2.0, "%.2f")
+	printer.PutKey("rlatency")
+	printer.PutFloatFmt(duentry.RdLatency, "%.3f")
+	printer.PutKey("wlatency")
+	printer.PutFloatFmt(duentry.WrLatency, "%.3f")
+	printer.PutKey("rsize")
+	printer.PutFloatFmt(duentry.AvgRdSize, "%.2f")
+	printer.PutKey("wsize")
+	printer.PutFloatFmt(duentry.AvgWrSize, "%.2f")
+	printer.PutKey("qlen")
+	printer.PutFloatFmt(duentry.ReqQlen, "%.2f")
+	if duentry.HasInFlight {
+		printer.PutKey("inflight")
+		printer.PutInt64(duentry.InFlight)
+	}
+	printer.PutKey("rrqmps")
+	printer.PutFloatFmt(duentry.RdMergeps, "%.2f")
+	printer.PutKey("wrqmps")
+	printer.PutFloatFmt(duentry.WrMergeps, "%.2f")
+	printer.PutKey("rrqm")
+	printer.PutFloatFmt(duentry.RdMergePct, "%.2f")
+	printer.PutKey("wrqm")
+	printer.PutFloatFmt(duentry.WrMergePct, "%.2f")
+	printer.PutKey("svctm")
+	printer.PutFloatFmt(duentry.Svctm, "%.3f")
+	printer.PutKey("util")
+	printer.PutFloatFmt(duentry.Util, "%.2f")
+	if duentry.HasDiscard {
+		printer.PutKey("diops")
+		printer.PutFloatFmt(duentry.DcIops, "%.2f")
+		printer.PutKey("dkbyteps")
+		printer.PutFloatFmt(duentry.DcSecps/2.0, "%.2f")
+		printer.PutKey("dlatency")
+		printer.PutFloatFmt(duentry.DcLatency, "%.3f")
+	}
+	if duentry.HasFlush {
+		printer.PutKey("fiops")
+		printer.PutFloatFmt(duentry.FlIops, "%.2f")
+		printer.PutKey("flatency")
+		printer.PutFloatFmt(duentry.FlLatency, "%.3f")
+	}
+	printer.FinishObject()
+}
+
+func strarrayToString(arr []string) string {
+	buf := bytes.NewBuffer([]byte{})
+
+	fmt.Fprintf(buf, "[")
+	for i, elem := range arr {
+		if i > 0 {
+			fmt.Fprintf(buf, ",")
+		}
+
+		if UseColor {
+			fmt.Fprintf(buf, "\033[35m\"%s\"\033[0m", elem)
+		} else {
+			fmt.Fprintf(buf, "\"%s\"", elem)
+		}
+	}
+	fmt.Fprintf(buf, "]")
+
+	return buf.String()
+}
+
+func (dusage *DiskUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	var devices []string
+
+	for device, _ := range *dusage {
+		if device != "total" {
+			devices = append(devices, device)
+		}
+	}
+	sort.Strings(devices)
+
+	printer.BeginObject()
+	printer.PutKey("devices")
+	printer.BeginArray()
+	for _, device := range devices {
+		printer.PutString(device)
+	}
+	printer.FinishArray()
+
+	devices = append(devices, "total")
+
+	for _, device := range devices {
+		usage := (*dusage)[device]
+
+		printer.PutKey(device)
+		usage.WriteJsonTo(printer)
+	}
+
+	printer.FinishObject()
+}
+
+func avgDelta(v int64, w int64, interval float64) float64 {
+	ret := float64(w-v) / interval
+	return ret
+}
+
+func GetDiskUsage(t1 time.Time, d1 *DiskStat, t2 time.Time, d2 *DiskStat) (*DiskUsage, error) {
+	return GetDiskUsage1(t1, d1, t2, d2, nil)
+}
+
+func GetDiskUsage1(t1 time.Time, d1 *DiskStat, t2 time.Time, d2 *DiskStat,
+	filter *regexp.Regexp) (*DiskUsage, error) {
+	return GetDiskUsage2(t1, d1, t2, d2, filter, nil)
+}
+
+// GetDiskUsage2 is GetDiskUsage1 which takes the partitions of `devices`
+// (LinuxHeader.Devices) out of the total %util and svctm, since their busy
+// time is also counted in that of the disk. Without `devices`, every entry
+// is taken as a disk.
+func GetDiskUsage2(t1 time.Time, d1 *DiskStat, t2 time.Time, d2 *DiskStat,
+	filter *regexp.Regexp, devices map[string]LinuxDevice) (*DiskUsage, error) {
+	interval := t2.Sub(t1)
+	itv := interval.Seconds()
+
+	if itv <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+
+	if len(d1.Entries) == 0 || len(d2.Entries) == 0 {
+		return nil, errors.New("no DiskEntry")
+	}
+
+	usage := new(DiskUsage)
+	(*usage) = make(DiskUsage)
+	total := new(DiskUsageEntry)
+
+	var total_rd_ios int64 = 0
+	var total_wr_ios int64 = 0
+	var total_dc_ios int64 = 0
+	var total_fl_ios int64 = 0
+	var total_io_ticks int64 = 0
+	var total_rd_merges int64 = 0
+	var total_wr_merges int64 = 0
+	var num_devices int = 0
+	var dev_nr_ios int64 = 0
+
+	parts := make(map[string]bool)
+	for _, device := range devices {
+		for _, part := range device.Parts {
+			parts[part] = true
+		}
+	}
+
+	for _, entry1 := range d1.Entries {
+		name := entry1.Name
+		if filter != nil {
+			if !filter.MatchString(name) {
+				continue
+			}
+		}
+		var entry2 *DiskStatEntry = nil
+		for _, e := range d2.Entries {
+			if e.Name == entry1.Name {
+				entry2 = e
+				break
+			}
+		}
+		if entry2 == nil {
+			continue
+		}
+
+		rd_latency := 0.0
+		wr_latency := 0.0
+		avg_rd_sz := 0.0
+		avg_wr_sz := 0.0
+		if entry2.RdIos != entry1.RdIos {
+			rd_latency = float64(entry2.RdTicks-entry1.RdTicks) / float64(entry2.RdIos-entry1.RdIos)
+			avg_rd_sz = float64(entry2.RdSectors-entry1.RdSectors) / float64(entry2.RdIos-entry1.RdIos)
+		}
+		if entry2.WrIos != entry1.WrIos {
+			wr_latency = float64(entry2.WrTicks-entry1.WrTicks) / float64(entry2.WrIos-entry1.WrIos)
+			avg_wr_sz = float64(entry2.WrSectors-entry1.WrSectors) / float64(entry2.WrIos-entry1.WrIos)
+		}
+
+		rd_merges := entry2.RdMerges - entry1.RdMerges
+		wr_merges := entry2.WrMerges - entry1.WrMerges
+		rd_merge_pct := 0.0
+		wr_merge_pct := 0.0
+		if rd_merges+entry2.RdIos-entry1.RdIos > 0 {
+			rd_merge_pct = 100.0 * float64(rd_merges) / float64(rd_merges+entry2.RdIos-entry1.RdIos)
+		}
+		if wr_merges+entry2.WrIos-entry1.WrIos > 0 {
+			wr_merge_pct = 100.0 * float64(wr_merges) / float64(wr_merges+entry2.WrIos-entry1.WrIos)
+		}
+
+		// io_ticks counts milliseconds during which the device had at
+		// least one I/O in flight.
+		io_ticks := entry2.TotalTicks - entry1.TotalTicks
+		nr_ios := entry2.RdIos - entry1.RdIos + entry2.WrIos - entry1.WrIos
+		if entry1.HasDiscard && entry2.HasDiscard {
+			nr_ios += entry2.DcIos - entry1.DcIos
+		}
+		svctm := 0.0
+		if nr_ios > 0 {
+			svctm = float64(io_ticks) / float64(nr_ios)
+		}
+		util := 100.0 * float64(io_ticks) / itv / 1.0e3
+		if util > 100.0 {
+			util = 100.0
+		}
+
+		entry := &DiskUsageEntry{
+			interval,
+			avgDelta(entry1.RdIos, entry2.RdIos, itv),
+			avgDelta(entry1.WrIos, entry2.WrIos, itv),
+			entry2.RdSectors - entry1.RdSectors,
+			entry2.WrSectors - entry1.WrSectors,
+			avgDelta(entry1.RdSectors, entry2.RdSectors, itv),
+			avgDelta(entry1.WrSectors, entry2.WrSectors, itv),
+			rd_latency,
+			wr_latency,
+			avg_rd_sz,
+			avg_wr_sz,
+			float64(entry2.ReqTicks-entry1.ReqTicks) / itv / 1.0e3,
+			false, 0,
+			avgDelta(entry1.RdMerges, entry2.RdMerges, itv),
+			avgDelta(entry1.WrMerges, entry2.WrMerges, itv),
+			rd_merge_pct,
+			wr_merge_pct,
+			svctm,
+			util,
+			false, 0.0, 0, 0.0, 0.0,
+			false, 0.0, 0.0,
+		}
+
+		if entry2.HasInFlight {
+			entry.HasInFlight = true
+			entry.InFlight = entry2.IosPgr
+		}
+		if entry1.HasDiscard && entry2.HasDiscard {
+			entry.HasDiscard = true
+			entry.DcIops = avgDelta(entry1.DcIos, entry2.DcIos, itv)
+			entry.DcSectors = entry2.DcSectors - entry1.DcSectors
+			entry.DcSecps = avgDelta(entry1.DcSectors, entry2.DcSectors, itv)
+			if entry2.DcIos != entry1.DcIos {
+				entry.DcLatency = float64(entry2.DcTicks-entry1.DcTicks) / float64(entry2.DcIos-entry1.DcIos)
+			}
+		}
+		if entry1.HasFlush && entry2.HasFlush {
+			entry.HasFlush = true
+			entry.FlIops = avgDelta(entry1.FlIos, entry2.FlIos, itv)
+			if entry2.FlIos != entry1.FlIos {
+				entry.FlLatency = float64(entry2.FlTicks-entry1.FlTicks) / float64(entry2.FlIos-entry1.FlIos)
+			}
+		}
+
+		(*usage)[name] = entry
+
+		total.RdIops += entry.RdIops
 		total.WrIops += entry.WrIops
 		total.RdSectors += entry.RdSectors
 		total.WrSectors += entry.WrSectors
@@ -449,132 +1581,1830 @@ func GetDiskUsage1(t1 time.Time, d1 *DiskStat, t2 time.Time, d2 *DiskStat,
 		total.AvgWrSize += entry.AvgWrSize * float64(entry2.WrIos-entry1.WrIos)
 		total.ReqQlen += entry.ReqQlen
 
-		total_rd_ios += entry2.RdIos - entry1.RdIos
-		total_wr_ios += entry2.WrIos - entry1.WrIos
+		total_rd_ios += entry2.RdIos - entry1.RdIos
+		total_wr_ios += entry2.WrIos - entry1.WrIos
+
+		if entry.HasInFlight {
+			total.HasInFlight = true
+			total.InFlight += entry.InFlight
+		}
+		total.RdMergeps += entry.RdMergeps
+		total.WrMergeps += entry.WrMergeps
+		total_rd_merges += rd_merges
+		total_wr_merges += wr_merges
+		if !parts[name] {
+			total.Util += entry.Util
+			total_io_ticks += io_ticks
+			dev_nr_ios += nr_ios
+			num_devices += 1
+		}
+		if entry.HasDiscard {
+			total.HasDiscard = true
+			total.DcIops += entry.DcIops
+			total.DcSectors += entry.DcSectors
+			total.DcSecps += entry.DcSecps
+			total.DcLatency += entry.DcLatency * float64(entry2.DcIos-entry1.DcIos)
+			total_dc_ios += entry2.DcIos - entry1.DcIos
+		}
+		if entry.HasFlush {
+			total.HasFlush = true
+			total.FlIops += entry.FlIops
+			total.FlLatency += entry.FlLatency * float64(entry2.FlIos-entry1.FlIos)
+			total_fl_ios += entry2.FlIos - entry1.FlIos
+		}
+	}
+
+	if total_rd_ios > 0 {
+		total.RdLatency /= float64(total_rd_ios)
+		total.AvgRdSize /= float64(total_rd_ios)
+	}
+	if total_wr_ios > 0 {
+		total.WrLatency /= float64(total_wr_ios)
+		total.AvgWrSize /= float64(total_wr_ios)
+	}
+	if total_dc_ios > 0 {
+		total.DcLatency /= float64(total_dc_ios)
+	}
+	if total_rd_merges+total_rd_ios > 0 {
+		total.RdMergePct = 100.0 * float64(total_rd_merges) / float64(total_rd_merges+total_rd_ios)
+	}
+	if total_wr_merges+total_wr_ios > 0 {
+		total.WrMergePct = 100.0 * float64(total_wr_merges) / float64(total_wr_merges+total_wr_ios)
+	}
+	if dev_nr_ios > 0 {
+		total.Svctm = float64(total_io_ticks) / float64(dev_nr_ios)
+	}
+	// the total of %util is the average over disks
+	if num_devices > 0 {
+		total.Util /= float64(num_devices)
+	}
+	if total_fl_ios > 0 {
+		total.FlLatency /= float64(total_fl_ios)
+	}
+
+	(*usage)["total"] = total
+
+	return usage, nil
+}
+
+func usageItem(v1 int64, v2 int64, itv int64) float64 {
+	return float64(v2-v1) / float64(itv) * 100.0
+}
+
+// GetNetUsage computes per-interface throughput between d1 and d2. Link
+// utilization is filled in for interfaces whose speed is known in `devices`,
+// which may be nil for logs recorded without link metadata.
+func GetNetUsage(t1 time.Time, d1 *NetStat, t2 time.Time, d2 *NetStat,
+	devices map[string]LinuxNetDevice) (*NetUsage, error) {
+	return GetNetUsage1(t1, d1, t2, d2, devices, nil, nil)
+}
+
+// SelectNetDevice reports whether interface `name` matches `only` and does
+// not match `exclude`. A nil regexp matches every name for `only` and none
+// for `exclude`.
+func SelectNetDevice(name string, only *regexp.Regexp, exclude *regexp.Regexp) bool {
+	if only != nil && !only.MatchString(name) {
+		return false
+	}
+	if exclude != nil && exclude.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// netTotalMembers returns the interfaces among `names` whose traffic is
+// summed into the "total" entry so that each packet is counted once. If any
+// of them is a physical NIC, only physical NICs are counted: bond masters,
+// bridges, vlans and veths carry traffic which also passes the NICs below
+// them. Otherwise (e.g. inside a container) every interface is counted except
+// the loopback, bonds or bridges whose slaves or ports are counted, and veths
+// attached to a bridge whose uplink (a port other than a veth) is counted,
+// as the traffic of the veths leaves the host through the uplink.
+func netTotalMembers(names []string, devices map[string]LinuxNetDevice) []string {
+	members := []string{}
+	for _, name := range names {
+		if devices[name].Physical {
+			members = append(members, name)
+		}
+	}
+	if len(members) > 0 {
+		return members
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+	}
+	for _, name := range names {
+		dev, ok := devices[name]
+		if !ok || dev.Type == 772 { // ARPHRD_LOOPBACK
+			continue
+		}
+		has_lower := false
+		for _, lower := range dev.Lowers {
+			if selected[lower] {
+				has_lower = true
+			}
+		}
+		if has_lower {
+			continue
+		}
+		if dev.Kind == "veth" && dev.Master != "" {
+			has_uplink := false
+			for _, port := range devices[dev.Master].Lowers {
+				if selected[port] && devices[port].Kind != "veth" {
+					has_uplink = true
+				}
+			}
+			if has_uplink {
+				continue
+			}
+		}
+		members = append(members, name)
+	}
+
+	return members
+}
+
+// GetNetUsage1 is GetNetUsage for the interfaces selected by `only` and
+// `exclude` (see SelectNetDevice). Without link metadata the "total" entry is
+// the sum of all selected interfaces; with it, the sum of the interfaces
+// chosen by netTotalMembers, whose names are stored in total.Members. The
+// total link utilization is computed if every member has a known speed.
+func GetNetUsage1(t1 time.Time, d1 *NetStat, t2 time.Time, d2 *NetStat,
+	devices map[string]LinuxNetDevice,
+	only *regexp.Regexp, exclude *regexp.Regexp) (*NetUsage, error) {
+	if len(d1.Entries) == 0 && len(d2.Entries) == 0 {
+		return nil, errors.New("no entries")
+	}
+
+	interval := t2.Sub(t1)
+	itv := interval.Seconds()
+
+	if itv <= 0 {
+		return nil, errors.New("Non-positive interval")
+	}
+
+	net_usage := new(NetUsage)
+	(*net_usage) = make(NetUsage)
+	total := new(NetUsageEntry)
+	total.Interval = interval
+
+	var devnames []string
+	for _, d1_entry := range d1.Entries {
+		devname := d1_entry.Name
+		if !SelectNetDevice(devname, only, exclude) {
+			continue
+		}
+
+		// find devname in d2
+		var d2_entry *NetStatEntry = nil
+		for _, e := range d2.Entries {
+			if e.Name == devname {
+				d2_entry = e
+				break
+			}
+		}
+
+		if d2_entry == nil {
+			continue
+		}
+
+		ue := new(NetUsageEntry)
+
+		ue.Interval = interval
+		ue.RxBytesPerSec = avgDelta(d1_entry.RxBytes, d2_entry.RxBytes, itv)
+		ue.RxPacketsPerSec = avgDelta(d1_entry.RxPackets, d2_entry.RxPackets, itv)
+		ue.RxErrorsPerSec = avgDelta(d1_entry.RxErrors, d2_entry.RxErrors, itv)
+		ue.RxDropsPerSec = avgDelta(d1_entry.RxDrops, d2_entry.RxDrops, itv)
+		ue.RxFifoPerSec = avgDelta(d1_entry.RxFifo, d2_entry.RxFifo, itv)
+		ue.RxFramePerSec = avgDelta(d1_entry.RxFrame, d2_entry.RxFrame, itv)
+		ue.RxCompressedPerSec = avgDelta(d1_entry.RxCompressed, d2_entry.RxCompressed, itv)
+		ue.RxMulticastPerSec = avgDelta(d1_entry.RxMulticast, d2_entry.RxMulticast, itv)
+		ue.TxBytesPerSec = avgDelta(d1_entry.TxBytes, d2_entry.TxBytes, itv)
+		ue.TxPacketsPerSec = avgDelta(d1_entry.TxPackets, d2_entry.TxPackets, itv)
+		ue.TxErrorsPerSec = avgDelta(d1_entry.TxErrors, d2_entry.TxErrors, itv)
+		ue.TxDropsPerSec = avgDelta(d1_entry.TxDrops, d2_entry.TxDrops, itv)
+		ue.TxFifoPerSec = avgDelta(d1_entry.TxFifo, d2_entry.TxFifo, itv)
+		ue.TxFramePerSec = avgDelta(d1_entry.TxFrame, d2_entry.TxFrame, itv)
+		ue.TxCompressedPerSec = avgDelta(d1_entry.TxCompressed, d2_entry.TxCompressed, itv)
+		ue.TxMulticastPerSec = avgDelta(d1_entry.TxMulticast, d2_entry.TxMulticast, itv)
+
+		if dev, ok := devices[devname]; ok && dev.Speed > 0 {
+			ue.setLinkUtil(dev.Speed, dev.Duplex == "half")
+		}
+
+		(*net_usage)[devname] = ue
+		devnames = append(devnames, devname)
+	}
+
+	members := devnames
+	if devices != nil {
+		members = netTotalMembers(devnames, devices)
+		total.Members = members
+	}
+
+	total_speed := int64(0)
+	for _, devname := range members {
+		ue := (*net_usage)[devname]
+
+		if total_speed >= 0 && ue.LinkSpeed > 0 {
+			total_speed += ue.LinkSpeed
+		} else {
+			total_speed = -1
+		}
+
+		total.RxBytesPerSec += ue.RxBytesPerSec
+		total.RxPacketsPerSec += ue.RxPacketsPerSec
+		total.RxErrorsPerSec += ue.RxErrorsPerSec
+		total.RxDropsPerSec += ue.RxDropsPerSec
+		total.RxFifoPerSec += ue.RxFifoPerSec
+		total.RxFramePerSec += ue.RxFramePerSec
+		total.RxCompressedPerSec += ue.RxCompressedPerSec
+		total.RxMulticastPerSec += ue.RxMulticastPerSec
+		total.TxBytesPerSec += ue.TxBytesPerSec
+		total.TxPacketsPerSec += ue.TxPacketsPerSec
+		total.TxErrorsPerSec += ue.TxErrorsPerSec
+		total.TxDropsPerSec += ue.TxDropsPerSec
+		total.TxFifoPerSec += ue.TxFifoPerSec
+		total.TxFramePerSec += ue.TxFramePerSec
+		total.TxCompressedPerSec += ue.TxCompressedPerSec
+		total.TxMulticastPerSec += ue.TxMulticastPerSec
+	}
+
+	if devices != nil && total_speed > 0 {
+		total.setLinkUtil(total_speed, false)
+	}
+
+	(*net_usage)["total"] = total
+
+	return net_usage, nil
+}
+
+// setLinkUtil fills LinkSpeed, RxUtil and TxUtil for a link of `speed` Mb/s.
+func (entry *NetUsageEntry) setLinkUtil(speed int64, half_duplex bool) {
+	capacity := float64(speed) * 1000.0 * 1000.0 / 8.0 // bytes/s
+
+	entry.LinkSpeed = speed
+	if half_duplex {
+		entry.RxUtil = 100.0 * (entry.RxBytesPerSec + entry.TxBytesPerSec) / capacity
+		entry.TxUtil = entry.RxUtil
+	} else {
+		entry.RxUtil = 100.0 * entry.RxBytesPerSec / capacity
+		entry.TxUtil = 100.0 * entry.TxBytesPerSec / capacity
+	}
+}
+
+func (nusage *NetUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	var devices []string
+
+	for device, _ := range *nusage {
+		if device != "total" {
+			devices = append(devices, device)
+		}
+	}
+	sort.Strings(devices)
+
+	printer.BeginObject()
+	printer.PutKey("devices")
+	printer.BeginArray()
+	for _, device := range devices {
+		printer.PutString(device)
+	}
+	printer.FinishArray()
+
+	devices = append(devices, "total")
+
+	for _, device := range devices {
+		usage := (*nusage)[device]
+
+		printer.PutKey(device)
+		usage.WriteJsonTo(printer)
+	}
+
+	printer.FinishObject()
+}
+
+func GetNetProtoUsage(t1 time.Time, n1 *NetProtoStat, t2 time.Time, n2 *NetProtoStat) (*NetProtoUsage, error) {
+	if n1 == nil || n2 == nil {
+		return nil, errors.New("No network protocol stat")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+	itv := interval.Seconds()
+
+	usage := new(NetProtoUsage)
+	usage.Interval = interval
+	usage.IpInReceives = avgDelta(n1.IpInReceives, n2.IpInReceives, itv)
+	usage.IpInDiscards = avgDelta(n1.IpInDiscards, n2.IpInDiscards, itv)
+	usage.IpOutRequests = avgDelta(n1.IpOutRequests, n2.IpOutRequests, itv)
+	usage.IpOutDiscards = avgDelta(n1.IpOutDiscards, n2.IpOutDiscards, itv)
+	usage.TcpActiveOpens = avgDelta(n1.TcpActiveOpens, n2.TcpActiveOpens, itv)
+	usage.TcpPassiveOpens = avgDelta(n1.TcpPassiveOpens, n2.TcpPassiveOpens, itv)
+	usage.TcpAttemptFails = avgDelta(n1.TcpAttemptFails, n2.TcpAttemptFails, itv)
+	usage.TcpEstabResets = avgDelta(n1.TcpEstabResets, n2.TcpEstabResets, itv)
+	usage.TcpInSegs = avgDelta(n1.TcpInSegs, n2.TcpInSegs, itv)
+	usage.TcpOutSegs = avgDelta(n1.TcpOutSegs, n2.TcpOutSegs, itv)
+	usage.TcpRetransSegs = avgDelta(n1.TcpRetransSegs, n2.TcpRetransSegs, itv)
+	if n2.TcpOutSegs != n1.TcpOutSegs {
+		usage.TcpRetransRatio = 100.0 * float64(n2.TcpRetransSegs-n1.TcpRetransSegs) /
+			float64(n2.TcpOutSegs-n1.TcpOutSegs)
+	}
+	usage.TcpInErrs = avgDelta(n1.TcpInErrs, n2.TcpInErrs, itv)
+	usage.TcpOutRsts = avgDelta(n1.TcpOutRsts, n2.TcpOutRsts, itv)
+	usage.UdpInDatagrams = avgDelta(n1.UdpInDatagrams, n2.UdpInDatagrams, itv)
+	usage.UdpNoPorts = avgDelta(n1.UdpNoPorts, n2.UdpNoPorts, itv)
+	usage.UdpInErrors = avgDelta(n1.UdpInErrors, n2.UdpInErrors, itv)
+	usage.UdpOutDatagrams = avgDelta(n1.UdpOutDatagrams, n2.UdpOutDatagrams, itv)
+	usage.UdpRcvbufErrors = avgDelta(n1.UdpRcvbufErrors, n2.UdpRcvbufErrors, itv)
+	usage.UdpSndbufErrors = avgDelta(n1.UdpSndbufErrors, n2.UdpSndbufErrors, itv)
+	usage.ListenOverflows = avgDelta(n1.ListenOverflows, n2.ListenOverflows, itv)
+	usage.ListenDrops = avgDelta(n1.ListenDrops, n2.ListenDrops, itv)
+	usage.TCPTimeouts = avgDelta(n1.TCPTimeouts, n2.TCPTimeouts, itv)
+	usage.TCPSynRetrans = avgDelta(n1.TCPSynRetrans, n2.TCPSynRetrans, itv)
+	usage.TCPFastRetrans = avgDelta(n1.TCPFastRetrans, n2.TCPFastRetrans, itv)
+	usage.TCPAbortOnMemory = avgDelta(n1.TCPAbortOnMemory, n2.TCPAbortOnMemory, itv)
+	usage.TCPBacklogDrop = avgDelta(n1.TCPBacklogDrop, n2.TCPBacklogDrop, itv)
+
+	usage.TcpCurrEstab = n2.TcpCurrEstab
+	usage.SocketsUsed = n2.SocketsUsed
+	usage.TcpInUse = n2.TcpInUse
+	usage.TcpOrphan = n2.TcpOrphan
+	usage.TcpTimeWait = n2.TcpTimeWait
+	usage.TcpAlloc = n2.TcpAlloc
+	usage.TcpMem = n2.TcpMem
+	usage.UdpInUse = n2.UdpInUse
+	usage.UdpMem = n2.UdpMem
+
+	return usage, nil
+}
+
+func (nusage *NetProtoUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("ip_in_receives")
+	printer.PutFloatFmt(nusage.IpInReceives, "%.2f")
+	printer.PutKey("ip_in_discards")
+	printer.PutFloatFmt(nusage.IpInDiscards, "%.2f")
+	printer.PutKey("ip_out_requests")
+	printer.PutFloatFmt(nusage.IpOutRequests, "%.2f")
+	printer.PutKey("ip_out_discards")
+	printer.PutFloatFmt(nusage.IpOutDiscards, "%.2f")
+	printer.PutKey("tcp_active_opens")
+	printer.PutFloatFmt(nusage.TcpActiveOpens, "%.2f")
+	printer.PutKey("tcp_passive_opens")
+	printer.PutFloatFmt(nusage.TcpPassiveOpens, "%.2f")
+	printer.PutKey("tcp_attempt_fails")
+	printer.PutFloatFmt(nusage.TcpAttemptFails, "%.2f")
+	printer.PutKey("tcp_estab_resets")
+	printer.PutFloatFmt(nusage.TcpEstabResets, "%.2f")
+	printer.PutKey("tcp_in_segs")
+	printer.PutFloatFmt(nusage.TcpInSegs, "%.2f")
+	printer.PutKey("tcp_out_segs")
+	printer.PutFloatFmt(nusage.TcpOutSegs, "%.2f")
+	printer.PutKey("tcp_retrans_segs")
+	printer.PutFloatFmt(nusage.TcpRetransSegs, "%.2f")
+	printer.PutKey("tcp_retrans_ratio")
+	printer.PutFloatFmt(nusage.TcpRetransRatio, "%.2f")
+	printer.PutKey("tcp_in_errs")
+	printer.PutFloatFmt(nusage.TcpInErrs, "%.2f")
+	printer.PutKey("tcp_out_rsts")
+	printer.PutFloatFmt(nusage.TcpOutRsts, "%.2f")
+	printer.PutKey("udp_in_datagrams")
+	printer.PutFloatFmt(nusage.UdpInDatagrams, "%.2f")
+	printer.PutKey("udp_no_ports")
+	printer.PutFloatFmt(nusage.UdpNoPorts, "%.2f")
+	printer.PutKey("udp_in_errors")
+	printer.PutFloatFmt(nusage.UdpInErrors, "%.2f")
+	printer.PutKey("udp_out_datagrams")
+	printer.PutFloatFmt(nusage.UdpOutDatagrams, "%.2f")
+	printer.PutKey("udp_rcvbuf_errors")
+	printer.PutFloatFmt(nusage.UdpRcvbufErrors, "%.2f")
+	printer.PutKey("udp_sndbuf_errors")
+	printer.PutFloatFmt(nusage.UdpSndbufErrors, "%.2f")
+	printer.PutKey("listen_overflows")
+	printer.PutFloatFmt(nusage.ListenOverflows, "%.2f")
+	printer.PutKey("listen_drops")
+	printer.PutFloatFmt(nusage.ListenDrops, "%.2f")
+	printer.PutKey("tcp_timeouts")
+	printer.PutFloatFmt(nusage.TCPTimeouts, "%.2f")
+	printer.PutKey("tcp_syn_retrans")
+	printer.PutFloatFmt(nusage.TCPSynRetrans, "%.2f")
+	printer.PutKey("tcp_fast_retrans")
+	printer.PutFloatFmt(nusage.TCPFastRetrans, "%.2f")
+	printer.PutKey("tcp_abort_on_memory")
+	printer.PutFloatFmt(nusage.TCPAbortOnMemory, "%.2f")
+	printer.PutKey("tcp_backlog_drop")
+	printer.PutFloatFmt(nusage.TCPBacklogDrop, "%.2f")
+	printer.PutKey("tcp_curr_estab")
+	printer.PutInt64(nusage.TcpCurrEstab)
+	printer.PutKey("sockets_used")
+	printer.PutInt64(nusage.SocketsUsed)
+	printer.PutKey("tcp_inuse")
+	printer.PutInt64(nusage.TcpInUse)
+	printer.PutKey("tcp_orphan")
+	printer.PutInt64(nusage.TcpOrphan)
+	printer.PutKey("tcp_tw")
+	printer.PutInt64(nusage.TcpTimeWait)
+	printer.PutKey("tcp_alloc")
+	printer.PutInt64(nusage.TcpAlloc)
+	printer.PutKey("tcp_mem")
+	printer.PutInt64(nusage.TcpMem)
+	printer.PutKey("udp_inuse")
+	printer.PutInt64(nusage.UdpInUse)
+	printer.PutKey("udp_mem")
+	printer.PutInt64(nusage.UdpMem)
+	printer.FinishObject()
+}
+
+// GetNumaUsage returns per-node memory usage and NUMA allocation rates.
+// Nodes are matched by id; a node absent from n1 is skipped.
+func GetNumaUsage(t1 time.Time, n1 *NumaStat, t2 time.Time, n2 *NumaStat) (*NumaUsage, error) {
+	if n1 == nil || n2 == nil || len(n1.Entries) == 0 || len(n2.Entries) == 0 {
+		return nil, errors.New("No NUMA stat entries")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+	itv := interval.Seconds()
+
+	usage := new(NumaUsage)
+	usage.Interval = interval
+	usage.Nodes = make([]*NumaNodeUsage, 0, len(n2.Entries))
+
+	for _, e2 := range n2.Entries {
+		var e1 *NumaNodeStat = nil
+		for _, e := range n1.Entries {
+			if e.NodeId == e2.NodeId {
+				e1 = e
+				break
+			}
+		}
+		if e1 == nil {
+			continue
+		}
+
+		node_usage := &NumaNodeUsage{
+			NodeId:        e2.NodeId,
+			MemTotal:      e2.MemTotal,
+			MemUsed:       e2.MemUsed,
+			MemFree:       e2.MemFree,
+			FilePages:     e2.FilePages,
+			AnonPages:     e2.AnonPages,
+			Slab:          e2.Slab,
+			NumaHit:       avgDelta(e1.NumaHit, e2.NumaHit, itv),
+			NumaMiss:      avgDelta(e1.NumaMiss, e2.NumaMiss, itv),
+			NumaForeign:   avgDelta(e1.NumaForeign, e2.NumaForeign, itv),
+			InterleaveHit: avgDelta(e1.InterleaveHit, e2.InterleaveHit, itv),
+			LocalNode:     avgDelta(e1.LocalNode, e2.LocalNode, itv),
+			OtherNode:     avgDelta(e1.OtherNode, e2.OtherNode, itv),
+		}
+		if node_usage.NumaHit+node_usage.NumaMiss > 0.0 {
+			node_usage.MissRatio = node_usage.NumaMiss /
+				(node_usage.NumaHit + node_usage.NumaMiss) * 100.0
+		}
+		usage.Nodes = append(usage.Nodes, node_usage)
+	}
+
+	if len(usage.Nodes) == 0 {
+		return nil, errors.New("No NUMA stat entries")
+	}
+
+	return usage, nil
+}
+
+// GetNodeCpuUsage aggregates per-core usage into per-node usage according
+// to `node_cpus` (see LinuxHeader.NumaNodeCpus). As with CpuUsage.All, the
+// maximum of a node is 100% * the number of its cores. Cores beyond
+// cusage.NumCore are ignored.
+func GetNodeCpuUsage(cusage *CpuUsage, node_cpus map[int][]int) (map[int]*CpuCoreUsage, error) {
+	if cusage == nil || node_cpus == nil {
+		return nil, errors.New("No CPU usage or NUMA node map")
+	}
+
+	node_usages := make(map[int]*CpuCoreUsage)
+	for node_id, cpu_ids := range node_cpus {
+		node_usages[node_id] = sumCpuCoreUsages(cusage, cpu_ids)
+	}
+
+	return node_usages, nil
+}
+
+// sumCpuCoreUsages sums usage of the cores in `cpu_ids`. Cores beyond
+// cusage.NumCore are ignored.
+func sumCpuCoreUsages(cusage *CpuUsage, cpu_ids []int) *CpuCoreUsage {
+	sum := new(CpuCoreUsage)
+	for _, cpu_id := range cpu_ids {
+		if cpu_id < 0 || cpu_id >= len(cusage.CoreUsages) {
+			continue
+		}
+		core_usage := cusage.CoreUsages[cpu_id]
+		sum.User += core_usage.User
+		sum.Nice += core_usage.Nice
+		sum.Sys += core_usage.Sys
+		sum.Idle += core_usage.Idle
+		sum.Iowait += core_usage.Iowait
+		sum.Hardirq += core_usage.Hardirq
+		sum.Softirq += core_usage.Softirq
+		sum.Steal += core_usage.Steal
+		sum.Guest += core_usage.Guest
+		sum.GuestNice += core_usage.GuestNice
+	}
+
+	return sum
+}
+
+// GetCpuGroupUsage aggregates per-core usage by `group`, which is one of
+// "socket", "node" or "core" (physical core, i.e. SMT siblings), according
+// to `topology` (see LinuxHeader.CpuTopology). Groups are sorted by id.
+// CPUs whose id of the group is unknown, or which have no usage in `cusage`
+// (e.g. taken offline after the header was captured), are left out, so that
+// Cpus lists exactly the CPUs summed up.
+func GetCpuGroupUsage(cusage *CpuUsage, topology []LinuxCpuTopology, group string) ([]*CpuGroupUsage, error) {
+	if cusage == nil || topology == nil {
+		return nil, errors.New("No CPU usage or CPU topology")
+	}
+	if group != "socket" && group != "node" && group != "core" {
+		return nil, fmt.Errorf("unknown CPU group: %s", group)
+	}
+
+	type groupKey struct {
+		major int
+		minor int
+	}
+	keyOf := func(topo LinuxCpuTopology) (groupKey, string, bool) {
+		switch group {
+		case "socket":
+			return groupKey{topo.PackageId, 0}, fmt.Sprintf("socket%d", topo.PackageId),
+				topo.PackageId >= 0
+		case "node":
+			return groupKey{topo.NodeId, 0}, fmt.Sprintf("node%d", topo.NodeId),
+				topo.NodeId >= 0
+		default: // "core"
+			return groupKey{topo.PackageId, topo.CoreId},
+				fmt.Sprintf("socket%d/core%d", topo.PackageId, topo.CoreId),
+				topo.PackageId >= 0 && topo.CoreId >= 0
+		}
+	}
+
+	groups := make(map[groupKey]*CpuGroupUsage)
+	keys := []groupKey{}
+	for cpu_id, topo := range topology {
+		if cpu_id >= len(cusage.CoreUsages) {
+			continue
+		}
+		key, name, ok := keyOf(topo)
+		if !ok {
+			continue
+		}
+		gusage, ok := groups[key]
+		if !ok {
+			gusage = &CpuGroupUsage{name, []int{}, nil}
+			groups[key] = gusage
+			keys = append(keys, key)
+		}
+		gusage.Cpus = append(gusage.Cpus, cpu_id)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No CPU with known %s", group)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].major != keys[j].major {
+			return keys[i].major < keys[j].major
+		}
+		return keys[i].minor < keys[j].minor
+	})
+
+	usages := make([]*CpuGroupUsage, 0, len(keys))
+	for _, key := range keys {
+		gusage := groups[key]
+		gusage.Usage = sumCpuCoreUsages(cusage, gusage.Cpus)
+		usages = append(usages, gusage)
+	}
+
+	return usages, nil
+}
+
+func (gusage *CpuGroupUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("name")
+	printer.PutString(gusage.Name)
+	printer.PutKey("cpus")
+	printer.BeginArray()
+	for _, cpu_id := range gusage.Cpus {
+		printer.PutInt(cpu_id)
+	}
+	printer.FinishArray()
+	printer.PutKey("usage")
+	gusage.Usage.WriteJsonTo(printer)
+	printer.FinishObject()
+}
+
+// SetCpuUsage fills Cpu of each node with per-node aggregation of `cusage`.
+func (usage *NumaUsage) SetCpuUsage(cusage *CpuUsage, node_cpus map[int][]int) {
+	node_usages, err := GetNodeCpuUsage(cusage, node_cpus)
+	if err != nil {
+		return
+	}
+	for _, node := range usage.Nodes {
+		node.Cpu = node_usages[node.NodeId]
+	}
+}
+
+func (node *NumaNodeUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("node")
+	printer.PutInt(node.NodeId)
+	printer.PutKey("mem_total")
+	printer.PutInt64(node.MemTotal)
+	printer.PutKey("mem_used")
+	printer.PutInt64(node.MemUsed)
+	printer.PutKey("mem_free")
+	printer.PutInt64(node.MemFree)
+	printer.PutKey("file_pages")
+	printer.PutInt64(node.FilePages)
+	printer.PutKey("anon_pages")
+	printer.PutInt64(node.AnonPages)
+	printer.PutKey("slab")
+	printer.PutInt64(node.Slab)
+	printer.PutKey("numa_hit")
+	printer.PutFloatFmt(node.NumaHit, "%.2f")
+	printer.PutKey("numa_miss")
+	printer.PutFloatFmt(node.NumaMiss, "%.2f")
+	printer.PutKey("numa_foreign")
+	printer.PutFloatFmt(node.NumaForeign, "%.2f")
+	printer.PutKey("interleave_hit")
+	printer.PutFloatFmt(node.InterleaveHit, "%.2f")
+	printer.PutKey("local_node")
+	printer.PutFloatFmt(node.LocalNode, "%.2f")
+	printer.PutKey("other_node")
+	printer.PutFloatFmt(node.OtherNode, "%.2f")
+	printer.PutKey("miss_ratio")
+	printer.PutFloatFmt(node.MissRatio, "%.2f")
+	if node.Cpu != nil {
+		printer.PutKey("cpu")
+		node.Cpu.WriteJsonTo(printer)
+	}
+	printer.FinishObject()
+}
+
+func (usage *NumaUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("nodes")
+	printer.BeginArray()
+	for _, node := range usage.Nodes {
+		node.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+func GetFsUsage(t1 time.Time, f1 *FsStat, t2 time.Time, f2 *FsStat) (*FsUsage, error) {
+	if f1 == nil || f2 == nil || len(f1.Entries) == 0 || len(f2.Entries) == 0 {
+		return nil, errors.New("No filesystem stat entries")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+	itv := interval.Seconds()
+
+	usage := new(FsUsage)
+	usage.Interval = interval
+	usage.Mounts = make([]*FsUsageEntry, 0, len(f2.Entries))
+
+	for _, e2 := range f2.Entries {
+		var e1 *FsStatEntry = nil
+		for _, e := range f1.Entries {
+			if e.MountPoint == e2.MountPoint {
+				e1 = e
+				break
+			}
+		}
+		if e1 == nil {
+			continue
+		}
+
+		used1 := e1.TotalBytes - e1.FreeBytes
+		used2 := e2.TotalBytes - e2.FreeBytes
+		entry := &FsUsageEntry{
+			MountPoint:  e2.MountPoint,
+			Device:      e2.Device,
+			FsType:      e2.FsType,
+			TotalBytes:  e2.TotalBytes,
+			UsedBytes:   used2,
+			AvailBytes:  e2.AvailBytes,
+			TotalInodes: e2.TotalInodes,
+			UsedInodes:  e2.TotalInodes - e2.FreeInodes,
+			Growth:      avgDelta(used1, used2, itv),
+		}
+		if used2+e2.AvailBytes > 0 {
+			entry.UsedPct = float64(used2) / float64(used2+e2.AvailBytes) * 100.0
+		}
+		if e2.TotalInodes > 0 {
+			entry.UsedInodesPct = float64(entry.UsedInodes) / float64(e2.TotalInodes) * 100.0
+		}
+		if entry.Growth > 0.0 {
+			entry.FullIn = float64(e2.AvailBytes) / entry.Growth
+		}
+
+		usage.Mounts = append(usage.Mounts, entry)
+	}
+	sort.Slice(usage.Mounts, func(i, j int) bool {
+		return usage.Mounts[i].MountPoint < usage.Mounts[j].MountPoint
+	})
+
+	return usage, nil
+}
+
+func (entry *FsUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("mount_point")
+	printer.PutString(entry.MountPoint)
+	printer.PutKey("device")
+	printer.PutString(entry.Device)
+	printer.PutKey("fstype")
+	printer.PutString(entry.FsType)
+	printer.PutKey("total_mb")
+	printer.PutFloatFmt(float64(entry.TotalBytes)/1024.0/1024.0, "%.2f")
+	printer.PutKey("used_mb")
+	printer.PutFloatFmt(float64(entry.UsedBytes)/1024.0/1024.0, "%.2f")
+	printer.PutKey("avail_mb")
+	printer.PutFloatFmt(float64(entry.AvailBytes)/1024.0/1024.0, "%.2f")
+	printer.PutKey("used_pct")
+	printer.PutFloatFmt(entry.UsedPct, "%.2f")
+	printer.PutKey("inodes")
+	printer.PutInt64(entry.TotalInodes)
+	printer.PutKey("inodes_used")
+	printer.PutInt64(entry.UsedInodes)
+	printer.PutKey("inodes_used_pct")
+	printer.PutFloatFmt(entry.UsedInodesPct, "%.2f")
+	printer.PutKey("growth_mbps")
+	printer.PutFloatFmt(entry.Growth/1024.0/1024.0, "%.4f")
+	if entry.FullIn > 0.0 {
+		printer.PutKey("full_in")
+		printer.PutFloatFmt(entry.FullIn, "%.0f")
+	}
+	printer.FinishObject()
+}
+
+func (usage *FsUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("mounts")
+	printer.BeginArray()
+	for _, entry := range usage.Mounts {
+		entry.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+func findNfsOp(entry *NfsMountStatEntry, name string) *NfsOpStat {
+	for _, op := range entry.Ops {
+		if op.Name == name {
+			return op
+		}
+	}
+	return nil
+}
+
+func GetNfsUsage(t1 time.Time, n1 *NfsStat, t2 time.Time, n2 *NfsStat) (*NfsUsage, error) {
+	if n1 == nil || n2 == nil || len(n1.Entries) == 0 || len(n2.Entries) == 0 {
+		return nil, errors.New("No NFS stat entries")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+	itv := interval.Seconds()
+
+	usage := new(NfsUsage)
+	usage.Interval = interval
+	usage.Mounts = make([]*NfsMountUsage, 0, len(n2.Entries))
+
+	for _, e2 := range n2.Entries {
+		var e1 *NfsMountStatEntry = nil
+		for _, e := range n1.Entries {
+			if e.MountPoint == e2.MountPoint {
+				e1 = e
+				break
+			}
+		}
+		if e1 == nil {
+			continue
+		}
+
+		mount_usage := &NfsMountUsage{
+			MountPoint:    e2.MountPoint,
+			Device:        e2.Device,
+			FsType:        e2.FsType,
+			RdBytesPerSec: avgDelta(e1.ReadBytes, e2.ReadBytes, itv),
+			WrBytesPerSec: avgDelta(e1.WriteBytes, e2.WriteBytes, itv),
+			Ops:           make([]*NfsOpUsage, 0),
+		}
+
+		var ops, rtt, retrans, timeouts int64
+		for _, op2 := range e2.Ops {
+			// an operation not issued yet is not listed
+			op1 := findNfsOp(e1, op2.Name)
+			if op1 == nil {
+				op1 = &NfsOpStat{}
+			}
+			d_ops := op2.Ops - op1.Ops
+			if d_ops <= 0 {
+				continue
+			}
+
+			op_usage := &NfsOpUsage{
+				Name:    op2.Name,
+				Iops:    float64(d_ops) / itv,
+				Rtt:     float64(op2.Rtt-op1.Rtt) / float64(d_ops),
+				Execute: float64(op2.Execute-op1.Execute) / float64(d_ops),
+			}
+			mount_usage.Ops = append(mount_usage.Ops, op_usage)
+
+			switch op2.Name {
+			case "READ":
+				mount_usage.RdIops = op_usage.Iops
+				mount_usage.RdRtt = op_usage.Rtt
+				mount_usage.RdLatency = op_usage.Execute
+			case "WRITE":
+				mount_usage.WrIops = op_usage.Iops
+				mount_usage.WrRtt = op_usage.Rtt
+				mount_usage.WrLatency = op_usage.Execute
+			}
+
+			ops += d_ops
+			rtt += op2.Rtt - op1.Rtt
+			retrans += (op2.Trans - op2.Ops) - (op1.Trans - op1.Ops)
+			timeouts += op2.Timeouts - op1.Timeouts
+		}
+		mount_usage.Iops = float64(ops) / itv
+		if ops > 0 {
+			mount_usage.Rtt = float64(rtt) / float64(ops)
+		}
+		mount_usage.Retrans = float64(retrans) / itv
+		mount_usage.Timeouts = float64(timeouts) / itv
+		sort.SliceStable(mount_usage.Ops, func(i, j int) bool {
+			return mount_usage.Ops[i].Iops > mount_usage.Ops[j].Iops
+		})
+
+		usage.Mounts = append(usage.Mounts, mount_usage)
+	}
+	sort.Slice(usage.Mounts, func(i, j int) bool {
+		return usage.Mounts[i].MountPoint < usage.Mounts[j].MountPoint
+	})
+
+	return usage, nil
+}
+
+func (op *NfsOpUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("name")
+	printer.PutString(op.Name)
+	printer.PutKey("iops")
+	printer.PutFloatFmt(op.Iops, "%.2f")
+	printer.PutKey("rtt")
+	printer.PutFloatFmt(op.Rtt, "%.3f")
+	printer.PutKey("execute")
+	printer.PutFloatFmt(op.Execute, "%.3f")
+	printer.FinishObject()
+}
+
+func (mount *NfsMountUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("mount_point")
+	printer.PutString(mount.MountPoint)
+	printer.PutKey("device")
+	printer.PutString(mount.Device)
+	printer.PutKey("fstype")
+	printer.PutString(mount.FsType)
+	printer.PutKey("riops")
+	printer.PutFloatFmt(mount.RdIops, "%.2f")
+	printer.PutKey("wiops")
+	printer.PutFloatFmt(mount.WrIops, "%.2f")
+	printer.PutKey("iops")
+	printer.PutFloatFmt(mount.Iops, "%.2f")
+	printer.PutKey("rkbyteps")
+	printer.PutFloatFmt(mount.RdBytesPerSec/1024.0, "%.2f")
+	printer.PutKey("wkbyteps")
+	printer.PutFloatFmt(mount.WrBytesPerSec/1024.0, "%.2f")
+	printer.PutKey("rtt")
+	printer.PutFloatFmt(mount.Rtt, "%.3f")
+	printer.PutKey("rrtt")
+	printer.PutFloatFmt(mount.RdRtt, "%.3f")
+	printer.PutKey("wrtt")
+	printer.PutFloatFmt(mount.WrRtt, "%.3f")
+	printer.PutKey("rlatency")
+	printer.PutFloatFmt(mount.RdLatency, "%.3f")
+	printer.PutKey("wlatency")
+	printer.PutFloatFmt(mount.WrLatency, "%.3f")
+	printer.PutKey("retransps")
+	printer.PutFloatFmt(mount.Retrans, "%.2f")
+	printer.PutKey("timeoutps")
+	printer.PutFloatFmt(mount.Timeouts, "%.2f")
+	printer.PutKey("ops")
+	printer.BeginArray()
+	for _, op := range mount.Ops {
+		op.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+func (usage *NfsUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("mounts")
+	printer.BeginArray()
+	for _, mount := range usage.Mounts {
+		mount.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
+
+func GetVmUsage(t1 time.Time, v1 *VmStat, t2 time.Time, v2 *VmStat) (*VmUsage, error) {
+	if v1 == nil || v2 == nil {
+		return nil, errors.New("No vmstat")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+	itv := interval.Seconds()
+
+	usage := new(VmUsage)
+	usage.Interval = interval
+	usage.PgFault = float64(v2.PgFault-v1.PgFault) / itv
+	usage.PgMajFault = float64(v2.PgMajFault-v1.PgMajFault) / itv
+	usage.PswpIn = float64(v2.PswpIn-v1.PswpIn) / itv
+	usage.PswpOut = float64(v2.PswpOut-v1.PswpOut) / itv
+	usage.PgScanKswapd = float64(v2.PgScanKswapd-v1.PgScanKswapd) / itv
+	usage.PgScanDirect = float64(v2.PgScanDirect-v1.PgScanDirect) / itv
+	usage.PgScanKhugepaged = float64(v2.PgScanKhugepaged-v1.PgScanKhugepaged) / itv
+	usage.PgStealKswapd = float64(v2.PgStealKswapd-v1.PgStealKswapd) / itv
+	usage.PgStealDirect = float64(v2.PgStealDirect-v1.PgStealDirect) / itv
+	usage.PgStealKhugepaged = float64(v2.PgStealKhugepaged-v1.PgStealKhugepaged) / itv
+	usage.AllocStall = float64(v2.AllocStall-v1.AllocStall) / itv
+	usage.CompactStall = float64(v2.CompactStall-v1.CompactStall) / itv
+	usage.ThpFaultAlloc = float64(v2.ThpFaultAlloc-v1.ThpFaultAlloc) / itv
+	usage.ThpFaultFallback = float64(v2.ThpFaultFallback-v1.ThpFaultFallback) / itv
+	usage.ThpCollapseAlloc = float64(v2.ThpCollapseAlloc-v1.ThpCollapseAlloc) / itv
+	usage.ThpCollapseAllocFailed = float64(v2.ThpCollapseAllocFailed-v1.ThpCollapseAllocFailed) / itv
+	usage.ThpSplitPage = float64(v2.ThpSplitPage-v1.ThpSplitPage) / itv
+	usage.OomKill = float64(v2.OomKill-v1.OomKill) / itv
+
+	return usage, nil
+}
+
+func (vusage *VmUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("pgfault")
+	printer.PutFloatFmt(vusage.PgFault, "%.2f")
+	printer.PutKey("pgmajfault")
+	printer.PutFloatFmt(vusage.PgMajFault, "%.2f")
+	printer.PutKey("pswpin")
+	printer.PutFloatFmt(vusage.PswpIn, "%.2f")
+	printer.PutKey("pswpout")
+	printer.PutFloatFmt(vusage.PswpOut, "%.2f")
+	printer.PutKey("pgscan_kswapd")
+	printer.PutFloatFmt(vusage.PgScanKswapd, "%.2f")
+	printer.PutKey("pgscan_direct")
+	printer.PutFloatFmt(vusage.PgScanDirect, "%.2f")
+	printer.PutKey("pgscan_khugepaged")
+	printer.PutFloatFmt(vusage.PgScanKhugepaged, "%.2f")
+	printer.PutKey("pgsteal_kswapd")
+	printer.PutFloatFmt(vusage.PgStealKswapd, "%.2f")
+	printer.PutKey("pgsteal_direct")
+	printer.PutFloatFmt(vusage.PgStealDirect, "%.2f")
+	printer.PutKey("pgsteal_khugepaged")
+	printer.PutFloatFmt(vusage.PgStealKhugepaged, "%.2f")
+	printer.PutKey("allocstall")
+	printer.PutFloatFmt(vusage.AllocStall, "%.2f")
+	printer.PutKey("compact_stall")
+	printer.PutFloatFmt(vusage.CompactStall, "%.2f")
+	printer.PutKey("thp_fault_alloc")
+	printer.PutFloatFmt(vusage.ThpFaultAlloc, "%.2f")
+	printer.PutKey("thp_fault_fallback")
+	printer.PutFloatFmt(vusage.ThpFaultFallback, "%.2f")
+	printer.PutKey("thp_collapse_alloc")
+	printer.PutFloatFmt(vusage.ThpCollapseAlloc, "%.2f")
+	printer.PutKey("thp_collapse_alloc_failed")
+	printer.PutFloatFmt(vusage.ThpCollapseAllocFailed, "%.2f")
+	printer.PutKey("thp_split_page")
+	printer.PutFloatFmt(vusage.ThpSplitPage, "%.2f")
+	printer.PutKey("oom_kill")
+	printer.PutFloatFmt(vusage.OomKill, "%.2f")
+	printer.FinishObject()
+}
+
+// GetProcessUsage returns the usage of a process tree. `clock_ticks` is
+// USER_HZ, the unit of utime and stime (LinuxHeader.ClockTicks); 0 is taken
+// as 100.
+func GetProcessUsage(proc *ProcessStat, clock_ticks int64) (*ProcessUsage, error) {
+	if proc == nil || len(proc.Entries) == 0 {
+		return nil, errors.New("No process stat entries")
+	}
+	if clock_ticks <= 0 {
+		clock_ticks = 100
+	}
+	hz := float64(clock_ticks)
+
+	usage := new(ProcessUsage)
+	usage.NumProcs = len(proc.Entries)
+
+	for _, entry := range proc.Entries {
+		usage.Utime += float64(entry.Utime+entry.Cutime) / hz
+		usage.Stime += float64(entry.Stime+entry.Cstime) / hz
+		usage.MajFlt += entry.MajFlt + entry.CMajFlt
+		usage.Rss += entry.VmRSS
+		if entry.VmHWM > usage.PeakRss {
+			usage.PeakRss = entry.VmHWM
+		}
+		usage.ReadBytes += entry.ReadBytes
+		usage.WriteBytes += entry.WriteBytes
+		usage.VoluntaryCtxtSwitches += entry.VoluntaryCtxtSwitches
+		usage.NonvoluntaryCtxtSwitches += entry.NonvoluntaryCtxtSwitches
+	}
+	// VmHWM catches peaks between samples, but the tree as a whole may
+	// have been larger than any single process in it.
+	if usage.Rss > usage.PeakRss {
+		usage.PeakRss = usage.Rss
+	}
+
+	return usage, nil
+}
+
+// Merge updates each counter of pusage with the larger one of pusage and
+// other. Totals over a process tree can temporarily decrease when a process
+// exits before its parent waits for it, so the maximum over all samples is
+// the best estimate of the cumulative usage.
+func (pusage *ProcessUsage) Merge(other *ProcessUsage) {
+	maxFloat := func(dst *float64, v float64) {
+		if v > *dst {
+			*dst = v
+		}
+	}
+	maxInt := func(dst *int64, v int64) {
+		if v > *dst {
+			*dst = v
+		}
+	}
+
+	if other.NumProcs > pusage.NumProcs {
+		pusage.NumProcs = other.NumProcs
+	}
+	maxFloat(&pusage.Utime, other.Utime)
+	maxFloat(&pusage.Stime, other.Stime)
+	maxInt(&pusage.MajFlt, other.MajFlt)
+	maxInt(&pusage.Rss, other.Rss)
+	maxInt(&pusage.PeakRss, other.PeakRss)
+	maxInt(&pusage.ReadBytes, other.ReadBytes)
+	maxInt(&pusage.WriteBytes, other.WriteBytes)
+	maxInt(&pusage.VoluntaryCtxtSwitches, other.VoluntaryCtxtSwitches)
+	maxInt(&pusage.NonvoluntaryCtxtSwitches, other.NonvoluntaryCtxtSwitches)
+}
+
+func (pusage *ProcessUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("num_procs")
+	printer.PutInt(pusage.NumProcs)
+	printer.PutKey("utime")
+	printer.PutFloatFmt(pusage.Utime, "%.2f")
+	printer.PutKey("stime")
+	printer.PutFloatFmt(pusage.Stime, "%.2f")
+	printer.PutKey("majflt")
+	printer.PutInt64(pusage.MajFlt)
+	printer.PutKey("peak_rss")
+	printer.PutInt64(pusage.PeakRss)
+	printer.PutKey("read_bytes")
+	printer.PutInt64(pusage.ReadBytes)
+	printer.PutKey("write_bytes")
+	printer.PutInt64(pusage.WriteBytes)
+	printer.PutKey("voluntary_ctxt_switches")
+	printer.PutInt64(pusage.VoluntaryCtxtSwitches)
+	printer.PutKey("nonvoluntary_ctxt_switches")
+	printer.PutInt64(pusage.NonvoluntaryCtxtSwitches)
+	printer.FinishObject()
+}
+
+func getPressureUsageEntry(e1 *PressureStatEntry, e2 *PressureStatEntry, interval time.Duration) *PressureUsageEntry {
+	if e1 == nil || e2 == nil {
+		return nil
+	}
+
+	usec := float64(interval.Nanoseconds()) / 1000.0
+
+	entry := new(PressureUsageEntry)
+	entry.Some = 100.0 * float64(e2.SomeTotal-e1.SomeTotal) / usec
+	entry.Full = 100.0 * float64(e2.FullTotal-e1.FullTotal) / usec
+
+	return entry
+}
+
+func GetPressureUsage(t1 time.Time, p1 *PressureStat, t2 time.Time, p2 *PressureStat) (*PressureUsage, error) {
+	if p1 == nil || p2 == nil {
+		return nil, errors.New("No pressure stat")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+
+	usage := new(PressureUsage)
+	usage.Interval = interval
+	usage.Cpu = getPressureUsageEntry(p1.Cpu, p2.Cpu, interval)
+	usage.Io = getPressureUsageEntry(p1.Io, p2.Io, interval)
+	usage.Memory = getPressureUsageEntry(p1.Memory, p2.Memory, interval)
+
+	if usage.Cpu == nil && usage.Io == nil && usage.Memory == nil {
+		return nil, errors.New("No pressure stat entries")
+	}
+
+	return usage, nil
+}
+
+func (entry *PressureUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("some")
+	printer.PutFloatFmt(entry.Some, "%.2f")
+	printer.PutKey("full")
+	printer.PutFloatFmt(entry.Full, "%.2f")
+	printer.FinishObject()
+}
+
+func (pusage *PressureUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	if pusage.Cpu != nil {
+		printer.PutKey("cpu")
+		pusage.Cpu.WriteJsonTo(printer)
+	}
+	if pusage.Io != nil {
+		printer.PutKey("io")
+		pusage.Io.WriteJsonTo(printer)
+	}
+	if pusage.Memory != nil {
+		printer.PutKey("memory")
+		pusage.Memory.WriteJsonTo(printer)
+	}
+	printer.FinishObject()
+}
+
+func GetCgroupUsage(t1 time.Time, c1 *CgroupStat, t2 time.Time, c2 *CgroupStat) (*CgroupUsage, error) {
+	if c1 == nil || c2 == nil {
+		return nil, errors.New("No cgroup stat")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+
+	prev_entries := make(map[string]*CgroupStatEntry)
+	for _, entry := range c1.Entries {
+		prev_entries[entry.Path] = entry
+	}
+
+	usage := make(CgroupUsage)
+	usec := float64(interval.Nanoseconds()) / 1000.0
+	secs := interval.Seconds()
+
+	for _, e2 := range c2.Entries {
+		e1, ok := prev_entries[e2.Path]
+		if !ok {
+			continue
+		}
+
+		entry := new(CgroupUsageEntry)
+		entry.Interval = interval
+		entry.Cpu = 100.0 * float64(e2.UsageUsec-e1.UsageUsec) / usec
+		entry.Usr = 100.0 * float64(e2.UserUsec-e1.UserUsec) / usec
+		entry.Sys = 100.0 * float64(e2.SystemUsec-e1.SystemUsec) / usec
+		entry.Throttled = 100.0 * float64(e2.ThrottledUsec-e1.ThrottledUsec) / usec
+		entry.NrThrottled = e2.NrThrottled - e1.NrThrottled
+		entry.MemCurrent = e2.MemoryCurrent / 1024
+		entry.MemAnon = e2.MemAnon / 1024
+		entry.MemFile = e2.MemFile / 1024
+		entry.PgMajFault = avgDelta(e1.MemPgMajFault, e2.MemPgMajFault, secs)
+		entry.RdBytesPerSec = avgDelta(e1.IoRbytes, e2.IoRbytes, secs)
+		entry.WrBytesPerSec = avgDelta(e1.IoWbytes, e2.IoWbytes, secs)
+		entry.RdIops = avgDelta(e1.IoRios, e2.IoRios, secs)
+		entry.WrIops = avgDelta(e1.IoWios, e2.IoWios, secs)
+		entry.CpuPressure = getPressureUsageEntry(e1.CpuPressure, e2.CpuPressure, interval)
+		entry.IoPressure = getPressureUsageEntry(e1.IoPressure, e2.IoPressure, interval)
+
+		usage[e2.Path] = entry
+	}
+
+	if len(usage) == 0 {
+		return nil, errors.New("No cgroup stat entries")
+	}
+
+	return &usage, nil
+}
+
+func (entry *CgroupUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("cpu")
+	printer.PutFloatFmt(entry.Cpu, "%.2f")
+	printer.PutKey("usr")
+	printer.PutFloatFmt(entry.Usr, "%.2f")
+	printer.PutKey("sys")
+	printer.PutFloatFmt(entry.Sys, "%.2f")
+	printer.PutKey("throttled")
+	printer.PutFloatFmt(entry.Throttled, "%.2f")
+	printer.PutKey("nr_throttled")
+	printer.PutInt64(entry.NrThrottled)
+	printer.PutKey("mem_current")
+	printer.PutInt64(entry.MemCurrent)
+	printer.PutKey("mem_anon")
+	printer.PutInt64(entry.MemAnon)
+	printer.PutKey("mem_file")
+	printer.PutInt64(entry.MemFile)
+	printer.PutKey("pgmajfault")
+	printer.PutFloatFmt(entry.PgMajFault, "%.2f")
+	printer.PutKey("rbyteps")
+	printer.PutFloatFmt(entry.RdBytesPerSec, "%.2f")
+	printer.PutKey("wbyteps")
+	printer.PutFloatFmt(entry.WrBytesPerSec, "%.2f")
+	printer.PutKey("riops")
+	printer.PutFloatFmt(entry.RdIops, "%.2f")
+	printer.PutKey("wiops")
+	printer.PutFloatFmt(entry.WrIops, "%.2f")
+	if entry.CpuPressure != nil {
+		printer.PutKey("cpu_pressure")
+		entry.CpuPressure.WriteJsonTo(printer)
+	}
+	if entry.IoPressure != nil {
+		printer.PutKey("io_pressure")
+		entry.IoPressure.WriteJsonTo(printer)
+	}
+	printer.FinishObject()
+}
+
+func (cusage *CgroupUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	var paths []string
+
+	for path, _ := range *cusage {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	printer.BeginObject()
+	printer.PutKey("cgroups")
+	printer.BeginArray()
+	for _, path := range paths {
+		printer.PutString(path)
+	}
+	printer.FinishArray()
+
+	for _, path := range paths {
+		printer.PutKey(path)
+		(*cusage)[path].WriteJsonTo(printer)
+	}
+
+	printer.FinishObject()
+}
+
+func GetProcUsage(t1 time.Time, p1 *ProcStat, t2 time.Time, p2 *ProcStat) (*ProcUsage, error) {
+	if p1 == nil || p2 == nil {
+		return nil, errors.New("No proc stat")
+	}
+
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return nil, errors.New("negative interval")
+	}
+
+	usage := new(ProcUsage)
+	usage.Interval = interval
+	usage.ContextSwitch = avgDelta(p1.ContextSwitch, p2.ContextSwitch, interval.Seconds())
+	usage.Fork = avgDelta(p1.Fork, p2.Fork, interval.Seconds())
+	usage.LoadAvg = p2.LoadAvg
+	if p1.HasProcsRunning && p2.HasProcsRunning {
+		usage.HasProcsRunning = true
+		usage.Interrupt = avgDelta(p1.Interrupt, p2.Interrupt, interval.Seconds())
+		usage.ProcsRunning = p2.ProcsRunning
+		usage.ProcsBlocked = p2.ProcsBlocked
 	}
 
-	if total_rd_ios > 0 {
-		total.RdLatency /= float64(total_rd_ios)
-		total.AvgRdSize /= float64(total_rd_ios)
+	return usage, nil
+}
+
+func (pusage *ProcUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("ctxtps")
+	printer.PutFloatFmt(pusage.ContextSwitch, "%.2f")
+	printer.PutKey("forkps")
+	printer.PutFloatFmt(pusage.Fork, "%.2f")
+	if pusage.HasProcsRunning {
+		printer.PutKey("intrps")
+		printer.PutFloatFmt(pusage.Interrupt, "%.2f")
+		printer.PutKey("procs_running")
+		printer.PutInt64(pusage.ProcsRunning)
+		printer.PutKey("procs_blocked")
+		printer.PutInt64(pusage.ProcsBlocked)
 	}
-	if total_wr_ios > 0 {
-		total.WrLatency /= float64(total_wr_ios)
-		total.AvgWrSize /= float64(total_wr_ios)
+	if pusage.LoadAvg != nil {
+		printer.PutKey("loadavg1")
+		printer.PutFloatFmt(pusage.LoadAvg.Load1, "%.2f")
+		printer.PutKey("loadavg5")
+		printer.PutFloatFmt(pusage.LoadAvg.Load5, "%.2f")
+		printer.PutKey("loadavg15")
+		printer.PutFloatFmt(pusage.LoadAvg.Load15, "%.2f")
+		printer.PutKey("nr_running")
+		printer.PutInt64(pusage.LoadAvg.NrRunning)
+		printer.PutKey("nr_threads")
+		printer.PutInt64(pusage.LoadAvg.NrThreads)
+	}
+	printer.FinishObject()
+}
+
+func (cfusage *CpuCoreFreqUsage) add(khz int64) {
+	if khz <= 0 {
+		return
 	}
 
-	(*usage)["total"] = total
+	mhz := float64(khz) / 1000.0
+	if cfusage.NumSamples == 0 || mhz < cfusage.Min {
+		cfusage.Min = mhz
+	}
+	if cfusage.NumSamples == 0 || mhz > cfusage.Max {
+		cfusage.Max = mhz
+	}
+	cfusage.NumSamples++
+	cfusage.sum += mhz
+	cfusage.Avg = cfusage.sum / float64(cfusage.NumSamples)
+}
+
+// NewCpuFreqUsage returns empty statistics to which samples are added with
+// CpuFreqUsage.Add.
+func NewCpuFreqUsage(num_core int) *CpuFreqUsage {
+	usage := new(CpuFreqUsage)
+	usage.NumCore = num_core
+	usage.All = new(CpuCoreFreqUsage)
+	usage.CoreFreqUsages = make([]*CpuCoreFreqUsage, num_core)
+	for idx, _ := range usage.CoreFreqUsages {
+		usage.CoreFreqUsages[idx] = new(CpuCoreFreqUsage)
+	}
+
+	return usage
+}
+
+// GetCpuFreqUsage returns frequency statistics over the two samples. More
+// samples can be accumulated with CpuFreqUsage.Add.
+func GetCpuFreqUsage(f1 *CpuFreqStat, f2 *CpuFreqStat) (*CpuFreqUsage, error) {
+	if f1 == nil || f2 == nil {
+		return nil, errors.New("No cpufreq stat")
+	}
+	if f1.NumCore == 0 || f1.NumCore != f2.NumCore {
+		return nil, errors.New("Invalid cpufreq stat")
+	}
+
+	usage := NewCpuFreqUsage(f1.NumCore)
+	usage.Add(f1)
+	usage.Add(f2)
 
 	return usage, nil
 }
 
-func usageItem(v1 int64, v2 int64, itv int64) float64 {
-	return float64(v2-v1) / float64(itv) * 100.0
+// Add accumulates another sample into the statistics.
+func (usage *CpuFreqUsage) Add(freq *CpuFreqStat) error {
+	if freq == nil || freq.NumCore != usage.NumCore {
+		return errors.New("Invalid cpufreq stat")
+	}
+
+	for idx, khz := range freq.CoreFreqs {
+		usage.CoreFreqUsages[idx].add(khz)
+		usage.All.add(khz)
+	}
+
+	return nil
 }
 
-func GetNetUsage(t1 time.Time, d1 *NetStat, t2 time.Time, d2 *NetStat) (*NetUsage, error) {
-	if len(d1.Entries) == 0 && len(d2.Entries) == 0 {
-		return nil, errors.New("no entries")
+func (cfusage *CpuCoreFreqUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("avg")
+	printer.PutFloatFmt(cfusage.Avg, "%.2f")
+	printer.PutKey("min")
+	printer.PutFloatFmt(cfusage.Min, "%.2f")
+	printer.PutKey("max")
+	printer.PutFloatFmt(cfusage.Max, "%.2f")
+	printer.FinishObject()
+}
+
+func (tsusage *ThermalSensorUsage) add(millicelsius int64) {
+	if millicelsius == 0 {
+		return
 	}
 
-	interval := t2.Sub(t1)
-	itv := interval.Seconds()
+	temp := float64(millicelsius) / 1000.0
+	if tsusage.NumSamples == 0 || temp < tsusage.Min {
+		tsusage.Min = temp
+	}
+	if tsusage.NumSamples == 0 || temp > tsusage.Max {
+		tsusage.Max = temp
+	}
+	tsusage.Temp = temp
+	tsusage.NumSamples++
+	tsusage.sum += temp
+	tsusage.Avg = tsusage.sum / float64(tsusage.NumSamples)
+}
 
-	if itv <= 0 {
-		return nil, errors.New("Non-positive interval")
+// NewThermalUsage returns empty statistics of `sensors`, normally
+// LinuxHeader.Sensors, to which samples are added with ThermalUsage.Add.
+func NewThermalUsage(sensors []LinuxSensor) *ThermalUsage {
+	usage := new(ThermalUsage)
+	usage.Sensors = make([]*ThermalSensorUsage, len(sensors))
+	for idx, sensor := range sensors {
+		usage.Sensors[idx] = &ThermalSensorUsage{Name: sensor.Name}
 	}
 
-	net_usage := new(NetUsage)
-	(*net_usage) = make(NetUsage)
-	total := new(NetUsageEntry)
+	return usage
+}
 
-	for _, d1_entry := range d1.Entries {
-		devname := d1_entry.Name
+// GetThermalUsage returns temperature statistics over the two samples. More
+// samples can be accumulated with ThermalUsage.Add.
+func GetThermalUsage(sensors []LinuxSensor, t1 *ThermalStat, t2 *ThermalStat) (*ThermalUsage, error) {
+	if t1 == nil || t2 == nil {
+		return nil, errors.New("No thermal stat")
+	}
+	if len(sensors) == 0 || len(t1.Temps) != len(sensors) || len(t2.Temps) != len(sensors) {
+		return nil, errors.New("Invalid thermal stat")
+	}
 
-		// find devname in d2
-		var d2_entry *NetStatEntry = nil
-		for _, e := range d2.Entries {
-			if e.Name == devname {
-				d2_entry = e
-				break
-			}
-		}
+	usage := NewThermalUsage(sensors)
+	usage.Add(t1)
+	usage.Add(t2)
 
-		if d2_entry == nil {
+	return usage, nil
+}
+
+// Add accumulates another sample into the statistics.
+func (usage *ThermalUsage) Add(thermal *ThermalStat) error {
+	if thermal == nil || len(thermal.Temps) != len(usage.Sensors) {
+		return errors.New("Invalid thermal stat")
+	}
+
+	for idx, millicelsius := range thermal.Temps {
+		usage.Sensors[idx].add(millicelsius)
+	}
+
+	return nil
+}
+
+func (tsusage *ThermalSensorUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("name")
+	printer.PutString(tsusage.Name)
+	printer.PutKey("temp")
+	printer.PutFloatFmt(tsusage.Temp, "%.1f")
+	printer.PutKey("avg")
+	printer.PutFloatFmt(tsusage.Avg, "%.1f")
+	printer.PutKey("min")
+	printer.PutFloatFmt(tsusage.Min, "%.1f")
+	printer.PutKey("max")
+	printer.PutFloatFmt(tsusage.Max, "%.1f")
+	printer.FinishObject()
+}
+
+func (usage *ThermalUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("sensors")
+	printer.BeginArray()
+	for _, tsusage := range usage.Sensors {
+		if tsusage.NumSamples == 0 {
 			continue
 		}
+		tsusage.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
 
-		ue := new(NetUsageEntry)
+func (edusage *EnergyDomainUsage) add(microjoules int64, itv float64) {
+	edusage.Joules += float64(microjoules) / 1000000.0
+	edusage.elapsed += itv
+	edusage.NumIntervals++
+	edusage.Watts = edusage.Joules / edusage.elapsed
+}
 
-		ue.Interval = interval
-		ue.RxBytesPerSec = avgDelta(d1_entry.RxBytes, d2_entry.RxBytes, itv)
-		ue.RxPacketsPerSec = avgDelta(d1_entry.RxPackets, d2_entry.RxPackets, itv)
-		ue.RxErrorsPerSec = avgDelta(d1_entry.RxErrors, d2_entry.RxErrors, itv)
-		ue.RxDropsPerSec = avgDelta(d1_entry.RxDrops, d2_entry.RxDrops, itv)
-		ue.RxFifoPerSec = avgDelta(d1_entry.RxFifo, d2_entry.RxFifo, itv)
-		ue.RxFramePerSec = avgDelta(d1_entry.RxFrame, d2_entry.RxFrame, itv)
-		ue.RxCompressedPerSec = avgDelta(d1_entry.RxCompressed, d2_entry.RxCompressed, itv)
-		ue.RxMulticastPerSec = avgDelta(d1_entry.RxMulticast, d2_entry.RxMulticast, itv)
-		ue.TxBytesPerSec = avgDelta(d1_entry.TxBytes, d2_entry.TxBytes, itv)
-		ue.TxPacketsPerSec = avgDelta(d1_entry.TxPackets, d2_entry.TxPackets, itv)
-		ue.TxErrorsPerSec = avgDelta(d1_entry.TxErrors, d2_entry.TxErrors, itv)
-		ue.TxDropsPerSec = avgDelta(d1_entry.TxDrops, d2_entry.TxDrops, itv)
-		ue.TxFifoPerSec = avgDelta(d1_entry.TxFifo, d2_entry.TxFifo, itv)
-		ue.TxFramePerSec = avgDelta(d1_entry.TxFrame, d2_entry.TxFrame, itv)
-		ue.TxCompressedPerSec = avgDelta(d1_entry.TxCompressed, d2_entry.TxCompressed, itv)
-		ue.TxMulticastPerSec = avgDelta(d1_entry.TxMulticast, d2_entry.TxMulticast, itv)
+// NewEnergyUsage returns empty statistics of `domains`, normally
+// LinuxHeader.PowerDomains, to which intervals are added with
+// EnergyUsage.Add.
+func NewEnergyUsage(domains []LinuxPowerDomain) *EnergyUsage {
+	usage := new(EnergyUsage)
+	usage.Domains = make([]*EnergyDomainUsage, len(domains))
+	usage.total_idxs = []int{}
+	usage.max_ranges = make([]int64, len(domains))
+	psys_idx := -1
+	for idx, domain := range domains {
+		usage.Domains[idx] = &EnergyDomainUsage{Name: domain.Name}
+		usage.max_ranges[idx] = domain.MaxEnergyRange
+		if domain.Parent == "" && domain.Zone == "psys" {
+			psys_idx = idx
+		} else if domain.Parent == "" || domain.Zone == "dram" {
+			usage.total_idxs = append(usage.total_idxs, idx)
+		}
+	}
+	if len(usage.total_idxs) == 0 && psys_idx >= 0 {
+		usage.total_idxs = append(usage.total_idxs, psys_idx)
+	}
+	if len(usage.total_idxs) > 0 {
+		usage.Total = &EnergyDomainUsage{Name: "total"}
+	}
 
-		(*net_usage)[devname] = ue
+	return usage
+}
 
-		total.RxBytesPerSec += ue.RxBytesPerSec
-		total.RxPacketsPerSec += ue.RxPacketsPerSec
-		total.RxErrorsPerSec += ue.RxErrorsPerSec
-		total.RxDropsPerSec += ue.RxDropsPerSec
-		total.RxFifoPerSec += ue.RxFifoPerSec
-		total.RxFramePerSec += ue.RxFramePerSec
-		total.RxCompressedPerSec += ue.RxCompressedPerSec
-		total.RxMulticastPerSec += ue.RxMulticastPerSec
-		total.TxBytesPerSec += ue.TxBytesPerSec
-		total.TxPacketsPerSec += ue.TxPacketsPerSec
-		total.TxErrorsPerSec += ue.TxErrorsPerSec
-		total.TxDropsPerSec += ue.TxDropsPerSec
-		total.TxFifoPerSec += ue.TxFifoPerSec
-		total.TxFramePerSec += ue.TxFramePerSec
-		total.TxCompressedPerSec += ue.TxCompressedPerSec
-		total.TxMulticastPerSec += ue.TxMulticastPerSec
+// GetEnergyUsage returns energy consumption between the two samples. Only
+// a single wraparound of each counter can be detected in between, so a long
+// period should be accumulated interval by interval with EnergyUsage.Add.
+func GetEnergyUsage(domains []LinuxPowerDomain, t1 time.Time, e1 *EnergyStat, t2 time.Time, e2 *EnergyStat) (*EnergyUsage, error) {
+	usage := NewEnergyUsage(domains)
+	if err := usage.Add(t1, e1, t2, e2); err != nil {
+		return nil, err
 	}
 
-	(*net_usage)["total"] = total
-
-	return net_usage, nil
+	return usage, nil
 }
 
-func (nusage *NetUsage) WriteJsonTo(printer *projson.JsonPrinter) {
-	var devices []string
+// Add accumulates energy consumed in another interval. A counter smaller
+// than the previous one is taken as wrapped around at max_energy_range_uj.
+func (usage *EnergyUsage) Add(t1 time.Time, e1 *EnergyStat, t2 time.Time, e2 *EnergyStat) error {
+	if e1 == nil || e2 == nil {
+		return errors.New("No energy stat")
+	}
+	if len(usage.Domains) == 0 || len(e1.Energy) != len(usage.Domains) || len(e2.Energy) != len(usage.Domains) {
+		return errors.New("Invalid energy stat")
+	}
 
-	for device, _ := range *nusage {
-		if device != "total" {
-			devices = append(devices, device)
+	interval := t2.Sub(t1)
+	if interval.Seconds() <= 0.0 {
+		return errors.New("negative interval")
+	}
+	itv := interval.Seconds()
+	usage.Interval += interval
+
+	deltas := make([]int64, len(usage.Domains))
+	for idx := range usage.Domains {
+		deltas[idx] = -1
+		if e1.Energy[idx] < 0 || e2.Energy[idx] < 0 {
+			continue
+		}
+		delta := e2.Energy[idx] - e1.Energy[idx]
+		if delta < 0 {
+			if usage.max_ranges[idx] <= 0 {
+				continue
+			}
+			delta += usage.max_ranges[idx]
 		}
+		deltas[idx] = delta
+		usage.Domains[idx].add(delta, itv)
 	}
-	sort.Strings(devices)
 
+	if usage.Total != nil {
+		var total int64 = 0
+		for _, idx := range usage.total_idxs {
+			if deltas[idx] < 0 {
+				return nil
+			}
+			total += deltas[idx]
+		}
+		usage.Total.add(total, itv)
+	}
+
+	return nil
+}
+
+func (edusage *EnergyDomainUsage) WriteJsonTo(printer *projson.JsonPrinter) {
 	printer.BeginObject()
-	printer.PutKey("devices")
+	printer.PutKey("name")
+	printer.PutString(edusage.Name)
+	printer.PutKey("joules")
+	printer.PutFloatFmt(edusage.Joules, "%.3f")
+	printer.PutKey("watts")
+	printer.PutFloatFmt(edusage.Watts, "%.3f")
+	printer.FinishObject()
+}
+
+func (usage *EnergyUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("domains")
 	printer.BeginArray()
-	for _, device := range devices {
-		printer.PutString(device)
+	for _, edusage := range usage.Domains {
+		if edusage.NumIntervals == 0 {
+			continue
+		}
+		edusage.WriteJsonTo(printer)
 	}
 	printer.FinishArray()
+	if usage.Total != nil && usage.Total.NumIntervals > 0 {
+		printer.PutKey("total")
+		usage.Total.WriteJsonTo(printer)
+	}
+	printer.FinishObject()
+}
 
-	devices = append(devices, "total")
+// CustomSeriesName returns the name of the series of `key` reported by the
+// command of `metric`.
+func CustomSeriesName(metric string, key string) string {
+	if key == "" {
+		return metric
+	}
+	return metric + "." + key
+}
 
-	for _, device := range devices {
-		usage := (*nusage)[device]
+func (csusage *CustomSeriesUsage) addValue(value float64, t time.Time) {
+	if csusage.NumSamples == 0 || value < csusage.Min {
+		csusage.Min = value
+	}
+	if csusage.NumSamples == 0 || value > csusage.Max {
+		csusage.Max = value
+	}
+	csusage.Time = t
+	csusage.NumSamples++
+	csusage.sum += value
+	csusage.Avg = csusage.sum / float64(csusage.NumSamples)
+}
 
-		printer.PutKey(device)
-		usage.WriteJsonTo(printer)
+// addRate counts the increase from `v1` to `v2` in `itv` seconds. A counter
+// smaller than the previous one is taken as reset to 0 in between.
+func (csusage *CustomSeriesUsage) addRate(v1 float64, v2 float64, itv float64, t time.Time) {
+	if itv <= 0.0 {
+		return
+	}
+	delta := v2 - v1
+	if delta < 0 {
+		delta = v2
+	}
+
+	rate := delta / itv
+	if csusage.NumSamples == 0 || rate < csusage.Min {
+		csusage.Min = rate
+	}
+	if csusage.NumSamples == 0 || rate > csusage.Max {
+		csusage.Max = rate
+	}
+	csusage.Rate = rate
+	csusage.Time = t
+	csusage.NumSamples++
+	csusage.Total += delta
+	csusage.elapsed += itv
+	csusage.Avg = csusage.Total / csusage.elapsed
+}
+
+// NewCustomUsage returns empty statistics of `metrics` and `rates`,
+// normally LinuxHeader.CustomMetrics and CustomRates, to which records are
+// added with CustomUsage.Add.
+func NewCustomUsage(metrics []LinuxCustomMetric, rates []string) *CustomUsage {
+	usage := new(CustomUsage)
+	usage.Series = []*CustomSeriesUsage{}
+	usage.metrics = metrics
+	usage.rates = rates
+	usage.index = make(map[string]*CustomSeriesUsage)
+
+	return usage
+}
+
+// GetCustomUsage returns statistics of the values reported between the two
+// records. `c1` may be nil if `c2` is the first record.
+func GetCustomUsage(metrics []LinuxCustomMetric, rates []string, c1 *CustomStat, c2 *CustomStat) (*CustomUsage, error) {
+	usage := NewCustomUsage(metrics, rates)
+	if err := usage.Add(c1, c2); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+func (usage *CustomUsage) series(metric int, key string) *CustomSeriesUsage {
+	name := CustomSeriesName(usage.metrics[metric].Name, key)
+	if csusage, ok := usage.index[name]; ok {
+		return csusage
+	}
+
+	csusage := &CustomSeriesUsage{Name: name, Metric: usage.metrics[metric].Name, metric: metric, key: key}
+	for _, pattern := range usage.rates {
+		if matched, _ := path.Match(pattern, name); matched {
+			csusage.Counter = true
+			break
+		}
+	}
+	usage.index[name] = csusage
+	usage.Series = append(usage.Series, csusage)
+	sort.Slice(usage.Series, func(i, j int) bool {
+		if usage.Series[i].metric != usage.Series[j].metric {
+			return usage.Series[i].metric < usage.Series[j].metric
+		}
+		return usage.Series[i].key < usage.Series[j].key
+	})
+
+	return csusage
+}
+
+// Add accumulates the values reported after the record `c1` up to the
+// record `c2`. `c1` may be nil if `c2` is the first record, in which case
+// counters only get their values.
+func (usage *CustomUsage) Add(c1 *CustomStat, c2 *CustomStat) error {
+	if c2 == nil {
+		return errors.New("No custom stat")
+	}
+	if len(c2.Samples) != len(usage.metrics) || (c1 != nil && len(c1.Samples) != len(usage.metrics)) {
+		return errors.New("Invalid custom stat")
+	}
+
+	for idx, s2 := range c2.Samples {
+		if s2.Time.IsZero() {
+			continue
+		}
+		var s1 *CustomMetricSample = nil
+		if c1 != nil && !c1.Samples[idx].Time.IsZero() {
+			s1 = &c1.Samples[idx]
+		}
+		reported := s1 == nil || s2.Time.After(s1.Time)
+
+		for key, value := range s2.Values {
+			csusage := usage.series(idx, key)
+			csusage.Value = value
+			if !reported {
+				continue
+			}
+			if !csusage.Counter {
+				csusage.addValue(value, s2.Time)
+			} else if s1 != nil {
+				if prev, ok := s1.Values[key]; ok {
+					csusage.addRate(prev, value, s2.Time.Sub(s1.Time).Seconds(), s2.Time)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (csusage *CustomSeriesUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("name")
+	printer.PutString(csusage.Name)
+	printer.PutKey("value")
+	printer.PutFloat(csusage.Value)
+	if csusage.NumSamples > 0 {
+		if csusage.Counter {
+			printer.PutKey("rate")
+			printer.PutFloatFmt(csusage.Rate, "%.3f")
+			printer.PutKey("total")
+			printer.PutFloat(csusage.Total)
+		}
+		printer.PutKey("avg")
+		printer.PutFloatFmt(csusage.Avg, "%.3f")
+		printer.PutKey("min")
+		printer.PutFloatFmt(csusage.Min, "%.3f")
+		printer.PutKey("max")
+		printer.PutFloatFmt(csusage.Max, "%.3f")
+	}
+	printer.FinishObject()
+}
+
+func (usage *CustomUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("series")
+	printer.BeginArray()
+	for _, csusage := range usage.Series {
+		csusage.WriteJsonTo(printer)
 	}
+	printer.FinishArray()
+	printer.FinishObject()
+}
 
+func (usage *CpuFreqUsage) WriteJsonTo(printer *projson.JsonPrinter) {
+	printer.BeginObject()
+	printer.PutKey("num_core")
+	printer.PutInt(usage.NumCore)
+	printer.PutKey("all")
+	usage.All.WriteJsonTo(printer)
+	printer.PutKey("cores")
+	printer.BeginArray()
+	for _, cfusage := range usage.CoreFreqUsages {
+		cfusage.WriteJsonTo(printer)
+	}
+	printer.FinishArray()
+	if usage.Governors != nil {
+		printer.PutKey("governors")
+		printer.BeginArray()
+		for _, governor := range usage.Governors {
+			printer.PutString(governor)
+		}
+		printer.FinishArray()
+	}
 	printer.FinishObject()
 }
 
@@ -586,6 +3416,34 @@ func GetMemUsage(mem *MemStat) (*MemUsage, error) {
 	musage := new(MemUsage)
 	musage.mem = mem
 
+	reclaimable_kernel := mem.SReclaimable
+	if mem.HasMemAvailable {
+		musage.Available = mem.MemAvailable
+		musage.Anon = mem.ActiveAnon + mem.InactiveAnon
+		musage.File = mem.ActiveFile + mem.InactiveFile
+		if mem.KReclaimable > 0 {
+			reclaimable_kernel = mem.KReclaimable
+		}
+	} else {
+		musage.Available = mem.MemFree + mem.Buffers + mem.Cached + mem.SReclaimable
+		musage.Anon = mem.AnonPages
+		musage.File = mem.Buffers + mem.Cached
+	}
+	musage.Used = mem.MemTotal - musage.Available
+	musage.SwapUsed = mem.SwapTotal - mem.SwapFree
+
+	pct := func(val int64, total int64) float64 {
+		if total <= 0 {
+			return 0.0
+		}
+		return float64(val) / float64(total) * 100.0
+	}
+	musage.AvailablePct = pct(musage.Available, mem.MemTotal)
+	musage.ReclaimablePct = pct(musage.File+reclaimable_kernel, mem.MemTotal)
+	musage.AnonPct = pct(musage.Anon, mem.MemTotal)
+	musage.FilePct = pct(musage.File, mem.MemTotal)
+	musage.SwapUsedPct = pct(musage.SwapUsed, mem.SwapTotal)
+
 	return musage, nil
 }
 
@@ -595,7 +3453,7 @@ func (musage *MemUsage) WriteJsonTo(printer *projson.JsonPrinter) {
 	printer.PutKey("mem_total")
 	printer.PutInt64(musage.mem.MemTotal)
 	printer.PutKey("mem_used")
-	printer.PutInt64(musage.mem.MemTotal - musage.mem.MemFree - musage.mem.Buffers - musage.mem.Cached - musage.mem.SReclaimable)
+	printer.PutInt64(musage.Used)
 	printer.PutKey("mem_free")
 	printer.PutInt64(musage.mem.MemFree)
 	printer.PutKey("buffers")
@@ -651,6 +3509,67 @@ func (musage *MemUsage) WriteJsonTo(printer *projson.JsonPrinter) {
 	printer.PutKey("huge_pages_surp")
 	printer.PutInt64(musage.mem.HugePages_Surp)
 
+	if musage.mem.HasMemAvailable {
+		printer.PutKey("mem_available")
+		printer.PutInt64(musage.mem.MemAvailable)
+		printer.PutKey("active_anon")
+		printer.PutInt64(musage.mem.ActiveAnon)
+		printer.PutKey("inactive_anon")
+		printer.PutInt64(musage.mem.InactiveAnon)
+		printer.PutKey("active_file")
+		printer.PutInt64(musage.mem.ActiveFile)
+		printer.PutKey("inactive_file")
+		printer.PutInt64(musage.mem.InactiveFile)
+		printer.PutKey("k_reclaimable")
+		printer.PutInt64(musage.mem.KReclaimable)
+		printer.PutKey("percpu")
+		printer.PutInt64(musage.mem.Percpu)
+		printer.PutKey("zswap")
+		printer.PutInt64(musage.mem.Zswap)
+		printer.PutKey("zswapped")
+		printer.PutInt64(musage.mem.Zswapped)
+		printer.PutKey("shmem_huge_pages")
+		printer.PutInt64(musage.mem.ShmemHugePages)
+		printer.PutKey("file_huge_pages")
+		printer.PutInt64(musage.mem.FileHugePages)
+		printer.PutKey("unaccepted")
+		printer.PutInt64(musage.mem.Unaccepted)
+		printer.PutKey("cma_total")
+		printer.PutInt64(musage.mem.CmaTotal)
+		printer.PutKey("cma_free")
+		printer.PutInt64(musage.mem.CmaFree)
+	}
+	if musage.mem.Others != nil {
+		keys := make([]string, 0, len(musage.mem.Others))
+		for key := range musage.mem.Others {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		printer.PutKey("others")
+		printer.BeginObject()
+		for _, key := range keys {
+			printer.PutKey(key)
+			printer.PutInt64(musage.mem.Others[key])
+		}
+		printer.FinishObject()
+	}
+
+	printer.PutKey("available_pct")
+	printer.PutFloatFmt(musage.AvailablePct, "%.2f")
+	printer.PutKey("reclaimable_pct")
+	printer.PutFloatFmt(musage.ReclaimablePct, "%.2f")
+	printer.PutKey("anon_pct")
+	printer.PutFloatFmt(musage.AnonPct, "%.2f")
+	printer.PutKey("file_pct")
+	printer.PutFloatFmt(musage.FilePct, "%.2f")
+	printer.PutKey("swap_used_pct")
+	printer.PutFloatFmt(musage.SwapUsedPct, "%.2f")
+	if musage.HasMinAvailable {
+		printer.PutKey("min_available_pct")
+		printer.PutFloatFmt(musage.MinAvailablePct, "%.2f")
+	}
+
 	printer.FinishObject()
 }
 
@@ -674,5 +3593,23 @@ func (entry *NetUsageEntry) WriteJsonTo(printer *projson.JsonPrinter) {
 	printer.PutKey("txdropps")
 	printer.PutFloatFmt(entry.TxDropsPerSec, "%.2f")
 
+	if entry.Members != nil {
+		printer.PutKey("members")
+		printer.BeginArray()
+		for _, member := range entry.Members {
+			printer.PutString(member)
+		}
+		printer.FinishArray()
+	}
+
+	if entry.LinkSpeed > 0 {
+		printer.PutKey("speed")
+		printer.PutInt64(entry.LinkSpeed)
+		printer.PutKey("rxutil")
+		printer.PutFloatFmt(entry.RxUtil, "%.2f")
+		printer.PutKey("txutil")
+		printer.PutFloatFmt(entry.TxUtil, "%.2f")
+	}
+
 	printer.FinishObject()
 }
@@ -2,6 +2,7 @@ package perfmonger
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
 	"regexp"
 	"strconv"
@@ -484,6 +485,203 @@ func TestDiskUsage(t *testing.T) {
 	assertHasKey("total")
 }
 
+func TestDiskUsageIostat(t *testing.T) {
+	d1 := NewDiskStat()
+	d2 := NewDiskStat()
+	t1, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	t2 := t1.Add(time.Second * 2)
+
+	e1 := NewDiskStatEntry()
+	e1.Name = "sda"
+	d1.Entries = append(d1.Entries, e1)
+	e2 := NewDiskStatEntry()
+	e2.Name = "sda"
+	e2.RdIos = 300
+	e2.RdMerges = 100
+	e2.WrIos = 100
+	e2.TotalTicks = 500
+	d2.Entries = append(d2.Entries, e2)
+
+	e3 := NewDiskStatEntry()
+	e3.Name = "sdb"
+	d1.Entries = append(d1.Entries, e3)
+	e4 := NewDiskStatEntry()
+	e4.Name = "sdb"
+	e4.WrIos = 100
+	e4.WrMerges = 100
+	e4.TotalTicks = 3000 // longer than the interval
+	d2.Entries = append(d2.Entries, e4)
+
+	usage, err := GetDiskUsage(t1, d1, t2, d2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	sda := (*usage)["sda"]
+	if !floatEqWithin(sda.Util, 25.0, 0.001) {
+		t.Errorf("sda.Util = %v, want 25.0", sda.Util)
+	}
+	if !floatEqWithin(sda.Svctm, 500.0/400.0, 0.001) {
+		t.Errorf("sda.Svctm = %v, want %v", sda.Svctm, 500.0/400.0)
+	}
+	if !floatEqWithin(sda.RdMergeps, 50.0, 0.001) {
+		t.Errorf("sda.RdMergeps = %v, want 50.0", sda.RdMergeps)
+	}
+	if !floatEqWithin(sda.RdMergePct, 25.0, 0.001) {
+		t.Errorf("sda.RdMergePct = %v, want 25.0", sda.RdMergePct)
+	}
+	if sda.WrMergePct != 0.0 {
+		t.Errorf("sda.WrMergePct = %v, want 0.0", sda.WrMergePct)
+	}
+
+	sdb := (*usage)["sdb"]
+	if sdb.Util != 100.0 {
+		t.Errorf("sdb.Util = %v, want 100.0 (capped)", sdb.Util)
+	}
+	if !floatEqWithin(sdb.WrMergePct, 50.0, 0.001) {
+		t.Errorf("sdb.WrMergePct = %v, want 50.0", sdb.WrMergePct)
+	}
+
+	total := (*usage)["total"]
+	if !floatEqWithin(total.Util, (25.0+100.0)/2, 0.001) {
+		t.Errorf("total.Util = %v, want %v", total.Util, (25.0+100.0)/2)
+	}
+	if !floatEqWithin(total.Svctm, 3500.0/500.0, 0.001) {
+		t.Errorf("total.Svctm = %v, want %v", total.Svctm, 3500.0/500.0)
+	}
+	if !floatEqWithin(total.WrMergePct, 100.0/300.0*100.0, 0.001) {
+		t.Errorf("total.WrMergePct = %v, want %v", total.WrMergePct, 100.0/300.0*100.0)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	for _, key := range []string{"sda.util", "sda.svctm", "sda.rrqm",
+		"sda.wrqm", "sda.rrqmps", "sda.wrqmps", "total.util"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("%v is not present in JSON:\n%v", key, str)
+		}
+	}
+
+	// a partition is busy while its disk is, so it is not counted again
+	e5 := NewDiskStatEntry()
+	e5.Name = "sda1"
+	d1.Entries = append(d1.Entries, e5)
+	e6 := NewDiskStatEntry()
+	e6.Name = "sda1"
+	e6.RdIos = 100
+	e6.TotalTicks = 500
+	d2.Entries = append(d2.Entries, e6)
+	devices := map[string]LinuxDevice{
+		"sda": {"sda", []string{"sda1"}},
+		"sdb": {"sdb", nil},
+	}
+	usage, err = GetDiskUsage2(t1, d1, t2, d2, nil, devices)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	total = (*usage)["total"]
+	if !floatEqWithin(total.Util, (25.0+100.0)/2, 0.001) {
+		t.Errorf("total.Util = %v, want %v", total.Util, (25.0+100.0)/2)
+	}
+	if !floatEqWithin(total.Svctm, 3500.0/500.0, 0.001) {
+		t.Errorf("total.Svctm = %v, want %v", total.Svctm, 3500.0/500.0)
+	}
+	if (*usage)["sda1"] == nil || !floatEqWithin((*usage)["sda1"].Util, 25.0, 0.001) {
+		t.Errorf("sda1 = %+v, want Util 25.0", (*usage)["sda1"])
+	}
+}
+
+func TestDiskUsageDiscardFlush(t *testing.T) {
+	d1 := NewDiskStat()
+	d2 := NewDiskStat()
+	t1, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	t2 := t1.Add(time.Second * 2)
+
+	e1 := NewDiskStatEntry()
+	e1.Name = "nvme0n1"
+	e1.HasDiscard = true
+	e1.DcIos = 10
+	e1.DcSectors = 100
+	e1.DcTicks = 50
+	e1.HasFlush = true
+	e1.FlIos = 4
+	e1.FlTicks = 8
+	e1.HasInFlight = true
+	d1.Entries = append(d1.Entries, e1)
+
+	e2 := NewDiskStatEntry()
+	*e2 = *e1
+	e2.DcIos += 20
+	e2.DcSectors += 4000
+	e2.DcTicks += 100
+	e2.FlIos += 6
+	e2.FlTicks += 30
+	e2.IosPgr = 3
+	d2.Entries = append(d2.Entries, e2)
+
+	usage, err := GetDiskUsage(t1, d1, t2, d2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	entry := (*usage)["nvme0n1"]
+	if !entry.HasDiscard || !entry.HasFlush {
+		t.Fatal("nvme0n1 should have discard and flush usage")
+	}
+	if !floatEqWithin(entry.DcIops, 10.0, 0.001) {
+		t.Errorf("DcIops = %v, want 10.0", entry.DcIops)
+	}
+	if !floatEqWithin(entry.DcSecps, 2000.0, 0.001) || entry.DcSectors != 4000 {
+		t.Errorf("DcSecps = %v, DcSectors = %v, want 2000.0, 4000",
+			entry.DcSecps, entry.DcSectors)
+	}
+	if !floatEqWithin(entry.DcLatency, 5.0, 0.001) {
+		t.Errorf("DcLatency = %v, want 5.0", entry.DcLatency)
+	}
+	if !floatEqWithin(entry.FlIops, 3.0, 0.001) {
+		t.Errorf("FlIops = %v, want 3.0", entry.FlIops)
+	}
+	if !floatEqWithin(entry.FlLatency, 5.0, 0.001) {
+		t.Errorf("FlLatency = %v, want 5.0", entry.FlLatency)
+	}
+	if entry.InFlight != 3 || (*usage)["total"].InFlight != 3 {
+		t.Errorf("InFlight = %v, want 3", entry.InFlight)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	for _, key := range []string{"nvme0n1.inflight", "nvme0n1.diops",
+		"nvme0n1.dkbyteps", "nvme0n1.dlatency", "nvme0n1.fiops",
+		"nvme0n1.flatency", "total.diops", "total.fiops"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("%v is not present in JSON:\n%v", key, str)
+		}
+	}
+
+	// Recordings from older kernels lack the fields entirely.
+	e1.HasDiscard, e1.HasFlush = false, false
+	usage, _ = GetDiskUsage(t1, d1, t2, d2)
+	if (*usage)["nvme0n1"].HasDiscard || (*usage)["nvme0n1"].HasFlush {
+		t.Error("discard/flush usage should be absent if either sample lacks them")
+	}
+
+	// Recordings from older versions do not say whether in-flight was read.
+	e2.HasInFlight = false
+	usage, _ = GetDiskUsage(t1, d1, t2, d2)
+	printer = projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, _ = printer.String()
+	if jsonHasKey([]byte(str), "nvme0n1.inflight") || jsonHasKey([]byte(str), "total.inflight") {
+		t.Errorf("inflight should not be in JSON without HasInFlight: %s", str)
+	}
+}
+
 func TestGetNetUsage(t *testing.T) {
 	n1 := NewNetStat()
 	n2 := NewNetStat()
@@ -494,7 +692,7 @@ func TestGetNetUsage(t *testing.T) {
 		t.Error("Timestamp parse error")
 	}
 
-	_, err := GetNetUsage(t1, n1, t2, n2)
+	_, err := GetNetUsage(t1, n1, t2, n2, nil)
 	if err == nil {
 		t.Error("Error should be returned because timestamps are the same")
 	}
@@ -503,7 +701,7 @@ func TestGetNetUsage(t *testing.T) {
 	interval := interval_duration.Seconds()
 	t2 = t1.Add(interval_duration)
 
-	_, err = GetNetUsage(t1, n1, t2, n2)
+	_, err = GetNetUsage(t1, n1, t2, n2, nil)
 	if err == nil {
 		t.Error("Error should be returned because no entries in NetStat")
 	}
@@ -519,7 +717,7 @@ func TestGetNetUsage(t *testing.T) {
 	n2.Entries[0].RxPackets = n1.Entries[0].RxPackets + 100
 
 	var usage *NetUsage
-	usage, err = GetNetUsage(t1, n1, t2, n2)
+	usage, err = GetNetUsage(t1, n1, t2, n2, nil)
 	if err != nil {
 		t.Errorf("Error should not be returned with:\n  n1 = %v\n  n2 = %v",
 			n1, n2)
@@ -556,7 +754,7 @@ func TestGetNetUsage(t *testing.T) {
 	n1.Entries[1].RxBytes = 45678
 	n1.Entries[1].RxPackets = 123
 
-	usage, err = GetNetUsage(t1, n1, t2, n2)
+	usage, err = GetNetUsage(t1, n1, t2, n2, nil)
 	if err != nil {
 		t.Errorf("Error should not be returned with:\n  n1 = %v\n  n2 = %v",
 			n1, n2)
@@ -572,7 +770,7 @@ func TestGetNetUsage(t *testing.T) {
 	n2.Entries[1].RxBytes = n1.Entries[1].RxBytes + 7000
 	n2.Entries[1].RxPackets = n1.Entries[1].RxPackets + 150
 
-	usage, err = GetNetUsage(t1, n1, t2, n2)
+	usage, err = GetNetUsage(t1, n1, t2, n2, nil)
 	if err != nil {
 		t.Errorf("Error should not be returned with:\n  n1 = %v\n  n2 = %v",
 			n1, n2)
@@ -627,4 +825,1553 @@ func TestGetNetUsage(t *testing.T) {
 	assertHasKey("eth0.txerrps")
 	assertHasKey("eth0.rxdropps")
 	assertHasKey("eth0.txdropps")
+	if jsonHasKey([]byte(str), "eth0.rxutil") {
+		t.Errorf("eth0.rxutil should be absent without link speed:\n%v", str)
+	}
+
+	// 7000 B over 2 sec on a 1 Mb/s full-duplex link is 2.8% of rx
+	// capacity; on a half-duplex link tx shares the same share.
+	n2.Entries[1].TxBytes = n1.Entries[1].TxBytes + 3000
+	devices := map[string]LinuxNetDevice{
+		"eth0": {Speed: 1, Duplex: "full"},
+		"lo":   {Speed: -1, Duplex: "unknown"},
+	}
+	usage, _ = GetNetUsage(t1, n1, t2, n2, devices)
+	eth0 := (*usage)["eth0"]
+	if eth0.LinkSpeed != 1 || !floatEqWithin(eth0.RxUtil, 2.8, 0.001) ||
+		!floatEqWithin(eth0.TxUtil, 1.2, 0.001) {
+		t.Errorf("eth0 = {%v, %v, %v}, want {1, 2.8, 1.2}",
+			eth0.LinkSpeed, eth0.RxUtil, eth0.TxUtil)
+	}
+	if (*usage)["lo"].LinkSpeed != 0 || (*usage)["lo"].RxUtil != 0.0 {
+		t.Errorf("lo should have no link utilization: %v", (*usage)["lo"])
+	}
+
+	devices["eth0"] = LinuxNetDevice{Speed: 1, Duplex: "half"}
+	usage, _ = GetNetUsage(t1, n1, t2, n2, devices)
+	eth0 = (*usage)["eth0"]
+	if !floatEqWithin(eth0.RxUtil, 4.0, 0.001) || !floatEqWithin(eth0.TxUtil, 4.0, 0.001) {
+		t.Errorf("half-duplex eth0 util = {%v, %v}, want {4.0, 4.0}",
+			eth0.RxUtil, eth0.TxUtil)
+	}
+
+	printer = projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, _ = printer.String()
+	assertHasKey("eth0.speed")
+	assertHasKey("eth0.rxutil")
+	assertHasKey("eth0.txutil")
+}
+
+func TestGetNetUsage1(t *testing.T) {
+	t1, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	t2 := t1.Add(time.Second)
+
+	// eth0 and eth1 are bonded into bond0, a port of br0 which also has
+	// veth0 attached. 1000 B/s leaves the host via each NIC.
+	n1 := NewNetStat()
+	n2 := NewNetStat()
+	for _, e := range []struct {
+		name  string
+		bytes int64
+	}{{"lo", 500}, {"eth0", 1000}, {"eth1", 1000}, {"bond0", 2000},
+		{"br0", 2000}, {"veth0", 300}} {
+		e1 := NewNetStatEntry()
+		e1.Name = e.name
+		e2 := NewNetStatEntry()
+		e2.Name = e.name
+		e2.TxBytes = e.bytes
+		n1.Entries = append(n1.Entries, e1)
+		n2.Entries = append(n2.Entries, e2)
+	}
+	devices := map[string]LinuxNetDevice{
+		"lo":    {Speed: -1, Type: 772},
+		"eth0":  {Speed: 1, Duplex: "full", Type: 1, Physical: true, Master: "bond0"},
+		"eth1":  {Speed: 1, Duplex: "full", Type: 1, Physical: true, Master: "bond0"},
+		"bond0": {Speed: 2, Duplex: "full", Type: 1, Kind: "bond", Master: "br0", Lowers: []string{"eth0", "eth1"}},
+		"br0":   {Speed: -1, Type: 1, Kind: "bridge", Lowers: []string{"bond0", "veth0"}},
+		"veth0": {Speed: 10000, Duplex: "full", Type: 1, Kind: "veth", Master: "br0"},
+	}
+
+	// without link metadata every interface is summed up
+	usage, err := GetNetUsage1(t1, n1, t2, n2, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := (*usage)["total"]
+	if !floatEqWithin(total.TxBytesPerSec, 6800.0, 0.001) || total.Members != nil {
+		t.Errorf("total = {%v, %v}, want {6800, nil}", total.TxBytesPerSec, total.Members)
+	}
+
+	// physical NICs only
+	usage, _ = GetNetUsage1(t1, n1, t2, n2, devices, nil, nil)
+	total = (*usage)["total"]
+	if !floatEqWithin(total.TxBytesPerSec, 2000.0, 0.001) ||
+		fmt.Sprint(total.Members) != "[eth0 eth1]" {
+		t.Errorf("total = {%v, %v}, want {2000, [eth0 eth1]}", total.TxBytesPerSec, total.Members)
+	}
+	if total.LinkSpeed != 2 || !floatEqWithin(total.TxUtil, 0.8, 0.001) {
+		t.Errorf("total = {%v, %v}, want {2, 0.8}", total.LinkSpeed, total.TxUtil)
+	}
+
+	// no NIC selected: bond0 is counted instead of br0, veth0 whose traffic
+	// goes out through bond0 and lo are skipped
+	usage, _ = GetNetUsage1(t1, n1, t2, n2, devices, nil, regexp.MustCompile("^eth"))
+	total = (*usage)["total"]
+	if _, ok := (*usage)["eth0"]; ok {
+		t.Error("eth0 should be excluded")
+	}
+	if fmt.Sprint(total.Members) != "[bond0]" || total.LinkSpeed != 2 ||
+		!floatEqWithin(total.TxBytesPerSec, 2000.0, 0.001) {
+		t.Errorf("total = {%v, %v, %v}, want {[bond0], 2, 2000}",
+			total.Members, total.LinkSpeed, total.TxBytesPerSec)
+	}
+
+	// without the uplink, veth0 is counted
+	usage, _ = GetNetUsage1(t1, n1, t2, n2, devices, nil, regexp.MustCompile("^(eth|bond)"))
+	total = (*usage)["total"]
+	if fmt.Sprint(total.Members) != "[veth0]" || total.LinkSpeed != 10000 {
+		t.Errorf("total = {%v, %v}, want {[veth0], 10000}", total.Members, total.LinkSpeed)
+	}
+
+	// br0 has no speed, so is the total
+	usage, _ = GetNetUsage1(t1, n1, t2, n2, devices, regexp.MustCompile("^br"), nil)
+	total = (*usage)["total"]
+	if len(*usage) != 2 || fmt.Sprint(total.Members) != "[br0]" || total.LinkSpeed != 0 {
+		t.Errorf("usage = %v, total = {%v, %v}", usage, total.Members, total.LinkSpeed)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, _ := printer.String()
+	if !jsonHasKey([]byte(str), "total.members") {
+		t.Errorf("total.members is not present in JSON:\n%v", str)
+	}
+}
+
+func TestGetIrqDetailUsage(t *testing.T) {
+	t1, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	t2 := t1.Add(time.Second * 2)
+
+	newEntry := func(irqno int, irqtype string, descr string, counts ...int) *InterruptStatEntry {
+		return &InterruptStatEntry{irqno, irqtype, len(counts), counts, descr}
+	}
+	i1 := NewInterruptStat()
+	i1.Entries = append(i1.Entries,
+		newEntry(24, "", "PCI-MSI 524288-edge nvme0q0", 0, 0),
+		newEntry(25, "", "PCI-MSI 524289-edge nvme0q1", 100, 0),
+		newEntry(26, "", "PCI-MSI 524290-edge nvme0q2", 100, 0),
+		newEntry(40, "", "PCI-MSI 1048577-edge mlx5_comp0@pci:0000:3b:00.0", 0, 0),
+		newEntry(41, "", "PCI-MSI 1048578-edge mlx5_comp1@pci:0000:3b:00.0", 0, 0),
+		newEntry(-1, "LOC", "Local timer interrupts", 1000, 1000))
+	i1.NumEntries = uint(len(i1.Entries))
+
+	i2 := NewInterruptStat()
+	i2.Entries = append(i2.Entries,
+		newEntry(24, "", "PCI-MSI 524288-edge nvme0q0", 0, 0),
+		newEntry(25, "", "PCI-MSI 524289-edge nvme0q1", 300, 0),
+		newEntry(26, "", "PCI-MSI 524290-edge nvme0q2", 500, 0),
+		newEntry(40, "", "PCI-MSI 1048577-edge mlx5_comp0@pci:0000:3b:00.0", 2000, 0),
+		newEntry(41, "", "PCI-MSI 1048578-edge mlx5_comp1@pci:0000:3b:00.0", 1000, 0),
+		newEntry(-1, "LOC", "Local timer interrupts", 1100, 1300),
+		newEntry(50, "", "PCI-MSI 1-edge hotplugged", 10, 10))
+	i2.NumEntries = uint(len(i2.Entries))
+
+	_, err := GetIrqDetailUsage(t1, i1, t1, i2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+	_, err = GetIrqDetailUsage(t1, nil, t2, i2)
+	if err == nil {
+		t.Error("Error should be returned for nil InterruptStat")
+	}
+
+	usage, err := GetIrqDetailUsage(t1, i1, t2, i2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if len(usage.Entries) != 6 {
+		t.Fatalf("len(Entries) = %v, want 6 (lines absent in the first sample are skipped)", len(usage.Entries))
+	}
+	top := usage.Entries[0]
+	if top.IrqNo != 40 || top.Name != "mlx5_comp0@pci:0000:3b:00.0" || top.Device != "mlx5_comp@pci:0000:3b:00.0" {
+		t.Errorf("top entry = %+v, want IRQ 40 of mlx5_comp@pci:0000:3b:00.0", top)
+	}
+	if !floatEqWithin(top.Total, 1000.0, 0.001) || !floatEqWithin(top.CoreRates[0], 1000.0, 0.001) {
+		t.Errorf("top entry rates = %v / %v, want 1000.0", top.Total, top.CoreRates)
+	}
+	for _, e := range usage.Entries {
+		if e.IrqNo == -1 && (e.Name != "LOC" || e.Device != "" ||
+			!floatEqWithin(e.CoreRates[1], 150.0, 0.001)) {
+			t.Errorf("system entry = %+v", e)
+		}
+	}
+	busiest, share := top.BusiestCore()
+	if busiest != 0 || !floatEqWithin(share, 100.0, 0.001) {
+		t.Errorf("BusiestCore() = %v, %v, want 0, 100.0", busiest, share)
+	}
+
+	if len(usage.Devices) != 2 {
+		t.Fatalf("len(Devices) = %v, want 2", len(usage.Devices))
+	}
+	if usage.Devices[0].Device != "mlx5_comp@pci:0000:3b:00.0" || usage.Devices[0].NumIrqs != 2 ||
+		!floatEqWithin(usage.Devices[0].Total, 1500.0, 0.001) {
+		t.Errorf("Devices[0] = %+v, want mlx5_comp@pci:0000:3b:00.0 with 2 IRQs", usage.Devices[0])
+	}
+	if usage.Devices[1].Device != "nvme0" || usage.Devices[1].NumIrqs != 3 ||
+		!floatEqWithin(usage.Devices[1].Total, 300.0, 0.001) {
+		t.Errorf("Devices[1] = %+v, want nvme0 with 3 IRQs", usage.Devices[1])
+	}
+
+	usage.Affinity = map[int]string{40: "0-1"}
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !strings.Contains(str, `"affinity":"0-1"`) {
+		t.Errorf("affinity not found in JSON: %s", str)
+	}
+	for _, key := range []string{"irqs", "devices"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("key %s not found in JSON: %s", key, str)
+		}
+	}
+}
+
+func TestIrqDeviceName(t *testing.T) {
+	for name, want := range map[string]string{
+		"nvme0q3":                     "nvme0",
+		"mlx5_comp7@pci:0000:3b:00.0": "mlx5_comp@pci:0000:3b:00.0",
+		"mlx5_comp7@pci:0000:af:00.0": "mlx5_comp@pci:0000:af:00.0",
+		"mlx5_async@pci:0000:3b:00.0": "mlx5_async@pci:0000:3b:00.0",
+		"eth0-TxRx-3":                 "eth0",
+		"virtio0-input.0":             "virtio0",
+		"eth0":                        "eth0",
+		"ahci[0000:00:1f.2]":          "ahci[0000:00:1f.2]",
+		"i8042":                       "i8042",
+	} {
+		if got := irqDeviceName(name); got != want {
+			t.Errorf("irqDeviceName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestGetSoftIrqUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		t.Fatal("Timestamp parse error")
+	}
+
+	num_core := 2
+	s1 := NewSoftIrqStat(num_core)
+	s2 := NewSoftIrqStat(num_core)
+
+	_, err := GetSoftIrqUsage(t1, s1, t1, s2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+
+	_, err = GetSoftIrqUsage(t1, s1, t1.Add(time.Second), NewSoftIrqStat(num_core+1))
+	if err == nil {
+		t.Error("Error should be returned because number of cores changed")
+	}
+
+	interval_duration := time.Second * 2
+	interval := interval_duration.Seconds()
+	t2 := t1.Add(interval_duration)
+
+	s1.CoreStats[0].NetRx = 100
+	s1.CoreStats[1].NetRx = 100
+	s1.All.NetRx = 200
+	s2.CoreStats[0].NetRx = 100 + 4000
+	s2.CoreStats[1].NetRx = 100 + 10
+	s2.All.NetRx = 200 + 4010
+
+	usage, err := GetSoftIrqUsage(t1, s1, t2, s2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if usage.NumCore != num_core || len(usage.CoreSoftIrqUsages) != num_core {
+		t.Errorf("NumCore = %v, len(CoreSoftIrqUsages) = %v, want %v",
+			usage.NumCore, len(usage.CoreSoftIrqUsages), num_core)
+	}
+	if !floatEqWithin(usage.CoreSoftIrqUsages[0].NetRx, 4000.0/interval, 0.001) {
+		t.Errorf("cores[0].NetRx = %v, want %v",
+			usage.CoreSoftIrqUsages[0].NetRx, 4000.0/interval)
+	}
+	if !floatEqWithin(usage.CoreSoftIrqUsages[1].NetRx, 10.0/interval, 0.001) {
+		t.Errorf("cores[1].NetRx = %v, want %v",
+			usage.CoreSoftIrqUsages[1].NetRx, 10.0/interval)
+	}
+	if !floatEqWithin(usage.All.NetRx, 4010.0/interval, 0.001) {
+		t.Errorf("All.NetRx = %v, want %v", usage.All.NetRx, 4010.0/interval)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	for _, key := range []string{"num_core", "all.net_rx", "cores.[1].block"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("key %s not found in JSON: %s", key, str)
+		}
+	}
+}
+
+func TestGetSoftnetUsage(t *testing.T) {
+	t1, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	t2 := t1.Add(time.Second * 2)
+
+	s1 := NewSoftnetStat()
+	s1.Entries = append(s1.Entries,
+		&SoftnetStatEntry{0, 1000, 0, 0, 0, 0},
+		&SoftnetStatEntry{2, 500, 10, 4, 0, 0})
+	s2 := NewSoftnetStat()
+	s2.Entries = append(s2.Entries,
+		&SoftnetStatEntry{0, 3000, 0, 0, 0, 0},
+		&SoftnetStatEntry{1, 100, 0, 0, 0, 0},
+		&SoftnetStatEntry{2, 900, 30, 10, 6, 0})
+
+	_, err := GetSoftnetUsage(t1, s1, t1, s2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+	_, err = GetSoftnetUsage(t1, nil, t2, s2)
+	if err == nil {
+		t.Error("Error should be returned for nil SoftnetStat")
+	}
+
+	usage, err := GetSoftnetUsage(t1, s1, t2, s2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if len(usage.CoreUsages) != 2 {
+		t.Fatalf("len(CoreUsages) = %v, want 2 (cpu1 is missing in the first sample)", len(usage.CoreUsages))
+	}
+	cpu2 := usage.CoreUsages[1]
+	if cpu2.CpuId != 2 || !floatEqWithin(cpu2.Dropped, 10.0, 0.001) ||
+		!floatEqWithin(cpu2.TimeSqueeze, 3.0, 0.001) || !floatEqWithin(cpu2.ReceivedRps, 3.0, 0.001) {
+		t.Errorf("CoreUsages[1] = %+v", cpu2)
+	}
+	if !floatEqWithin(usage.All.Processed, 1200.0, 0.001) || !floatEqWithin(usage.All.Dropped, 10.0, 0.001) {
+		t.Errorf("All = %+v", usage.All)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	for _, key := range []string{"all", "all.processed", "all.dropped", "all.time_squeeze", "cores"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("key %s not found in JSON: %s", key, str)
+		}
+	}
+
+	// 32-bit counters wrap around
+	s3 := NewSoftnetStat()
+	s3.Entries = append(s3.Entries,
+		&SoftnetStatEntry{0, 1000, 0, 0, 0, 0},
+		&SoftnetStatEntry{1, 300, 0, 0, 0, 0},
+		&SoftnetStatEntry{2, 900, 30, 10, 6, 0})
+	s2.Entries[0].Processed = 1<<32 - 1000
+	t3 := t2.Add(time.Second * 2)
+	usage, err = GetSoftnetUsage(t2, s2, t3, s3)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if usage.CoreUsages[0].CpuId != 0 || !floatEqWithin(usage.CoreUsages[0].Processed, 1000.0, 0.001) {
+		t.Errorf("CoreUsages[0] = %+v, want 1000 packets/sec across the wraparound", usage.CoreUsages[0])
+	}
+
+	// averaged over the intervals added
+	s2.Entries[0].Processed = 3000
+	usage = NewSoftnetUsage()
+	if err := usage.Add(t1, s1, t2, s2); err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if err := usage.Add(t2, s2, t3, s3); err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if usage.Interval != 4*time.Second || len(usage.CoreUsages) != 3 {
+		t.Fatalf("usage = %+v", usage)
+	}
+	// cpu0: 2000 packets, then 1000 - 3000 + 2^32 across a wraparound
+	if !floatEqWithin(usage.CoreUsages[0].Processed, (2000.0+float64(int64(1)<<32-2000))/4.0, 0.001) {
+		t.Errorf("CoreUsages[0] = %+v", usage.CoreUsages[0])
+	}
+	// cpu1 appears in the second interval only
+	if usage.CoreUsages[2].CpuId != 1 || !floatEqWithin(usage.CoreUsages[2].Processed, 50.0, 0.001) {
+		t.Errorf("CoreUsages[2] = %+v", usage.CoreUsages[2])
+	}
+	if !floatEqWithin(usage.CoreUsages[1].Dropped, 5.0, 0.001) || !floatEqWithin(usage.All.Dropped, 5.0, 0.001) {
+		t.Errorf("CoreUsages[1] = %+v, All = %+v", usage.CoreUsages[1], usage.All)
+	}
+}
+
+func TestGetPressureUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		t.Fatal("Timestamp parse error")
+	}
+
+	p1 := NewPressureStat()
+	p2 := NewPressureStat()
+
+	_, err := GetPressureUsage(t1, p1, t1.Add(time.Second), p2)
+	if err == nil {
+		t.Error("Error should be returned because no entries in PressureStat")
+	}
+
+	p1.Io = &PressureStatEntry{SomeTotal: 1000, FullTotal: 500}
+	p2.Io = &PressureStatEntry{SomeTotal: 1000 + 500000, FullTotal: 500 + 100000}
+
+	_, err = GetPressureUsage(t1, p1, t1, p2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+
+	t2 := t1.Add(time.Second * 2)
+	usage, err := GetPressureUsage(t1, p1, t2, p2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if usage.Cpu != nil || usage.Memory != nil {
+		t.Error("Cpu and Memory should be nil")
+	}
+	// 500ms stalled in 2s
+	if !floatEqWithin(usage.Io.Some, 25.0, 0.001) {
+		t.Errorf("Io.Some = %v, want %v", usage.Io.Some, 25.0)
+	}
+	if !floatEqWithin(usage.Io.Full, 5.0, 0.001) {
+		t.Errorf("Io.Full = %v, want %v", usage.Io.Full, 5.0)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "io.full") {
+		t.Errorf("key io.full not found in JSON: %s", str)
+	}
+	if jsonHasKey([]byte(str), "cpu") {
+		t.Errorf("key cpu should not be in JSON: %s", str)
+	}
+}
+
+func TestGetVmUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		t.Fatal("Timestamp parse error")
+	}
+
+	v1 := NewVmStat()
+	v2 := NewVmStat()
+
+	_, err := GetVmUsage(t1, v1, t1, v2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+	_, err = GetVmUsage(t1, nil, t1.Add(time.Second), v2)
+	if err == nil {
+		t.Error("Error should be returned for nil VmStat")
+	}
+
+	v1.PgMajFault = 100
+	v1.PswpOut = 1000
+	v2.PgMajFault = 100 + 50
+	v2.PswpOut = 1000 + 4000
+
+	interval := 2.0
+	t2 := t1.Add(time.Second * 2)
+	usage, err := GetVmUsage(t1, v1, t2, v2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if !floatEqWithin(usage.PgMajFault, 50.0/interval, 0.001) {
+		t.Errorf("PgMajFault = %v, want %v", usage.PgMajFault, 50.0/interval)
+	}
+	if !floatEqWithin(usage.PswpOut, 4000.0/interval, 0.001) {
+		t.Errorf("PswpOut = %v, want %v", usage.PswpOut, 4000.0/interval)
+	}
+	if usage.PswpIn != 0.0 {
+		t.Errorf("PswpIn = %v, want %v", usage.PswpIn, 0.0)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	for _, key := range []string{"pgmajfault", "pswpout", "pgscan_direct", "allocstall", "oom_kill"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("key %s not found in JSON: %s", key, str)
+		}
+	}
+}
+
+func TestGetNetProtoUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		t.Fatal("Timestamp parse error")
+	}
+
+	n1 := NewNetProtoStat()
+	n2 := NewNetProtoStat()
+
+	_, err := GetNetProtoUsage(t1, n1, t1, n2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+	_, err = GetNetProtoUsage(t1, nil, t1.Add(time.Second), n2)
+	if err == nil {
+		t.Error("Error should be returned for nil NetProtoStat")
+	}
+
+	n1.TcpOutSegs = 1000
+	n1.TcpRetransSegs = 10
+	n1.ListenOverflows = 3
+	n1.TcpCurrEstab = 100
+	n2.TcpOutSegs = 1000 + 2000
+	n2.TcpRetransSegs = 10 + 50
+	n2.ListenOverflows = 3 + 4
+	n2.TcpCurrEstab = 80
+	n2.TcpTimeWait = 30
+
+	interval := 2.0
+	t2 := t1.Add(time.Second * 2)
+	usage, err := GetNetProtoUsage(t1, n1, t2, n2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if !floatEqWithin(usage.TcpRetransSegs, 50.0/interval, 0.001) {
+		t.Errorf("TcpRetransSegs = %v, want %v", usage.TcpRetransSegs, 50.0/interval)
+	}
+	if !floatEqWithin(usage.TcpRetransRatio, 2.5, 0.001) {
+		t.Errorf("TcpRetransRatio = %v, want %v", usage.TcpRetransRatio, 2.5)
+	}
+	if !floatEqWithin(usage.ListenOverflows, 4.0/interval, 0.001) {
+		t.Errorf("ListenOverflows = %v, want %v", usage.ListenOverflows, 4.0/interval)
+	}
+	if usage.TcpCurrEstab != 80 || usage.TcpTimeWait != 30 {
+		t.Errorf("TcpCurrEstab = %v, TcpTimeWait = %v, want values at the end",
+			usage.TcpCurrEstab, usage.TcpTimeWait)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	for _, key := range []string{"tcp_retrans_segs", "tcp_retrans_ratio", "listen_overflows",
+		"udp_rcvbuf_errors", "tcp_curr_estab", "sockets_used"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("key %s not found in JSON: %s", key, str)
+		}
+	}
+}
+
+func TestGetProcessUsage(t *testing.T) {
+	_, err := GetProcessUsage(nil, 100)
+	if err == nil {
+		t.Error("Error should be returned for nil ProcessStat")
+	}
+	_, err = GetProcessUsage(NewProcessStat(100), 100)
+	if err == nil {
+		t.Error("Error should be returned because no entries in ProcessStat")
+	}
+
+	proc := NewProcessStat(100)
+	proc.Entries = append(proc.Entries, &ProcessStatEntry{
+		Pid: 100, Utime: 100, Stime: 50, Cutime: 200, Cstime: 10,
+		MajFlt: 1, CMajFlt: 2, VmRSS: 1000, VmHWM: 4000,
+		ReadBytes: 10, WriteBytes: 20,
+		VoluntaryCtxtSwitches: 3, NonvoluntaryCtxtSwitches: 4})
+	proc.Entries = append(proc.Entries, &ProcessStatEntry{
+		Pid: 101, Ppid: 100, Utime: 300, VmRSS: 3500, VmHWM: 3500,
+		ReadBytes: 1, WriteBytes: 2})
+
+	usage, err := GetProcessUsage(proc, 0)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if usage.NumProcs != 2 {
+		t.Errorf("NumProcs = %v, want %v", usage.NumProcs, 2)
+	}
+	if !floatEqWithin(usage.Utime, 6.0, 0.001) || !floatEqWithin(usage.Stime, 0.6, 0.001) {
+		t.Errorf("Utime, Stime = %v, %v, want 6.0, 0.6", usage.Utime, usage.Stime)
+	}
+	if usage.MajFlt != 3 || usage.ReadBytes != 11 || usage.WriteBytes != 22 {
+		t.Errorf("usage = %+v", usage)
+	}
+	// the sum of RSS when it is larger than the largest VmHWM
+	if usage.PeakRss != 4500 {
+		t.Errorf("PeakRss = %v, want %v", usage.PeakRss, 4500)
+	}
+	hz250, err := GetProcessUsage(proc, 250)
+	if err != nil || !floatEqWithin(hz250.Utime, 2.4, 0.001) {
+		t.Errorf("Utime with USER_HZ 250 = %v, %v, want 2.4", hz250.Utime, err)
+	}
+
+	// the child exited before being waited for: totals temporarily drop
+	proc.Entries = proc.Entries[:1]
+	proc.Entries[0].Utime += 10
+	later, err := GetProcessUsage(proc, 100)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	usage.Merge(later)
+	if !floatEqWithin(usage.Utime, 6.0, 0.001) {
+		t.Errorf("Utime = %v, want %v", usage.Utime, 6.0)
+	}
+	if usage.PeakRss != 4500 || usage.NumProcs != 2 {
+		t.Errorf("PeakRss, NumProcs = %v, %v, want 4500, 2", usage.PeakRss, usage.NumProcs)
+	}
+
+	// a peak between samples is only seen in VmHWM
+	proc.Entries[0].VmHWM = 8000
+	later, err = GetProcessUsage(proc, 100)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if later.PeakRss != 8000 {
+		t.Errorf("PeakRss = %v, want %v", later.PeakRss, 8000)
+	}
+	usage.Merge(later)
+	if usage.PeakRss != 8000 {
+		t.Errorf("merged PeakRss = %v, want %v", usage.PeakRss, 8000)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	for _, key := range []string{"utime", "stime", "majflt", "peak_rss", "read_bytes", "write_bytes",
+		"voluntary_ctxt_switches", "nonvoluntary_ctxt_switches"} {
+		if !jsonHasKey([]byte(str), key) {
+			t.Errorf("key %s not found in JSON: %s", key, str)
+		}
+	}
+}
+
+func TestGetCgroupUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		t.Fatal("Timestamp parse error")
+	}
+
+	c1 := NewCgroupStat()
+	c2 := NewCgroupStat()
+
+	_, err := GetCgroupUsage(t1, c1, t1.Add(time.Second), c2)
+	if err == nil {
+		t.Error("Error should be returned because no entries in CgroupStat")
+	}
+
+	e1 := NewCgroupStatEntry("/foo")
+	e1.UsageUsec = 1000000
+	e1.UserUsec = 600000
+	e1.SystemUsec = 400000
+	e1.IoRbytes = 4096
+	e1.IoRios = 1
+	e1.IoPressure = &PressureStatEntry{SomeTotal: 0, FullTotal: 0}
+	c1.Entries = append(c1.Entries, e1)
+
+	e2 := NewCgroupStatEntry("/foo")
+	e2.UsageUsec = 1000000 + 3000000
+	e2.UserUsec = 600000 + 2000000
+	e2.SystemUsec = 400000 + 1000000
+	e2.ThrottledUsec = 200000
+	e2.NrThrottled = 4
+	e2.MemoryCurrent = 2 * 1024 * 1024
+	e2.IoRbytes = 4096 + 8192
+	e2.IoRios = 1 + 4
+	e2.IoPressure = &PressureStatEntry{SomeTotal: 100000, FullTotal: 20000}
+	c2.Entries = append(c2.Entries, e2, NewCgroupStatEntry("/bar"))
+
+	_, err = GetCgroupUsage(t1, c1, t1, c2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+
+	t2 := t1.Add(time.Second * 2)
+	usage, err := GetCgroupUsage(t1, c1, t2, c2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if _, ok := (*usage)["/bar"]; ok {
+		t.Error("/bar should not be in usage because it is missing in the first stat")
+	}
+
+	u := (*usage)["/foo"]
+	if u == nil {
+		t.Fatal("/foo should be in usage")
+	}
+	// 3 sec of CPU time in 2 sec
+	if !floatEqWithin(u.Cpu, 150.0, 0.001) {
+		t.Errorf("Cpu = %v, want %v", u.Cpu, 150.0)
+	}
+	if !floatEqWithin(u.Usr, 100.0, 0.001) {
+		t.Errorf("Usr = %v, want %v", u.Usr, 100.0)
+	}
+	if !floatEqWithin(u.Sys, 50.0, 0.001) {
+		t.Errorf("Sys = %v, want %v", u.Sys, 50.0)
+	}
+	if !floatEqWithin(u.Throttled, 10.0, 0.001) || u.NrThrottled != 4 {
+		t.Errorf("Throttled = %v (%v times), want %v (4 times)", u.Throttled, u.NrThrottled, 10.0)
+	}
+	if u.MemCurrent != 2048 {
+		t.Errorf("MemCurrent = %v, want %v", u.MemCurrent, 2048)
+	}
+	if !floatEqWithin(u.RdBytesPerSec, 4096.0, 0.001) || !floatEqWithin(u.RdIops, 2.0, 0.001) {
+		t.Errorf("RdBytesPerSec = %v, RdIops = %v", u.RdBytesPerSec, u.RdIops)
+	}
+	if u.CpuPressure != nil {
+		t.Error("CpuPressure should be nil")
+	}
+	if u.IoPressure == nil || !floatEqWithin(u.IoPressure.Some, 5.0, 0.001) {
+		t.Errorf("IoPressure = %v", u.IoPressure)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "cgroups") {
+		t.Errorf("key cgroups not found in JSON: %s", str)
+	}
+}
+
+func TestGetCpuFreqUsage(t *testing.T) {
+	_, err := GetCpuFreqUsage(nil, NewCpuFreqStat(2))
+	if err == nil {
+		t.Error("Error should be returned because of nil CpuFreqStat")
+	}
+	_, err = GetCpuFreqUsage(NewCpuFreqStat(1), NewCpuFreqStat(2))
+	if err == nil {
+		t.Error("Error should be returned because of mismatched number of cores")
+	}
+
+	f1 := NewCpuFreqStat(2)
+	f1.CoreFreqs[0] = 1000000
+	f1.CoreFreqs[1] = 2000000
+	f2 := NewCpuFreqStat(2)
+	f2.CoreFreqs[0] = 3000000
+	f2.CoreFreqs[1] = 0 // unknown
+
+	usage, err := GetCpuFreqUsage(f1, f2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if !floatEqWithin(usage.CoreFreqUsages[0].Avg, 2000.0, 0.001) ||
+		!floatEqWithin(usage.CoreFreqUsages[0].Min, 1000.0, 0.001) ||
+		!floatEqWithin(usage.CoreFreqUsages[0].Max, 3000.0, 0.001) {
+		t.Errorf("core 0 = %+v", usage.CoreFreqUsages[0])
+	}
+	if usage.CoreFreqUsages[1].NumSamples != 1 ||
+		!floatEqWithin(usage.CoreFreqUsages[1].Avg, 2000.0, 0.001) {
+		t.Errorf("core 1 = %+v, want unknown frequency ignored", usage.CoreFreqUsages[1])
+	}
+
+	f3 := NewCpuFreqStat(2)
+	f3.CoreFreqs[0] = 500000
+	f3.CoreFreqs[1] = 500000
+	if err := usage.Add(f3); err != nil {
+		t.Fatalf("Add returned an error: %v", err)
+	}
+	if usage.All.NumSamples != 5 ||
+		!floatEqWithin(usage.All.Avg, 1400.0, 0.001) ||
+		!floatEqWithin(usage.All.Min, 500.0, 0.001) ||
+		!floatEqWithin(usage.All.Max, 3000.0, 0.001) {
+		t.Errorf("All = %+v", usage.All)
+	}
+
+	usage.Governors = []string{"performance", "performance"}
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "all.avg") || !jsonHasKey([]byte(str), "governors") {
+		t.Errorf("keys all.avg and governors should be in JSON: %s", str)
+	}
+}
+
+func TestGetCpuIdleUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		panic(perr)
+	}
+	t2 := t1.Add(2 * time.Second)
+
+	_, err := GetCpuIdleUsage(t1, nil, t2, NewCpuIdleStat(2))
+	if err == nil {
+		t.Error("Error should be returned because of nil CpuIdleStat")
+	}
+
+	c1 := NewCpuIdleStat(2)
+	c1.StateNames = []string{"POLL", "C1", "C6"}
+	c1.CoreStats[0] = CpuIdleCoreStat{[]int64{0, 0, 0}, []int64{0, 0, 0}}
+	c1.CoreStats[1] = CpuIdleCoreStat{[]int64{0, 0, 0}, []int64{0, 0, 0}}
+	c2 := NewCpuIdleStat(2)
+	c2.StateNames = c1.StateNames
+	// core 0 was idle for 1 sec, 75% of which in C6
+	c2.CoreStats[0] = CpuIdleCoreStat{[]int64{0, 250000, 750000}, []int64{0, 10, 20}}
+	// core 1 was idle for the whole interval in C6
+	c2.CoreStats[1] = CpuIdleCoreStat{[]int64{0, 0, 2000000}, []int64{0, 0, 4}}
+
+	_, err = GetCpuIdleUsage(t2, c1, t1, c2)
+	if err == nil {
+		t.Error("Error should be returned because of negative interval")
+	}
+
+	usage, err := GetCpuIdleUsage(t1, c1, t2, c2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if len(usage.CoreUsages) != 2 {
+		t.Fatalf("len(CoreUsages) = %d, want 2", len(usage.CoreUsages))
+	}
+	core0 := usage.CoreUsages[0]
+	if !floatEqWithin(core0.Idle, 50.0, 0.001) ||
+		!floatEqWithin(core0.Residency[1], 25.0, 0.001) ||
+		!floatEqWithin(core0.DeepestResidency(), 75.0, 0.001) ||
+		!floatEqWithin(core0.Usage[2], 10.0, 0.001) {
+		t.Errorf("core 0 = %+v", core0)
+	}
+	if !floatEqWithin(usage.All.Idle, 75.0, 0.001) ||
+		!floatEqWithin(usage.All.DeepestResidency(), 2750000.0/3000000.0*100.0, 0.001) {
+		t.Errorf("All = %+v", usage.All)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "all.residency") || !jsonHasKey([]byte(str), "states") {
+		t.Errorf("keys all.residency and states should be in JSON: %s", str)
+	}
+}
+
+func TestGetMemUsage(t *testing.T) {
+	_, err := GetMemUsage(nil)
+	if err == nil {
+		t.Error("Error should be returned because of nil MemStat")
+	}
+
+	mem := NewMemStat()
+	mem.MemTotal = 10000
+	mem.MemFree = 1000
+	mem.Buffers = 500
+	mem.Cached = 2500
+	mem.SReclaimable = 1000
+	mem.AnonPages = 4000
+	mem.SwapTotal = 2000
+	mem.SwapFree = 1500
+
+	// estimated from MemFree, Buffers, Cached and SReclaimable
+	musage, err := GetMemUsage(mem)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if musage.Available != 5000 || musage.Used != 5000 ||
+		!floatEqWithin(musage.AvailablePct, 50.0, 0.001) ||
+		musage.Anon != 4000 || musage.File != 3000 ||
+		!floatEqWithin(musage.ReclaimablePct, 40.0, 0.001) ||
+		!floatEqWithin(musage.SwapUsedPct, 25.0, 0.001) {
+		t.Errorf("estimated usage = %+v", musage)
+	}
+
+	mem.HasMemAvailable = true
+	mem.MemAvailable = 6000
+	mem.ActiveAnon = 2000
+	mem.InactiveAnon = 1000
+	mem.ActiveFile = 1500
+	mem.InactiveFile = 1500
+	mem.KReclaimable = 1200
+	musage, err = GetMemUsage(mem)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if musage.Used != 4000 || !floatEqWithin(musage.AvailablePct, 60.0, 0.001) ||
+		!floatEqWithin(musage.AnonPct, 30.0, 0.001) ||
+		!floatEqWithin(musage.FilePct, 30.0, 0.001) ||
+		!floatEqWithin(musage.ReclaimablePct, 42.0, 0.001) {
+		t.Errorf("usage = %+v", musage)
+	}
+
+	printer := projson.NewPrinter()
+	musage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "mem_available") || !jsonHasKey([]byte(str), "available_pct") {
+		t.Errorf("keys mem_available and available_pct should be in JSON: %s", str)
+	}
+	if jsonHasKey([]byte(str), "others") {
+		t.Errorf("key others should not be in JSON without other keys: %s", str)
+	}
+
+	mem.Others = map[string]int64{"DirectMap4k": 100, "DirectMap2M": 8000000}
+	musage, _ = GetMemUsage(mem)
+	printer = projson.NewPrinter()
+	musage.WriteJsonTo(printer)
+	str, _ = printer.String()
+	if !strings.Contains(str, `"others":{"DirectMap2M":8000000,"DirectMap4k":100}`) {
+		t.Errorf("others not found in JSON: %s", str)
+	}
+
+	mem.SwapTotal = 0
+	mem.SwapFree = 0
+	musage, _ = GetMemUsage(mem)
+	if musage.SwapUsedPct != 0.0 {
+		t.Errorf("SwapUsedPct = %v, want 0 without swap", musage.SwapUsedPct)
+	}
+}
+
+func TestGetNumaUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		panic(perr)
+	}
+	t2 := t1.Add(2 * time.Second)
+
+	_, err := GetNumaUsage(t1, nil, t2, NewNumaStat())
+	if err == nil {
+		t.Error("Error should be returned because of nil NumaStat")
+	}
+
+	n1 := NewNumaStat()
+	n1.Entries = append(n1.Entries,
+		&NumaNodeStat{NodeId: 0, NumaHit: 1000, NumaMiss: 0},
+		&NumaNodeStat{NodeId: 1, NumaHit: 1000, NumaMiss: 100})
+	n2 := NewNumaStat()
+	n2.Entries = append(n2.Entries,
+		&NumaNodeStat{NodeId: 0, MemTotal: 4096, MemUsed: 1024, NumaHit: 1180, NumaMiss: 20},
+		&NumaNodeStat{NodeId: 1, NumaHit: 1000, NumaMiss: 100})
+
+	_, err = GetNumaUsage(t2, n1, t1, n2)
+	if err == nil {
+		t.Error("Error should be returned because of negative interval")
+	}
+
+	usage, err := GetNumaUsage(t1, n1, t2, n2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if len(usage.Nodes) != 2 {
+		t.Fatalf("len(Nodes) = %d, want 2", len(usage.Nodes))
+	}
+	node0 := usage.Nodes[0]
+	if node0.MemUsed != 1024 || !floatEqWithin(node0.NumaHit, 90.0, 0.001) ||
+		!floatEqWithin(node0.NumaMiss, 10.0, 0.001) ||
+		!floatEqWithin(node0.MissRatio, 10.0, 0.001) {
+		t.Errorf("node 0 = %+v", node0)
+	}
+	if usage.Nodes[1].MissRatio != 0.0 {
+		t.Errorf("node 1 MissRatio = %v, want 0 without allocations", usage.Nodes[1].MissRatio)
+	}
+
+	cusage := &CpuUsage{NumCore: 3, CoreUsages: []*CpuCoreUsage{
+		{User: 50.0, Idle: 50.0},
+		{User: 20.0, Idle: 80.0},
+		{Sys: 10.0, Idle: 90.0},
+	}}
+	node_cpus := map[int][]int{0: {0, 1}, 1: {2, 3}}
+	node_usages, err := GetNodeCpuUsage(cusage, node_cpus)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if !floatEqWithin(node_usages[0].User, 70.0, 0.001) ||
+		!floatEqWithin(node_usages[0].Idle, 130.0, 0.001) {
+		t.Errorf("node 0 CPU = %+v", node_usages[0])
+	}
+	if !floatEqWithin(node_usages[1].Sys, 10.0, 0.001) ||
+		!floatEqWithin(node_usages[1].Idle, 90.0, 0.001) {
+		t.Errorf("node 1 CPU = %+v, want cpu3 ignored", node_usages[1])
+	}
+
+	usage.SetCpuUsage(cusage, node_cpus)
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "nodes") {
+		t.Errorf("key nodes should be in JSON: %s", str)
+	}
+}
+
+func TestGetFsUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		panic(perr)
+	}
+	t2 := t1.Add(10 * time.Second)
+	const mb = 1024 * 1024
+
+	_, err := GetFsUsage(t1, nil, t2, NewFsStat())
+	if err == nil {
+		t.Error("Error should be returned because of nil FsStat")
+	}
+
+	f1 := NewFsStat()
+	f1.Entries = append(f1.Entries,
+		&FsStatEntry{MountPoint: "/data", TotalBytes: 1000 * mb, FreeBytes: 600 * mb, AvailBytes: 550 * mb,
+			TotalInodes: 1000, FreeInodes: 900},
+		&FsStatEntry{MountPoint: "/", TotalBytes: 100 * mb, FreeBytes: 50 * mb, AvailBytes: 50 * mb},
+		&FsStatEntry{MountPoint: "/gone", TotalBytes: 100 * mb})
+	f2 := NewFsStat()
+	f2.Entries = append(f2.Entries,
+		&FsStatEntry{MountPoint: "/data", Device: "/dev/vdb", FsType: "xfs",
+			TotalBytes: 1000 * mb, FreeBytes: 500 * mb, AvailBytes: 450 * mb,
+			TotalInodes: 1000, FreeInodes: 750},
+		&FsStatEntry{MountPoint: "/", TotalBytes: 100 * mb, FreeBytes: 60 * mb, AvailBytes: 60 * mb})
+
+	_, err = GetFsUsage(t2, f1, t1, f2)
+	if err == nil {
+		t.Error("Error should be returned because of negative interval")
+	}
+
+	usage, err := GetFsUsage(t1, f1, t2, f2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if len(usage.Mounts) != 2 || usage.Mounts[0].MountPoint != "/" {
+		t.Fatalf("Mounts = %+v, want / and /data", usage.Mounts)
+	}
+
+	root := usage.Mounts[0]
+	if !floatEqWithin(root.Growth, -1.0*mb, 0.001) || root.FullIn != 0.0 {
+		t.Errorf("/ = %+v, want shrinking without FullIn", root)
+	}
+
+	data := usage.Mounts[1]
+	if data.Device != "/dev/vdb" || data.UsedBytes != 500*mb ||
+		!floatEqWithin(data.UsedPct, 500.0/950.0*100.0, 0.001) ||
+		data.UsedInodes != 250 || !floatEqWithin(data.UsedInodesPct, 25.0, 0.001) {
+		t.Errorf("/data = %+v", data)
+	}
+	if !floatEqWithin(data.Growth, 10.0*mb, 0.001) || !floatEqWithin(data.FullIn, 45.0, 0.001) {
+		t.Errorf("/data Growth = %v, FullIn = %v, want 10 MB/s and 45 sec", data.Growth, data.FullIn)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "mounts") {
+		t.Errorf("key mounts should be in JSON: %s", str)
+	}
+	if !strings.Contains(str, `"full_in":45`) {
+		t.Errorf("full_in of /data should be in JSON: %s", str)
+	}
+}
+
+func TestGetNfsUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		panic(perr)
+	}
+	t2 := t1.Add(2 * time.Second)
+
+	_, err := GetNfsUsage(t1, nil, t2, NewNfsStat())
+	if err == nil {
+		t.Error("Error should be returned because of nil NfsStat")
+	}
+
+	n1 := NewNfsStat()
+	n1.Entries = append(n1.Entries, &NfsMountStatEntry{
+		MountPoint: "/mnt/data", ReadBytes: 1000, WriteBytes: 0,
+		Ops: []*NfsOpStat{
+			{Name: "READ", Ops: 100, Trans: 100, Rtt: 500, Execute: 600},
+			{Name: "GETATTR", Ops: 50, Trans: 50, Rtt: 50, Execute: 50},
+		}})
+	n2 := NewNfsStat()
+	n2.Entries = append(n2.Entries, &NfsMountStatEntry{
+		MountPoint: "/mnt/data", Device: "srv:/data", FsType: "nfs4",
+		ReadBytes: 1000 + 4*1024*1024, WriteBytes: 2 * 1024 * 1024,
+		Ops: []*NfsOpStat{
+			{Name: "READ", Ops: 300, Trans: 302, Timeouts: 2, Rtt: 1500, Execute: 1800},
+			{Name: "WRITE", Ops: 20, Trans: 20, Rtt: 200, Execute: 220},
+			{Name: "GETATTR", Ops: 50, Trans: 50, Rtt: 50, Execute: 50},
+		}})
+
+	_, err = GetNfsUsage(t2, n1, t1, n2)
+	if err == nil {
+		t.Error("Error should be returned because of negative interval")
+	}
+
+	usage, err := GetNfsUsage(t1, n1, t2, n2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if len(usage.Mounts) != 1 {
+		t.Fatalf("len(Mounts) = %d, want 1", len(usage.Mounts))
+	}
+	m := usage.Mounts[0]
+	if !floatEqWithin(m.RdBytesPerSec, 2*1024*1024, 0.001) ||
+		!floatEqWithin(m.WrBytesPerSec, 1024*1024, 0.001) {
+		t.Errorf("throughput = %v/%v", m.RdBytesPerSec, m.WrBytesPerSec)
+	}
+	if !floatEqWithin(m.RdIops, 100.0, 0.001) || !floatEqWithin(m.WrIops, 10.0, 0.001) ||
+		!floatEqWithin(m.Iops, 110.0, 0.001) {
+		t.Errorf("IOPS = %v/%v/%v", m.RdIops, m.WrIops, m.Iops)
+	}
+	// WRITE was not issued in the first sample
+	if !floatEqWithin(m.RdRtt, 5.0, 0.001) || !floatEqWithin(m.RdLatency, 6.0, 0.001) ||
+		!floatEqWithin(m.WrRtt, 10.0, 0.001) || !floatEqWithin(m.WrLatency, 11.0, 0.001) {
+		t.Errorf("latencies = %+v", m)
+	}
+	if !floatEqWithin(m.Rtt, 1200.0/220.0, 0.001) || !floatEqWithin(m.Retrans, 1.0, 0.001) ||
+		!floatEqWithin(m.Timeouts, 1.0, 0.001) {
+		t.Errorf("Rtt = %v, Retrans = %v, Timeouts = %v", m.Rtt, m.Retrans, m.Timeouts)
+	}
+	if len(m.Ops) != 2 || m.Ops[0].Name != "READ" || m.Ops[1].Name != "WRITE" {
+		t.Errorf("Ops = %+v, want READ and WRITE without idle GETATTR", m.Ops)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "mounts") {
+		t.Errorf("key mounts should be in JSON: %s", str)
+	}
+}
+
+func TestGetThermalUsage(t *testing.T) {
+	sensors := []LinuxSensor{{Name: "coretemp:Package id 0"}, {Name: "nvme:Composite"}}
+
+	_, err := GetThermalUsage(sensors, nil, &ThermalStat{[]int64{0, 0}})
+	if err == nil {
+		t.Error("Error should be returned because of nil ThermalStat")
+	}
+	_, err = GetThermalUsage(sensors, &ThermalStat{[]int64{0}}, &ThermalStat{[]int64{0, 0}})
+	if err == nil {
+		t.Error("Error should be returned because of sensor count mismatch")
+	}
+
+	usage, err := GetThermalUsage(sensors,
+		&ThermalStat{[]int64{50000, 0}}, &ThermalStat{[]int64{70000, 0}})
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	usage.Add(&ThermalStat{[]int64{60000, 0}})
+	pkg := usage.Sensors[0]
+	if pkg.Name != "coretemp:Package id 0" || pkg.NumSamples != 3 ||
+		!floatEqWithin(pkg.Temp, 60.0, 0.001) || !floatEqWithin(pkg.Avg, 60.0, 0.001) ||
+		!floatEqWithin(pkg.Min, 50.0, 0.001) || !floatEqWithin(pkg.Max, 70.0, 0.001) {
+		t.Errorf("Sensors[0] = %+v", pkg)
+	}
+	if usage.Sensors[1].NumSamples != 0 {
+		t.Errorf("Sensors[1] = %+v, want no samples", usage.Sensors[1])
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "sensors") || strings.Contains(str, "nvme") {
+		t.Errorf("JSON should have sensors without unavailable ones: %s", str)
+	}
+}
+
+func TestGetEnergyUsage(t *testing.T) {
+	domains := []LinuxPowerDomain{
+		{Name: "package-0", Zone: "package-0", MaxEnergyRange: 10000000},
+		{Name: "package-0/core", Zone: "core", Parent: "package-0", MaxEnergyRange: 10000000},
+		{Name: "package-0/dram", Zone: "dram", Parent: "package-0", MaxEnergyRange: 10000000},
+		{Name: "psys", Zone: "psys"},
+	}
+	t0, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	t1 := t0.Add(2 * time.Second)
+	t2 := t1.Add(2 * time.Second)
+
+	_, err := GetEnergyUsage(domains, t0, nil, t1, &EnergyStat{[]int64{0, 0, 0, 0}})
+	if err == nil {
+		t.Error("Error should be returned because of nil EnergyStat")
+	}
+	_, err = GetEnergyUsage(domains, t0, &EnergyStat{[]int64{0}}, t1, &EnergyStat{[]int64{0, 0, 0, 0}})
+	if err == nil {
+		t.Error("Error should be returned because of domain count mismatch")
+	}
+	_, err = GetEnergyUsage(domains, t1, &EnergyStat{[]int64{0, 0, 0, 0}}, t0, &EnergyStat{[]int64{0, 0, 0, 0}})
+	if err == nil {
+		t.Error("Error should be returned because of negative interval")
+	}
+
+	usage, err := GetEnergyUsage(domains,
+		t0, &EnergyStat{[]int64{9000000, 1000000, 500000, 100}},
+		t1, &EnergyStat{[]int64{9800000, 1300000, 520000, 50}})
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	// package-0 wraps around at 10 J
+	err = usage.Add(t1, &EnergyStat{[]int64{9800000, 1300000, 520000, 50}},
+		t2, &EnergyStat{[]int64{600000, 1600000, 540000, -1}})
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+
+	if usage.Interval != 4*time.Second {
+		t.Errorf("Interval = %v, want 4s", usage.Interval)
+	}
+	pkg := usage.Domains[0]
+	if !floatEqWithin(pkg.Joules, 1.6, 0.000001) || !floatEqWithin(pkg.Watts, 0.4, 0.000001) {
+		t.Errorf("Domains[0] = %+v", pkg)
+	}
+	if !floatEqWithin(usage.Domains[1].Joules, 0.6, 0.000001) {
+		t.Errorf("Domains[1] = %+v", usage.Domains[1])
+	}
+	// psys without max_energy_range_uj cannot recover from a decrease
+	if usage.Domains[3].Joules != 0.0 || usage.Domains[3].NumIntervals != 0 {
+		t.Errorf("Domains[3] = %+v, want no intervals", usage.Domains[3])
+	}
+	// package + dram, excluding core (in package) and psys (everything)
+	if usage.Total == nil || !floatEqWithin(usage.Total.Joules, 1.64, 0.000001) ||
+		!floatEqWithin(usage.Total.Watts, 0.41, 0.000001) {
+		t.Errorf("Total = %+v", usage.Total)
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "domains") || !jsonHasKey([]byte(str), "total") ||
+		strings.Contains(str, "psys") {
+		t.Errorf("JSON should have domains and total without unavailable ones: %s", str)
+	}
+
+	usage = NewEnergyUsage([]LinuxPowerDomain{{Name: "psys", Zone: "psys"}})
+	if usage.Total == nil || usage.total_idxs[0] != 0 {
+		t.Errorf("psys alone should be counted in Total: %+v", usage)
+	}
+}
+
+func TestGetCustomUsage(t *testing.T) {
+	metrics := []LinuxCustomMetric{{Name: "app"}, {Name: "depth"}}
+	rates := []string{"app.req*"}
+	t0, _ := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	t1 := t0.Add(2 * time.Second)
+	t2 := t1.Add(2 * time.Second)
+
+	_, err := GetCustomUsage(metrics, rates, nil, nil)
+	if err == nil {
+		t.Error("Error should be returned because of nil CustomStat")
+	}
+	_, err = GetCustomUsage(metrics, rates, nil, NewCustomStat(1))
+	if err == nil {
+		t.Error("Error should be returned because of metric count mismatch")
+	}
+
+	c0 := &CustomStat{[]CustomMetricSample{
+		{t0, map[string]float64{"requests": 100, "hit_ratio": 0.5}},
+		{},
+	}}
+	c1 := &CustomStat{[]CustomMetricSample{
+		{t1, map[string]float64{"requests": 300, "hit_ratio": 0.7}},
+		{t1, map[string]float64{"": 4}},
+	}}
+	// app is not reported again, and the counter of depth is reset
+	c2 := &CustomStat{[]CustomMetricSample{
+		c1.Samples[0],
+		{t2, map[string]float64{"": 3}},
+	}}
+
+	usage, err := GetCustomUsage(metrics, rates, nil, c0)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if err = usage.Add(c0, c1); err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if err = usage.Add(c1, c2); err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+
+	names := []string{}
+	for _, series := range usage.Series {
+		names = append(names, series.Name)
+	}
+	if fmt.Sprint(names) != "[app.hit_ratio app.requests depth]" {
+		t.Fatalf("Series = %v", names)
+	}
+	hit_ratio, requests, depth := usage.Series[0], usage.Series[1], usage.Series[2]
+	if hit_ratio.Counter || hit_ratio.NumSamples != 2 || !floatEqWithin(hit_ratio.Avg, 0.6, 0.000001) ||
+		hit_ratio.Min != 0.5 || hit_ratio.Max != 0.7 || hit_ratio.Value != 0.7 || !hit_ratio.Time.Equal(t1) {
+		t.Errorf("app.hit_ratio = %+v", hit_ratio)
+	}
+	if !requests.Counter || requests.NumSamples != 1 || requests.Total != 200 ||
+		!floatEqWithin(requests.Rate, 100.0, 0.000001) || requests.Value != 300 {
+		t.Errorf("app.requests = %+v", requests)
+	}
+	if depth.Counter || depth.NumSamples != 2 || depth.Avg != 3.5 || depth.Metric != "depth" {
+		t.Errorf("depth = %+v", depth)
+	}
+
+	usage, err = GetCustomUsage(metrics, []string{"depth"}, c1, c2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	// a counter smaller than the previous one has been reset
+	depth = usage.Series[len(usage.Series)-1]
+	if !depth.Counter || depth.Total != 3 || !floatEqWithin(depth.Rate, 1.5, 0.000001) {
+		t.Errorf("depth = %+v", depth)
+	}
+	if usage.Series[0].NumSamples != 0 {
+		t.Errorf("app is not reported between c1 and c2: %+v", usage.Series[0])
+	}
+
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "series") || !strings.Contains(str, `"rate":1.500`) {
+		t.Errorf("JSON should have series and the rate of depth: %s", str)
+	}
+}
+
+func TestGetCpuGroupUsage(t *testing.T) {
+	cusage := &CpuUsage{NumCore: 4, CoreUsages: []*CpuCoreUsage{
+		{User: 100.0},
+		{Idle: 100.0},
+		{User: 50.0, Idle: 50.0},
+		{Sys: 20.0, Idle: 80.0},
+	}}
+	// 2 sockets x 1 core x 2 threads; socket 1 is on node 0 as well
+	topology := []LinuxCpuTopology{
+		{0, 0, 0, []int{0, 2}},
+		{1, 0, 0, []int{1, 3}},
+		{0, 0, 0, []int{0, 2}},
+		{1, 0, 0, []int{1, 3}},
+		{-1, -1, -1, nil}, // offline CPU
+	}
+
+	_, err := GetCpuGroupUsage(cusage, topology, "thread")
+	if err == nil {
+		t.Error("Error should be returned because of unknown group")
+	}
+	_, err = GetCpuGroupUsage(cusage, nil, "socket")
+	if err == nil {
+		t.Error("Error should be returned because of nil topology")
+	}
+
+	gusages, err := GetCpuGroupUsage(cusage, topology, "socket")
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if len(gusages) != 2 || gusages[0].Name != "socket0" || gusages[1].Name != "socket1" {
+		t.Fatalf("groups = %+v", gusages)
+	}
+	if fmt.Sprint(gusages[0].Cpus) != "[0 2]" ||
+		!floatEqWithin(gusages[0].Usage.User, 150.0, 0.001) ||
+		!floatEqWithin(gusages[0].Usage.Idle, 50.0, 0.001) {
+		t.Errorf("socket0 = %+v %+v", gusages[0], gusages[0].Usage)
+	}
+	if !floatEqWithin(gusages[1].Usage.Sys, 20.0, 0.001) ||
+		!floatEqWithin(gusages[1].Usage.Idle, 180.0, 0.001) {
+		t.Errorf("socket1 = %+v", gusages[1].Usage)
+	}
+
+	gusages, err = GetCpuGroupUsage(cusage, topology, "node")
+	if err != nil || len(gusages) != 1 || len(gusages[0].Cpus) != 4 {
+		t.Errorf("node groups = %+v, err = %v", gusages, err)
+	}
+
+	gusages, err = GetCpuGroupUsage(cusage, topology, "core")
+	if err != nil || len(gusages) != 2 || gusages[1].Name != "socket1/core0" {
+		t.Errorf("core groups = %+v, err = %v", gusages, err)
+	}
+
+	printer := projson.NewPrinter()
+	gusages[0].WriteJsonTo(printer)
+	str, err := printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "usage.usr") {
+		t.Errorf("key usage.usr should be in JSON: %s", str)
+	}
+
+	// CPUs 2 and 3 have gone since the topology was captured
+	cusage.NumCore = 2
+	cusage.CoreUsages = cusage.CoreUsages[:2]
+	gusages, err = GetCpuGroupUsage(cusage, topology, "socket")
+	if err != nil || len(gusages) != 2 {
+		t.Fatalf("groups = %+v, err = %v", gusages, err)
+	}
+	if fmt.Sprint(gusages[0].Cpus) != "[0]" || fmt.Sprint(gusages[1].Cpus) != "[1]" ||
+		!floatEqWithin(gusages[1].Usage.Idle, 100.0, 0.001) {
+		t.Errorf("groups = %+v %+v", gusages[0], gusages[1])
+	}
+}
+
+func TestGetProcUsage(t *testing.T) {
+	t1, perr := time.Parse(time.RFC3339, "2012-01-23T01:23:45+09:00")
+	if perr != nil {
+		t.Fatal("Timestamp parse error")
+	}
+
+	p1 := NewProcStat()
+	p2 := NewProcStat()
+
+	_, err := GetProcUsage(t1, p1, t1, p2)
+	if err == nil {
+		t.Error("Error should be returned because timestamps are the same")
+	}
+	_, err = GetProcUsage(t1, nil, t1.Add(time.Second), p2)
+	if err == nil {
+		t.Error("Error should be returned for nil ProcStat")
+	}
+
+	p1.ContextSwitch = 1000
+	p1.Fork = 10
+	p1.Interrupt = 5000
+	p2.ContextSwitch = 1000 + 600
+	p2.Fork = 10 + 4
+	p2.Interrupt = 5000 + 2000
+	p2.ProcsRunning = 3
+	p2.ProcsBlocked = 1
+
+	t2 := t1.Add(time.Second * 2)
+	usage, err := GetProcUsage(t1, p1, t2, p2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if usage.HasProcsRunning {
+		t.Error("HasProcsRunning should be false for logs without procs_running")
+	}
+	printer := projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, _ := printer.String()
+	if jsonHasKey([]byte(str), "intrps") || jsonHasKey([]byte(str), "procs_running") {
+		t.Errorf("intrps and procs_running should not be in JSON without HasProcsRunning: %s", str)
+	}
+
+	p1.HasProcsRunning = true
+	p2.HasProcsRunning = true
+	usage, err = GetProcUsage(t1, p1, t2, p2)
+	if err != nil {
+		t.Fatalf("Error should not be returned: %v", err)
+	}
+	if !floatEqWithin(usage.ContextSwitch, 300.0, 0.001) {
+		t.Errorf("ContextSwitch = %v, want %v", usage.ContextSwitch, 300.0)
+	}
+	if !floatEqWithin(usage.Fork, 2.0, 0.001) {
+		t.Errorf("Fork = %v, want %v", usage.Fork, 2.0)
+	}
+	if !floatEqWithin(usage.Interrupt, 1000.0, 0.001) {
+		t.Errorf("Interrupt = %v, want %v", usage.Interrupt, 1000.0)
+	}
+	if usage.ProcsRunning != 3 || usage.ProcsBlocked != 1 {
+		t.Errorf("ProcsRunning = %v, ProcsBlocked = %v, want 3, 1", usage.ProcsRunning, usage.ProcsBlocked)
+	}
+
+	printer = projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, err = printer.String()
+	if err != nil {
+		t.Fatal("failed printing JSON")
+	}
+	if !isValidJson([]byte(str)) {
+		t.Errorf("invalid json: %s", str)
+	}
+	if !jsonHasKey([]byte(str), "intrps") {
+		t.Errorf("key intrps not found in JSON: %s", str)
+	}
+	if jsonHasKey([]byte(str), "loadavg1") {
+		t.Errorf("key loadavg1 should not be in JSON without LoadAvg: %s", str)
+	}
+
+	p2.LoadAvg = &LoadAvgStat{Load1: 1.5, Load5: 1.0, Load15: 0.5, NrRunning: 2, NrThreads: 100}
+	usage, _ = GetProcUsage(t1, p1, t2, p2)
+	printer = projson.NewPrinter()
+	usage.WriteJsonTo(printer)
+	str, _ = printer.String()
+	if !jsonHasKey([]byte(str), "loadavg1") {
+		t.Errorf("key loadavg1 not found in JSON: %s", str)
+	}
 }